@@ -13,7 +13,6 @@ import (
 	"sync"
 
 	"github.com/newrelic/newrelic-lambda-extension/config"
-	"github.com/newrelic/newrelic-lambda-extension/util"
 )
 
 var (
@@ -242,13 +241,13 @@ func CollectorRequest(cmd RpmCmd, cs *rpmControls) *rpmResponse {
 func collectorRequestInternal(url string, cmd RpmCmd, cs *rpmControls) *rpmResponse {
 	compressed, err := compress(cmd.Data, cs.GzipWriterPool)
 	if err != nil {
-		util.Debugf("Error compressing data: %v", err)
+		logger.Debugf("Error compressing data: %v", err)
 		return newRPMResponse(err)
 	}
 
 	req, err := http.NewRequest("POST", url, compressed)
 	if err != nil {
-		util.Debugf("Error creating request: %v", err)
+		logger.Debugf("Error creating request: %v", err)
 		return newRPMResponse(err)
 	}
 
@@ -264,7 +263,7 @@ func collectorRequestInternal(url string, cmd RpmCmd, cs *rpmControls) *rpmRespo
 
 	resp, err := cs.Client.Do(req)
 	if err != nil {
-		util.Debugf("Error connecting: %v", err)
+		logger.Debugf("Error connecting: %v", err)
 		return newRPMResponse(err)
 	}
 
@@ -218,7 +218,7 @@ func getAgentVersion(runtime string) (string, string, error) {
 func Connect(cmd RpmCmd, cs *rpmControls) (string, string, error) {
 	runtimeLanguage := checkRuntime()
 	NRAgentLanguage, NRAgentVersion, err := getAgentVersion(string(runtimeLanguage))
-	util.Logf("Connect: Detected runtime %s with agent language %s and version %s", runtimeLanguage, NRAgentLanguage, NRAgentVersion)
+	logger.Logf("Connect: Detected runtime %s with agent language %s and version %s", runtimeLanguage, NRAgentLanguage, NRAgentVersion)
 	if err != nil {
 		NRAgentLanguage = "go"
 		NRAgentVersion = "3.39.0"
@@ -243,7 +243,7 @@ func Connect(cmd RpmCmd, cs *rpmControls) (string, string, error) {
 		},
 	}
 	marshaledData, err := json.Marshal(data)
-	util.Debugf("APM Connect Call for runtime %s: %s\n", string(runtimeLanguage), string(marshaledData))
+	logger.Debugf("APM Connect Call for runtime %s: %s\n", string(runtimeLanguage), string(marshaledData))
 	if err != nil {
 		util.Fatal(fmt.Errorf("Extension shutdown: failed to perform APM connect: %w", err))
 	}
@@ -289,13 +289,32 @@ func SendErrorEvent(cmd RpmCmd, cs *rpmControls, errorData []interface{}, runId
 		cmd.Data = finalData
 		cmd.RunID = runId
 		rpmResponse := CollectorRequest(cmd, cs)
-		util.Debugf("Status Code %v telemetry: %d\n", CmdErrorEvents, rpmResponse.GetStatusCode())
+		logger.Debugf("Status Code %v telemetry: %d\n", CmdErrorEvents, rpmResponse.GetStatusCode())
 		endTimeMetric := time.Now()
 		durationMetric := endTimeMetric.Sub(startTimeMetric)
-		util.Debugf("Send %v duration: %s\n", CmdErrorEvents, durationMetric)
+		logger.Debugf("Send %v duration: %s\n", CmdErrorEvents, durationMetric)
 	}
 }
 
+// SendSpanEvents sends spans, such as the platform's phases of invocations, as span events
+func SendSpanEvents(cmd RpmCmd, cs *rpmControls, spans []telemetry.Span, runId string, LambdaFunctionName string, LambdaFunctionVersion string) {
+	if len(spans) == 0 {
+		return
+	}
+	startTimeMetric := time.Now()
+	finalData, err := json.Marshal(MapToSpanEventData(spans, runId, LambdaFunctionName, LambdaFunctionVersion))
+	if err != nil {
+		logger.Debugf("Error encoding span events: %v", err)
+		return
+	}
+	cmd.Name = CmdSpanEvents
+	cmd.Data = finalData
+	cmd.RunID = runId
+	rpmResponse := CollectorRequest(cmd, cs)
+	logger.Debugf("Status Code %v telemetry: %d\n", CmdSpanEvents, rpmResponse.GetStatusCode())
+	logger.Debugf("Send %v duration: %s\n", CmdSpanEvents, time.Since(startTimeMetric))
+}
+
 // Function to send data based on the type specified
 func sendAPMTelemetryInternal(data []interface{}, dataType string, wg *sync.WaitGroup, runID string, cmd RpmCmd, cs *rpmControls) rpmResponse {
 	if len(data) == 0 {
@@ -315,7 +334,7 @@ func sendAPMTelemetryInternal(data []interface{}, dataType string, wg *sync.Wait
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
 	if err := enc.Encode(updatedData); err != nil {
-		util.Logf("Error encoding data for %s: %v", dataType, err)
+		logger.Warnf("Error encoding data for %s: %v", dataType, err)
 		return *newRPMResponse(err)
 	}
 
@@ -331,20 +350,20 @@ func sendAPMTelemetryInternal(data []interface{}, dataType string, wg *sync.Wait
 	}
 
 	statusCode := rpmResponse.GetStatusCode()
-	util.Debugf("Status Code for %s telemetry: %d", dataType, statusCode)
+	logger.Debugf("Status Code for %s telemetry: %d", dataType, statusCode)
 	if err := rpmResponse.GetError(); err != nil {
-		util.Logf("Error in telemetry response for %s: %v", dataType, err)
+		logger.Warnf("Error in telemetry response for %s: %v", dataType, err)
 		return *newRPMResponse(err)
 	}
 
 	durationMetric := time.Since(startTimeMetric)
-	util.Debugf("Send %v duration: %s\n", dataType, durationMetric)
+	logger.Debugf("Send %v duration: %s\n", dataType, durationMetric)
 
 	return *newRPMResponse(nil)
 }
 
 func SendAPMTelemetry(ctx context.Context, payload []byte, conf *config.Configuration, cmd RpmCmd, cs *rpmControls, runId string) (error, int) {
-	util.Debugf("Send APM Telemetry: sending telemetry to New Relic...")
+	logger.Debugf("Send APM Telemetry: sending telemetry to New Relic...")
 
 	// Decode and decompress payload
 	datav1, datav2, pv, err := GetServerlessData(payload)
@@ -383,7 +402,7 @@ func extractTelemetryData(datav1 LambdaRawData, datav2 LambdaData, pv int) (stru
 	switch pv {
 	case 2:
 		if reflect.DeepEqual(datav2, LambdaData{}) {
-			util.Debugf("SendTelemetry: no telemetry data found in payload")
+			logger.Debugf("SendTelemetry: no telemetry data found in payload")
 			return telemetryData, nil
 		}
 		telemetryData = struct {
@@ -405,7 +424,7 @@ func extractTelemetryData(datav1 LambdaRawData, datav2 LambdaData, pv int) (stru
 		}
 	default: // Assuming default case is for v1 data
 		if reflect.DeepEqual(datav1, LambdaRawData{}) {
-			util.Debugf("SendTelemetry: no telemetry data found in payload")
+			logger.Debugf("SendTelemetry: no telemetry data found in payload")
 			return telemetryData, nil
 		}
 		telemetryData = struct {
@@ -478,7 +497,7 @@ func sendTelemetryData(ctx context.Context, data struct {
 
 func sendSingleTelemetry(task telemetryType, wg *sync.WaitGroup, errChan chan<- error, runID string, cmd RpmCmd, cs *rpmControls) {
 	if len(task.Data) == 0 {
-		util.Debugf("No %s telemetry to send", task.DataType)
+		logger.Debugf("No %s telemetry to send", task.DataType)
 		return
 	}
 	wg.Add(1)
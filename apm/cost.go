@@ -0,0 +1,143 @@
+package apm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+// Lambda's instruction set architectures
+const (
+	ArchitectureX86 = "x86_64"
+	ArchitectureARM = "arm64"
+)
+
+// DefaultPricingRegion is the pricing table entry for regions without their own
+const DefaultPricingRegion = "default"
+
+// Price is the price of Lambda compute, in USD, per GB-second and per request
+type Price struct {
+	GBSecond float64 `json:"gbSecond"`
+	Request  float64 `json:"request"`
+}
+
+// PricingTable holds prices by region, then architecture
+type PricingTable map[string]map[string]Price
+
+// DefaultPricing is Lambda's on-demand price for the first tier of monthly usage. Most regions
+// share the default price, which is also used for the regions missing here. Some of those are
+// priced higher, such as newer regions and GovCloud, and the China regions are priced in CNY, so
+// their estimates are off unless a pricing table has their prices.
+var DefaultPricing = PricingTable{
+	DefaultPricingRegion: {
+		ArchitectureX86: {GBSecond: 0.0000166667, Request: 0.0000002},
+		ArchitectureARM: {GBSecond: 0.0000133334, Request: 0.0000002},
+	},
+	"af-south-1": {
+		ArchitectureX86: {GBSecond: 0.0000221, Request: 0.00000027},
+		ArchitectureARM: {GBSecond: 0.0000177, Request: 0.00000027},
+	},
+	"ap-east-1": {
+		ArchitectureX86: {GBSecond: 0.00002292, Request: 0.00000028},
+		ArchitectureARM: {GBSecond: 0.0000183, Request: 0.00000028},
+	},
+}
+
+// ParsePricingTable parses a JSON pricing table, such as
+// {"default": {"arm64": {"gbSecond": 0.0000133334, "request": 0.0000002}}}
+func ParsePricingTable(str string) (PricingTable, error) {
+	var table PricingTable
+	if err := json.Unmarshal([]byte(str), &table); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// lookup finds the price of a region and architecture, or the table's default for the architecture
+func (t PricingTable) lookup(region string, architecture string) (Price, bool) {
+	if price, ok := t[region][architecture]; ok {
+		return price, true
+	}
+	price, ok := t[DefaultPricingRegion][architecture]
+	return price, ok
+}
+
+// Architecture is the architecture the extension runs on, which is the function's
+func Architecture() string {
+	if runtime.GOARCH == "arm64" {
+		return ArchitectureARM
+	}
+	return ArchitectureX86
+}
+
+// CostEstimator estimates the cost of invocations from their reports
+type CostEstimator struct {
+	Architecture string
+	Price        Price
+}
+
+// NewCostEstimator finds the price of invocations in the region and architecture. Prices in
+// table take precedence over DefaultPricing; table may be nil.
+func NewCostEstimator(table PricingTable, region string, architecture string) (*CostEstimator, error) {
+	price, ok := table.lookup(region, architecture)
+	if !ok {
+		price, ok = DefaultPricing.lookup(region, architecture)
+	}
+	if !ok {
+		return nil, fmt.Errorf("no price for %s in %s", architecture, region)
+	}
+	return &CostEstimator{Architecture: architecture, Price: price}, nil
+}
+
+// StartCostEstimator creates the CostEstimator of the function's region and architecture, with
+// the configured pricing table
+func StartCostEstimator(conf *config.Configuration) (*CostEstimator, error) {
+	var table PricingTable
+	if conf.CostPricing != "" {
+		var err error
+		if table, err = ParsePricingTable(conf.CostPricing); err != nil {
+			return nil, fmt.Errorf("error parsing pricing table: %v", err)
+		}
+	}
+	return NewCostEstimator(table, os.Getenv("AWS_REGION"), Architecture())
+}
+
+// Estimate returns the GB-seconds an invocation is billed for, and its estimated cost in USD
+func (e *CostEstimator) Estimate(lm *LambdaMetrics) (float64, float64) {
+	gbSeconds := lm.BilledDuration / 1000 * float64(lm.MemorySize) / 1024
+	return gbSeconds, gbSeconds*e.Price.GBSecond + e.Price.Request
+}
+
+// ConvertToCostMetrics converts the GB-seconds and estimated cost of an invocation to metrics,
+// like ConvertToMetrics. Reports without billing, such as faults, have none.
+func (lm *LambdaMetrics) ConvertToCostMetrics(prefix string, entityGuid string, functionName string, estimator *CostEstimator) []telemetry.Metric {
+	if lm.BilledDuration == 0 || lm.MemorySize == 0 {
+		return nil
+	}
+
+	timestamp := util.Timestamp()
+	attributes := lambdaMetricAttributes(lm.RequestID, entityGuid, functionName)
+	attributes["aws.lambda.architecture"] = estimator.Architecture
+	gbSeconds, cost := estimator.Estimate(lm)
+	return []telemetry.Metric{
+		{
+			Name:       prefix + ".gb_seconds",
+			Type:       "gauge",
+			Value:      gbSeconds,
+			Timestamp:  timestamp,
+			Attributes: attributes,
+		},
+		{
+			Name:       prefix + ".estimated_cost",
+			Type:       "gauge",
+			Value:      cost,
+			Timestamp:  timestamp,
+			Attributes: attributes,
+		},
+	}
+}
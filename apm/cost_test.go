@@ -0,0 +1,73 @@
+package apm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCostEstimator(t *testing.T) {
+	estimator, err := NewCostEstimator(nil, "us-east-1", ArchitectureARM)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPricing[DefaultPricingRegion][ArchitectureARM], estimator.Price)
+
+	estimator, err = NewCostEstimator(nil, "af-south-1", ArchitectureX86)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPricing["af-south-1"][ArchitectureX86], estimator.Price)
+
+	// The configured table takes precedence, then falls back to the defaults
+	table := PricingTable{"eu-west-1": {ArchitectureX86: {GBSecond: 0.00002, Request: 0.0000003}}}
+	estimator, err = NewCostEstimator(table, "eu-west-1", ArchitectureX86)
+	assert.NoError(t, err)
+	assert.Equal(t, Price{GBSecond: 0.00002, Request: 0.0000003}, estimator.Price)
+
+	estimator, err = NewCostEstimator(table, "eu-west-1", ArchitectureARM)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPricing[DefaultPricingRegion][ArchitectureARM], estimator.Price)
+
+	_, err = NewCostEstimator(table, "eu-west-1", "mips")
+	assert.Error(t, err)
+}
+
+func TestStartCostEstimator(t *testing.T) {
+	os.Setenv("AWS_REGION", "eu-west-1")
+	defer os.Unsetenv("AWS_REGION")
+
+	estimator, err := StartCostEstimator(&config.Configuration{
+		CostPricing: `{"default": {"x86_64": {"gbSecond": 0.00001}, "arm64": {"gbSecond": 0.00001}}}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Architecture(), estimator.Architecture)
+	assert.Equal(t, Price{GBSecond: 0.00001}, estimator.Price)
+
+	_, err = StartCostEstimator(&config.Configuration{CostPricing: "not json"})
+	assert.Error(t, err)
+}
+
+func TestCostEstimatorEstimate(t *testing.T) {
+	estimator := &CostEstimator{Architecture: ArchitectureX86, Price: Price{GBSecond: 0.00001, Request: 0.0000002}}
+	gbSeconds, cost := estimator.Estimate(&LambdaMetrics{BilledDuration: 2000, MemorySize: 512})
+	assert.Equal(t, 1.0, gbSeconds)
+	assert.InDelta(t, 0.0000102, cost, 1e-12)
+}
+
+func TestConvertToCostMetrics(t *testing.T) {
+	estimator := &CostEstimator{Architecture: ArchitectureARM, Price: Price{GBSecond: 0.00001}}
+	lm := &LambdaMetrics{RequestID: "request-id", BilledDuration: 1000, MemorySize: 1024}
+
+	metrics := lm.ConvertToCostMetrics("apm.lambda.transaction", "entity-guid", "function-name", estimator)
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, "apm.lambda.transaction.gb_seconds", metrics[0].Name)
+	assert.Equal(t, 1.0, metrics[0].Value)
+	assert.Equal(t, "apm.lambda.transaction.estimated_cost", metrics[1].Name)
+	assert.Equal(t, 0.00001, metrics[1].Value)
+	assert.Equal(t, "entity-guid", metrics[1].Attributes["entity.guid"])
+	assert.Equal(t, "request-id", metrics[1].Attributes["aws.requestId"])
+	assert.Equal(t, ArchitectureARM, metrics[1].Attributes["aws.lambda.architecture"])
+
+	// Faults aren't billed
+	fault := &LambdaMetrics{RequestID: "request-id", Error: "error"}
+	assert.Empty(t, fault.ConvertToCostMetrics("apm.lambda.transaction", "entity-guid", "function-name", estimator))
+}
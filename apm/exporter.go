@@ -0,0 +1,77 @@
+package apm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+)
+
+// Exporter is the New Relic exporter of APM Lambda mode. Agent payloads, platform errors and spans
+// go to the APM collector through the app; logs, metrics and events are sent by the telemetry
+// client, linked to the APM entity.
+type Exporter struct {
+	client *telemetry.Client
+	app    *InternalAPMApp
+	// entityGUID returns the APM entity's GUID, once the app has connected
+	entityGUID func() string
+}
+
+// NewExporter creates the APM exporter for an app
+func NewExporter(client *telemetry.Client, app *InternalAPMApp, entityGUID func() string) *Exporter {
+	return &Exporter{
+		client:     client,
+		app:        app,
+		entityGUID: entityGUID,
+	}
+}
+
+// ExportAgentPayloads sends agent payloads as APM harvests, and platform errors as error events
+func (e *Exporter) ExportAgentPayloads(ctx context.Context, invokedFunctionARN string, harvested []*telemetry.Invocation) error {
+	for _, inv := range harvested {
+		for _, payload := range inv.AgentTelemetry() {
+			e.app.DataChan <- payload
+		}
+		for _, platformError := range inv.Errors {
+			e.app.ErrorEventChan <- e.errorData(platformError)
+		}
+	}
+	return nil
+}
+
+// errorData is a platform error in the form MapToErrorEventData expects
+func (e *Exporter) errorData(platformError telemetry.PlatformError) []interface{} {
+	return []interface{}{
+		platformError.Type,
+		fmt.Sprintf("%f", platformError.Duration.Seconds()),
+		platformError.RequestID,
+		platformError.Message,
+		e.app.apmConfig.LambdaFunctionName,
+		e.app.apmConfig.LambdaAccountId,
+		e.app.apmConfig.LambdaFunctionVersion,
+	}
+}
+
+// ExportLogs sends logs to the Log API, linked to the APM entity
+func (e *Exporter) ExportLogs(ctx context.Context, invokedFunctionARN string, lines []logserver.LogLine) error {
+	return e.client.SendFunctionLogs(ctx, invokedFunctionARN, lines, e.entityGUID())
+}
+
+// ExportMetrics sends metrics to the Metric API
+func (e *Exporter) ExportMetrics(ctx context.Context, invokedFunctionARN string, metrics []telemetry.Metric) error {
+	return SendMetrics(ctx, e.client, invokedFunctionARN, metrics)
+}
+
+// ExportEvents sends events to the Event API
+func (e *Exporter) ExportEvents(ctx context.Context, invokedFunctionARN string, events []telemetry.CustomEvent) error {
+	return e.client.SendCustomEvents(ctx, invokedFunctionARN, events)
+}
+
+// ExportSpans sends spans to the APM collector as span events
+func (e *Exporter) ExportSpans(ctx context.Context, invokedFunctionARN string, spans []telemetry.Span) error {
+	if len(spans) > 0 {
+		e.app.SpanEventChan <- spans
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package apm
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+)
+
+func TestExporter(t *testing.T) {
+	app := &InternalAPMApp{
+		apmConfig:      apmConfig{LambdaFunctionName: "my-function", LambdaAccountId: "123456789012", LambdaFunctionVersion: "$LATEST"},
+		DataChan:       make(chan []byte, 5),
+		ErrorEventChan: make(chan []interface{}, 5),
+		SpanEventChan:  make(chan []telemetry.Span, 5),
+	}
+
+	var logPayload string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		logPayload = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	client := telemetry.NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &telemetry.Batch{}, false, time.Second)
+	exporter := NewExporter(client, app, func() string { return "entity-guid" })
+	ctx := context.Background()
+	arn := "arn:aws:lambda:us-east-1:123456789012:function:my-function"
+
+	inv := telemetry.AgentPayloadInvocation("request-1", time.Now(), []byte("agent payload"))
+	inv.Errors = append(inv.Errors, telemetry.PlatformError{
+		RequestID: "request-1",
+		Type:      telemetry.PlatformErrorTimeout,
+		Message:   "Task timed out after 3.00 seconds",
+		Duration:  3 * time.Second,
+	})
+	assert.NoError(t, exporter.ExportAgentPayloads(ctx, arn, []*telemetry.Invocation{inv}))
+	assert.Equal(t, []byte("agent payload"), <-app.DataChan)
+	assert.Equal(t, []interface{}{telemetry.PlatformErrorTimeout, "3.000000", "request-1", "Task timed out after 3.00 seconds", "my-function", "123456789012", "$LATEST"}, <-app.ErrorEventChan)
+
+	assert.NoError(t, exporter.ExportSpans(ctx, arn, nil))
+	assert.NoError(t, exporter.ExportSpans(ctx, arn, []telemetry.Span{{ID: "0000000000000001"}}))
+	assert.Len(t, app.SpanEventChan, 1)
+
+	lines := []logserver.LogLine{{Time: time.Now(), RequestID: "request-1", Content: []byte("hello")}}
+	assert.NoError(t, exporter.ExportLogs(ctx, arn, lines))
+	assert.Contains(t, logPayload, `"entity.guid":"entity-guid"`)
+}
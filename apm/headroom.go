@@ -0,0 +1,160 @@
+package apm
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+)
+
+// HeadroomWarningEventType is the type of the events sent when a sandbox's headroom is low
+const HeadroomWarningEventType = "AwsLambdaHeadroomWarning"
+
+const (
+	// headroomSamples is how many invocations the headroom distributions hold
+	headroomSamples = 100
+	// minHeadroomSamples is how many invocations are needed before warning, so that a cold start
+	// alone doesn't cause one
+	minHeadroomSamples = 5
+	// maxPendingTimeouts is how many invocations' timeouts are remembered, until their reports arrive
+	maxPendingTimeouts = 16
+	// headroomPercentile is the usage percentile whose headroom is compared with the thresholds
+	headroomPercentile = 0.95
+)
+
+// HeadroomTracker tracks the sandbox's distributions of memory used, as a fraction of the
+// function's memory size, and duration, as a fraction of the invocation's timeout. When the
+// headroom at the 95th percentile is below a threshold, it warns, at most once per interval.
+type HeadroomTracker struct {
+	lock             sync.Mutex
+	memoryThreshold  float64
+	timeoutThreshold float64
+	interval         time.Duration
+
+	memoryUsage  []float64
+	timeoutUsage []float64
+	// timeouts are the timeouts of invocations, in milliseconds, by request ID
+	timeouts    map[string]float64
+	requests    []string
+	lastWarning time.Time
+}
+
+// NewHeadroomTracker creates a HeadroomTracker. Thresholds are fractions of the memory size
+// and timeout.
+func NewHeadroomTracker(memoryThreshold float64, timeoutThreshold float64, interval time.Duration) *HeadroomTracker {
+	return &HeadroomTracker{
+		memoryThreshold:  memoryThreshold,
+		timeoutThreshold: timeoutThreshold,
+		interval:         interval,
+		timeouts:         make(map[string]float64),
+	}
+}
+
+// AddInvocation records the timeout of an invocation, from when its event arrived until its
+// deadline
+func (t *HeadroomTracker) AddInvocation(requestID string, start time.Time, deadline time.Time) {
+	timeout := deadline.Sub(start)
+	if timeout <= 0 {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.requests) == maxPendingTimeouts {
+		delete(t.timeouts, t.requests[0])
+		t.requests = t.requests[1:]
+	}
+	t.timeouts[requestID] = float64(timeout) / float64(time.Millisecond)
+	t.requests = append(t.requests, requestID)
+}
+
+// AddReport records the memory usage of an invocation's report, and its duration, when its
+// timeout is known
+func (t *HeadroomTracker) AddReport(report *LambdaMetrics) {
+	if report == nil || report.MemorySize <= 0 {
+		// Faults have no metrics
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.memoryUsage = appendSample(t.memoryUsage, float64(report.MaxMemoryUsed)/float64(report.MemorySize))
+	if timeout, ok := t.timeouts[report.RequestID]; ok {
+		t.timeoutUsage = appendSample(t.timeoutUsage, report.Duration/timeout)
+		delete(t.timeouts, report.RequestID)
+		for i, requestID := range t.requests {
+			if requestID == report.RequestID {
+				t.requests = append(t.requests[:i], t.requests[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Warnings returns an event for each resource whose headroom is below its threshold, once the
+// interval has passed since the last warning
+func (t *HeadroomTracker) Warnings(now time.Time) []telemetry.CustomEvent {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.lastWarning.IsZero() && now.Sub(t.lastWarning) < t.interval {
+		return nil
+	}
+
+	var events []telemetry.CustomEvent
+	for _, resource := range []struct {
+		name      string
+		usage     []float64
+		threshold float64
+	}{
+		{"memory", t.memoryUsage, t.memoryThreshold},
+		{"timeout", t.timeoutUsage, t.timeoutThreshold},
+	} {
+		if len(resource.usage) < minHeadroomSamples {
+			continue
+		}
+		headroom := 1 - usagePercentile(resource.usage, headroomPercentile)
+		if headroom >= resource.threshold {
+			continue
+		}
+
+		logger.Warnf("The p95 %s headroom of the last %d invocations is %.0f%%, below %.0f%%",
+			resource.name, len(resource.usage), headroom*100, resource.threshold*100)
+		events = append(events, telemetry.CustomEvent{
+			"eventType":   HeadroomWarningEventType,
+			"timestamp":   now.UnixMilli(),
+			"resource":    resource.name,
+			"p95Headroom": headroom,
+			"threshold":   resource.threshold,
+			"invocations": len(resource.usage),
+		})
+	}
+
+	if len(events) > 0 {
+		t.lastWarning = now
+	}
+	return events
+}
+
+// appendSample adds a sample, dropping the oldest when there are too many
+func appendSample(samples []float64, sample float64) []float64 {
+	if len(samples) == headroomSamples {
+		samples = append(samples[:0], samples[1:]...)
+	}
+	return append(samples, sample)
+}
+
+// usagePercentile is the nearest-rank percentile of samples
+func usagePercentile(samples []float64, percentile float64) float64 {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(percentile*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,86 @@
+package apm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadroomTracker(t *testing.T) {
+	tracker := NewHeadroomTracker(0.1, 0.2, time.Minute)
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < minHeadroomSamples; i++ {
+		assert.Empty(t, tracker.Warnings(start))
+
+		requestID := fmt.Sprintf("request-%d", i)
+		tracker.AddInvocation(requestID, start, start.Add(time.Second))
+		tracker.AddReport(&LambdaMetrics{RequestID: requestID, Duration: 850, MemorySize: 128, MaxMemoryUsed: 64})
+	}
+	// Faults have no metrics
+	tracker.AddReport(&LambdaMetrics{RequestID: "request-0", Error: "error"})
+	tracker.AddReport(nil)
+
+	warnings := tracker.Warnings(start)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, HeadroomWarningEventType, warnings[0]["eventType"])
+	assert.Equal(t, start.UnixMilli(), warnings[0]["timestamp"])
+	assert.Equal(t, "timeout", warnings[0]["resource"])
+	assert.InDelta(t, 0.15, warnings[0]["p95Headroom"], 0.0001)
+	assert.Equal(t, 0.2, warnings[0]["threshold"])
+	assert.Equal(t, minHeadroomSamples, warnings[0]["invocations"])
+
+	// At most once per interval
+	assert.Empty(t, tracker.Warnings(start.Add(30*time.Second)))
+	assert.Len(t, tracker.Warnings(start.Add(time.Minute)), 1)
+}
+
+func TestHeadroomTrackerMemory(t *testing.T) {
+	tracker := NewHeadroomTracker(0.1, 0.1, time.Minute)
+	for i := 0; i < 20; i++ {
+		// Reports without a known timeout only count towards memory
+		used := int64(100)
+		if i == 19 {
+			used = 127
+		}
+		tracker.AddReport(&LambdaMetrics{RequestID: fmt.Sprintf("request-%d", i), Duration: 10, MemorySize: 128, MaxMemoryUsed: used})
+	}
+	assert.Empty(t, tracker.Warnings(time.Now()))
+
+	tracker.AddReport(&LambdaMetrics{RequestID: "request-20", Duration: 10, MemorySize: 128, MaxMemoryUsed: 127})
+	warnings := tracker.Warnings(time.Now())
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, "memory", warnings[0]["resource"])
+	assert.Equal(t, 21, warnings[0]["invocations"])
+}
+
+func TestHeadroomTrackerPendingTimeouts(t *testing.T) {
+	tracker := NewHeadroomTracker(0.1, 0.1, time.Minute)
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < maxPendingTimeouts+1; i++ {
+		tracker.AddInvocation(fmt.Sprintf("request-%d", i), start, start.Add(time.Second))
+	}
+	// No timeout
+	tracker.AddInvocation("request-x", start, start)
+
+	assert.Len(t, tracker.timeouts, maxPendingTimeouts)
+	assert.Len(t, tracker.requests, maxPendingTimeouts)
+	assert.NotContains(t, tracker.timeouts, "request-0")
+
+	tracker.AddReport(&LambdaMetrics{RequestID: "request-1", Duration: 500, MemorySize: 128, MaxMemoryUsed: 64})
+	assert.Len(t, tracker.timeouts, maxPendingTimeouts-1)
+	assert.Equal(t, []float64{0.5}, tracker.timeoutUsage)
+}
+
+func TestUsagePercentile(t *testing.T) {
+	samples := make([]float64, 0, 100)
+	for i := 100; i > 0; i-- {
+		samples = append(samples, float64(i)/100)
+	}
+	assert.Equal(t, 0.95, usagePercentile(samples, 0.95))
+	assert.Equal(t, 0.5, usagePercentile([]float64{0.5}, 0.95))
+	// The samples aren't reordered
+	assert.Equal(t, 1.0, samples[0])
+}
@@ -10,9 +10,12 @@ import (
 	"time"
 
 	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
 	"github.com/newrelic/newrelic-lambda-extension/util"
 )
 
+var logger = util.NewComponentLogger("apm")
+
 type harvest struct {
 	data [][]byte
 }
@@ -41,6 +44,7 @@ type InternalAPMApp struct {
 
 	DataChan           chan []byte
 	ErrorEventChan	   chan []interface{}
+	SpanEventChan      chan []telemetry.Span
 	collectorErrorChan chan rpmResponse
 	connectChan        chan *appRun
 	LambdaLogChan      chan string
@@ -72,6 +76,7 @@ func NewApp(ctx context.Context ,c *config.Configuration, LambdaFunctionName str
 		connectChan:        make(chan *appRun, 1),
 		collectorErrorChan: make(chan rpmResponse, 1),
 		ErrorEventChan:     make(chan []interface{}, 5),
+		SpanEventChan:      make(chan []telemetry.Span, 5),
 		DataChan:           make(chan []byte, 5),
 		LambdaLogChan:      make(chan string, 1),
 		rpmControls: rpmControls{
@@ -86,7 +91,7 @@ func NewApp(ctx context.Context ,c *config.Configuration, LambdaFunctionName str
 			},
 		},
 	}
-	util.Debugf("New Internl APM app created with serverless config")
+	logger.Debugf("New Internl APM app created with serverless config")
 	go app.process(ctx)
 	go app.connectRoutine()
 
@@ -130,7 +135,7 @@ func (app *InternalAPMApp) connectRoutine() {
 	for attempts < maxAttempts {
 		reply, resp := app.connectAttempt()
 		if reply != nil {
-			util.Debugf("Connect successful in attempt %d", attempts+1)
+			logger.Debugf("Connect successful in attempt %d", attempts+1)
 
 			select {
 			case app.connectChan <- newAppRun(app.apmConfig, reply):
@@ -148,7 +153,7 @@ func (app *InternalAPMApp) connectRoutine() {
 		}
 
 		if nil != resp.GetError() {
-			util.Debugf("Error connecting to collector: %v", resp.GetError())
+			logger.Debugf("Error connecting to collector: %v", resp.GetError())
 		}
 
 		backoff := getConnectBackoffTime(attempts)
@@ -156,7 +161,7 @@ func (app *InternalAPMApp) connectRoutine() {
 		attempts++
 	}
 
-	util.Debugf("Exceeded maximum connection attempts.")
+	logger.Debugf("Exceeded maximum connection attempts.")
 	util.Fatal(fmt.Errorf("failed to connect to collector after %d attempts", maxAttempts))
 }
 
@@ -191,9 +196,17 @@ func (app *InternalAPMApp) sendError(errorData []interface{}, run *appRun) {
 	SendErrorEvent(cmd, &app.rpmControls, errorData, runId)
 }
 
+func (app *InternalAPMApp) sendSpans(spans []telemetry.Span, run *appRun) {
+	cmd := RpmCmd{
+		Name:      CmdSpanEvents,
+		Collector: app.apmConfig.hostname,
+	}
+	SendSpanEvents(cmd, &app.rpmControls, spans, run.Reply.RunID, app.apmConfig.LambdaFunctionName, app.apmConfig.LambdaFunctionVersion)
+}
+
 func (app *InternalAPMApp) doHarvest(ctx context.Context, payload []byte, run *appRun) {
 	collectorHost := app.apmConfig.hostname 
-	util.Debugf("Harvest collector host: %s", collectorHost)
+	logger.Debugf("Harvest collector host: %s", collectorHost)
 	cmd := RpmCmd{
 		Name: cmdPreconnect,
 		Collector: collectorHost,
@@ -208,56 +221,61 @@ func (app *InternalAPMApp) doHarvest(ctx context.Context, payload []byte, run *a
 
 	resp, _ := SendAPMTelemetry(ctx, payload, app.apmConfig.Configuration, cmd, &app.rpmControls, runId)
 	if resp != nil {
-		util.Debugf("Error sending telemetry data: %v", resp)
+		logger.Debugf("Error sending telemetry data: %v", resp)
 		nrResponse := newRPMResponse(resp)
 		app.collectorErrorChan <- *nrResponse
-		util.Debugf("Error sent to collector error channel")
+		logger.Debugf("Error sent to collector error channel")
 	}
-	util.Debugf("Harvest sent to collector")
+	logger.Debugf("Harvest sent to collector")
 }
 
 func (app *InternalAPMApp) process(ctx context.Context) {
 	var run *appRun
-	util.Debugf("Starting APM process loop....")
+	logger.Debugf("Starting APM process loop....")
 
 	for {
 		select {
 		case data := <-app.DataChan:
 			if nil != run && run.Reply.RunID != "" {
-				util.Debugf("Received data in DataChan with length: %d", len(data))
+				logger.Debugf("Received data in DataChan with length: %d", len(data))
 				go app.doHarvest(ctx, data, run)
 				if app.apmHarvest != nil {
-					util.Debugf("Harvesting data from DataChan")
+					logger.Debugf("Harvesting data from DataChan")
 					for _, harvestableData := range app.apmHarvest.data {
-						util.Debugf("Harvesting data: %s", string(harvestableData))
+						logger.Debugf("Harvesting data: %s", string(harvestableData))
 						go app.doHarvest(ctx, harvestableData, run)
 					}
 				}
 			} else {
-				util.Debugf("Received data in DataChan but runId not available, saving data for later")
+				logger.Debugf("Received data in DataChan but runId not available, saving data for later")
 				app.apmHarvest.data = append(app.apmHarvest.data, data)
 			}
 		case resp := <-app.collectorErrorChan:
-			util.Debugf("Received error in CollectorErrorChan: %v", resp)
+			logger.Debugf("Received error in CollectorErrorChan: %v", resp)
 			app.setState(nil, nil)
 			if resp.IsDisconnect() {
 				util.Fatal(fmt.Errorf("collector disconnected: %v", resp.GetError()))
 			} else if resp.IsRestartException() {
-				util.Debugf("Received restart exception, resetting app state")
+				logger.Debugf("Received restart exception, resetting app state")
 				go app.connectRoutine()
 			}
 		case <-app.shutdownStarted:
-			util.Debugf("Shutdown started")
+			logger.Debugf("Shutdown started")
 			return
 		case run = <-app.connectChan:
-			util.Debugf("Received run in ConnectChan and setting app state")
+			logger.Debugf("Received run in ConnectChan and setting app state")
 			app.setState(run, nil)
 			app.LambdaLogChan <- run.Reply.EntityGUID
 		case errorData := <-app.ErrorEventChan:
-			util.Debugf("Received error event in ErrorEventChan")
+			logger.Debugf("Received error event in ErrorEventChan")
 			if nil != run && run.Reply.RunID != "" {
 				app.sendError(errorData, run)
 			}
+		case spans := <-app.SpanEventChan:
+			logger.Debugf("Received %d spans in SpanEventChan", len(spans))
+			if nil != run && run.Reply.RunID != "" {
+				app.sendSpans(spans, run)
+			}
 		}
 	}
 }
@@ -1,42 +1,39 @@
 package apm
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"regexp"
-	"strconv"
-	"strings"
 
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
 	"github.com/newrelic/newrelic-lambda-extension/util"
 )
 
 const (
-	MetricEndpointEU string = "https://metric-api.eu.newrelic.com/metric/v1"
-	MetricEndpointUS string = "https://metric-api.newrelic.com/metric/v1"
+	MetricEndpointEU string = telemetry.MetricEndpointEU
+	MetricEndpointUS string = telemetry.MetricEndpointUS
 )
 
+// Metric is a dimensional metric, in Metric API form. Every metric the extension sends has the
+// telemetry package's type, so they can all go through one sender.
+type Metric = telemetry.Metric
+
+// Summary is the value of a summary metric
+type Summary = telemetry.Summary
+
+// MetricPayload is a Metric API payload. The Metric API expects an array of them.
+type MetricPayload struct {
+	Metrics []Metric `json:"metrics"`
+}
+
+// MetricPrefix names the metrics of Lambda invocations, in APM Lambda mode and otherwise
+const MetricPrefix = "apm.lambda.transaction"
+
 // Precompile regex patterns at package level for reusability
 var (
-	basicRe    = regexp.MustCompile(`RequestId: (\S+)\s+Duration: ([\d.]+) ms\s+Billed Duration: (\d+) ms\s+Memory Size: (\d+) MB\s+Max Memory Used: (\d+) MB`)
-	initRe     = regexp.MustCompile(`Init Duration: ([\d.]+) ms`)
 	faultLogRe = regexp.MustCompile(`RequestId: (\S+)\s+Status: (\S+)(?:\s+ErrorType: (\S+))?`)
 )
 
-type Metric struct {
-	Name       string            `json:"name"`
-	Type       string            `json:"type"`
-	Value      float64           `json:"value"`
-	Timestamp  int64             `json:"timestamp"`
-	Attributes map[string]string `json:"attributes"`
-	Interval   int64             `json:"interval.ms,omitempty"`
-}
-type MetricPayload struct {
-	Metrics []Metric `json:"metrics"`
-}
 type LambdaMetrics struct {
 	RequestID      string
 	Duration       float64
@@ -68,59 +65,43 @@ func ParseLambdaFaultLog(logLine string) (*LambdaMetrics, error) {
 }
 
 func ParseLambdaReportLog(logLine string) (*LambdaMetrics, error) {
-	basicMatches := basicRe.FindStringSubmatch(logLine)
-	if basicMatches == nil {
+	report, err := telemetry.ParsePlatformReport(logLine)
+	if err != nil {
 		return ParseLambdaFaultLog(logLine) // Delegate to fault handler
 	}
 
-	// Parse fields directly from matches
-	duration, err := strconv.ParseFloat(basicMatches[2], 64)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing duration: %v", err)
-	}
-	billedDuration, err := strconv.ParseInt(basicMatches[3], 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing billed duration: %v", err)
-	}
-	memorySize, err := strconv.ParseInt(basicMatches[4], 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing memory size: %v", err)
-	}
-	maxMemoryUsed, err := strconv.ParseInt(basicMatches[5], 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing max memory used: %v", err)
-	}
+	return NewLambdaMetrics(report), nil
+}
 
-	metrics := &LambdaMetrics{
-		RequestID:      basicMatches[1],
-		Duration:       duration,
-		BilledDuration: float64(billedDuration),
-		MemorySize:     memorySize,
-		MaxMemoryUsed:  maxMemoryUsed,
-		InitDuration:   nil,
-	}
-	// Parse optional init duration
-	if initMatches := initRe.FindStringSubmatch(logLine); initMatches != nil {
-		if initDuration, err := strconv.ParseFloat(initMatches[1], 64); err == nil {
-			metrics.InitDuration = &initDuration
-		}
+// NewLambdaMetrics takes the metrics of a parsed platform report
+func NewLambdaMetrics(report *telemetry.PlatformReport) *LambdaMetrics {
+	return &LambdaMetrics{
+		RequestID:      report.RequestID,
+		Duration:       report.Duration,
+		BilledDuration: report.BilledDuration,
+		MemorySize:     report.MemorySize,
+		MaxMemoryUsed:  report.MaxMemoryUsed,
+		InitDuration:   report.InitDuration,
 	}
-
-	return metrics, nil
 }
 
-func (lm *LambdaMetrics) ConvertToMetrics(prefix string, entityGuid string, functionName string) []Metric {
-	timestamp := util.Timestamp()
-	attributes := map[string]string{
-		"aws.requestId": lm.RequestID,
+// lambdaMetricAttributes are the attributes of an invocation's metrics, linking them to the APM entity
+func lambdaMetricAttributes(requestID string, entityGuid string, functionName string) map[string]interface{} {
+	return map[string]interface{}{
+		"aws.requestId": requestID,
 		"entity.guid":   entityGuid,
 		"entity.name":   functionName,
 		"entity.type":   "APM",
 	}
+}
+
+func (lm *LambdaMetrics) ConvertToMetrics(prefix string, entityGuid string, functionName string) []telemetry.Metric {
+	timestamp := util.Timestamp()
+	attributes := lambdaMetricAttributes(lm.RequestID, entityGuid, functionName)
 	// Preallocate slice with estimated capacity to reduce reallocations
-	metrics := make([]Metric, 0, 6) // Max possible metrics: 6 (duration, billed, memory, max memory, init, error)
+	metrics := make([]telemetry.Metric, 0, 6) // Max possible metrics: 6 (duration, billed, memory, max memory, init, error)
 	if lm.Duration != 0 {
-		metrics = append(metrics, Metric{
+		metrics = append(metrics, telemetry.Metric{
 			Name:       prefix + ".duration",
 			Type:       "gauge",
 			Value:      lm.Duration,
@@ -129,7 +110,7 @@ func (lm *LambdaMetrics) ConvertToMetrics(prefix string, entityGuid string, func
 		})
 	}
 	if lm.BilledDuration != 0 {
-		metrics = append(metrics, Metric{
+		metrics = append(metrics, telemetry.Metric{
 			Name:       prefix + ".billed_duration",
 			Type:       "gauge",
 			Value:      lm.BilledDuration,
@@ -138,7 +119,7 @@ func (lm *LambdaMetrics) ConvertToMetrics(prefix string, entityGuid string, func
 		})
 	}
 	if lm.MemorySize != 0 {
-		metrics = append(metrics, Metric{
+		metrics = append(metrics, telemetry.Metric{
 			Name:       prefix + ".memory_size",
 			Type:       "gauge",
 			Value:      float64(lm.MemorySize),
@@ -148,7 +129,7 @@ func (lm *LambdaMetrics) ConvertToMetrics(prefix string, entityGuid string, func
 	}
 
 	if lm.MaxMemoryUsed != 0 {
-		metrics = append(metrics, Metric{
+		metrics = append(metrics, telemetry.Metric{
 			Name:       prefix + ".max_memory_used",
 			Type:       "gauge",
 			Value:      float64(lm.MaxMemoryUsed),
@@ -159,7 +140,7 @@ func (lm *LambdaMetrics) ConvertToMetrics(prefix string, entityGuid string, func
 
 	// Add init duration metric only if it exists
 	if lm.InitDuration != nil {
-		metrics = append(metrics, Metric{
+		metrics = append(metrics, telemetry.Metric{
 			Name:       prefix + ".init_duration",
 			Type:       "gauge",
 			Value:      *lm.InitDuration,
@@ -172,7 +153,7 @@ func (lm *LambdaMetrics) ConvertToMetrics(prefix string, entityGuid string, func
 		if lm.ErrorType != "" {
 			attributes["Error Type"] = lm.ErrorType
 		}
-		metrics = append(metrics, Metric{
+		metrics = append(metrics, telemetry.Metric{
 			Name:       prefix + ".error",
 			Type:       "count",
 			Value:      1,
@@ -184,47 +165,7 @@ func (lm *LambdaMetrics) ConvertToMetrics(prefix string, entityGuid string, func
 	return metrics
 }
 
-func getMetricEndpointURL(licenseKey string, metricEndpointOverride string) string {
-	if metricEndpointOverride != "" {
-		return metricEndpointOverride
-	}
-
-	if strings.HasPrefix(licenseKey, "eu") {
-		return MetricEndpointEU
-	}
-
-	return MetricEndpointUS
-}
-
-func SendMetrics(apiKey string, metricEndpointOverride string, metrics []Metric, skipTLSVerify bool) (int, string, error) {
-	payload := []MetricPayload{
-		{
-			Metrics: metrics,
-		},
-	}
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return 0, "", fmt.Errorf("error marshaling JSON: %v", err)
-	}
-	metricEndpoint := getMetricEndpointURL(apiKey, metricEndpointOverride)
-	req, err := http.NewRequest("POST", metricEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return 0, "", fmt.Errorf("error creating request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Api-Key", apiKey)
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: skipTLSVerify},
-	}
-	client := &http.Client{Transport: tr}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, "", fmt.Errorf("error sending request: %v", err)
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return resp.StatusCode, "", fmt.Errorf("error reading response: %v", err)
-	}
-	return resp.StatusCode, string(body), nil
+// SendMetrics sends metrics to the Metric API, through the telemetry client
+func SendMetrics(ctx context.Context, client *telemetry.Client, invokedFunctionARN string, metrics []Metric) error {
+	return client.SendMetrics(ctx, invokedFunctionARN, metrics)
 }
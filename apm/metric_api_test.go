@@ -1,8 +1,16 @@
 package apm
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
 	"github.com/newrelic/newrelic-lambda-extension/util"
 	"github.com/stretchr/testify/assert"
 )
@@ -150,7 +158,7 @@ func TestLambdaMetrics_ConvertToMetrics(t *testing.T) {
 	tests := []struct {
 		name   string
 		input  LambdaMetrics
-		verify func(t *testing.T, metrics []Metric)
+		verify func(t *testing.T, metrics []telemetry.Metric)
 	}{
 		{
 			name: "All fields set, including InitDuration and ErrorType",
@@ -164,7 +172,7 @@ func TestLambdaMetrics_ConvertToMetrics(t *testing.T) {
 				Error:          "Error",
 				ErrorType:      "Timeout",
 			},
-			verify: func(t *testing.T, metrics []Metric) {
+			verify: func(t *testing.T, metrics []telemetry.Metric) {
 				assert.Len(t, metrics, 6)
 				names := []string{}
 				for _, m := range metrics {
@@ -204,7 +212,7 @@ func TestLambdaMetrics_ConvertToMetrics(t *testing.T) {
 				MemorySize:     256,
 				MaxMemoryUsed:  128,
 			},
-			verify: func(t *testing.T, metrics []Metric) {
+			verify: func(t *testing.T, metrics []telemetry.Metric) {
 				assert.Len(t, metrics, 4)
 				names := []string{}
 				for _, m := range metrics {
@@ -228,7 +236,7 @@ func TestLambdaMetrics_ConvertToMetrics(t *testing.T) {
 				RequestID: "req-3",
 				Error:     "Error",
 			},
-			verify: func(t *testing.T, metrics []Metric) {
+			verify: func(t *testing.T, metrics []telemetry.Metric) {
 				assert.Len(t, metrics, 1)
 				m := metrics[0]
 				assert.Equal(t, "lambda.error", m.Name)
@@ -243,7 +251,7 @@ func TestLambdaMetrics_ConvertToMetrics(t *testing.T) {
 			input: LambdaMetrics{
 				RequestID: "req-4",
 			},
-			verify: func(t *testing.T, metrics []Metric) {
+			verify: func(t *testing.T, metrics []telemetry.Metric) {
 				assert.Len(t, metrics, 0)
 			},
 		},
@@ -253,7 +261,7 @@ func TestLambdaMetrics_ConvertToMetrics(t *testing.T) {
 				RequestID:    "req-5",
 				InitDuration: func() *float64 { v := 123.45; return &v }(),
 			},
-			verify: func(t *testing.T, metrics []Metric) {
+			verify: func(t *testing.T, metrics []telemetry.Metric) {
 				assert.Len(t, metrics, 1)
 				m := metrics[0]
 				assert.Equal(t, "lambda.init_duration", m.Name)
@@ -267,7 +275,7 @@ func TestLambdaMetrics_ConvertToMetrics(t *testing.T) {
 				RequestID: "req-6",
 				Error:     "Failed",
 			},
-			verify: func(t *testing.T, metrics []Metric) {
+			verify: func(t *testing.T, metrics []telemetry.Metric) {
 				assert.Len(t, metrics, 1)
 				m := metrics[0]
 				assert.Equal(t, "lambda.error", m.Name)
@@ -284,49 +292,23 @@ func TestLambdaMetrics_ConvertToMetrics(t *testing.T) {
 	}
 }
 
-func Test_getMetricEndpointURL(t *testing.T) {
-	tests := []struct {
-		name                 string
-		licenseKey           string
-		metricEndpointOverride string
-		want                 string
-	}{
-		{
-			name:       "Override provided",
-			licenseKey: "eu1234567890abcdef",
-			metricEndpointOverride: "https://custom-endpoint.com/metric/v1",
-			want:       "https://custom-endpoint.com/metric/v1",
-		},
-		{
-			name:       "EU license key, no override",
-			licenseKey: "eu01xx1234567890abcdef",
-			metricEndpointOverride: "",
-			want:       MetricEndpointEU,
-		},
-		{
-			name:       "US license key, no override",
-			licenseKey: "us01xx1234567890abcdef",
-			metricEndpointOverride: "",
-			want:       MetricEndpointUS,
-		},
-		{
-			name:       "Non-EU, non-US license key, no override",
-			licenseKey: "xx01xx1234567890abcdef",
-			metricEndpointOverride: "",
-			want:       MetricEndpointUS,
-		},
-		{
-			name:       "Empty license key, no override",
-			licenseKey: "",
-			metricEndpointOverride: "",
-			want:       MetricEndpointUS,
-		},
-	}
+func TestSendMetrics(t *testing.T) {
+	var received []MetricPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := getMetricEndpointURL(tt.licenseKey, tt.metricEndpointOverride)
-			assert.Equal(t, tt.want, got)
-		})
-	}
+	client := telemetry.NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &telemetry.Batch{}, false, time.Second)
+	client.SetCustomDataEndpoints("", srv.URL, "")
+
+	metrics := []Metric{{Name: "orders", Type: "count", Value: 2, Timestamp: 1000, Interval: 1000}}
+	assert.NoError(t, SendMetrics(context.Background(), client, "arn:aws:lambda:us-east-1:123456789012:function:my-function", metrics))
+	assert.Len(t, received, 1)
+	assert.Equal(t, metrics, received[0].Metrics)
 }
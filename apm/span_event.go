@@ -0,0 +1,73 @@
+package apm
+
+import (
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+)
+
+type SpanEventDetail struct {
+	Category      string  `json:"category"`
+	Duration      float64 `json:"duration"`
+	EntryPoint    bool    `json:"nr.entryPoint,omitempty"`
+	Guid          string  `json:"guid"`
+	Name          string  `json:"name"`
+	ParentId      string  `json:"parentId,omitempty"`
+	Priority      float64 `json:"priority"`
+	Sampled       bool    `json:"sampled"`
+	Timestamp     int64   `json:"timestamp"`
+	TraceId       string  `json:"traceId"`
+	TransactionId string  `json:"transactionId"`
+	Type          string  `json:"type"`
+}
+
+// MapToSpanEventData converts spans to the collector's span_event_data. Durations are in seconds,
+// and the root span is the entry point. Spans of a trace share a transaction ID, which is the
+// root span's ID.
+func MapToSpanEventData(spans []telemetry.Span, runId string, LambdaFunctionName string, LambdaFunctionVersion string) []interface{} {
+	rootIds := make(map[string]string)
+	for _, span := range spans {
+		if span.ParentID() == "" {
+			rootIds[span.TraceID] = span.ID
+		}
+	}
+
+	events := make([][]interface{}, 0, len(spans))
+	for _, span := range spans {
+		agentAttributes := map[string]interface{}{
+			"aws.lambda.functionName":    LambdaFunctionName,
+			"aws.lambda.functionVersion": LambdaFunctionVersion,
+		}
+		for k, v := range span.Attributes {
+			if k != "name" && k != "duration.ms" && k != "parent.id" {
+				agentAttributes[k] = v
+			}
+		}
+
+		events = append(events, []interface{}{
+			SpanEventDetail{
+				Category:      "generic",
+				Duration:      span.Duration() / 1000,
+				EntryPoint:    span.ParentID() == "",
+				Guid:          span.ID,
+				Name:          span.Name(),
+				ParentId:      span.ParentID(),
+				Priority:      1.5,
+				Sampled:       true,
+				Timestamp:     span.Timestamp,
+				TraceId:       span.TraceID,
+				TransactionId: rootIds[span.TraceID],
+				Type:          "Span",
+			},
+			struct{}{},
+			agentAttributes,
+		})
+	}
+
+	return []interface{}{
+		runId,
+		map[string]int{
+			"events_seen":    len(events),
+			"reservoir_size": len(events),
+		},
+		events,
+	}
+}
@@ -0,0 +1,62 @@
+package apm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+)
+
+func TestMapToSpanEventData(t *testing.T) {
+	spans := []telemetry.Span{
+		{
+			ID:         "root-id",
+			TraceID:    "trace-id",
+			Timestamp:  1700000000000,
+			Attributes: map[string]interface{}{"name": telemetry.InvocationSpanName, "duration.ms": 250.0, "aws.requestId": "request-id"},
+		},
+		{
+			ID:         "child-id",
+			TraceID:    "trace-id",
+			Timestamp:  1700000000010,
+			Attributes: map[string]interface{}{"name": "responseLatency", "duration.ms": 20.0, "parent.id": "root-id", "aws.requestId": "request-id"},
+		},
+	}
+
+	data := MapToSpanEventData(spans, "test-run-id", "myLambdaFunc", "42")
+	assert.Len(t, data, 3)
+	assert.Equal(t, "test-run-id", data[0])
+	assert.Equal(t, map[string]int{"events_seen": 2, "reservoir_size": 2}, data[1])
+
+	events, ok := data[2].([][]interface{})
+	assert.True(t, ok)
+	assert.Len(t, events, 2)
+
+	root := events[0][0].(SpanEventDetail)
+	assert.Equal(t, SpanEventDetail{
+		Category:      "generic",
+		Duration:      0.25,
+		EntryPoint:    true,
+		Guid:          "root-id",
+		Name:          telemetry.InvocationSpanName,
+		Priority:      1.5,
+		Sampled:       true,
+		Timestamp:     1700000000000,
+		TraceId:       "trace-id",
+		TransactionId: "root-id",
+		Type:          "Span",
+	}, root)
+
+	child := events[1][0].(SpanEventDetail)
+	assert.False(t, child.EntryPoint)
+	assert.Equal(t, "root-id", child.ParentId)
+	assert.Equal(t, "root-id", child.TransactionId)
+	assert.Equal(t, 0.02, child.Duration)
+
+	agentAttributes := events[1][2].(map[string]interface{})
+	assert.Equal(t, "request-id", agentAttributes["aws.requestId"])
+	assert.Equal(t, "myLambdaFunc", agentAttributes["aws.lambda.functionName"])
+	assert.Equal(t, "42", agentAttributes["aws.lambda.functionVersion"])
+	assert.Nil(t, agentAttributes["parent.id"])
+}
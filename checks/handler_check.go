@@ -66,7 +66,7 @@ func (r runtimeConfig) check(h handlerConfigs) bool {
 
 func (r runtimeConfig) getTrueHandler(h handlerConfigs) string {
 	if h.handlerName != r.wrapperName {
-		util.Logln("Warning: handler not set to New Relic layer wrapper", r.wrapperName)
+		logger.Logln("Warning: handler not set to New Relic layer wrapper", r.wrapperName)
 		return h.handlerName
 	}
 
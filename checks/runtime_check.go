@@ -50,7 +50,7 @@ func latestAgentTag(r *runtimeConfig) error {
 	release, _, err := githubClient.Repositories.GetLatestRelease(ctx, r.agentVersionGitOrg, r.agentVersionGitRepo)
 
 	if err != nil {
-		util.Debugf("Could not retrieve latest GitHub release: %v", err)
+		logger.Debugf("Could not retrieve latest GitHub release: %v", err)
 		return nil
 	}
 
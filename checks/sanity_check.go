@@ -49,6 +49,21 @@ func sanityCheck(ctx context.Context, conf *config.Configuration, res *api.Regis
 		isSSMParameterConfigured = credentials.IsSSMParameterConfigured(ctxSSMParameter, conf)
 	}
 
+	// KMS-encrypted environment variable. It isn't decrypted again here.
+	isKMSConfigured := credentials.IsKMSConfigured(conf)
+
+	if isKMSConfigured && envKeyExists {
+		return fmt.Errorf("There is both a KMS-encrypted NEW_RELIC_LICENSE_KEY_KMS and a NEW_RELIC_LICENSE_KEY environment variable set. Recommend removing the NEW_RELIC_LICENSE_KEY environment variable and using the KMS-encrypted license key.")
+	}
+
+	if isKMSConfigured && isSecretConfigured {
+		return fmt.Errorf("There is both a KMS-encrypted NEW_RELIC_LICENSE_KEY_KMS and a AWS Secrets Manager secret set. Recommend using just one.")
+	}
+
+	if isKMSConfigured && isSSMParameterConfigured {
+		return fmt.Errorf("There is both a KMS-encrypted NEW_RELIC_LICENSE_KEY_KMS and a AWS Parameter Store parameter set. Recommend using just one.")
+	}
+
 	if isSecretConfigured && envKeyExists {
 		return fmt.Errorf("There is both a AWS Secrets Manager secret and a NEW_RELIC_LICENSE_KEY environment variable set. Recommend removing the NEW_RELIC_LICENSE_KEY environment variable and using the AWS Secrets Manager secret.")
 	}
@@ -61,8 +76,8 @@ func sanityCheck(ctx context.Context, conf *config.Configuration, res *api.Regis
 		return fmt.Errorf("There is both a AWS Secrets Manager secret and a AWS Parameter Store parameter set. Recommend using just one.")
 	}
 
-	if !envKeyExists && !isSecretConfigured && !isSSMParameterConfigured {
-		util.Debugln("No configured license key found, attempting fallback to default AWS Secrets Manager secret with NEW_RELIC_LICENSE_KEY.")
+	if !envKeyExists && !isKMSConfigured && !isSecretConfigured && !isSSMParameterConfigured {
+		logger.Debugln("No configured license key found, attempting fallback to default AWS Secrets Manager secret with NEW_RELIC_LICENSE_KEY.")
 	}
 
 	return nil
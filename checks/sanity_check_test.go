@@ -2,11 +2,13 @@ package checks
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
@@ -236,3 +238,122 @@ func TestSanityCheckSSMParameter(t *testing.T) {
 		})
 	}
 }
+
+type mockKMS struct {
+	plaintext string
+	calls     int
+}
+
+func (m *mockKMS) Decrypt(_ context.Context, input *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	m.calls++
+	if string(input.CiphertextBlob) != "ciphertext" {
+		return nil, fmt.Errorf("InvalidCiphertextException")
+	}
+
+	return &kms.DecryptOutput{Plaintext: []byte(m.plaintext)}, nil
+}
+
+func TestSanityCheckKMS(t *testing.T) {
+	ciphertext := base64.StdEncoding.EncodeToString([]byte("ciphertext"))
+
+	table := []struct {
+		Name string
+
+		Conf           config.Configuration
+		Environment    map[string]string
+		SecretsManager credentials.SecretsManagerAPI
+		SSM            credentials.SSMAPI
+
+		ExpectedErr string
+	}{
+		{
+			Name: "returns nil when just the KMS-encrypted key is configured",
+
+			Conf:           config.Configuration{LicenseKeyKMSCiphertext: ciphertext},
+			SecretsManager: mockSecretManager{},
+			SSM:            &mockSSM{},
+		},
+		{
+			Name: "returns error when environment variable and an undecryptable KMS-encrypted key are configured",
+
+			Conf: config.Configuration{LicenseKeyKMSCiphertext: base64.StdEncoding.EncodeToString([]byte("other"))},
+			Environment: map[string]string{
+				"NEW_RELIC_LICENSE_KEY": "12345",
+			},
+			SecretsManager: mockSecretManager{},
+			SSM:            &mockSSM{},
+
+			ExpectedErr: "There is both a KMS-encrypted NEW_RELIC_LICENSE_KEY_KMS and a NEW_RELIC_LICENSE_KEY environment variable set. Recommend removing the NEW_RELIC_LICENSE_KEY environment variable and using the KMS-encrypted license key.",
+		},
+		{
+			Name: "returns error when environment variable and KMS-encrypted key are configured",
+
+			Conf: config.Configuration{LicenseKeyKMSCiphertext: ciphertext},
+			Environment: map[string]string{
+				"NEW_RELIC_LICENSE_KEY": "12345",
+			},
+			SecretsManager: mockSecretManager{},
+			SSM:            &mockSSM{},
+
+			ExpectedErr: "There is both a KMS-encrypted NEW_RELIC_LICENSE_KEY_KMS and a NEW_RELIC_LICENSE_KEY environment variable set. Recommend removing the NEW_RELIC_LICENSE_KEY environment variable and using the KMS-encrypted license key.",
+		},
+		{
+			Name: "returns error when secret and KMS-encrypted key are configured",
+
+			Conf: config.Configuration{
+				LicenseKeyKMSCiphertext: ciphertext,
+				LicenseKeySecretId:      "secret",
+			},
+			SecretsManager: mockSecretManager{
+				validSecrets: []string{"secret"},
+			},
+			SSM: &mockSSM{},
+
+			ExpectedErr: "There is both a KMS-encrypted NEW_RELIC_LICENSE_KEY_KMS and a AWS Secrets Manager secret set. Recommend using just one.",
+		},
+		{
+			Name: "returns error when parameter and KMS-encrypted key are configured",
+
+			Conf: config.Configuration{
+				LicenseKeyKMSCiphertext:    ciphertext,
+				LicenseKeySSMParameterName: "parameter",
+			},
+			SecretsManager: mockSecretManager{},
+			SSM: &mockSSM{
+				validParameters: []string{"parameter"},
+			},
+
+			ExpectedErr: "There is both a KMS-encrypted NEW_RELIC_LICENSE_KEY_KMS and a AWS Parameter Store parameter set. Recommend using just one.",
+		},
+	}
+
+	ctx := context.Background()
+	kmsMock := &mockKMS{plaintext: "kms_key"}
+	credentials.OverrideKMS(kmsMock)
+	defer credentials.OverrideKMS(nil)
+
+	for _, entry := range table {
+		t.Run(entry.Name, func(t *testing.T) {
+			credentials.OverrideSecretsManager(entry.SecretsManager)
+			credentials.OverrideSSM(entry.SSM)
+
+			for name, value := range entry.Environment {
+				os.Setenv(name, value)
+			}
+
+			err := sanityCheck(ctx, &entry.Conf, &api.RegistrationResponse{}, runtimeConfig{})
+
+			if entry.ExpectedErr != "" {
+				assert.EqualError(t, err, entry.ExpectedErr)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			for name := range entry.Environment {
+				os.Unsetenv(name)
+			}
+		})
+	}
+	// The check doesn't decrypt the key
+	assert.Equal(t, 0, kmsMock.calls)
+}
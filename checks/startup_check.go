@@ -17,6 +17,8 @@ type LogSender interface {
 	SendFunctionLogs(ctx context.Context, invokedFunctionARN string, lines []logserver.LogLine, entityGuid string) error
 }
 
+var logger = util.NewComponentLogger("checks")
+
 /// Register checks here
 var checks = map[string]checkFn{
     "agent":         agentVersionCheck, 
@@ -29,7 +31,7 @@ func RunChecks(ctx context.Context, conf *config.Configuration, reg *api.Registr
 	runtimeConfig, err := checkAndReturnRuntime()
 	if err != nil {
 		errLog := fmt.Sprintf("There was an issue querying for the latest agent version: %v", err)
-		util.Logln(errLog)
+		logger.Logln(errLog)
 	}
 
 	for checkName, check := range checks {
@@ -44,7 +46,7 @@ func runCheck(ctx context.Context, conf *config.Configuration, reg *api.Registra
 	err := check(ctx, conf, reg, r)
 	if err != nil {
 		errLog := fmt.Sprintf("Startup check warning: %v", err)
-		util.Logln(errLog)
+		logger.Logln(errLog)
 		var entityGuid string
 		//Send a log line to NR as well
 		logSender.SendFunctionLogs(ctx, "", []logserver.LogLine{
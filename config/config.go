@@ -8,16 +8,51 @@ import (
 )
 
 const (
-	DefaultRipeMillis    = 7_000
-	DefaultRotMillis     = 12_000
-	DefaultLogLevel      = "INFO"
-	DebugLogLevel        = "DEBUG"
-	InfoLogLevel         = "INFO"
-	WarnLogLevel         = "WARN"
-	defaultLogServerHost = "sandbox.localdomain"
-	DefaultClientTimeout = 10 * time.Second
+	DefaultRipeMillis      = 7_000
+	DefaultRotMillis       = 12_000
+	DefaultLogLevel        = "INFO"
+	DebugLogLevel          = "DEBUG"
+	InfoLogLevel           = "INFO"
+	WarnLogLevel           = "WARN"
+	ErrorLogLevel          = "ERROR"
+	LogFormatText          = "text"
+	LogFormatJSON          = "json"
+	defaultLogServerHost   = "sandbox.localdomain"
+	DefaultClientTimeout   = 10 * time.Second
+	DefaultIngestAPIPort   = 8389
+	DefaultStatsDPort      = 8125
+	DefaultOTLPPort        = 4318
+	SecretFormatPlain      = "plain"
+	ExporterNewRelic       = "newrelic"
+	ExporterOTLP           = "otlp"
+	ExporterStdout         = "stdout"
+	ExporterFile           = "file"
+	DefaultExporterFile    = "/tmp/newrelic-telemetry.jsonl"
+	LogQueueDropOldest     = "drop_oldest"
+	LogQueueDropNewest     = "drop_newest"
+	LogQueueBlock          = "block"
+	DefaultLogQueueSize    = 100
+	DefaultLogQueueTimeout = 500 * time.Millisecond
+	DefaultDiagnosticsRate = 20
 )
 
+// Log pipeline defaults
+const (
+	DefaultLogStitchingMaxSize = 64 * 1024
+	DefaultLogStitchingTimeout = time.Second
+	DefaultLogDedupeWindow     = time.Second
+)
+
+// Headroom warning defaults
+const (
+	DefaultMemoryHeadroomThreshold  = 0.1
+	DefaultTimeoutHeadroomThreshold = 0.1
+	DefaultHeadroomWarningInterval  = 5 * time.Minute
+)
+
+// DefaultResourceSamplerInterval is how often the resource sampler reads /proc during an invocation
+const DefaultResourceSamplerInterval = 100 * time.Millisecond
+
 var EmptyNRWrapper = "Undefined"
 
 type Configuration struct {
@@ -33,16 +68,66 @@ type Configuration struct {
 	LicenseKey                 string
 	LicenseKeySecretId         string
 	LicenseKeySSMParameterName string
+	LicenseKeyKMSCiphertext    string
+	LicenseKeyFile             string
+	LicenseKeyProviders        []string
+	LicenseKeySecretJSONKey    string
+	LicenseKeySecretVersionStage string
+	LicenseKeySecretVersionId  string
+	LicenseKeySecretFormat     string
 	NRHandler                  string
 	TelemetryEndpoint          string
 	MetricEndpoint 		       string
 	LogEndpoint                string
 	LogLevel                   string
+	LogFormat                  string
 	LogServerHost              string
 	ClientTimeout              time.Duration
 	NewRelicHost               string
 	APMLambdaMode              bool
 	PreconnectEnabled		   bool
+	IngestAPIEnabled           bool
+	IngestAPIPort              uint16
+	AccountID                  string
+	EventEndpoint              string
+	StatsDEnabled              bool
+	StatsDPort                 uint16
+	OTLPReceiverEnabled        bool
+	OTLPReceiverPort           uint16
+	OTLPEndpoint               string
+	Exporter                   string
+	ExporterFile               string
+	LogQueueSize               uint32
+	LogQueuePolicy             string
+	LogQueueTimeout            time.Duration
+	DiagnosticLogsEnabled      bool
+	DiagnosticLogsRate         uint32
+	LogMetricRules             string
+	LogStitchingEnabled        bool
+	LogStitchingPattern        string
+	LogStitchingMaxSize        uint32
+	LogStitchingTimeout        time.Duration
+	LogSeverityEnabled         bool
+	LogSamplingRates           map[string]float64
+	LogDedupeEnabled           bool
+	LogDedupeWindow            time.Duration
+	LogBudgetLines             uint32
+	LogBudgetBytes             uint32
+	EMFEnabled                 bool
+	EMFForwardLogs             bool
+	InvocationEventsEnabled    bool
+	HeadroomWarningsEnabled    bool
+	MemoryHeadroomThreshold    float64
+	TimeoutHeadroomThreshold   float64
+	HeadroomWarningInterval    time.Duration
+	CostMetricsEnabled         bool
+	CostPricing                string
+	ResourceSamplerEnabled     bool
+	ResourceSamplerInterval    time.Duration
+	OverheadMetricsEnabled     bool
+	PlatformSpansEnabled       bool
+	TraceEndpoint              string
+	SandboxEventsEnabled       bool
 }
 
 func parseIgnoredExtensionChecks(nrIgnoreExtensionChecksOverride bool, nrIgnoreExtensionChecksStr string) map[string]bool {
@@ -77,6 +162,50 @@ func parseIgnoredExtensionChecks(nrIgnoreExtensionChecksOverride bool, nrIgnoreE
 	return ignoredChecks
 }
 
+// parseLogSamplingRates parses comma-separated LEVEL=rate pairs, such as DEBUG=0.1,INFO=0.5.
+// Rates outside 0 to 1, and pairs that can't be parsed, are ignored.
+func parseLogSamplingRates(str string) map[string]float64 {
+	var rates map[string]float64
+	for _, pair := range parseList(str) {
+		level, rateStr, found := strings.Cut(pair, "=")
+		if !found {
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			continue
+		}
+		if rates == nil {
+			rates = make(map[string]float64)
+		}
+		rates[strings.ToUpper(strings.TrimSpace(level))] = rate
+	}
+	return rates
+}
+
+// parseFraction parses a value from 0 to 1
+func parseFraction(str string) (float64, bool) {
+	fraction, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || fraction < 0 || fraction > 1 {
+		return 0, false
+	}
+	return fraction, true
+}
+
+// parseList splits a comma-separated value, dropping empty entries
+func parseList(str string) []string {
+	var ret []string
+
+	for _, item := range strings.Split(str, ",") {
+		trimmed := strings.TrimSpace(item)
+		if trimmed != "" {
+			ret = append(ret, trimmed)
+		}
+	}
+
+	return ret
+}
+
 func ConfigurationFromEnvironment() *Configuration {
 	nrEnabledStr, nrEnabledOverride := os.LookupEnv("NEW_RELIC_ENABLED")
 	nrEnabledRubyStr, nrEnabledRubyOverride := os.LookupEnv("NEW_RELIC_AGENT_ENABLED")
@@ -85,6 +214,13 @@ func ConfigurationFromEnvironment() *Configuration {
 	licenseKey, lkOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY")
 	licenseKeySecretId, lkSecretOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_SECRET")
 	licenseKeySSMParameterName, lkSSMParameterOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_SSM_PARAMETER_NAME")
+	licenseKeyKMSCiphertext, lkKMSOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_KMS")
+	licenseKeyFile, lkFileOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_FILE")
+	licenseKeyProvidersStr, lkProvidersOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_PROVIDERS")
+	licenseKeySecretJSONKey, lkSecretJSONKeyOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_SECRET_KEY")
+	licenseKeySecretVersionStage, lkSecretVersionStageOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_SECRET_VERSION_STAGE")
+	licenseKeySecretVersionId, lkSecretVersionIdOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_SECRET_VERSION_ID")
+	licenseKeySecretFormat, lkSecretFormatOverride := os.LookupEnv("NEW_RELIC_LICENSE_KEY_SECRET_FORMAT")
 	nrHandler, nrOverride := os.LookupEnv("NEW_RELIC_LAMBDA_HANDLER")
 	telemetryEndpoint, teOverride := os.LookupEnv("NEW_RELIC_TELEMETRY_ENDPOINT")
 	logEndpoint, leOverride := os.LookupEnv("NEW_RELIC_LOG_ENDPOINT")
@@ -92,6 +228,8 @@ func ConfigurationFromEnvironment() *Configuration {
 	ripeMillisStr, ripeMillisOverride := os.LookupEnv("NEW_RELIC_HARVEST_RIPE_MILLIS")
 	rotMillisStr, rotMillisOverride := os.LookupEnv("NEW_RELIC_HARVEST_ROT_MILLIS")
 	logLevelStr, logLevelOverride := os.LookupEnv("NEW_RELIC_EXTENSION_LOG_LEVEL")
+	logFormatStr, logFormatOverride := os.LookupEnv("NEW_RELIC_EXTENSION_LOG_FORMAT")
+	lambdaLogFormatStr, lambdaLogFormatOverride := os.LookupEnv("AWS_LAMBDA_LOG_FORMAT")
 	logsEnabledStr, logsEnabledOverride := os.LookupEnv("NEW_RELIC_EXTENSION_LOGS_ENABLED")
 	sendFunctionLogsStr, sendFunctionLogsOverride := os.LookupEnv("NEW_RELIC_EXTENSION_SEND_FUNCTION_LOGS")
 	sendExtensionLogsStr, sendExtensionLogsOverride := os.LookupEnv("NEW_RELIC_EXTENSION_SEND_EXTENSION_LOGS")
@@ -100,6 +238,49 @@ func ConfigurationFromEnvironment() *Configuration {
 	nrHostStr, nrHostOverride := os.LookupEnv("NEW_RELIC_HOST")
 	nrAPMModeStr, nrAPMModeOverride := os.LookupEnv("NEW_RELIC_APM_LAMBDA_MODE")
 	metricEndpoint, meOverride := os.LookupEnv("NEW_RELIC_METRIC_ENDPOINT")
+	eventEndpoint, eeOverride := os.LookupEnv("NEW_RELIC_EVENT_ENDPOINT")
+	accountIdStr, accountIdOverride := os.LookupEnv("NEW_RELIC_ACCOUNT_ID")
+	ingestAPIEnabledStr, ingestAPIEnabledOverride := os.LookupEnv("NEW_RELIC_INGEST_API_ENABLED")
+	ingestAPIPortStr, ingestAPIPortOverride := os.LookupEnv("NEW_RELIC_INGEST_API_PORT")
+	statsDEnabledStr, statsDEnabledOverride := os.LookupEnv("NEW_RELIC_STATSD_ENABLED")
+	statsDPortStr, statsDPortOverride := os.LookupEnv("NEW_RELIC_STATSD_PORT")
+	otlpReceiverEnabledStr, otlpReceiverEnabledOverride := os.LookupEnv("NEW_RELIC_OTLP_RECEIVER_ENABLED")
+	otlpReceiverPortStr, otlpReceiverPortOverride := os.LookupEnv("NEW_RELIC_OTLP_RECEIVER_PORT")
+	otlpEndpoint, otlpEndpointOverride := os.LookupEnv("NEW_RELIC_OTLP_ENDPOINT")
+	otlpExportEnabledStr, otlpExportEnabledOverride := os.LookupEnv("NEW_RELIC_OTLP_EXPORT_ENABLED")
+	exporterStr, exporterOverride := os.LookupEnv("NEW_RELIC_EXPORTER")
+	exporterFile, exporterFileOverride := os.LookupEnv("NEW_RELIC_EXPORTER_FILE")
+	logQueueSizeStr, logQueueSizeOverride := os.LookupEnv("NEW_RELIC_LOG_QUEUE_SIZE")
+	logQueuePolicyStr, logQueuePolicyOverride := os.LookupEnv("NEW_RELIC_LOG_QUEUE_POLICY")
+	logQueueTimeoutStr, logQueueTimeoutOverride := os.LookupEnv("NEW_RELIC_LOG_QUEUE_TIMEOUT")
+	diagnosticLogsEnabledStr, diagnosticLogsEnabledOverride := os.LookupEnv("NEW_RELIC_EXTENSION_DIAGNOSTIC_LOGS")
+	diagnosticLogsRateStr, diagnosticLogsRateOverride := os.LookupEnv("NEW_RELIC_EXTENSION_DIAGNOSTIC_LOGS_RATE")
+	logMetricRules, logMetricRulesOverride := os.LookupEnv("NEW_RELIC_LOG_METRIC_RULES")
+	logStitchingEnabledStr, logStitchingEnabledOverride := os.LookupEnv("NEW_RELIC_LOG_STITCHING_ENABLED")
+	logStitchingPattern, logStitchingPatternOverride := os.LookupEnv("NEW_RELIC_LOG_STITCHING_PATTERN")
+	logStitchingMaxSizeStr, logStitchingMaxSizeOverride := os.LookupEnv("NEW_RELIC_LOG_STITCHING_MAX_SIZE")
+	logStitchingTimeoutStr, logStitchingTimeoutOverride := os.LookupEnv("NEW_RELIC_LOG_STITCHING_TIMEOUT")
+	logSeverityEnabledStr, logSeverityEnabledOverride := os.LookupEnv("NEW_RELIC_LOG_SEVERITY_ENABLED")
+	logSamplingRatesStr, logSamplingRatesOverride := os.LookupEnv("NEW_RELIC_LOG_SAMPLING_RATES")
+	logDedupeEnabledStr, logDedupeEnabledOverride := os.LookupEnv("NEW_RELIC_LOG_DEDUPE_ENABLED")
+	logDedupeWindowStr, logDedupeWindowOverride := os.LookupEnv("NEW_RELIC_LOG_DEDUPE_WINDOW")
+	logBudgetLinesStr, logBudgetLinesOverride := os.LookupEnv("NEW_RELIC_LOG_BUDGET_LINES")
+	logBudgetBytesStr, logBudgetBytesOverride := os.LookupEnv("NEW_RELIC_LOG_BUDGET_BYTES")
+	emfEnabledStr, emfEnabledOverride := os.LookupEnv("NEW_RELIC_EMF_ENABLED")
+	emfForwardLogsStr, emfForwardLogsOverride := os.LookupEnv("NEW_RELIC_EMF_FORWARD_LOGS")
+	invocationEventsEnabledStr, invocationEventsEnabledOverride := os.LookupEnv("NEW_RELIC_INVOCATION_EVENTS_ENABLED")
+	headroomWarningsEnabledStr, headroomWarningsEnabledOverride := os.LookupEnv("NEW_RELIC_HEADROOM_WARNINGS_ENABLED")
+	memoryHeadroomThresholdStr, memoryHeadroomThresholdOverride := os.LookupEnv("NEW_RELIC_MEMORY_HEADROOM_THRESHOLD")
+	timeoutHeadroomThresholdStr, timeoutHeadroomThresholdOverride := os.LookupEnv("NEW_RELIC_TIMEOUT_HEADROOM_THRESHOLD")
+	headroomWarningIntervalStr, headroomWarningIntervalOverride := os.LookupEnv("NEW_RELIC_HEADROOM_WARNING_INTERVAL")
+	costMetricsEnabledStr, costMetricsEnabledOverride := os.LookupEnv("NEW_RELIC_COST_METRICS_ENABLED")
+	costPricing, costPricingOverride := os.LookupEnv("NEW_RELIC_COST_PRICING")
+	resourceSamplerEnabledStr, resourceSamplerEnabledOverride := os.LookupEnv("NEW_RELIC_RESOURCE_SAMPLER_ENABLED")
+	resourceSamplerIntervalStr, resourceSamplerIntervalOverride := os.LookupEnv("NEW_RELIC_RESOURCE_SAMPLER_INTERVAL")
+	overheadMetricsEnabledStr, overheadMetricsEnabledOverride := os.LookupEnv("NEW_RELIC_OVERHEAD_METRICS_ENABLED")
+	platformSpansEnabledStr, platformSpansEnabledOverride := os.LookupEnv("NEW_RELIC_PLATFORM_SPANS_ENABLED")
+	traceEndpoint, traceEndpointOverride := os.LookupEnv("NEW_RELIC_TRACE_ENDPOINT")
+	sandboxEventsEnabledStr, sandboxEventsEnabledOverride := os.LookupEnv("NEW_RELIC_SANDBOX_EVENTS_ENABLED")
 
 
 	extensionEnabled := true
@@ -146,6 +327,34 @@ func ConfigurationFromEnvironment() *Configuration {
 		ret.LicenseKeySSMParameterName = licenseKeySSMParameterName
 	}
 
+	if lkKMSOverride {
+		ret.LicenseKeyKMSCiphertext = licenseKeyKMSCiphertext
+	}
+
+	if lkFileOverride {
+		ret.LicenseKeyFile = licenseKeyFile
+	}
+
+	if lkProvidersOverride {
+		ret.LicenseKeyProviders = parseList(licenseKeyProvidersStr)
+	}
+
+	if lkSecretJSONKeyOverride {
+		ret.LicenseKeySecretJSONKey = licenseKeySecretJSONKey
+	}
+
+	if lkSecretVersionStageOverride {
+		ret.LicenseKeySecretVersionStage = licenseKeySecretVersionStage
+	}
+
+	if lkSecretVersionIdOverride {
+		ret.LicenseKeySecretVersionId = licenseKeySecretVersionId
+	}
+
+	if lkSecretFormatOverride && strings.ToLower(strings.TrimSpace(licenseKeySecretFormat)) == SecretFormatPlain {
+		ret.LicenseKeySecretFormat = SecretFormatPlain
+	}
+
 	ret.IgnoreExtensionChecks = parseIgnoredExtensionChecks(nrIgnoreExtensionChecksOverride, nrIgnoreExtensionChecksStr)
 
 	if nrOverride {
@@ -166,6 +375,257 @@ func ConfigurationFromEnvironment() *Configuration {
 		ret.LogEndpoint = logEndpoint
 	}
 
+	if eeOverride {
+		ret.EventEndpoint = eventEndpoint
+	}
+
+	if accountIdOverride {
+		ret.AccountID = strings.TrimSpace(accountIdStr)
+	}
+
+	if ingestAPIEnabledOverride && strings.ToLower(ingestAPIEnabledStr) == "true" {
+		ret.IngestAPIEnabled = true
+	}
+
+	if ingestAPIPortOverride {
+		ingestAPIPort, err := strconv.ParseUint(ingestAPIPortStr, 10, 16)
+		if err == nil {
+			ret.IngestAPIPort = uint16(ingestAPIPort)
+		}
+	}
+
+	if ret.IngestAPIPort == 0 {
+		ret.IngestAPIPort = DefaultIngestAPIPort
+	}
+
+	if statsDEnabledOverride && strings.ToLower(statsDEnabledStr) == "true" {
+		ret.StatsDEnabled = true
+	}
+
+	if statsDPortOverride {
+		statsDPort, err := strconv.ParseUint(statsDPortStr, 10, 16)
+		if err == nil {
+			ret.StatsDPort = uint16(statsDPort)
+		}
+	}
+
+	if ret.StatsDPort == 0 {
+		ret.StatsDPort = DefaultStatsDPort
+	}
+
+	if otlpReceiverEnabledOverride && strings.ToLower(otlpReceiverEnabledStr) == "true" {
+		ret.OTLPReceiverEnabled = true
+	}
+
+	if otlpReceiverPortOverride {
+		otlpReceiverPort, err := strconv.ParseUint(otlpReceiverPortStr, 10, 16)
+		if err == nil {
+			ret.OTLPReceiverPort = uint16(otlpReceiverPort)
+		}
+	}
+
+	if ret.OTLPReceiverPort == 0 {
+		ret.OTLPReceiverPort = DefaultOTLPPort
+	}
+
+	if otlpEndpointOverride {
+		ret.OTLPEndpoint = otlpEndpoint
+	}
+
+	if exporterOverride {
+		ret.Exporter = strings.ToLower(strings.TrimSpace(exporterStr))
+	} else if otlpExportEnabledOverride && strings.ToLower(otlpExportEnabledStr) == "true" {
+		ret.Exporter = ExporterOTLP
+	}
+
+	if exporterFileOverride {
+		ret.ExporterFile = exporterFile
+	} else if ret.Exporter == ExporterFile {
+		ret.ExporterFile = DefaultExporterFile
+	}
+
+	if logQueueSizeOverride {
+		logQueueSize, err := strconv.ParseUint(logQueueSizeStr, 10, 32)
+		if err == nil {
+			ret.LogQueueSize = uint32(logQueueSize)
+		}
+	}
+
+	if ret.LogQueueSize == 0 {
+		ret.LogQueueSize = DefaultLogQueueSize
+	}
+
+	ret.LogQueuePolicy = LogQueueDropOldest
+	if logQueuePolicyOverride {
+		switch policy := strings.ToLower(strings.TrimSpace(logQueuePolicyStr)); policy {
+		case LogQueueDropOldest, LogQueueDropNewest, LogQueueBlock:
+			ret.LogQueuePolicy = policy
+		}
+	}
+
+	ret.LogQueueTimeout = DefaultLogQueueTimeout
+	if logQueueTimeoutOverride && logQueueTimeoutStr != "" {
+		logQueueTimeout, err := time.ParseDuration(logQueueTimeoutStr)
+		if err == nil && logQueueTimeout > 0 {
+			ret.LogQueueTimeout = logQueueTimeout
+		}
+	}
+
+	if diagnosticLogsEnabledOverride && strings.ToLower(diagnosticLogsEnabledStr) == "true" {
+		ret.DiagnosticLogsEnabled = true
+	}
+
+	if diagnosticLogsRateOverride {
+		diagnosticLogsRate, err := strconv.ParseUint(diagnosticLogsRateStr, 10, 32)
+		if err == nil {
+			ret.DiagnosticLogsRate = uint32(diagnosticLogsRate)
+		}
+	}
+
+	if ret.DiagnosticLogsRate == 0 {
+		ret.DiagnosticLogsRate = DefaultDiagnosticsRate
+	}
+
+	if logMetricRulesOverride {
+		ret.LogMetricRules = strings.TrimSpace(logMetricRules)
+	}
+
+	if logStitchingEnabledOverride && strings.ToLower(logStitchingEnabledStr) == "true" {
+		ret.LogStitchingEnabled = true
+	}
+
+	if logStitchingPatternOverride {
+		ret.LogStitchingPattern = logStitchingPattern
+	}
+
+	if logStitchingMaxSizeOverride {
+		logStitchingMaxSize, err := strconv.ParseUint(logStitchingMaxSizeStr, 10, 32)
+		if err == nil {
+			ret.LogStitchingMaxSize = uint32(logStitchingMaxSize)
+		}
+	}
+
+	if ret.LogStitchingMaxSize == 0 {
+		ret.LogStitchingMaxSize = DefaultLogStitchingMaxSize
+	}
+
+	ret.LogStitchingTimeout = DefaultLogStitchingTimeout
+	if logStitchingTimeoutOverride && logStitchingTimeoutStr != "" {
+		logStitchingTimeout, err := time.ParseDuration(logStitchingTimeoutStr)
+		if err == nil && logStitchingTimeout > 0 {
+			ret.LogStitchingTimeout = logStitchingTimeout
+		}
+	}
+
+	if logSeverityEnabledOverride && strings.ToLower(logSeverityEnabledStr) == "true" {
+		ret.LogSeverityEnabled = true
+	}
+
+	if logSamplingRatesOverride {
+		ret.LogSamplingRates = parseLogSamplingRates(logSamplingRatesStr)
+	}
+
+	if logDedupeEnabledOverride && strings.ToLower(logDedupeEnabledStr) == "true" {
+		ret.LogDedupeEnabled = true
+	}
+
+	ret.LogDedupeWindow = DefaultLogDedupeWindow
+	if logDedupeWindowOverride && logDedupeWindowStr != "" {
+		logDedupeWindow, err := time.ParseDuration(logDedupeWindowStr)
+		if err == nil && logDedupeWindow > 0 {
+			ret.LogDedupeWindow = logDedupeWindow
+		}
+	}
+
+	if logBudgetLinesOverride {
+		logBudgetLines, err := strconv.ParseUint(logBudgetLinesStr, 10, 32)
+		if err == nil {
+			ret.LogBudgetLines = uint32(logBudgetLines)
+		}
+	}
+
+	if logBudgetBytesOverride {
+		logBudgetBytes, err := strconv.ParseUint(logBudgetBytesStr, 10, 32)
+		if err == nil {
+			ret.LogBudgetBytes = uint32(logBudgetBytes)
+		}
+	}
+
+	if emfEnabledOverride && strings.ToLower(emfEnabledStr) == "true" {
+		ret.EMFEnabled = true
+	}
+
+	ret.EMFForwardLogs = true
+	if emfForwardLogsOverride && strings.ToLower(emfForwardLogsStr) == "false" {
+		ret.EMFForwardLogs = false
+	}
+
+	if invocationEventsEnabledOverride && strings.ToLower(invocationEventsEnabledStr) == "true" {
+		ret.InvocationEventsEnabled = true
+	}
+
+	if headroomWarningsEnabledOverride && strings.ToLower(headroomWarningsEnabledStr) == "true" {
+		ret.HeadroomWarningsEnabled = true
+	}
+
+	ret.MemoryHeadroomThreshold = DefaultMemoryHeadroomThreshold
+	if memoryHeadroomThresholdOverride {
+		if threshold, ok := parseFraction(memoryHeadroomThresholdStr); ok {
+			ret.MemoryHeadroomThreshold = threshold
+		}
+	}
+
+	ret.TimeoutHeadroomThreshold = DefaultTimeoutHeadroomThreshold
+	if timeoutHeadroomThresholdOverride {
+		if threshold, ok := parseFraction(timeoutHeadroomThresholdStr); ok {
+			ret.TimeoutHeadroomThreshold = threshold
+		}
+	}
+
+	ret.HeadroomWarningInterval = DefaultHeadroomWarningInterval
+	if headroomWarningIntervalOverride && headroomWarningIntervalStr != "" {
+		headroomWarningInterval, err := time.ParseDuration(headroomWarningIntervalStr)
+		if err == nil && headroomWarningInterval > 0 {
+			ret.HeadroomWarningInterval = headroomWarningInterval
+		}
+	}
+
+	if costMetricsEnabledOverride && strings.ToLower(costMetricsEnabledStr) == "true" {
+		ret.CostMetricsEnabled = true
+	}
+
+	if costPricingOverride {
+		ret.CostPricing = strings.TrimSpace(costPricing)
+	}
+
+	if resourceSamplerEnabledOverride && strings.ToLower(resourceSamplerEnabledStr) == "true" {
+		ret.ResourceSamplerEnabled = true
+	}
+
+	ret.ResourceSamplerInterval = DefaultResourceSamplerInterval
+	if resourceSamplerIntervalOverride && resourceSamplerIntervalStr != "" {
+		resourceSamplerInterval, err := time.ParseDuration(resourceSamplerIntervalStr)
+		if err == nil && resourceSamplerInterval > 0 {
+			ret.ResourceSamplerInterval = resourceSamplerInterval
+		}
+	}
+
+	if overheadMetricsEnabledOverride && strings.ToLower(overheadMetricsEnabledStr) == "true" {
+		ret.OverheadMetricsEnabled = true
+	}
+
+	if platformSpansEnabledOverride && strings.ToLower(platformSpansEnabledStr) == "true" {
+		ret.PlatformSpansEnabled = true
+	}
+
+	if traceEndpointOverride {
+		ret.TraceEndpoint = traceEndpoint
+	}
+
+	if sandboxEventsEnabledOverride && strings.ToLower(sandboxEventsEnabledStr) == "true" {
+		ret.SandboxEventsEnabled = true
+	}
+
 	if ripeMillisOverride {
 		ripeMillis, err := strconv.ParseUint(ripeMillisStr, 10, 32)
 		if err == nil {
@@ -194,6 +654,10 @@ func ConfigurationFromEnvironment() *Configuration {
 			ret.LogLevel = DebugLogLevel
 		case InfoLogLevel:
 			ret.LogLevel = InfoLogLevel
+		case WarnLogLevel, "WARNING":
+			ret.LogLevel = WarnLogLevel
+		case ErrorLogLevel:
+			ret.LogLevel = ErrorLogLevel
 		default:
 			ret.LogLevel = DefaultLogLevel
 		}
@@ -201,6 +665,16 @@ func ConfigurationFromEnvironment() *Configuration {
 		ret.LogLevel = DefaultLogLevel
 	}
 
+	// JSON lines when asked for, or when the function uses Lambda's JSON log format
+	ret.LogFormat = LogFormatText
+	if logFormatOverride && logFormatStr != "" {
+		if strings.ToLower(strings.TrimSpace(logFormatStr)) == LogFormatJSON {
+			ret.LogFormat = LogFormatJSON
+		}
+	} else if lambdaLogFormatOverride && strings.ToLower(lambdaLogFormatStr) == LogFormatJSON {
+		ret.LogFormat = LogFormatJSON
+	}
+
 	if logServerHostOverride {
 		ret.LogServerHost = logServerHostStr
 	} else {
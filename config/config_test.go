@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -14,10 +15,28 @@ func TestConfigurationFromEnvironmentZero(t *testing.T) {
 		RipeMillis:       DefaultRipeMillis,
 		RotMillis:        DefaultRotMillis,
 		LogLevel:         DefaultLogLevel,
+		LogFormat:        LogFormatText,
 		LogsEnabled:      true,
 		NRHandler:        EmptyNRWrapper,
 		LogServerHost:    defaultLogServerHost,
 		ClientTimeout:    DefaultClientTimeout,
+		IngestAPIPort:    DefaultIngestAPIPort,
+		StatsDPort:       DefaultStatsDPort,
+		OTLPReceiverPort: DefaultOTLPPort,
+		LogQueueSize:     DefaultLogQueueSize,
+		LogQueuePolicy:   LogQueueDropOldest,
+		LogQueueTimeout:  DefaultLogQueueTimeout,
+
+		DiagnosticLogsRate:  DefaultDiagnosticsRate,
+		LogStitchingMaxSize: DefaultLogStitchingMaxSize,
+		LogStitchingTimeout: DefaultLogStitchingTimeout,
+		LogDedupeWindow:     DefaultLogDedupeWindow,
+		EMFForwardLogs:      true,
+
+		MemoryHeadroomThreshold:  DefaultMemoryHeadroomThreshold,
+		TimeoutHeadroomThreshold: DefaultTimeoutHeadroomThreshold,
+		HeadroomWarningInterval:  DefaultHeadroomWarningInterval,
+		ResourceSamplerInterval:  DefaultResourceSamplerInterval,
 	}
 	assert.Equal(t, expected, conf)
 }
@@ -169,6 +188,341 @@ func TestConfigurationFromEnvironmentParameterName(t *testing.T) {
 	assert.Equal(t, "parameterName", conf.LicenseKeySSMParameterName)
 }
 
+func TestConfigurationFromEnvironmentLicenseKeyProviders(t *testing.T) {
+	os.Setenv("NEW_RELIC_LICENSE_KEY_KMS", "Y2lwaGVydGV4dA==")
+	os.Setenv("NEW_RELIC_LICENSE_KEY_FILE", "/opt/newrelic/license_key")
+	os.Setenv("NEW_RELIC_LICENSE_KEY_PROVIDERS", "file, ssm,,secret")
+	os.Setenv("NEW_RELIC_LICENSE_KEY_SECRET_KEY", "nrLicenseKey")
+	os.Setenv("NEW_RELIC_LICENSE_KEY_SECRET_VERSION_STAGE", "AWSPENDING")
+	os.Setenv("NEW_RELIC_LICENSE_KEY_SECRET_VERSION_ID", "a1b2c3")
+	os.Setenv("NEW_RELIC_LICENSE_KEY_SECRET_FORMAT", "Plain")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_LICENSE_KEY_KMS")
+		os.Unsetenv("NEW_RELIC_LICENSE_KEY_FILE")
+		os.Unsetenv("NEW_RELIC_LICENSE_KEY_PROVIDERS")
+		os.Unsetenv("NEW_RELIC_LICENSE_KEY_SECRET_KEY")
+		os.Unsetenv("NEW_RELIC_LICENSE_KEY_SECRET_VERSION_STAGE")
+		os.Unsetenv("NEW_RELIC_LICENSE_KEY_SECRET_VERSION_ID")
+		os.Unsetenv("NEW_RELIC_LICENSE_KEY_SECRET_FORMAT")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.Equal(t, "Y2lwaGVydGV4dA==", conf.LicenseKeyKMSCiphertext)
+	assert.Equal(t, "/opt/newrelic/license_key", conf.LicenseKeyFile)
+	assert.Equal(t, []string{"file", "ssm", "secret"}, conf.LicenseKeyProviders)
+	assert.Equal(t, "nrLicenseKey", conf.LicenseKeySecretJSONKey)
+	assert.Equal(t, "AWSPENDING", conf.LicenseKeySecretVersionStage)
+	assert.Equal(t, "a1b2c3", conf.LicenseKeySecretVersionId)
+	assert.Equal(t, SecretFormatPlain, conf.LicenseKeySecretFormat)
+}
+
+func TestConfigurationFromEnvironmentLicenseKeySecretFormat(t *testing.T) {
+	os.Setenv("NEW_RELIC_LICENSE_KEY_SECRET_FORMAT", "json")
+	defer os.Unsetenv("NEW_RELIC_LICENSE_KEY_SECRET_FORMAT")
+
+	conf := ConfigurationFromEnvironment()
+	assert.Empty(t, conf.LicenseKeySecretFormat)
+
+	os.Setenv("NEW_RELIC_LICENSE_KEY_SECRET_FORMAT", " PLAIN ")
+	conf = ConfigurationFromEnvironment()
+	assert.Equal(t, SecretFormatPlain, conf.LicenseKeySecretFormat)
+}
+
+func TestConfigurationFromEnvironmentIngestAPI(t *testing.T) {
+	os.Setenv("NEW_RELIC_INGEST_API_ENABLED", "true")
+	os.Setenv("NEW_RELIC_INGEST_API_PORT", "9000")
+	os.Setenv("NEW_RELIC_ACCOUNT_ID", " 12345 ")
+	os.Setenv("NEW_RELIC_EVENT_ENDPOINT", "endpoint")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_INGEST_API_ENABLED")
+		os.Unsetenv("NEW_RELIC_INGEST_API_PORT")
+		os.Unsetenv("NEW_RELIC_ACCOUNT_ID")
+		os.Unsetenv("NEW_RELIC_EVENT_ENDPOINT")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.IngestAPIEnabled)
+	assert.Equal(t, uint16(9000), conf.IngestAPIPort)
+	assert.Equal(t, "12345", conf.AccountID)
+	assert.Equal(t, "endpoint", conf.EventEndpoint)
+
+	os.Setenv("NEW_RELIC_INGEST_API_PORT", "not-a-port")
+	conf = ConfigurationFromEnvironment()
+	assert.Equal(t, uint16(DefaultIngestAPIPort), conf.IngestAPIPort)
+}
+
+func TestConfigurationFromEnvironmentStatsD(t *testing.T) {
+	os.Setenv("NEW_RELIC_STATSD_ENABLED", "true")
+	os.Setenv("NEW_RELIC_STATSD_PORT", "9125")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_STATSD_ENABLED")
+		os.Unsetenv("NEW_RELIC_STATSD_PORT")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.StatsDEnabled)
+	assert.Equal(t, uint16(9125), conf.StatsDPort)
+}
+
+func TestConfigurationFromEnvironmentOTLP(t *testing.T) {
+	os.Setenv("NEW_RELIC_OTLP_RECEIVER_ENABLED", "true")
+	os.Setenv("NEW_RELIC_OTLP_RECEIVER_PORT", "14318")
+	os.Setenv("NEW_RELIC_OTLP_ENDPOINT", "https://otlp.example.com")
+	os.Setenv("NEW_RELIC_OTLP_EXPORT_ENABLED", "TRUE")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_OTLP_RECEIVER_ENABLED")
+		os.Unsetenv("NEW_RELIC_OTLP_RECEIVER_PORT")
+		os.Unsetenv("NEW_RELIC_OTLP_ENDPOINT")
+		os.Unsetenv("NEW_RELIC_OTLP_EXPORT_ENABLED")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.OTLPReceiverEnabled)
+	assert.Equal(t, uint16(14318), conf.OTLPReceiverPort)
+	assert.Equal(t, "https://otlp.example.com", conf.OTLPEndpoint)
+	assert.Equal(t, ExporterOTLP, conf.Exporter)
+}
+
+func TestConfigurationFromEnvironmentExporter(t *testing.T) {
+	os.Setenv("NEW_RELIC_EXPORTER", " File")
+	defer os.Unsetenv("NEW_RELIC_EXPORTER")
+
+	conf := ConfigurationFromEnvironment()
+	assert.Equal(t, ExporterFile, conf.Exporter)
+	assert.Equal(t, DefaultExporterFile, conf.ExporterFile)
+
+	os.Setenv("NEW_RELIC_EXPORTER_FILE", "/tmp/export.jsonl")
+	defer os.Unsetenv("NEW_RELIC_EXPORTER_FILE")
+
+	conf = ConfigurationFromEnvironment()
+	assert.Equal(t, "/tmp/export.jsonl", conf.ExporterFile)
+}
+
+func TestConfigurationFromEnvironmentLogQueue(t *testing.T) {
+	os.Setenv("NEW_RELIC_LOG_QUEUE_SIZE", "10")
+	os.Setenv("NEW_RELIC_LOG_QUEUE_POLICY", "Block")
+	os.Setenv("NEW_RELIC_LOG_QUEUE_TIMEOUT", "2s")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_LOG_QUEUE_SIZE")
+		os.Unsetenv("NEW_RELIC_LOG_QUEUE_POLICY")
+		os.Unsetenv("NEW_RELIC_LOG_QUEUE_TIMEOUT")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.Equal(t, uint32(10), conf.LogQueueSize)
+	assert.Equal(t, LogQueueBlock, conf.LogQueuePolicy)
+	assert.Equal(t, 2*time.Second, conf.LogQueueTimeout)
+
+	os.Setenv("NEW_RELIC_LOG_QUEUE_POLICY", "drop_everything")
+	os.Setenv("NEW_RELIC_LOG_QUEUE_TIMEOUT", "-1s")
+
+	conf = ConfigurationFromEnvironment()
+	assert.Equal(t, LogQueueDropOldest, conf.LogQueuePolicy)
+	assert.Equal(t, DefaultLogQueueTimeout, conf.LogQueueTimeout)
+}
+
+func TestConfigurationFromEnvironmentDiagnosticLogs(t *testing.T) {
+	os.Setenv("NEW_RELIC_EXTENSION_DIAGNOSTIC_LOGS", "true")
+	os.Setenv("NEW_RELIC_EXTENSION_DIAGNOSTIC_LOGS_RATE", "5")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_EXTENSION_DIAGNOSTIC_LOGS")
+		os.Unsetenv("NEW_RELIC_EXTENSION_DIAGNOSTIC_LOGS_RATE")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.DiagnosticLogsEnabled)
+	assert.Equal(t, uint32(5), conf.DiagnosticLogsRate)
+}
+
+func TestConfigurationFromEnvironmentLogMetricRules(t *testing.T) {
+	os.Setenv("NEW_RELIC_LOG_METRIC_RULES", ` [{"name": "errors", "pattern": "ERROR"}] `)
+	defer os.Unsetenv("NEW_RELIC_LOG_METRIC_RULES")
+
+	conf := ConfigurationFromEnvironment()
+	assert.Equal(t, `[{"name": "errors", "pattern": "ERROR"}]`, conf.LogMetricRules)
+}
+
+func TestConfigurationFromEnvironmentLogStitching(t *testing.T) {
+	os.Setenv("NEW_RELIC_LOG_STITCHING_ENABLED", "true")
+	os.Setenv("NEW_RELIC_LOG_STITCHING_PATTERN", `^\[`)
+	os.Setenv("NEW_RELIC_LOG_STITCHING_MAX_SIZE", "1024")
+	os.Setenv("NEW_RELIC_LOG_STITCHING_TIMEOUT", "250ms")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_LOG_STITCHING_ENABLED")
+		os.Unsetenv("NEW_RELIC_LOG_STITCHING_PATTERN")
+		os.Unsetenv("NEW_RELIC_LOG_STITCHING_MAX_SIZE")
+		os.Unsetenv("NEW_RELIC_LOG_STITCHING_TIMEOUT")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.LogStitchingEnabled)
+	assert.Equal(t, `^\[`, conf.LogStitchingPattern)
+	assert.Equal(t, uint32(1024), conf.LogStitchingMaxSize)
+	assert.Equal(t, 250*time.Millisecond, conf.LogStitchingTimeout)
+
+	os.Setenv("NEW_RELIC_LOG_STITCHING_TIMEOUT", "soon")
+
+	conf = ConfigurationFromEnvironment()
+	assert.Equal(t, DefaultLogStitchingTimeout, conf.LogStitchingTimeout)
+}
+
+func TestConfigurationFromEnvironmentLogSeverity(t *testing.T) {
+	os.Setenv("NEW_RELIC_LOG_SEVERITY_ENABLED", "true")
+	os.Setenv("NEW_RELIC_LOG_SAMPLING_RATES", "debug=0.1, INFO = 0.5,WARN=2,ERROR,TRACE=none")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_LOG_SEVERITY_ENABLED")
+		os.Unsetenv("NEW_RELIC_LOG_SAMPLING_RATES")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.LogSeverityEnabled)
+	assert.Equal(t, map[string]float64{"DEBUG": 0.1, "INFO": 0.5}, conf.LogSamplingRates)
+
+	os.Setenv("NEW_RELIC_LOG_SAMPLING_RATES", "")
+
+	conf = ConfigurationFromEnvironment()
+	assert.Nil(t, conf.LogSamplingRates)
+}
+
+func TestConfigurationFromEnvironmentLogDedupe(t *testing.T) {
+	os.Setenv("NEW_RELIC_LOG_DEDUPE_ENABLED", "true")
+	os.Setenv("NEW_RELIC_LOG_DEDUPE_WINDOW", "5s")
+	os.Setenv("NEW_RELIC_LOG_BUDGET_LINES", "1000")
+	os.Setenv("NEW_RELIC_LOG_BUDGET_BYTES", "65536")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_LOG_DEDUPE_ENABLED")
+		os.Unsetenv("NEW_RELIC_LOG_DEDUPE_WINDOW")
+		os.Unsetenv("NEW_RELIC_LOG_BUDGET_LINES")
+		os.Unsetenv("NEW_RELIC_LOG_BUDGET_BYTES")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.LogDedupeEnabled)
+	assert.Equal(t, 5*time.Second, conf.LogDedupeWindow)
+	assert.Equal(t, uint32(1000), conf.LogBudgetLines)
+	assert.Equal(t, uint32(65536), conf.LogBudgetBytes)
+}
+
+func TestConfigurationFromEnvironmentEMF(t *testing.T) {
+	os.Setenv("NEW_RELIC_EMF_ENABLED", "true")
+	os.Setenv("NEW_RELIC_EMF_FORWARD_LOGS", "false")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_EMF_ENABLED")
+		os.Unsetenv("NEW_RELIC_EMF_FORWARD_LOGS")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.EMFEnabled)
+	assert.False(t, conf.EMFForwardLogs)
+}
+
+func TestConfigurationFromEnvironmentInvocationEvents(t *testing.T) {
+	os.Setenv("NEW_RELIC_INVOCATION_EVENTS_ENABLED", "TRUE")
+	defer os.Unsetenv("NEW_RELIC_INVOCATION_EVENTS_ENABLED")
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.InvocationEventsEnabled)
+}
+
+func TestConfigurationFromEnvironmentHeadroomWarnings(t *testing.T) {
+	os.Setenv("NEW_RELIC_HEADROOM_WARNINGS_ENABLED", "true")
+	os.Setenv("NEW_RELIC_MEMORY_HEADROOM_THRESHOLD", "0.25")
+	os.Setenv("NEW_RELIC_TIMEOUT_HEADROOM_THRESHOLD", "1.5")
+	os.Setenv("NEW_RELIC_HEADROOM_WARNING_INTERVAL", "1m")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_HEADROOM_WARNINGS_ENABLED")
+		os.Unsetenv("NEW_RELIC_MEMORY_HEADROOM_THRESHOLD")
+		os.Unsetenv("NEW_RELIC_TIMEOUT_HEADROOM_THRESHOLD")
+		os.Unsetenv("NEW_RELIC_HEADROOM_WARNING_INTERVAL")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.HeadroomWarningsEnabled)
+	assert.Equal(t, 0.25, conf.MemoryHeadroomThreshold)
+	// Out of range
+	assert.Equal(t, DefaultTimeoutHeadroomThreshold, conf.TimeoutHeadroomThreshold)
+	assert.Equal(t, time.Minute, conf.HeadroomWarningInterval)
+}
+
+func TestConfigurationFromEnvironmentCostMetrics(t *testing.T) {
+	os.Setenv("NEW_RELIC_COST_METRICS_ENABLED", "true")
+	os.Setenv("NEW_RELIC_COST_PRICING", ` {"default": {"arm64": {"gbSecond": 0.00001}}} `)
+	defer func() {
+		os.Unsetenv("NEW_RELIC_COST_METRICS_ENABLED")
+		os.Unsetenv("NEW_RELIC_COST_PRICING")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.CostMetricsEnabled)
+	assert.Equal(t, `{"default": {"arm64": {"gbSecond": 0.00001}}}`, conf.CostPricing)
+}
+
+func TestConfigurationFromEnvironmentResourceSampler(t *testing.T) {
+	os.Setenv("NEW_RELIC_RESOURCE_SAMPLER_ENABLED", "true")
+	os.Setenv("NEW_RELIC_RESOURCE_SAMPLER_INTERVAL", "250ms")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_RESOURCE_SAMPLER_ENABLED")
+		os.Unsetenv("NEW_RELIC_RESOURCE_SAMPLER_INTERVAL")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.ResourceSamplerEnabled)
+	assert.Equal(t, 250*time.Millisecond, conf.ResourceSamplerInterval)
+
+	os.Setenv("NEW_RELIC_RESOURCE_SAMPLER_INTERVAL", "-1s")
+	conf = ConfigurationFromEnvironment()
+	assert.Equal(t, DefaultResourceSamplerInterval, conf.ResourceSamplerInterval)
+}
+
+func TestConfigurationFromEnvironmentOverheadMetrics(t *testing.T) {
+	os.Setenv("NEW_RELIC_OVERHEAD_METRICS_ENABLED", "true")
+	defer os.Unsetenv("NEW_RELIC_OVERHEAD_METRICS_ENABLED")
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.OverheadMetricsEnabled)
+}
+
+func TestConfigurationFromEnvironmentPlatformSpans(t *testing.T) {
+	os.Setenv("NEW_RELIC_PLATFORM_SPANS_ENABLED", "true")
+	os.Setenv("NEW_RELIC_TRACE_ENDPOINT", "endpoint")
+	defer func() {
+		os.Unsetenv("NEW_RELIC_PLATFORM_SPANS_ENABLED")
+		os.Unsetenv("NEW_RELIC_TRACE_ENDPOINT")
+	}()
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.PlatformSpansEnabled)
+	assert.Equal(t, "endpoint", conf.TraceEndpoint)
+}
+
+func TestConfigurationFromEnvironmentSandboxEvents(t *testing.T) {
+	os.Setenv("NEW_RELIC_SANDBOX_EVENTS_ENABLED", "true")
+	defer os.Unsetenv("NEW_RELIC_SANDBOX_EVENTS_ENABLED")
+
+	conf := ConfigurationFromEnvironment()
+	assert.True(t, conf.SandboxEventsEnabled)
+}
+
+func TestConfigurationFromEnvironmentLogFormat(t *testing.T) {
+	os.Setenv("AWS_LAMBDA_LOG_FORMAT", "JSON")
+	defer os.Unsetenv("AWS_LAMBDA_LOG_FORMAT")
+
+	conf := ConfigurationFromEnvironment()
+	assert.Equal(t, LogFormatJSON, conf.LogFormat)
+
+	os.Setenv("NEW_RELIC_EXTENSION_LOG_FORMAT", "text")
+	defer os.Unsetenv("NEW_RELIC_EXTENSION_LOG_FORMAT")
+
+	conf = ConfigurationFromEnvironment()
+	assert.Equal(t, LogFormatText, conf.LogFormat)
+
+	os.Unsetenv("AWS_LAMBDA_LOG_FORMAT")
+	os.Setenv("NEW_RELIC_EXTENSION_LOG_FORMAT", "JSON")
+
+	conf = ConfigurationFromEnvironment()
+	assert.Equal(t, LogFormatJSON, conf.LogFormat)
+}
+
 func TestConfigurationFromEnvironmentLogServerHost(t *testing.T) {
 	os.Setenv("NEW_RELIC_LOG_SERVER_HOST", "foobar")
 	defer os.Unsetenv("NEW_RELIC_LOG_SERVER_HOST")
@@ -187,9 +541,10 @@ func TestLogLevelConfiguration(t *testing.T) {
         {"DEBUG", DebugLogLevel},
         {"info", InfoLogLevel},
         {"INFO", InfoLogLevel},
-        {"error", DefaultLogLevel},
-        {"ERROR", DefaultLogLevel},
-        {"warn", DefaultLogLevel},
+        {"error", ErrorLogLevel},
+        {"ERROR", ErrorLogLevel},
+        {"warn", WarnLogLevel},
+        {"warning", WarnLogLevel},
         {"invalid", DefaultLogLevel},
     }
 
@@ -263,6 +618,13 @@ func clearEnvVars() {
         "NEW_RELIC_LICENSE_KEY",
         "NEW_RELIC_LICENSE_KEY_SECRET",
         "NEW_RELIC_LICENSE_KEY_SSM_PARAMETER_NAME",
+        "NEW_RELIC_LICENSE_KEY_KMS",
+        "NEW_RELIC_LICENSE_KEY_FILE",
+        "NEW_RELIC_LICENSE_KEY_PROVIDERS",
+        "NEW_RELIC_LICENSE_KEY_SECRET_KEY",
+        "NEW_RELIC_LICENSE_KEY_SECRET_VERSION_STAGE",
+        "NEW_RELIC_LICENSE_KEY_SECRET_VERSION_ID",
+        "NEW_RELIC_LICENSE_KEY_SECRET_FORMAT",
         "NEW_RELIC_LAMBDA_HANDLER",
         "NEW_RELIC_TELEMETRY_ENDPOINT",
         "NEW_RELIC_LOG_ENDPOINT",
@@ -278,6 +640,51 @@ func clearEnvVars() {
         "NEW_RELIC_COLLECT_TRACE_ID",
         "NEW_RELIC_HOST",
         "NEW_RELIC_APM_LAMBDA_MODE",
+        "NEW_RELIC_EVENT_ENDPOINT",
+        "NEW_RELIC_ACCOUNT_ID",
+        "NEW_RELIC_INGEST_API_ENABLED",
+        "NEW_RELIC_INGEST_API_PORT",
+        "NEW_RELIC_STATSD_ENABLED",
+        "NEW_RELIC_STATSD_PORT",
+        "NEW_RELIC_OTLP_RECEIVER_ENABLED",
+        "NEW_RELIC_OTLP_RECEIVER_PORT",
+        "NEW_RELIC_OTLP_ENDPOINT",
+        "NEW_RELIC_OTLP_EXPORT_ENABLED",
+        "NEW_RELIC_EXPORTER",
+        "NEW_RELIC_EXPORTER_FILE",
+        "NEW_RELIC_LOG_QUEUE_SIZE",
+        "NEW_RELIC_LOG_QUEUE_POLICY",
+        "NEW_RELIC_LOG_QUEUE_TIMEOUT",
+        "NEW_RELIC_EXTENSION_DIAGNOSTIC_LOGS",
+        "NEW_RELIC_EXTENSION_DIAGNOSTIC_LOGS_RATE",
+        "NEW_RELIC_LOG_METRIC_RULES",
+        "NEW_RELIC_LOG_STITCHING_ENABLED",
+        "NEW_RELIC_LOG_STITCHING_PATTERN",
+        "NEW_RELIC_LOG_STITCHING_MAX_SIZE",
+        "NEW_RELIC_LOG_STITCHING_TIMEOUT",
+        "NEW_RELIC_LOG_SEVERITY_ENABLED",
+        "NEW_RELIC_LOG_SAMPLING_RATES",
+        "NEW_RELIC_LOG_DEDUPE_ENABLED",
+        "NEW_RELIC_LOG_DEDUPE_WINDOW",
+        "NEW_RELIC_LOG_BUDGET_LINES",
+        "NEW_RELIC_LOG_BUDGET_BYTES",
+        "NEW_RELIC_EMF_ENABLED",
+        "NEW_RELIC_EMF_FORWARD_LOGS",
+        "NEW_RELIC_INVOCATION_EVENTS_ENABLED",
+        "NEW_RELIC_HEADROOM_WARNINGS_ENABLED",
+        "NEW_RELIC_MEMORY_HEADROOM_THRESHOLD",
+        "NEW_RELIC_TIMEOUT_HEADROOM_THRESHOLD",
+        "NEW_RELIC_HEADROOM_WARNING_INTERVAL",
+        "NEW_RELIC_COST_METRICS_ENABLED",
+        "NEW_RELIC_COST_PRICING",
+        "NEW_RELIC_RESOURCE_SAMPLER_ENABLED",
+        "NEW_RELIC_RESOURCE_SAMPLER_INTERVAL",
+        "NEW_RELIC_OVERHEAD_METRICS_ENABLED",
+        "NEW_RELIC_PLATFORM_SPANS_ENABLED",
+        "NEW_RELIC_TRACE_ENDPOINT",
+        "NEW_RELIC_SANDBOX_EVENTS_ENABLED",
+        "NEW_RELIC_EXTENSION_LOG_FORMAT",
+        "AWS_LAMBDA_LOG_FORMAT",
     }
 
     for _, envVar := range envVars {
@@ -4,22 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/newrelic/newrelic-lambda-extension/config"
 	"github.com/newrelic/newrelic-lambda-extension/util"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
-type licenseKeySecret struct {
-	LicenseKey string
-}
-
 // SecretsManagerAPI defines the interface for Secrets Manager operations
 type SecretsManagerAPI interface {
 	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
@@ -30,10 +28,16 @@ type SSMAPI interface {
 	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
 }
 
+// KMSAPI defines the interface for KMS operations
+type KMSAPI interface {
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
 var (
 	cfg        aws.Config
 	secretsAPI SecretsManagerAPI
 	ssmAPI     SSMAPI
+	kmsAPI     KMSAPI
 )
 
 const defaultSecretId = "NEW_RELIC_LICENSE_KEY"
@@ -51,6 +55,7 @@ func init() {
 	}
 	secretsAPI = secretsmanager.NewFromConfig(cfg)
 	ssmAPI = ssm.NewFromConfig(cfg)
+	kmsAPI = kms.NewFromConfig(cfg)
 }
 
 func getLicenseKeySecretId(conf *config.Configuration) string {
@@ -70,30 +75,89 @@ func getLicenseKeySSMParameterName(conf *config.Configuration) string {
 }
 
 func decodeLicenseKey(rawJson *string) (string, error) {
-	var secrets licenseKeySecret
+	return decodeSecretField(rawJson, defaultSecretJSONKey)
+}
+
+// decodeSecretField extracts the license key from a JSON secret. The key is a dotted
+// path, so that nested documents such as {"newrelic": {"licenseKey": "..."}} can be
+// read with "newrelic.licenseKey".
+func decodeSecretField(rawJson *string, key string) (string, error) {
+	if rawJson == nil {
+		return "", fmt.Errorf("malformed license key secret; expected a JSON object with a %q attribute, but the secret has no string value", key)
+	}
+
+	var secrets map[string]interface{}
 
 	err := json.Unmarshal([]byte(*rawJson), &secrets)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("malformed license key secret; expected a JSON object with a %q attribute: %v", key, err)
+	}
+
+	value, found := lookupSecretField(secrets, key)
+	if !found {
+		return "", fmt.Errorf("malformed license key secret; missing %q attribute", key)
+	}
+
+	licenseKey, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("malformed license key secret; %q attribute is not a string", key)
+	}
+	if licenseKey == "" {
+		return "", fmt.Errorf("malformed license key secret; missing %q attribute", key)
+	}
+
+	return licenseKey, nil
+}
+
+// lookupSecretField resolves a dotted path in a decoded JSON document. An attribute
+// whose name contains the whole path, dots included, takes precedence.
+func lookupSecretField(secrets map[string]interface{}, path string) (interface{}, bool) {
+	if value, found := secrets[path]; found {
+		return value, true
 	}
-	if secrets.LicenseKey == "" {
-		return "", fmt.Errorf("malformed license key secret; missing \"LicenseKey\" attribute")
+
+	var current interface{} = secrets
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		current, ok = object[part]
+		if !ok {
+			return nil, false
+		}
 	}
 
-	return secrets.LicenseKey, nil
+	return current, true
+}
+
+// secretRegion returns the region of a Secrets Manager secret ARN, or an empty string
+// when the secret is referenced by name
+func secretRegion(secretId string) string {
+	if !arn.IsARN(secretId) {
+		return ""
+	}
+
+	parsed, err := arn.Parse(secretId)
+	if err != nil {
+		return ""
+	}
+
+	return parsed.Region
 }
 
 // IsSecretConfigured returns true if the Secrets Manager secret is configured, false
-// otherwise
+// otherwise. It reads the version of the secret that SecretProvider does.
 func IsSecretConfigured(ctx context.Context, conf *config.Configuration) bool {
 	if secretsAPI == nil {
 		return false
 	}
 
 	secretId := getLicenseKeySecretId(conf)
-	secretValueInput := secretsmanager.GetSecretValueInput{SecretId: &secretId}
+	provider := newSecretProvider(conf, secretId)
 
-	_, err := secretsAPI.GetSecretValue(ctx, &secretValueInput)
+	_, err := secretsAPI.GetSecretValue(ctx, provider.secretValueInput(), secretRegionOption(secretId))
 	if err != nil {
 		return false
 	}
@@ -101,6 +165,16 @@ func IsSecretConfigured(ctx context.Context, conf *config.Configuration) bool {
 	return true
 }
 
+// secretRegionOption points the Secrets Manager client at the region of the secret, so
+// that secrets shared from another account or region can be read by their ARN
+func secretRegionOption(secretId string) func(*secretsmanager.Options) {
+	return func(o *secretsmanager.Options) {
+		if region := secretRegion(secretId); region != "" {
+			o.Region = region
+		}
+	}
+}
+
 // IsSSMParameterConfigured returns true if the SSM parameter is configured, false
 // otherwise.
 func IsSSMParameterConfigured(ctx context.Context, conf *config.Configuration) bool {
@@ -114,79 +188,26 @@ func IsSSMParameterConfigured(ctx context.Context, conf *config.Configuration) b
 	return true
 }
 
-// GetNewRelicLicenseKey fetches the license key from AWS Secrets Manager or
-// SSM Parameter Store, falling back to the NEW_RELIC_LICENSE_KEY environment
-// variable if set.
-func GetNewRelicLicenseKey(ctx context.Context, conf *config.Configuration) (string, error) {
-	if conf.LicenseKey != "" {
-		util.Logln("Using license key from environment variable")
-		return conf.LicenseKey, nil
-	}
-
-	secretId := conf.LicenseKeySecretId
-	if secretId != "" {
-		util.Logln("Fetching license key from secret id " + secretId)
-		return tryLicenseKeyFromSecret(ctx, secretId)
-	}
-
-	parameterName := conf.LicenseKeySSMParameterName
-	if parameterName != "" {
-		util.Logln("Fetching license key from parameter name " + conf.LicenseKeySSMParameterName)
-		return tryLicenseKeyFromSSMParameter(ctx, parameterName)
-	}
-
-	envLicenseKey, found := os.LookupEnv(defaultSecretId)
-	if found {
-		return envLicenseKey, nil
-	}
-
-	util.Debugln("No configured license key found, attempting fallbacks to default")
-
-	licenseKey, err := tryLicenseKeyFromSecret(ctx, defaultSecretId)
-	if err == nil {
-		return licenseKey, nil
-	}
-
-	licenseKey, err = tryLicenseKeyFromSSMParameter(ctx, defaultSecretId)
-	if err == nil {
-		return licenseKey, nil
-	}
-
-	return "", fmt.Errorf("No license key configured")
+// IsKMSConfigured returns true if a KMS-encrypted license key is configured, false
+// otherwise. It doesn't decrypt the key, which the provider chain already does at startup.
+func IsKMSConfigured(conf *config.Configuration) bool {
+	return conf.LicenseKeyKMSCiphertext != ""
 }
 
-func tryLicenseKeyFromSecret(ctx context.Context, secretId string) (string, error) {
-	if secretsAPI == nil {
-		return "", fmt.Errorf("Secrets Manager client not initialized")
-	}
-
-	util.Debugf("fetching '%s' from Secrets Manager\n", secretId)
-
-	secretValueInput := secretsmanager.GetSecretValueInput{SecretId: &secretId}
-
-	secretValueOutput, err := secretsAPI.GetSecretValue(ctx, &secretValueInput)
+// GetNewRelicLicenseKey fetches the license key using the configured provider chain. By
+// default it checks the NEW_RELIC_LICENSE_KEY environment variable, a KMS-encrypted
+// license key, a license key file, AWS Secrets Manager and SSM Parameter Store, in that order.
+func GetNewRelicLicenseKey(ctx context.Context, conf *config.Configuration) (string, error) {
+	chain, err := ChainFromConfig(conf)
 	if err != nil {
 		return "", err
 	}
 
-	return decodeLicenseKey(secretValueOutput.SecretString)
+	return chain.Retrieve(ctx)
 }
 
 func tryLicenseKeyFromSSMParameter(ctx context.Context, parameterName string) (string, error) {
-	if ssmAPI == nil {
-		return "", fmt.Errorf("SSM client not initialized")
-	}
-
-	util.Debugf("fetching '%s' from SSM Parameter Store\n", parameterName)
-
-	parameterValueInput := ssm.GetParameterInput{Name: &parameterName, WithDecryption: aws.Bool(true)}
-
-	parameterValueOutput, err := ssmAPI.GetParameter(ctx, &parameterValueInput)
-	if err != nil {
-		return "", err
-	}
-
-	return *parameterValueOutput.Parameter.Value, nil
+	return (&SSMProvider{ParameterName: parameterName}).Retrieve(ctx)
 }
 
 // OverrideSecretsManager overrides the default Secrets Manager implementation
@@ -198,3 +219,8 @@ func OverrideSecretsManager(override SecretsManagerAPI) {
 func OverrideSSM(override SSMAPI) {
 	ssmAPI = override
 }
+
+// OverrideKMS overrides the default KMS implementation
+func OverrideKMS(override KMSAPI) {
+	kmsAPI = override
+}
@@ -70,6 +70,25 @@ func TestIsSecretConfigured(t *testing.T) {
 	}))
 }
 
+func TestIsSecretConfiguredVersion(t *testing.T) {
+	ctx := context.Background()
+
+	originalSecrets := secretsAPI
+	defer func() { secretsAPI = originalSecrets }()
+
+	// Only the pending version of the secret exists
+	OverrideSecretsManager(mockStagedSecretManager{stages: map[string]string{
+		"AWSPENDING": `{"LicenseKey": "pending"}`,
+	}})
+	assert.False(t, IsSecretConfigured(ctx, &config.Configuration{
+		LicenseKeySecretId: "testSecretName",
+	}))
+	assert.True(t, IsSecretConfigured(ctx, &config.Configuration{
+		LicenseKeySecretId:           "testSecretName",
+		LicenseKeySecretVersionStage: "AWSPENDING",
+	}))
+}
+
 type mockSSM struct {
 	validParameters []string
 }
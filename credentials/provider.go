@@ -0,0 +1,371 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+const defaultSecretJSONKey = "LicenseKey"
+
+// ErrNotConfigured is returned by a Provider that has no license key source
+// configured. The chain skips such providers and moves on to the next one.
+var ErrNotConfigured = errors.New("license key provider not configured")
+
+// Provider retrieves a New Relic license key from a single source
+type Provider interface {
+	// Name describes the source of the license key, for logging
+	Name() string
+	// Retrieve returns the license key, or ErrNotConfigured if this provider has nothing to offer
+	Retrieve(ctx context.Context) (string, error)
+}
+
+// Chain tries each of its providers in order, returning the first license key found.
+// A provider that is configured but fails stops the chain, so that a misconfigured
+// source is reported rather than silently skipped.
+type Chain struct {
+	providers []Provider
+}
+
+// NewChain creates a Chain from the given providers
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{providers: providers}
+}
+
+// Retrieve walks the chain, and logs which provider supplied the license key
+func (c *Chain) Retrieve(ctx context.Context) (string, error) {
+	for _, provider := range c.providers {
+		licenseKey, err := provider.Retrieve(ctx)
+		if errors.Is(err, ErrNotConfigured) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		util.Logf("Using license key from %s", provider.Name())
+		return licenseKey, nil
+	}
+
+	return "", fmt.Errorf("No license key configured")
+}
+
+// DefaultChain reproduces the historical lookup order: the license key from config, an
+// explicitly configured KMS ciphertext, file, secret or parameter, the NEW_RELIC_LICENSE_KEY
+// environment variable, and finally the default secret and parameter.
+func DefaultChain(conf *config.Configuration) *Chain {
+	return NewChain(
+		&ConfigProvider{LicenseKey: conf.LicenseKey},
+		&KMSProvider{Ciphertext: conf.LicenseKeyKMSCiphertext},
+		&FileProvider{Path: conf.LicenseKeyFile},
+		newSecretProvider(conf, conf.LicenseKeySecretId),
+		&SSMProvider{ParameterName: conf.LicenseKeySSMParameterName},
+		&EnvProvider{Variable: defaultSecretId},
+		Optional(newSecretProvider(conf, defaultSecretId)),
+		Optional(&SSMProvider{ParameterName: defaultSecretId}),
+	)
+}
+
+// ChainFromConfig builds the chain named by NEW_RELIC_LICENSE_KEY_PROVIDERS, or the
+// default chain when no order was configured.
+func ChainFromConfig(conf *config.Configuration) (*Chain, error) {
+	if len(conf.LicenseKeyProviders) == 0 {
+		return DefaultChain(conf), nil
+	}
+
+	var providers []Provider
+	for _, name := range conf.LicenseKeyProviders {
+		named, err := providersByName(conf, name)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, named...)
+	}
+
+	return NewChain(providers...), nil
+}
+
+// providersByName maps a configured provider name to the providers backing it. The secret
+// and ssm providers fall back to the default name when no explicit one is configured.
+func providersByName(conf *config.Configuration, name string) ([]Provider, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "env":
+		return []Provider{&ConfigProvider{LicenseKey: conf.LicenseKey}, &EnvProvider{Variable: defaultSecretId}}, nil
+	case "kms":
+		return []Provider{&KMSProvider{Ciphertext: conf.LicenseKeyKMSCiphertext}}, nil
+	case "file":
+		return []Provider{&FileProvider{Path: conf.LicenseKeyFile}}, nil
+	case "secret":
+		if conf.LicenseKeySecretId != "" {
+			return []Provider{newSecretProvider(conf, conf.LicenseKeySecretId)}, nil
+		}
+		return []Provider{Optional(newSecretProvider(conf, defaultSecretId))}, nil
+	case "ssm":
+		if conf.LicenseKeySSMParameterName != "" {
+			return []Provider{&SSMProvider{ParameterName: conf.LicenseKeySSMParameterName}}, nil
+		}
+		return []Provider{Optional(&SSMProvider{ParameterName: defaultSecretId})}, nil
+	default:
+		return nil, fmt.Errorf("unknown license key provider %q", name)
+	}
+}
+
+// optionalProvider turns any failure of the wrapped provider into ErrNotConfigured
+type optionalProvider struct {
+	Provider
+}
+
+// Optional wraps a provider so that its failures don't stop the chain. It is used for
+// best-effort fallbacks, such as the default secret name.
+func Optional(provider Provider) Provider {
+	return &optionalProvider{Provider: provider}
+}
+
+func (p *optionalProvider) Retrieve(ctx context.Context) (string, error) {
+	licenseKey, err := p.Provider.Retrieve(ctx)
+	if err != nil {
+		util.Debugf("Fallback to %s failed: %v", p.Name(), err)
+		return "", ErrNotConfigured
+	}
+
+	return licenseKey, nil
+}
+
+// ConfigProvider returns a license key already present in the configuration
+type ConfigProvider struct {
+	LicenseKey string
+}
+
+func (p *ConfigProvider) Name() string {
+	return "environment variable"
+}
+
+func (p *ConfigProvider) Retrieve(_ context.Context) (string, error) {
+	if p.LicenseKey == "" {
+		return "", ErrNotConfigured
+	}
+
+	return p.LicenseKey, nil
+}
+
+// EnvProvider reads the license key from an environment variable
+type EnvProvider struct {
+	Variable string
+}
+
+func (p *EnvProvider) Name() string {
+	return "environment variable " + p.Variable
+}
+
+func (p *EnvProvider) Retrieve(_ context.Context) (string, error) {
+	licenseKey, found := os.LookupEnv(p.Variable)
+	if !found {
+		return "", ErrNotConfigured
+	}
+
+	return licenseKey, nil
+}
+
+// KMSProvider decrypts a base64-encoded, KMS-encrypted license key, such as the value of
+// NEW_RELIC_LICENSE_KEY_KMS
+type KMSProvider struct {
+	Ciphertext string
+}
+
+func (p *KMSProvider) Name() string {
+	return "KMS-encrypted environment variable"
+}
+
+func (p *KMSProvider) Retrieve(ctx context.Context) (string, error) {
+	if p.Ciphertext == "" {
+		return "", ErrNotConfigured
+	}
+	if kmsAPI == nil {
+		return "", fmt.Errorf("KMS client not initialized")
+	}
+
+	ciphertextBlob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(p.Ciphertext))
+	if err != nil {
+		return "", fmt.Errorf("malformed KMS-encrypted license key; not valid base64: %v", err)
+	}
+
+	util.Debugln("decrypting license key with KMS")
+
+	decryptInput := kms.DecryptInput{CiphertextBlob: ciphertextBlob}
+	decryptOutput, err := kmsAPI.Decrypt(ctx, &decryptInput)
+
+	// The Lambda console's encryption helpers bind the ciphertext to the function name. Without
+	// the encryption context, KMS rejects it as invalid; other errors aren't retried.
+	var invalidCiphertext *kmstypes.InvalidCiphertextException
+	functionName := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	if errors.As(err, &invalidCiphertext) && functionName != "" {
+		util.Debugln("retrying KMS decryption with the Lambda function name encryption context")
+		decryptInput.EncryptionContext = map[string]string{"LambdaFunctionName": functionName}
+		decryptOutput, err = kmsAPI.Decrypt(ctx, &decryptInput)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	licenseKey := strings.TrimSpace(string(decryptOutput.Plaintext))
+	if licenseKey == "" {
+		return "", fmt.Errorf("KMS-encrypted license key decrypted to an empty value")
+	}
+
+	return licenseKey, nil
+}
+
+// FileProvider reads the license key from a file, such as one shipped in a layer under /opt
+type FileProvider struct {
+	Path string
+}
+
+func (p *FileProvider) Name() string {
+	return "file " + p.Path
+}
+
+func (p *FileProvider) Retrieve(_ context.Context) (string, error) {
+	if p.Path == "" {
+		return "", ErrNotConfigured
+	}
+
+	util.Debugf("reading license key from file '%s'\n", p.Path)
+
+	contents, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", err
+	}
+
+	licenseKey := strings.TrimSpace(string(contents))
+	if licenseKey == "" {
+		return "", fmt.Errorf("license key file %s is empty", p.Path)
+	}
+
+	return licenseKey, nil
+}
+
+// SecretProvider fetches the license key from AWS Secrets Manager. The secret may be
+// referenced by the ARN of a secret in another account or region.
+type SecretProvider struct {
+	SecretId string
+	// JSONKey is the dotted path, within the secret's JSON document, of the license key
+	JSONKey string
+	// Plain treats the whole secret value as the license key, rather than a JSON document
+	Plain bool
+	// VersionStage selects a staging label, such as AWSPENDING. AWSCURRENT is used when empty.
+	VersionStage string
+	// VersionId pins a specific version of the secret
+	VersionId string
+}
+
+func newSecretProvider(conf *config.Configuration, secretId string) *SecretProvider {
+	return &SecretProvider{
+		SecretId:     secretId,
+		JSONKey:      conf.LicenseKeySecretJSONKey,
+		Plain:        strings.EqualFold(conf.LicenseKeySecretFormat, config.SecretFormatPlain),
+		VersionStage: conf.LicenseKeySecretVersionStage,
+		VersionId:    conf.LicenseKeySecretVersionId,
+	}
+}
+
+func (p *SecretProvider) Name() string {
+	return "secret " + p.SecretId
+}
+
+func (p *SecretProvider) Retrieve(ctx context.Context) (string, error) {
+	if p.SecretId == "" {
+		return "", ErrNotConfigured
+	}
+	if secretsAPI == nil {
+		return "", fmt.Errorf("Secrets Manager client not initialized")
+	}
+
+	util.Debugf("fetching '%s' from Secrets Manager\n", p.SecretId)
+
+	secretValueOutput, err := secretsAPI.GetSecretValue(ctx, p.secretValueInput(), secretRegionOption(p.SecretId))
+	if err != nil {
+		return "", err
+	}
+
+	if p.Plain {
+		return decodePlainSecret(secretValueOutput)
+	}
+
+	jsonKey := p.JSONKey
+	if jsonKey == "" {
+		jsonKey = defaultSecretJSONKey
+	}
+
+	return decodeSecretField(secretValueOutput.SecretString, jsonKey)
+}
+
+// secretValueInput requests the configured version of the secret
+func (p *SecretProvider) secretValueInput() *secretsmanager.GetSecretValueInput {
+	secretValueInput := &secretsmanager.GetSecretValueInput{SecretId: aws.String(p.SecretId)}
+	if p.VersionStage != "" {
+		secretValueInput.VersionStage = aws.String(p.VersionStage)
+	}
+	if p.VersionId != "" {
+		secretValueInput.VersionId = aws.String(p.VersionId)
+	}
+	return secretValueInput
+}
+
+// decodePlainSecret returns a secret stored as the bare license key, in either the
+// string or the binary value of the secret
+func decodePlainSecret(secretValueOutput *secretsmanager.GetSecretValueOutput) (string, error) {
+	var licenseKey string
+	if secretValueOutput.SecretString != nil {
+		licenseKey = *secretValueOutput.SecretString
+	} else {
+		licenseKey = string(secretValueOutput.SecretBinary)
+	}
+
+	licenseKey = strings.TrimSpace(licenseKey)
+	if licenseKey == "" {
+		return "", fmt.Errorf("malformed license key secret; expected a plain-text license key, but the secret is empty")
+	}
+
+	return licenseKey, nil
+}
+
+// SSMProvider fetches the license key from SSM Parameter Store
+type SSMProvider struct {
+	ParameterName string
+}
+
+func (p *SSMProvider) Name() string {
+	return "parameter " + p.ParameterName
+}
+
+func (p *SSMProvider) Retrieve(ctx context.Context) (string, error) {
+	if p.ParameterName == "" {
+		return "", ErrNotConfigured
+	}
+	if ssmAPI == nil {
+		return "", fmt.Errorf("SSM client not initialized")
+	}
+
+	util.Debugf("fetching '%s' from SSM Parameter Store\n", p.ParameterName)
+
+	parameterValueInput := ssm.GetParameterInput{Name: aws.String(p.ParameterName), WithDecryption: aws.Bool(true)}
+
+	parameterValueOutput, err := ssmAPI.GetParameter(ctx, &parameterValueInput)
+	if err != nil {
+		return "", err
+	}
+
+	return *parameterValueOutput.Parameter.Value, nil
+}
@@ -0,0 +1,471 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticProvider struct {
+	name string
+	key  string
+	err  error
+}
+
+func (p *staticProvider) Name() string {
+	return p.name
+}
+
+func (p *staticProvider) Retrieve(_ context.Context) (string, error) {
+	return p.key, p.err
+}
+
+func TestChainRetrieve(t *testing.T) {
+	ctx := context.Background()
+
+	chain := NewChain(
+		&staticProvider{name: "first", err: ErrNotConfigured},
+		&staticProvider{name: "second", key: "second_key"},
+		&staticProvider{name: "third", key: "third_key"},
+	)
+	lk, err := chain.Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "second_key", lk)
+
+	chain = NewChain(
+		&staticProvider{name: "first", err: fmt.Errorf("boom")},
+		&staticProvider{name: "second", key: "second_key"},
+	)
+	lk, err = chain.Retrieve(ctx)
+	assert.EqualError(t, err, "boom")
+	assert.Empty(t, lk)
+
+	chain = NewChain(
+		Optional(&staticProvider{name: "first", err: fmt.Errorf("boom")}),
+		&staticProvider{name: "second", key: "second_key"},
+	)
+	lk, err = chain.Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "second_key", lk)
+
+	lk, err = NewChain().Retrieve(ctx)
+	assert.EqualError(t, err, "No license key configured")
+	assert.Empty(t, lk)
+}
+
+func TestFileProvider(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := (&FileProvider{}).Retrieve(ctx)
+	assert.ErrorIs(t, err, ErrNotConfigured)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "license_key")
+	assert.NoError(t, os.WriteFile(path, []byte("file_key\n"), 0600))
+
+	lk, err := (&FileProvider{Path: path}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "file_key", lk)
+
+	_, err = (&FileProvider{Path: filepath.Join(dir, "missing")}).Retrieve(ctx)
+	assert.Error(t, err)
+
+	empty := filepath.Join(dir, "empty")
+	assert.NoError(t, os.WriteFile(empty, []byte("  \n"), 0600))
+	_, err = (&FileProvider{Path: empty}).Retrieve(ctx)
+	assert.EqualError(t, err, fmt.Sprintf("license key file %s is empty", empty))
+}
+
+func TestEnvProvider(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := (&EnvProvider{Variable: "NR_TEST_LICENSE_KEY"}).Retrieve(ctx)
+	assert.ErrorIs(t, err, ErrNotConfigured)
+
+	os.Setenv("NR_TEST_LICENSE_KEY", "env_key")
+	defer os.Unsetenv("NR_TEST_LICENSE_KEY")
+
+	lk, err := (&EnvProvider{Variable: "NR_TEST_LICENSE_KEY"}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "env_key", lk)
+}
+
+type mockStagedSecretManager struct {
+	stages map[string]string
+}
+
+func (m mockStagedSecretManager) GetSecretValue(_ context.Context, input *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	stage := "AWSCURRENT"
+	if input.VersionStage != nil {
+		stage = *input.VersionStage
+	}
+
+	secret, ok := m.stages[stage]
+	if !ok {
+		return nil, fmt.Errorf("Secret version not found")
+	}
+
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(secret)}, nil
+}
+
+func TestSecretProvider(t *testing.T) {
+	ctx := context.Background()
+
+	originalSecrets := secretsAPI
+	defer func() { secretsAPI = originalSecrets }()
+
+	OverrideSecretsManager(mockStagedSecretManager{stages: map[string]string{
+		"AWSCURRENT": `{"LicenseKey": "current", "nrKey": "shared_current"}`,
+		"AWSPENDING": `{"LicenseKey": "pending"}`,
+	}})
+
+	_, err := (&SecretProvider{}).Retrieve(ctx)
+	assert.ErrorIs(t, err, ErrNotConfigured)
+
+	lk, err := (&SecretProvider{SecretId: "secret"}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "current", lk)
+
+	lk, err = (&SecretProvider{SecretId: "secret", VersionStage: "AWSPENDING"}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", lk)
+
+	lk, err = (&SecretProvider{SecretId: "secret", JSONKey: "nrKey"}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "shared_current", lk)
+
+	_, err = (&SecretProvider{SecretId: "secret", JSONKey: "nrKey", VersionStage: "AWSPENDING"}).Retrieve(ctx)
+	assert.EqualError(t, err, "malformed license key secret; missing \"nrKey\" attribute")
+}
+
+func TestSSMProvider(t *testing.T) {
+	ctx := context.Background()
+
+	originalSSM := ssmAPI
+	defer func() { ssmAPI = originalSSM }()
+
+	OverrideSSM(mockSSM{validParameters: []string{"parameter"}})
+
+	_, err := (&SSMProvider{}).Retrieve(ctx)
+	assert.ErrorIs(t, err, ErrNotConfigured)
+
+	lk, err := (&SSMProvider{ParameterName: "parameter"}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, mockParameterStoreKeyValue, lk)
+
+	_, err = (&SSMProvider{ParameterName: "missing"}).Retrieve(ctx)
+	assert.EqualError(t, err, "Parameter not found")
+}
+
+func TestChainFromConfig(t *testing.T) {
+	ctx := context.Background()
+
+	originalSecrets := secretsAPI
+	originalSSM := ssmAPI
+	defer func() {
+		secretsAPI = originalSecrets
+		ssmAPI = originalSSM
+	}()
+
+	OverrideSecretsManager(mockSecretManager{validSecrets: []string{defaultSecretId}})
+	OverrideSSM(mockSSM{validParameters: []string{"testParameterName"}})
+
+	path := filepath.Join(t.TempDir(), "license_key")
+	assert.NoError(t, os.WriteFile(path, []byte("file_key"), 0600))
+
+	conf := &config.Configuration{
+		LicenseKeyFile:             path,
+		LicenseKeySSMParameterName: "testParameterName",
+		LicenseKeyProviders:        []string{"ssm", "file", "secret"},
+	}
+	lk, err := GetNewRelicLicenseKey(ctx, conf)
+	assert.NoError(t, err)
+	assert.Equal(t, mockParameterStoreKeyValue, lk)
+
+	conf.LicenseKeyProviders = []string{"file", "ssm"}
+	lk, err = GetNewRelicLicenseKey(ctx, conf)
+	assert.NoError(t, err)
+	assert.Equal(t, "file_key", lk)
+
+	conf.LicenseKeyProviders = []string{"secret"}
+	lk, err = GetNewRelicLicenseKey(ctx, conf)
+	assert.NoError(t, err)
+	assert.Equal(t, mockSecretManagerKeyValue, lk)
+
+	conf.LicenseKeyProviders = []string{"secret", "vault"}
+	_, err = GetNewRelicLicenseKey(ctx, conf)
+	assert.EqualError(t, err, "unknown license key provider \"vault\"")
+}
+
+func TestDefaultChainUsesFileBeforeSecrets(t *testing.T) {
+	ctx := context.Background()
+
+	originalSecrets := secretsAPI
+	defer func() { secretsAPI = originalSecrets }()
+
+	OverrideSecretsManager(mockSecretManager{validSecrets: []string{"testSecretName"}})
+
+	path := filepath.Join(t.TempDir(), "license_key")
+	assert.NoError(t, os.WriteFile(path, []byte("file_key"), 0600))
+
+	lk, err := GetNewRelicLicenseKey(ctx, &config.Configuration{
+		LicenseKeyFile:     path,
+		LicenseKeySecretId: "testSecretName",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "file_key", lk)
+}
+
+type mockKMS struct {
+	plaintext string
+	// requiredContext, when set, must be present as the encryption context for Decrypt to succeed
+	requiredContext map[string]string
+	// err, when set, is returned by every call
+	err   error
+	calls int
+}
+
+func (m *mockKMS) Decrypt(_ context.Context, input *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	if string(input.CiphertextBlob) != "ciphertext" {
+		return nil, &kmstypes.InvalidCiphertextException{Message: aws.String("invalid ciphertext")}
+	}
+	for k, v := range m.requiredContext {
+		if input.EncryptionContext[k] != v {
+			return nil, &kmstypes.InvalidCiphertextException{Message: aws.String("invalid ciphertext")}
+		}
+	}
+
+	return &kms.DecryptOutput{Plaintext: []byte(m.plaintext)}, nil
+}
+
+func TestKMSProvider(t *testing.T) {
+	ctx := context.Background()
+
+	originalKMS := kmsAPI
+	defer func() { kmsAPI = originalKMS }()
+
+	ciphertext := base64.StdEncoding.EncodeToString([]byte("ciphertext"))
+
+	_, err := (&KMSProvider{}).Retrieve(ctx)
+	assert.ErrorIs(t, err, ErrNotConfigured)
+
+	OverrideKMS(nil)
+	_, err = (&KMSProvider{Ciphertext: ciphertext}).Retrieve(ctx)
+	assert.EqualError(t, err, "KMS client not initialized")
+
+	mock := &mockKMS{plaintext: "kms_key"}
+	OverrideKMS(mock)
+	lk, err := (&KMSProvider{Ciphertext: ciphertext}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "kms_key", lk)
+	assert.Equal(t, 1, mock.calls)
+
+	_, err = (&KMSProvider{Ciphertext: "not base64!"}).Retrieve(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "malformed KMS-encrypted license key")
+
+	_, err = (&KMSProvider{Ciphertext: base64.StdEncoding.EncodeToString([]byte("other"))}).Retrieve(ctx)
+	assert.EqualError(t, err, "InvalidCiphertextException: invalid ciphertext")
+
+	OverrideKMS(&mockKMS{plaintext: "  "})
+	_, err = (&KMSProvider{Ciphertext: ciphertext}).Retrieve(ctx)
+	assert.EqualError(t, err, "KMS-encrypted license key decrypted to an empty value")
+}
+
+func TestKMSProviderEncryptionContext(t *testing.T) {
+	ctx := context.Background()
+
+	originalKMS := kmsAPI
+	defer func() { kmsAPI = originalKMS }()
+
+	os.Setenv("AWS_LAMBDA_FUNCTION_NAME", "my-function")
+	defer os.Unsetenv("AWS_LAMBDA_FUNCTION_NAME")
+
+	mock := &mockKMS{
+		plaintext:       "kms_key",
+		requiredContext: map[string]string{"LambdaFunctionName": "my-function"},
+	}
+	OverrideKMS(mock)
+
+	lk, err := (&KMSProvider{Ciphertext: base64.StdEncoding.EncodeToString([]byte("ciphertext"))}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "kms_key", lk)
+	assert.Equal(t, 2, mock.calls)
+
+	// Other errors, such as throttling, aren't retried
+	throttled := &kmstypes.KMSInternalException{Message: aws.String("rate exceeded")}
+	mock = &mockKMS{err: throttled}
+	OverrideKMS(mock)
+	_, err = (&KMSProvider{Ciphertext: base64.StdEncoding.EncodeToString([]byte("ciphertext"))}).Retrieve(ctx)
+	assert.ErrorIs(t, err, throttled)
+	assert.Equal(t, 1, mock.calls)
+}
+
+func TestIsKMSConfigured(t *testing.T) {
+	originalKMS := kmsAPI
+	defer func() { kmsAPI = originalKMS }()
+
+	mock := &mockKMS{plaintext: "kms_key"}
+	OverrideKMS(mock)
+
+	assert.False(t, IsKMSConfigured(&config.Configuration{}))
+	assert.True(t, IsKMSConfigured(&config.Configuration{
+		LicenseKeyKMSCiphertext: base64.StdEncoding.EncodeToString([]byte("ciphertext")),
+	}))
+	// Configured, even when it can't be decrypted
+	assert.True(t, IsKMSConfigured(&config.Configuration{
+		LicenseKeyKMSCiphertext: base64.StdEncoding.EncodeToString([]byte("other")),
+	}))
+	// KMS isn't called
+	assert.Equal(t, 0, mock.calls)
+}
+
+func TestDefaultChainPrefersKMS(t *testing.T) {
+	ctx := context.Background()
+
+	originalKMS := kmsAPI
+	originalSecrets := secretsAPI
+	defer func() {
+		kmsAPI = originalKMS
+		secretsAPI = originalSecrets
+	}()
+
+	OverrideKMS(&mockKMS{plaintext: "kms_key"})
+	OverrideSecretsManager(mockSecretManager{validSecrets: []string{"testSecretName"}})
+
+	lk, err := GetNewRelicLicenseKey(ctx, &config.Configuration{
+		LicenseKeyKMSCiphertext: base64.StdEncoding.EncodeToString([]byte("ciphertext")),
+		LicenseKeySecretId:      "testSecretName",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "kms_key", lk)
+}
+
+type recordingSecretManager struct {
+	secret string
+	binary []byte
+	input  *secretsmanager.GetSecretValueInput
+	region string
+}
+
+func (m *recordingSecretManager) GetSecretValue(_ context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	options := secretsmanager.Options{Region: "us-east-1"}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+
+	m.input = input
+	m.region = options.Region
+
+	output := &secretsmanager.GetSecretValueOutput{SecretBinary: m.binary}
+	if m.binary == nil {
+		output.SecretString = aws.String(m.secret)
+	}
+
+	return output, nil
+}
+
+func TestSecretProviderNestedField(t *testing.T) {
+	ctx := context.Background()
+
+	originalSecrets := secretsAPI
+	defer func() { secretsAPI = originalSecrets }()
+
+	OverrideSecretsManager(&recordingSecretManager{
+		secret: `{"newrelic": {"licenseKey": "nested_key", "accountId": 1}, "shared.key": "dotted_key"}`,
+	})
+
+	lk, err := (&SecretProvider{SecretId: "secret", JSONKey: "newrelic.licenseKey"}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "nested_key", lk)
+
+	lk, err = (&SecretProvider{SecretId: "secret", JSONKey: "shared.key"}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "dotted_key", lk)
+
+	_, err = (&SecretProvider{SecretId: "secret", JSONKey: "newrelic.accountId"}).Retrieve(ctx)
+	assert.EqualError(t, err, "malformed license key secret; \"newrelic.accountId\" attribute is not a string")
+
+	_, err = (&SecretProvider{SecretId: "secret", JSONKey: "newrelic.licenseKey.value"}).Retrieve(ctx)
+	assert.EqualError(t, err, "malformed license key secret; missing \"newrelic.licenseKey.value\" attribute")
+}
+
+func TestSecretProviderPlain(t *testing.T) {
+	ctx := context.Background()
+
+	originalSecrets := secretsAPI
+	defer func() { secretsAPI = originalSecrets }()
+
+	OverrideSecretsManager(&recordingSecretManager{secret: "plain_key\n"})
+
+	lk, err := (&SecretProvider{SecretId: "secret", Plain: true}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "plain_key", lk)
+
+	_, err = (&SecretProvider{SecretId: "secret"}).Retrieve(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected a JSON object with a \"LicenseKey\" attribute")
+
+	OverrideSecretsManager(&recordingSecretManager{binary: []byte("binary_key")})
+
+	lk, err = (&SecretProvider{SecretId: "secret", Plain: true}).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "binary_key", lk)
+
+	_, err = (&SecretProvider{SecretId: "secret"}).Retrieve(ctx)
+	assert.EqualError(t, err, "malformed license key secret; expected a JSON object with a \"LicenseKey\" attribute, but the secret has no string value")
+
+	OverrideSecretsManager(&recordingSecretManager{secret: " "})
+
+	_, err = (&SecretProvider{SecretId: "secret", Plain: true}).Retrieve(ctx)
+	assert.EqualError(t, err, "malformed license key secret; expected a plain-text license key, but the secret is empty")
+}
+
+func TestSecretProviderVersionAndRegion(t *testing.T) {
+	ctx := context.Background()
+
+	originalSecrets := secretsAPI
+	defer func() { secretsAPI = originalSecrets }()
+
+	mock := &recordingSecretManager{secret: `{"LicenseKey": "shared_key"}`}
+	OverrideSecretsManager(mock)
+
+	secretArn := "arn:aws:secretsmanager:eu-west-1:123456789012:secret:shared/newrelic-AbCdEf"
+	lk, err := newSecretProvider(&config.Configuration{
+		LicenseKeySecretVersionId: "a1b2c3",
+	}, secretArn).Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "shared_key", lk)
+	assert.Equal(t, secretArn, *mock.input.SecretId)
+	assert.Equal(t, "a1b2c3", *mock.input.VersionId)
+	assert.Nil(t, mock.input.VersionStage)
+	assert.Equal(t, "eu-west-1", mock.region)
+
+	_, err = newSecretProvider(&config.Configuration{
+		LicenseKeySecretFormat: config.SecretFormatPlain,
+	}, "secret").Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, mock.input.VersionId)
+	assert.Equal(t, "us-east-1", mock.region)
+}
+
+func TestSecretRegion(t *testing.T) {
+	assert.Equal(t, "", secretRegion("NEW_RELIC_LICENSE_KEY"))
+	assert.Equal(t, "", secretRegion("arn:aws:secretsmanager"))
+	assert.Equal(t, "ap-southeast-2", secretRegion("arn:aws:secretsmanager:ap-southeast-2:123456789012:secret:nr-AbCdEf"))
+}
@@ -0,0 +1,254 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+var logger = util.NewComponentLogger("ingest")
+
+const (
+	listenHost = "127.0.0.1"
+	// maxBodyBytes matches the largest payload the Log API accepts
+	maxBodyBytes = 1024 * 1024
+
+	requestIdAttribute = "faas.execution"
+)
+
+// Server accepts custom events, dimensional metrics and log records from function code, on
+// localhost inside the sandbox. Data is held in the telemetry batch, and sent with the next
+// harvest, so that reporting it doesn't add to function latency.
+type Server struct {
+	listenString  string
+	server        *http.Server
+	batch         *telemetry.Batch
+	requestID     func() string
+	eventsEnabled bool
+}
+
+type logRecord struct {
+	Message    string                 `json:"message"`
+	Timestamp  int64                  `json:"timestamp"`
+	Level      string                 `json:"level"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Start starts the ingest API server. requestID reports the current invocation, which is
+// used to tag the data received.
+func Start(conf *config.Configuration, batch *telemetry.Batch, requestID func() string) (*Server, error) {
+	eventsEnabled := conf.AccountID != "" || conf.EventEndpoint != ""
+	return startInternal(net.JoinHostPort(listenHost, strconv.Itoa(int(conf.IngestAPIPort))), batch, requestID, eventsEnabled)
+}
+
+func startInternal(address string, batch *telemetry.Batch, requestID func() string, eventsEnabled bool) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	ingestServer := &Server{
+		listenString:  listener.Addr().String(),
+		server:        &http.Server{},
+		batch:         batch,
+		requestID:     requestID,
+		eventsEnabled: eventsEnabled,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/events", ingestServer.eventsHandler)
+	mux.HandleFunc("/v1/metrics", ingestServer.metricsHandler)
+	mux.HandleFunc("/v1/logs", ingestServer.logsHandler)
+	ingestServer.server.Handler = mux
+
+	go func() {
+		logger.Logf("Starting ingest API server on %s", ingestServer.listenString)
+		logger.Logf("Ingest API server terminated: %v\n", ingestServer.server.Serve(listener))
+	}()
+
+	return ingestServer, nil
+}
+
+func (s *Server) Port() uint16 {
+	_, portStr, _ := net.SplitHostPort(s.listenString)
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+	return uint16(port)
+}
+
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	ret := s.server.Shutdown(ctx)
+	if ret == context.DeadlineExceeded {
+		ret = nil
+	}
+	return ret
+}
+
+func (s *Server) eventsHandler(res http.ResponseWriter, req *http.Request) {
+	if !s.eventsEnabled {
+		http.Error(res, "custom events require NEW_RELIC_ACCOUNT_ID to be set", http.StatusServiceUnavailable)
+		return
+	}
+
+	var events []telemetry.CustomEvent
+	if !decodeBody(res, req, &events) {
+		return
+	}
+
+	requestId := s.requestID()
+	for i, event := range events {
+		eventType, _ := event["eventType"].(string)
+		if eventType == "" {
+			http.Error(res, fmt.Sprintf("event %d is missing an eventType", i), http.StatusBadRequest)
+			return
+		}
+		if _, ok := event["timestamp"]; !ok {
+			event["timestamp"] = util.Timestamp()
+		}
+		if requestId != "" {
+			event[requestIdAttribute] = requestId
+		}
+	}
+
+	s.accepted(res, "events", len(events), s.batch.AddEvents(requestId, events))
+}
+
+func (s *Server) metricsHandler(res http.ResponseWriter, req *http.Request) {
+	var metrics []telemetry.Metric
+	if !decodeBody(res, req, &metrics) {
+		return
+	}
+
+	requestId := s.requestID()
+	for i := range metrics {
+		metric := &metrics[i]
+		if metric.Name == "" {
+			http.Error(res, fmt.Sprintf("metric %d is missing a name", i), http.StatusBadRequest)
+			return
+		}
+
+		switch metric.Type {
+		case "":
+			metric.Type = "gauge"
+		case "gauge":
+		case "count":
+			if metric.Interval <= 0 {
+				http.Error(res, fmt.Sprintf("count metric %s is missing interval.ms", metric.Name), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(res, fmt.Sprintf("metric %s has unsupported type %q", metric.Name, metric.Type), http.StatusBadRequest)
+			return
+		}
+
+		if metric.Timestamp == 0 {
+			metric.Timestamp = util.Timestamp()
+		}
+		if requestId != "" {
+			if metric.Attributes == nil {
+				metric.Attributes = make(map[string]interface{}, 1)
+			}
+			metric.Attributes[requestIdAttribute] = requestId
+		}
+	}
+
+	s.accepted(res, "metrics", len(metrics), s.batch.AddMetrics(requestId, metrics))
+}
+
+func (s *Server) logsHandler(res http.ResponseWriter, req *http.Request) {
+	var records []logRecord
+	if !decodeBody(res, req, &records) {
+		return
+	}
+
+	requestId := s.requestID()
+	lines := make([]logserver.LogLine, 0, len(records))
+	for i, record := range records {
+		if record.Message == "" {
+			http.Error(res, fmt.Sprintf("log record %d is missing a message", i), http.StatusBadRequest)
+			return
+		}
+
+		timestamp := time.Now()
+		if record.Timestamp != 0 {
+			timestamp = time.UnixMilli(record.Timestamp)
+		}
+
+		attributes := record.Attributes
+		if record.Level != "" {
+			if attributes == nil {
+				attributes = make(map[string]interface{}, 1)
+			}
+			attributes["level"] = record.Level
+		}
+
+		lines = append(lines, logserver.LogLine{
+			Time:       timestamp,
+			RequestID:  requestId,
+			Content:    []byte(record.Message),
+			Attributes: attributes,
+		})
+	}
+
+	s.accepted(res, "log records", len(lines), s.batch.AddLogs(requestId, lines))
+}
+
+func (s *Server) accepted(res http.ResponseWriter, kind string, count int, inv *telemetry.Invocation) {
+	if inv == nil {
+		logger.Debugf("Dropped %d custom %s; there is no invocation to attach them to", count, kind)
+		http.Error(res, "no invocation in progress", http.StatusServiceUnavailable)
+		return
+	}
+
+	logger.WithRequestID(inv.RequestId).Debugf("Accepted %d custom %s", count, kind)
+	res.WriteHeader(http.StatusAccepted)
+}
+
+// decodeBody decodes a POSTed JSON array, or a single JSON object, into target, which must
+// point to a slice. It writes an error response, and returns false, when the body is invalid.
+func decodeBody(res http.ResponseWriter, req *http.Request, target interface{}) bool {
+	defer util.Close(req.Body)
+
+	if req.Method != http.MethodPost {
+		res.Header().Set("Allow", http.MethodPost)
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(res, "request body too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		}
+		return false
+	}
+
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		body = append(append([]byte{'['}, body...), ']')
+	}
+
+	if err = json.Unmarshal(body, target); err != nil {
+		http.Error(res, fmt.Sprintf("invalid JSON payload: %v", err), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,137 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRequestId = "test-request-id"
+
+func startTestServer(t *testing.T, eventsEnabled bool) (*Server, *telemetry.Batch) {
+	batch := telemetry.NewBatch(1000, 10000, false)
+	batch.AddInvocation(testRequestId, time.Now())
+
+	server, err := startInternal("localhost:0", batch, func() string { return testRequestId }, eventsEnabled)
+	assert.NoError(t, err)
+
+	return server, batch
+}
+
+func post(t *testing.T, server *Server, path string, body string) int {
+	res, err := http.Post(fmt.Sprintf("http://localhost:%d%s", server.Port(), path), "application/json", bytes.NewBufferString(body))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestIngestEvents(t *testing.T) {
+	server, batch := startTestServer(t, true)
+	defer server.Close()
+
+	assert.Equal(t, http.StatusAccepted, post(t, server, "/v1/events", `[{"eventType": "Order", "total": 12.5}]`))
+	assert.Equal(t, http.StatusAccepted, post(t, server, "/v1/events", ` {"eventType": "Order", "timestamp": 1000}`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server, "/v1/events", `[{"total": 12.5}]`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server, "/v1/events", `not json`))
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+
+	events := harvested[0].Events
+	assert.Len(t, events, 2)
+	assert.Equal(t, "Order", events[0]["eventType"])
+	assert.Equal(t, testRequestId, events[0]["faas.execution"])
+	assert.NotNil(t, events[0]["timestamp"])
+	assert.Equal(t, float64(1000), events[1]["timestamp"])
+}
+
+func TestIngestEventsWithoutAccount(t *testing.T) {
+	server, _ := startTestServer(t, false)
+	defer server.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, post(t, server, "/v1/events", `[{"eventType": "Order"}]`))
+}
+
+func TestIngestMetrics(t *testing.T) {
+	server, batch := startTestServer(t, false)
+	defer server.Close()
+
+	assert.Equal(t, http.StatusAccepted, post(t, server, "/v1/metrics", `[
+		{"name": "queue.depth", "value": 7, "attributes": {"queue": "a"}},
+		{"name": "orders", "type": "count", "value": 2, "interval.ms": 1000}
+	]`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server, "/v1/metrics", `[{"value": 7}]`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server, "/v1/metrics", `[{"name": "orders", "type": "count", "value": 2}]`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server, "/v1/metrics", `[{"name": "latency", "type": "summary", "value": 2}]`))
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+
+	metrics := harvested[0].Metrics
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, "gauge", metrics[0].Type)
+	assert.Equal(t, "a", metrics[0].Attributes["queue"])
+	assert.Equal(t, testRequestId, metrics[0].Attributes["faas.execution"])
+	assert.NotZero(t, metrics[0].Timestamp)
+	assert.Equal(t, int64(1000), metrics[1].Interval)
+}
+
+func TestIngestLogs(t *testing.T) {
+	server, batch := startTestServer(t, false)
+	defer server.Close()
+
+	assert.Equal(t, http.StatusAccepted, post(t, server, "/v1/logs", `[{"message": "order placed", "level": "INFO", "timestamp": 1603821157000}]`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server, "/v1/logs", `[{"level": "INFO"}]`))
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+
+	logs := harvested[0].Logs
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "order placed", string(logs[0].Content))
+	assert.Equal(t, testRequestId, logs[0].RequestID)
+	assert.Equal(t, "INFO", logs[0].Attributes["level"])
+	assert.Equal(t, time.UnixMilli(1603821157000), logs[0].Time)
+}
+
+func TestIngestWithoutInvocation(t *testing.T) {
+	batch := telemetry.NewBatch(1000, 10000, false)
+	server, err := startInternal("localhost:0", batch, func() string { return "" }, false)
+	assert.NoError(t, err)
+	defer server.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, post(t, server, "/v1/logs", `{"message": "too early"}`))
+}
+
+func TestIngestMethodNotAllowed(t *testing.T) {
+	server, _ := startTestServer(t, false)
+	defer server.Close()
+
+	res, err := http.Get(fmt.Sprintf("http://localhost:%d/v1/metrics", server.Port()))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestIngestBodyTooLarge(t *testing.T) {
+	server, _ := startTestServer(t, false)
+	defer server.Close()
+
+	body := `[{"message": "` + string(bytes.Repeat([]byte("a"), maxBodyBytes)) + `"}]`
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(t, server, "/v1/logs", body))
+}
+
+func TestStart(t *testing.T) {
+	batch := telemetry.NewBatch(1000, 10000, false)
+	server, err := Start(&config.Configuration{IngestAPIPort: 0, AccountID: "12345"}, batch, func() string { return "" })
+	assert.NoError(t, err)
+	assert.True(t, server.eventsEnabled)
+	assert.NotZero(t, server.Port())
+	assert.Nil(t, server.Close())
+}
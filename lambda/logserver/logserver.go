@@ -23,29 +23,114 @@ const (
 	platformLogBufferSize = 100
 )
 
+// maxRuntimeDone is how many platform.runtimeDone records are held until they're taken
+const maxRuntimeDone = platformLogBufferSize
+
+// maxOutOfMemoryFaults is how many out-of-memory faults are held until they're taken
+const maxOutOfMemoryFaults = platformLogBufferSize
+
+// outOfMemoryErrorType marks the platform faults of invocations that ran out of memory
+const outOfMemoryErrorType = "Runtime.OutOfMemory"
+
 var (
 	osStatFunc  = os.Stat
 	testMode    = false
 	testRuntime = ""
+
+	logger = util.NewComponentLogger("logserver")
 )
 
 type LogLine struct {
 	Time      time.Time
 	RequestID string
 	Content   []byte
+	// Attributes are added to the log record when it is sent, e.g. for records from the ingest API
+	Attributes map[string]interface{}
+	// Report holds what a platform report says that its REPORT line doesn't
+	Report *ReportDetails
+}
+
+// ReportDetails are the values of a platform.report record that aren't in the REPORT line. The
+// line is sent as New Relic parses it, so these are only passed on to the extension.
+type ReportDetails struct {
+	// RestoreDuration is in milliseconds, for SnapStart restores
+	RestoreDuration *float64
+	// Status is success, error, timeout or failure
+	Status    string
+	ErrorType string
 }
 
 type LogServer struct {
 	listenString      string
 	server            *http.Server
 	platformLogChan   chan LogLine
-	functionLogChan   chan []LogLine
+	functionLogs      *functionLogQueue
 	lastRequestId     string
 	lastRequestIdLock *sync.Mutex
 	isShuttingDown    bool
 	shutdownLock      sync.RWMutex
 	runtime           string
 	wg                sync.WaitGroup
+	dropLock          sync.Mutex
+	platformDrops     DropStats
+	dropsSince        time.Time
+	dropTotals        DropStats
+	runtimeDoneLock   sync.Mutex
+	runtimeDone       []RuntimeDone
+	faultsLock        sync.Mutex
+	outOfMemoryFaults []OutOfMemoryFault
+	spansLock         sync.Mutex
+	platformSpans     []PlatformSpans
+	initStart         time.Time
+}
+
+// RuntimeDone is a platform.runtimeDone record: the runtime finished an invocation at Time
+type RuntimeDone struct {
+	Time      time.Time
+	RequestID string
+	Status    string
+	// Duration is how long the runtime took, in milliseconds. The Telemetry API schema has it;
+	// the older schema doesn't.
+	Duration *float64
+}
+
+// OutOfMemoryFault is a platform.fault record of an invocation that ran out of memory. The record
+// is a function log; this is passed on to the extension separately, as the report may not say so.
+type OutOfMemoryFault struct {
+	Time      time.Time
+	RequestID string
+}
+
+// DropStats counts the function logs that were dropped over a period
+type DropStats struct {
+	Start time.Time
+	End   time.Time
+	// QueueDroppedLines were dropped by the extension, because its log queue was full
+	QueueDroppedLines uint64
+	// PlatformDropEvents is how many platform.logsDropped events the platform sent, and
+	// PlatformDroppedRecords and PlatformDroppedBytes are their totals
+	PlatformDropEvents     uint64
+	PlatformDroppedRecords uint64
+	PlatformDroppedBytes   uint64
+}
+
+// IsEmpty is true when nothing was dropped
+func (s DropStats) IsEmpty() bool {
+	return s.QueueDroppedLines == 0 && s.PlatformDropEvents == 0
+}
+
+// DroppedLines is how many function log lines, or records, were dropped by the extension and the
+// platform
+func (s DropStats) DroppedLines() uint64 {
+	return s.QueueDroppedLines + s.PlatformDroppedRecords
+}
+
+// add adds the counts of other
+func (s *DropStats) add(other DropStats) {
+	s.QueueDroppedLines += other.QueueDroppedLines
+	s.PlatformDropEvents += other.PlatformDropEvents
+	s.PlatformDroppedRecords += other.PlatformDroppedRecords
+	s.PlatformDroppedBytes += other.PlatformDroppedBytes
 }
 
 type functionLogJSON struct {
@@ -74,7 +159,7 @@ func (ls *LogServer) Close() error {
 	}
 	ls.wg.Wait()
 	close(ls.platformLogChan)
-	close(ls.functionLogChan)
+	ls.functionLogs.close()
 	return ret
 }
 
@@ -95,9 +180,125 @@ func (ls *LogServer) PollPlatformChannel() []LogLine {
 	}
 }
 
+// LastRequestID returns the request ID of the most recent platform.start event
+func (ls *LogServer) LastRequestID() string {
+	ls.lastRequestIdLock.Lock()
+	defer ls.lastRequestIdLock.Unlock()
+
+	return ls.lastRequestId
+}
+
 func (ls *LogServer) AwaitFunctionLogs() ([]LogLine, bool) {
-	ll, more := <-ls.functionLogChan
-	return ll, more
+	return ls.functionLogs.pop()
+}
+
+// TakeDropStats returns what was dropped since the last call, and resets the counts
+func (ls *LogServer) TakeDropStats() DropStats {
+	ls.dropLock.Lock()
+	defer ls.dropLock.Unlock()
+
+	now := time.Now()
+	stats := ls.platformDrops
+	stats.Start = ls.dropsSince
+	stats.End = now
+	stats.QueueDroppedLines = ls.functionLogs.dropped.Swap(0)
+
+	ls.platformDrops = DropStats{}
+	ls.dropsSince = now
+	ls.dropTotals.add(stats)
+	return stats
+}
+
+// TotalDropStats returns what was dropped since the log server started, including what
+// TakeDropStats hasn't returned yet
+func (ls *LogServer) TotalDropStats() DropStats {
+	ls.dropLock.Lock()
+	defer ls.dropLock.Unlock()
+
+	totals := ls.dropTotals
+	pending := ls.platformDrops
+	pending.QueueDroppedLines = ls.functionLogs.dropped.Load()
+	totals.add(pending)
+	totals.End = time.Now()
+	return totals
+}
+
+// TakeRuntimeDone returns the platform.runtimeDone records received since the last call
+func (ls *LogServer) TakeRuntimeDone() []RuntimeDone {
+	ls.runtimeDoneLock.Lock()
+	defer ls.runtimeDoneLock.Unlock()
+
+	ret := ls.runtimeDone
+	ls.runtimeDone = nil
+	return ret
+}
+
+// TakeOutOfMemoryFaults returns the out-of-memory platform faults received since the last call
+func (ls *LogServer) TakeOutOfMemoryFaults() []OutOfMemoryFault {
+	ls.faultsLock.Lock()
+	defer ls.faultsLock.Unlock()
+
+	ret := ls.outOfMemoryFaults
+	ls.outOfMemoryFaults = nil
+	return ret
+}
+
+// recordOutOfMemoryFault keeps an out-of-memory fault, dropping the oldest when too many haven't
+// been taken
+func (ls *LogServer) recordOutOfMemoryFault(fault OutOfMemoryFault) {
+	ls.faultsLock.Lock()
+	defer ls.faultsLock.Unlock()
+
+	if len(ls.outOfMemoryFaults) == maxOutOfMemoryFaults {
+		ls.outOfMemoryFaults = ls.outOfMemoryFaults[1:]
+	}
+	ls.outOfMemoryFaults = append(ls.outOfMemoryFaults, fault)
+}
+
+// recordRuntimeDone keeps a platform.runtimeDone record, dropping the oldest when too many
+// haven't been taken
+func (ls *LogServer) recordRuntimeDone(eventTime time.Time, record interface{}) {
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return
+	}
+	requestId, _ := fields["requestId"].(string)
+	if requestId == "" {
+		return
+	}
+
+	runtimeDone := RuntimeDone{Time: eventTime, RequestID: requestId}
+	runtimeDone.Status, _ = fields["status"].(string)
+	if metrics, ok := fields["metrics"].(map[string]interface{}); ok {
+		if duration, ok := metrics["durationMs"].(float64); ok {
+			runtimeDone.Duration = &duration
+		}
+	}
+
+	ls.runtimeDoneLock.Lock()
+	defer ls.runtimeDoneLock.Unlock()
+
+	if len(ls.runtimeDone) == maxRuntimeDone {
+		ls.runtimeDone = ls.runtimeDone[1:]
+	}
+	ls.runtimeDone = append(ls.runtimeDone, runtimeDone)
+}
+
+// recordPlatformDrop counts a platform.logsDropped event. In the Telemetry API schema, its record
+// holds droppedRecords and droppedBytes; the older schema only has a message.
+func (ls *LogServer) recordPlatformDrop(record interface{}) {
+	ls.dropLock.Lock()
+	defer ls.dropLock.Unlock()
+
+	ls.platformDrops.PlatformDropEvents++
+	if fields, ok := record.(map[string]interface{}); ok {
+		if records, ok := fields["droppedRecords"].(float64); ok {
+			ls.platformDrops.PlatformDroppedRecords += uint64(records)
+		}
+		if droppedBytes, ok := fields["droppedBytes"].(float64); ok {
+			ls.platformDrops.PlatformDroppedBytes += uint64(droppedBytes)
+		}
+	}
 }
 
 func formatReport(metrics map[string]interface{}) string {
@@ -122,9 +323,23 @@ func formatReport(metrics map[string]interface{}) string {
 	if val, ok := metrics["initDurationMs"]; ok {
 		ret += fmt.Sprintf("\tInit Duration: %.2f ms", val)
 	}
-	util.Debugf("Formatted Return Report: %s", ret)
+	logger.Debugf("Formatted Return Report: %s", ret)
 	return ret
 }
+
+// reportDetails takes the values of a platform.report record that formatReport leaves out
+func reportDetails(record map[string]interface{}) *ReportDetails {
+	details := &ReportDetails{}
+	if metrics, ok := record["metrics"].(map[string]interface{}); ok {
+		if restoreDuration, ok := metrics["restoreDurationMs"].(float64); ok {
+			details.RestoreDuration = &restoreDuration
+		}
+	}
+	details.Status, _ = record["status"].(string)
+	details.ErrorType, _ = record["errorType"].(string)
+	return details
+}
+
 func ExtractRequestId(recordString string) (string, error) {
 	fields := strings.Split(recordString, "\t")
 	if len(fields) >= 2 {
@@ -144,26 +359,29 @@ var reportStringRegExp, _ = regexp.Compile("RequestId: ([a-fA-F0-9-]+)(.*)")
 
 func (ls *LogServer) handler(res http.ResponseWriter, req *http.Request) {
 	defer util.Close(req.Body)
-	ls.wg.Add(1)
-	defer ls.wg.Done()
 
+	// Register the request while holding the lock, so that Close can't be waiting already
 	ls.shutdownLock.RLock()
 	logServerShuttingDown := ls.isShuttingDown
+	if !logServerShuttingDown {
+		ls.wg.Add(1)
+	}
 	ls.shutdownLock.RUnlock()
 	if logServerShuttingDown {
 		_, _ = res.Write(nil)
 		return
 	}
+	defer ls.wg.Done()
 
 	bodyBytes, err := io.ReadAll(req.Body)
 	if err != nil {
-		util.Logf("Error processing log request: %v", err)
+		logger.Warnf("Error processing log request: %v", err)
 	}
 
 	var logEvents []api.LogEvent
 	err = json.Unmarshal(bodyBytes, &logEvents)
 	if err != nil {
-		util.Logf("Error parsing log payload: %v", err)
+		logger.Warnf("Error parsing log payload: %v", err)
 	}
 
 	var functionLogs []LogLine
@@ -184,13 +402,16 @@ func (ls *LogServer) handler(res http.ResponseWriter, req *http.Request) {
 			}
 			ls.lastRequestIdLock.Unlock()
 		case "platform.report":
+			ls.recordSpans(event.Record)
 			metricString := ""
 			requestId := ""
+			var details *ReportDetails
 			switch event.Record.(type) {
 			case map[string]interface{}:
 				record := event.Record.(map[string]interface{})
 				metrics := record["metrics"].(map[string]interface{})
 				metricString = formatReport(metrics)
+				details = reportDetails(record)
 				requestId = record["requestId"].(string)
 			case string:
 				recordString := event.Record.(string)
@@ -201,7 +422,7 @@ func (ls *LogServer) handler(res http.ResponseWriter, req *http.Request) {
 						metricString = results[2]
 					}
 				} else {
-					util.Debugf("Unknown platform log: %s", recordString)
+					logger.Debugf("Unknown platform log: %s", recordString)
 				}
 			}
 
@@ -214,10 +435,19 @@ func (ls *LogServer) handler(res http.ResponseWriter, req *http.Request) {
 				Time:      event.Time,
 				RequestID: requestId,
 				Content:   []byte(reportStr),
+				Report:    details,
 			}
 			ls.platformLogChan <- reportLine
+		case "platform.runtimeDone":
+			ls.recordRuntimeDone(event.Time, event.Record)
+			ls.recordSpans(event.Record)
+		case "platform.initStart":
+			ls.recordInitStart(event.Time)
+		case "platform.initReport":
+			ls.recordInitReport(event.Time, event.Record)
 		case "platform.logsDropped":
-			util.Logf("Platform dropped logs: %v", event.Record)
+			logger.Logf("Platform dropped logs: %v", event.Record)
+			ls.recordPlatformDrop(event.Record)
 		case "function":
 			recordString := event.Record.(string)
 			var requestId string
@@ -244,29 +474,33 @@ func (ls *LogServer) handler(res http.ResponseWriter, req *http.Request) {
 		case "extension", "platform.fault":
 			record := event.Record.(string)
 			ls.lastRequestIdLock.Lock()
+			requestId := ls.lastRequestId
+			ls.lastRequestIdLock.Unlock()
 			functionLogs = append(functionLogs, LogLine{
 				Time:      event.Time,
-				RequestID: ls.lastRequestId,
+				RequestID: requestId,
 				Content:   []byte(record),
 			})
-			ls.lastRequestIdLock.Unlock()
+			if event.Type == "platform.fault" && strings.Contains(record, outOfMemoryErrorType) {
+				ls.recordOutOfMemoryFault(OutOfMemoryFault{Time: event.Time, RequestID: requestId})
+			}
 		default:
-			//util.Debugln("Ignored log event of type ", event.Type, string(bodyBytes))
+			//logger.Debugln("Ignored log event of type ", event.Type, string(bodyBytes))
 		}
 	}
 
 	if len(functionLogs) > 0 {
-		ls.functionLogChan <- functionLogs
+		ls.functionLogs.push(functionLogs)
 	}
 
 	_, _ = res.Write(nil)
 }
 
 func Start(conf *config.Configuration) (*LogServer, error) {
-	return startInternal(conf.LogServerHost)
+	return startInternal(conf.LogServerHost, newFunctionLogQueue(conf.LogQueueSize, conf.LogQueuePolicy, conf.LogQueueTimeout))
 }
 
-func startInternal(host string) (*LogServer, error) {
+func startInternal(host string, functionLogs *functionLogQueue) (*LogServer, error) {
 	listener, err := net.Listen("tcp", host+":")
 	if err != nil {
 		return nil, err
@@ -275,14 +509,17 @@ func startInternal(host string) (*LogServer, error) {
 	server := &http.Server{}
 
 	currentRuntime := detectRuntime()
+	startTime := time.Now()
 
 	logServer := &LogServer{
 		listenString:      listener.Addr().String(),
 		server:            server,
 		platformLogChan:   make(chan LogLine, platformLogBufferSize),
-		functionLogChan:   make(chan []LogLine),
+		functionLogs:      functionLogs,
 		lastRequestIdLock: &sync.Mutex{},
 		runtime:           currentRuntime,
+		dropsSince:        startTime,
+		dropTotals:        DropStats{Start: startTime},
 	}
 
 	mux := http.NewServeMux()
@@ -290,8 +527,8 @@ func startInternal(host string) (*LogServer, error) {
 	server.Handler = mux
 
 	go func() {
-		util.Logln("Starting log server.")
-		util.Logf("Log server started to terminate: %v\n", server.Serve(listener))
+		logger.Logln("Starting log server.")
+		logger.Logf("Log server started to terminate: %v\n", server.Serve(listener))
 	}()
 
 	return logServer, nil
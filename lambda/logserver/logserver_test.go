@@ -22,7 +22,7 @@ import (
 )
 
 func TestLogServer(t *testing.T) {
-	logs, err := startInternal("localhost")
+	logs, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
 	assert.NoError(t, err)
 
 	testEvents := []api.LogEvent{
@@ -38,6 +38,7 @@ func TestLogServer(t *testing.T) {
 					"initDurationMs":   202.0,
 				},
 				"requestId": "testRequestId",
+				"status":    "timeout",
 			},
 		},
 	}
@@ -60,12 +61,26 @@ func TestLogServer(t *testing.T) {
 
 	assert.Equal(t, 1, len(logLines))
 	assert.Equal(t, "REPORT RequestId: testRequestId\tDuration: 25.30 ms\tBilled Duration: 100 ms\tMemory Size: 128 MB\tMax Memory Used: 74 MB\tInit Duration: 202.00 ms", string(logLines[0].Content))
+	assert.Equal(t, "timeout", logLines[0].Report.Status)
 
 	assert.Nil(t, logs.Close())
 }
 
+func TestReportDetails(t *testing.T) {
+	// The REPORT line is left as the platform formats it
+	assert.Equal(t, "", formatReport(map[string]interface{}{"restoreDurationMs": 310.25}))
+
+	restoreDuration := 310.25
+	assert.Equal(t, &ReportDetails{Status: "success"}, reportDetails(map[string]interface{}{"status": "success"}))
+	assert.Equal(t, &ReportDetails{RestoreDuration: &restoreDuration, Status: "error", ErrorType: "Runtime.OutOfMemory"}, reportDetails(map[string]interface{}{
+		"metrics":   map[string]interface{}{"restoreDurationMs": 310.25},
+		"status":    "error",
+		"errorType": "Runtime.OutOfMemory",
+	}))
+}
+
 func TestFunctionLogs(t *testing.T) {
-	logs, err := startInternal("localhost")
+	logs, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
 	assert.NoError(t, err)
 
 	logs.runtime = "Node"
@@ -341,7 +356,7 @@ func TestFunctionLogs(t *testing.T) {
 }
 
 func TestExtensionLogs(t *testing.T) {
-	logs, err := startInternal("localhost")
+	logs, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
 	assert.NoError(t, err)
 
 	testEvents := []api.LogEvent{
@@ -404,6 +419,166 @@ func TestExtensionLogs(t *testing.T) {
 	assert.Nil(t, logs.Close())
 }
 
+func TestOutOfMemoryFault(t *testing.T) {
+	logs, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
+	assert.NoError(t, err)
+
+	testEvents := []api.LogEvent{
+		{
+			Time:   time.Now(),
+			Type:   "platform.start",
+			Record: map[string]interface{}{"requestId": "oom-request-id"},
+		},
+		{
+			Time:   time.Now(),
+			Type:   "platform.fault",
+			Record: "RequestId: oom-request-id Error: Runtime exited with error: signal: killed\nRuntime.OutOfMemory",
+		},
+	}
+
+	testEventBytes, err := json.Marshal(testEvents)
+	assert.NoError(t, err)
+
+	realEndpoint := fmt.Sprintf("http://localhost:%d", logs.Port())
+	res, err := http.Post(realEndpoint, "application/json", bytes.NewBuffer(testEventBytes))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	logLines, _ := logs.AwaitFunctionLogs()
+	assert.Equal(t, 1, len(logLines))
+	assert.Equal(t, "oom-request-id", logLines[0].RequestID)
+
+	// The fault isn't platform telemetry, which is sent on
+	assert.Empty(t, logs.PollPlatformChannel())
+	faults := logs.TakeOutOfMemoryFaults()
+	assert.Equal(t, 1, len(faults))
+	assert.Equal(t, "oom-request-id", faults[0].RequestID)
+	assert.Empty(t, logs.TakeOutOfMemoryFaults())
+
+	assert.Nil(t, logs.Close())
+}
+
+func TestLogServerRuntimeDone(t *testing.T) {
+	logs, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
+	assert.NoError(t, err)
+
+	doneTime := time.Unix(1700000000, 0).UTC()
+	testEvents := []api.LogEvent{
+		{
+			Time:   doneTime,
+			Type:   "platform.runtimeDone",
+			Record: map[string]interface{}{"requestId": "request-1", "status": "success"},
+		},
+		{
+			Time: doneTime.Add(time.Second),
+			Type: "platform.runtimeDone",
+			Record: map[string]interface{}{
+				"requestId": "request-2",
+				"status":    "error",
+				"metrics":   map[string]interface{}{"durationMs": 123.5, "producedBytes": 10},
+			},
+		},
+		// Not a record of the Telemetry API, or the Logs API
+		{
+			Time:   doneTime,
+			Type:   "platform.runtimeDone",
+			Record: "request-3",
+		},
+	}
+
+	testEventBytes, err := json.Marshal(testEvents)
+	assert.NoError(t, err)
+
+	realEndpoint := fmt.Sprintf("http://localhost:%d", logs.Port())
+	res, err := http.Post(realEndpoint, "application/json", bytes.NewBuffer(testEventBytes))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	duration := 123.5
+	assert.Equal(t, []RuntimeDone{
+		{Time: doneTime, RequestID: "request-1", Status: "success"},
+		{Time: doneTime.Add(time.Second), RequestID: "request-2", Status: "error", Duration: &duration},
+	}, logs.TakeRuntimeDone())
+	assert.Empty(t, logs.TakeRuntimeDone())
+
+	for i := 0; i < maxRuntimeDone+1; i++ {
+		logs.recordRuntimeDone(doneTime, map[string]interface{}{"requestId": fmt.Sprintf("request-%d", i)})
+	}
+	runtimeDone := logs.TakeRuntimeDone()
+	assert.Len(t, runtimeDone, maxRuntimeDone)
+	assert.Equal(t, "request-1", runtimeDone[0].RequestID)
+
+	assert.Nil(t, logs.Close())
+}
+
+func TestLastRequestID(t *testing.T) {
+	logs, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "", logs.LastRequestID())
+
+	testEvents := []api.LogEvent{
+		{
+			Time: time.Now(),
+			Type: "platform.start",
+			Record: map[string]interface{}{
+				"requestId": "testRequestId",
+			},
+		},
+	}
+
+	testEventBytes, err := json.Marshal(testEvents)
+	assert.NoError(t, err)
+
+	realEndpoint := fmt.Sprintf("http://localhost:%d", logs.Port())
+	res, err := http.Post(realEndpoint, "application/json", bytes.NewBuffer(testEventBytes))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	assert.Equal(t, "testRequestId", logs.LastRequestID())
+	assert.Nil(t, logs.Close())
+}
+
+func TestLogServerDropStats(t *testing.T) {
+	logServer, err := startInternal("localhost", newFunctionLogQueue(1, config.LogQueueDropNewest, 0))
+	require.NoError(t, err)
+	defer logServer.Close()
+
+	logEvents := []api.LogEvent{
+		{Time: time.Now(), Type: "function", Record: "log line 1"},
+		{Time: time.Now(), Type: "platform.logsDropped", Record: map[string]interface{}{"reason": "Consumer seems to have fallen behind", "droppedRecords": 3, "droppedBytes": 1024}},
+		{Time: time.Now(), Type: "platform.logsDropped", Record: "Dropped 5 logs due to buffer overflow"},
+	}
+	jsonData, err := json.Marshal(logEvents)
+	require.NoError(t, err)
+
+	// The second request doesn't fit in the queue
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		logServer.handler(recorder, httptest.NewRequest("POST", "/", bytes.NewBuffer(jsonData)))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	stats := logServer.TakeDropStats()
+	assert.False(t, stats.IsEmpty())
+	assert.Equal(t, uint64(1), stats.QueueDroppedLines)
+	assert.Equal(t, uint64(4), stats.PlatformDropEvents)
+	assert.Equal(t, uint64(6), stats.PlatformDroppedRecords)
+	assert.Equal(t, uint64(2048), stats.PlatformDroppedBytes)
+	assert.True(t, stats.End.After(stats.Start))
+
+	assert.True(t, logServer.TakeDropStats().IsEmpty())
+
+	// Totals include what's been taken, and what hasn't
+	logServer.handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/", bytes.NewBuffer(jsonData)))
+	totals := logServer.TotalDropStats()
+	assert.Equal(t, uint64(2), totals.QueueDroppedLines)
+	assert.Equal(t, uint64(6), totals.PlatformDropEvents)
+	assert.Equal(t, uint64(9), totals.PlatformDroppedRecords)
+	assert.Equal(t, uint64(11), totals.DroppedLines())
+	assert.False(t, logServer.TakeDropStats().IsEmpty())
+	assert.Equal(t, totals.PlatformDroppedRecords, logServer.TotalDropStats().PlatformDroppedRecords)
+}
+
 func TestLogServerStart(t *testing.T) {
 	logs, err := Start(&config.Configuration{LogServerHost: "localhost"})
 	assert.NoError(t, err)
@@ -411,7 +586,7 @@ func TestLogServerStart(t *testing.T) {
 }
 
 func TestLogServerCloseShutdownFlag(t *testing.T) {
-	logServer, err := startInternal("localhost")
+	logServer, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
 	require.NoError(t, err)
 	require.NotNil(t, logServer)
 
@@ -430,7 +605,7 @@ func TestLogServerCloseShutdownFlag(t *testing.T) {
 }
 
 func TestLogServerHandlerDuringShutdown(t *testing.T) {
-	logServer, err := startInternal("localhost")
+	logServer, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
 	require.NoError(t, err)
 	require.NotNil(t, logServer)
 
@@ -458,7 +633,7 @@ func TestLogServerHandlerDuringShutdown(t *testing.T) {
 	assert.Equal(t, http.StatusOK, recorder.Code)
 
 	select {
-	case logs := <-logServer.functionLogChan:
+	case logs := <-logServer.functionLogs.batches:
 		t.Fatalf("Expected no logs to be processed, but got: %v", logs)
 	default:
 	}
@@ -486,7 +661,7 @@ func SendFunctionLogsContinuously(logServer *LogServer, t *testing.T) {
 }
 
 func TestLogServerShutdownDuringRequests(t *testing.T) {
-	logServer, err := startInternal("localhost")
+	logServer, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
 	require.NoError(t, err)
 	require.NotNil(t, logServer)
 	var wg sync.WaitGroup
@@ -0,0 +1,91 @@
+package logserver
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+)
+
+// functionLogQueue holds function log batches until they are shipped. It is bounded, so that a
+// slow consumer can't hold up the Logs API's requests; what doesn't fit is dropped, and counted.
+type functionLogQueue struct {
+	batches chan []LogLine
+	policy  string
+	timeout time.Duration
+	// dropped counts the log lines that didn't fit
+	dropped atomic.Uint64
+}
+
+// newFunctionLogQueue creates a queue of up to size batches. Zero values get the defaults.
+func newFunctionLogQueue(size uint32, policy string, timeout time.Duration) *functionLogQueue {
+	if size == 0 {
+		size = config.DefaultLogQueueSize
+	}
+	if policy == "" {
+		policy = config.LogQueueDropOldest
+	}
+	if timeout <= 0 {
+		timeout = config.DefaultLogQueueTimeout
+	}
+
+	return &functionLogQueue{
+		batches: make(chan []LogLine, size),
+		policy:  policy,
+		timeout: timeout,
+	}
+}
+
+// push adds a batch to the queue. When the queue is full, the overflow policy decides which
+// batch is dropped: the oldest queued, this one, or this one once the timeout has elapsed.
+func (q *functionLogQueue) push(lines []LogLine) {
+	select {
+	case q.batches <- lines:
+		return
+	default:
+	}
+
+	switch q.policy {
+	case config.LogQueueDropNewest:
+		q.drop(lines)
+	case config.LogQueueBlock:
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+
+		select {
+		case q.batches <- lines:
+		case <-timer.C:
+			q.drop(lines)
+		}
+	default:
+		for {
+			select {
+			case q.batches <- lines:
+				return
+			default:
+			}
+
+			// Another request may have taken the free slot, or the consumer emptied the queue
+			select {
+			case oldest := <-q.batches:
+				q.drop(oldest)
+			default:
+			}
+		}
+	}
+}
+
+func (q *functionLogQueue) drop(lines []LogLine) {
+	total := q.dropped.Add(uint64(len(lines)))
+	logger.Debugf("Function log queue is full; dropped %d log lines (%d in total)", len(lines), total)
+}
+
+// pop waits for the next batch. It returns false once the queue is closed and empty.
+func (q *functionLogQueue) pop() ([]LogLine, bool) {
+	lines, more := <-q.batches
+	return lines, more
+}
+
+func (q *functionLogQueue) close() {
+	close(q.batches)
+}
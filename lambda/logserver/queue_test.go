@@ -0,0 +1,74 @@
+package logserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+)
+
+func testLines(contents ...string) []LogLine {
+	lines := make([]LogLine, 0, len(contents))
+	for _, content := range contents {
+		lines = append(lines, LogLine{Content: []byte(content)})
+	}
+	return lines
+}
+
+func TestFunctionLogQueueDefaults(t *testing.T) {
+	q := newFunctionLogQueue(0, "", 0)
+	assert.Equal(t, config.DefaultLogQueueSize, cap(q.batches))
+	assert.Equal(t, config.LogQueueDropOldest, q.policy)
+	assert.Equal(t, config.DefaultLogQueueTimeout, q.timeout)
+}
+
+func TestFunctionLogQueueDropOldest(t *testing.T) {
+	q := newFunctionLogQueue(2, config.LogQueueDropOldest, 0)
+	q.push(testLines("a", "b"))
+	q.push(testLines("c"))
+	q.push(testLines("d"))
+
+	assert.Equal(t, uint64(2), q.dropped.Load())
+	lines, more := q.pop()
+	assert.True(t, more)
+	assert.Equal(t, "c", string(lines[0].Content))
+	lines, _ = q.pop()
+	assert.Equal(t, "d", string(lines[0].Content))
+
+	q.close()
+	_, more = q.pop()
+	assert.False(t, more)
+}
+
+func TestFunctionLogQueueDropNewest(t *testing.T) {
+	q := newFunctionLogQueue(1, config.LogQueueDropNewest, 0)
+	q.push(testLines("a"))
+	q.push(testLines("b", "c"))
+
+	assert.Equal(t, uint64(2), q.dropped.Load())
+	lines, _ := q.pop()
+	assert.Equal(t, "a", string(lines[0].Content))
+}
+
+func TestFunctionLogQueueBlock(t *testing.T) {
+	q := newFunctionLogQueue(1, config.LogQueueBlock, 50*time.Millisecond)
+	q.push(testLines("a"))
+
+	// Times out, as nothing is consuming
+	start := time.Now()
+	q.push(testLines("b"))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, uint64(1), q.dropped.Load())
+
+	// Goes through, once there is room
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.pop()
+	}()
+	q.push(testLines("c"))
+	assert.Equal(t, uint64(1), q.dropped.Load())
+	lines, _ := q.pop()
+	assert.Equal(t, "c", string(lines[0].Content))
+}
@@ -0,0 +1,127 @@
+package logserver
+
+import (
+	"time"
+)
+
+// maxPlatformSpans is how many records' spans are held until they're taken
+const maxPlatformSpans = platformLogBufferSize
+
+// InitSpanName names the span of the sandbox's initialization
+const InitSpanName = "init"
+
+// PlatformSpan is a phase of the platform's work, such as responseLatency, from the spans of a
+// Telemetry API record
+type PlatformSpan struct {
+	Name  string
+	Start time.Time
+	// Duration is in milliseconds
+	Duration float64
+}
+
+// PlatformSpans are the spans of a platform record. The initialization's spans have no request ID.
+type PlatformSpans struct {
+	RequestID string
+	Spans     []PlatformSpan
+}
+
+// TakePlatformSpans returns the spans of the platform records received since the last call
+func (ls *LogServer) TakePlatformSpans() []PlatformSpans {
+	ls.spansLock.Lock()
+	defer ls.spansLock.Unlock()
+
+	ret := ls.platformSpans
+	ls.platformSpans = nil
+	return ret
+}
+
+// recordSpans keeps the spans of a platform.runtimeDone or platform.report record. Only the
+// Telemetry API schema has them.
+func (ls *LogServer) recordSpans(record interface{}) {
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return
+	}
+	requestId, _ := fields["requestId"].(string)
+	if requestId == "" {
+		return
+	}
+
+	ls.addPlatformSpans(PlatformSpans{RequestID: requestId, Spans: parseSpans(fields["spans"])})
+}
+
+// recordInitStart remembers when the sandbox's initialization started
+func (ls *LogServer) recordInitStart(eventTime time.Time) {
+	ls.spansLock.Lock()
+	defer ls.spansLock.Unlock()
+
+	ls.initStart = eventTime
+}
+
+// recordInitReport keeps the initialization's duration, from a platform.initReport record, as a
+// span, with the record's own spans
+func (ls *LogServer) recordInitReport(eventTime time.Time, record interface{}) {
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	spans := parseSpans(fields["spans"])
+	if metrics, ok := fields["metrics"].(map[string]interface{}); ok {
+		if duration, ok := metrics["durationMs"].(float64); ok {
+			ls.spansLock.Lock()
+			start := ls.initStart
+			ls.spansLock.Unlock()
+			if start.IsZero() {
+				// The report is sent when the initialization ends
+				start = eventTime.Add(-time.Duration(duration * float64(time.Millisecond)))
+			}
+			spans = append([]PlatformSpan{{Name: InitSpanName, Start: start, Duration: duration}}, spans...)
+		}
+	}
+
+	ls.addPlatformSpans(PlatformSpans{Spans: spans})
+}
+
+// addPlatformSpans keeps a record's spans, dropping the oldest when too many haven't been taken
+func (ls *LogServer) addPlatformSpans(spans PlatformSpans) {
+	if len(spans.Spans) == 0 {
+		return
+	}
+
+	ls.spansLock.Lock()
+	defer ls.spansLock.Unlock()
+
+	if len(ls.platformSpans) == maxPlatformSpans {
+		ls.platformSpans = ls.platformSpans[1:]
+	}
+	ls.platformSpans = append(ls.platformSpans, spans)
+}
+
+// parseSpans parses the spans of a Telemetry API record, skipping those that aren't valid
+func parseSpans(value interface{}) []PlatformSpan {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var spans []PlatformSpan
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := fields["name"].(string)
+		startStr, _ := fields["start"].(string)
+		duration, ok := fields["durationMs"].(float64)
+		if name == "" || !ok {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339Nano, startStr)
+		if err != nil {
+			continue
+		}
+		spans = append(spans, PlatformSpan{Name: name, Start: start, Duration: duration})
+	}
+	return spans
+}
@@ -0,0 +1,129 @@
+//go:build !race
+// +build !race
+
+package logserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/extension/api"
+)
+
+func TestLogServerPlatformSpans(t *testing.T) {
+	logs, err := startInternal("localhost", newFunctionLogQueue(0, "", 0))
+	assert.NoError(t, err)
+
+	initStart := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	doneTime := initStart.Add(time.Second)
+	testEvents := []api.LogEvent{
+		{
+			Time:   initStart,
+			Type:   "platform.initStart",
+			Record: map[string]interface{}{"initializationType": "on-demand", "phase": "init"},
+		},
+		{
+			Time: initStart.Add(250 * time.Millisecond),
+			Type: "platform.initReport",
+			Record: map[string]interface{}{
+				"initializationType": "on-demand",
+				"phase":              "init",
+				"metrics":            map[string]interface{}{"durationMs": 250.0},
+			},
+		},
+		{
+			Time: doneTime,
+			Type: "platform.runtimeDone",
+			Record: map[string]interface{}{
+				"requestId": "request-1",
+				"status":    "success",
+				"spans": []interface{}{
+					map[string]interface{}{"name": "responseLatency", "start": "2024-01-02T03:04:05.900Z", "durationMs": 40.5},
+					map[string]interface{}{"name": "responseDuration", "start": "2024-01-02T03:04:05.9405Z", "durationMs": 1.5},
+					// Not valid
+					map[string]interface{}{"name": "runtimeOverhead", "start": "yesterday", "durationMs": 2.0},
+					map[string]interface{}{"start": "2024-01-02T03:04:05.9405Z", "durationMs": 2.0},
+				},
+			},
+		},
+		// The old schema has no spans
+		{
+			Time:   doneTime,
+			Type:   "platform.runtimeDone",
+			Record: map[string]interface{}{"requestId": "request-2", "status": "success"},
+		},
+		{
+			Time: doneTime,
+			Type: "platform.report",
+			Record: map[string]interface{}{
+				"requestId": "request-1",
+				"metrics":   map[string]interface{}{"durationMs": 50.0},
+				"spans": []interface{}{
+					map[string]interface{}{"name": "extensionOverhead", "start": "2024-01-02T03:04:05.95Z", "durationMs": 3.0},
+				},
+			},
+		},
+	}
+
+	testEventBytes, err := json.Marshal(testEvents)
+	assert.NoError(t, err)
+
+	realEndpoint := fmt.Sprintf("http://localhost:%d", logs.Port())
+	res, err := http.Post(realEndpoint, "application/json", bytes.NewBuffer(testEventBytes))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	assert.Equal(t, []PlatformSpans{
+		{Spans: []PlatformSpan{{Name: InitSpanName, Start: initStart, Duration: 250}}},
+		{
+			RequestID: "request-1",
+			Spans: []PlatformSpan{
+				{Name: "responseLatency", Start: initStart.Add(900 * time.Millisecond), Duration: 40.5},
+				{Name: "responseDuration", Start: initStart.Add(940500 * time.Microsecond), Duration: 1.5},
+			},
+		},
+		{
+			RequestID: "request-1",
+			Spans:     []PlatformSpan{{Name: "extensionOverhead", Start: initStart.Add(950 * time.Millisecond), Duration: 3}},
+		},
+	}, logs.TakePlatformSpans())
+	assert.Empty(t, logs.TakePlatformSpans())
+
+	assert.Nil(t, logs.Close())
+}
+
+func TestRecordInitReportWithoutStart(t *testing.T) {
+	logs := &LogServer{}
+
+	reportTime := time.Unix(1700000000, 0).UTC()
+	logs.recordInitReport(reportTime, map[string]interface{}{
+		"metrics": map[string]interface{}{"durationMs": 100.0},
+	})
+	logs.recordInitReport(reportTime, "not a record")
+
+	assert.Equal(t, []PlatformSpans{
+		{Spans: []PlatformSpan{{Name: InitSpanName, Start: reportTime.Add(-100 * time.Millisecond), Duration: 100}}},
+	}, logs.TakePlatformSpans())
+}
+
+func TestAddPlatformSpansLimit(t *testing.T) {
+	logs := &LogServer{}
+
+	for i := 0; i < maxPlatformSpans+1; i++ {
+		logs.addPlatformSpans(PlatformSpans{
+			RequestID: fmt.Sprintf("request-%d", i),
+			Spans:     []PlatformSpan{{Name: "responseLatency"}},
+		})
+	}
+	logs.addPlatformSpans(PlatformSpans{RequestID: "empty"})
+
+	spans := logs.TakePlatformSpans()
+	assert.Len(t, spans, maxPlatformSpans)
+	assert.Equal(t, "request-1", spans[0].RequestID)
+}
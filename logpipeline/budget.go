@@ -0,0 +1,106 @@
+package logpipeline
+
+import (
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/apm"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/statsd"
+)
+
+// budgetDroppedMetric counts the lines dropped over budget, as the log server's drops are counted
+const budgetDroppedMetric = "newrelic.extension.logs.dropped"
+
+// maxBudgetedRequests is how many requests' usage is remembered. Invocations of a sandbox don't
+// overlap, so only the last few requests' lines can still arrive.
+const maxBudgetedRequests = 16
+
+// budgetUsage is what a request has sent
+type budgetUsage struct {
+	lines    uint64
+	bytes    uint64
+	exceeded bool
+}
+
+// BudgetStage limits the lines and bytes of function logs each invocation sends. Lines over
+// budget are dropped, and counted in the newrelic.extension.logs.dropped metric, with a source
+// of budget.
+type BudgetStage struct {
+	maxLines   uint64
+	maxBytes   uint64
+	usage      map[string]*budgetUsage
+	requests   []string
+	aggregator *statsd.Aggregator
+}
+
+// NewBudgetStage creates a BudgetStage. A limit of zero is no limit. Dropped lines are counted
+// by aggregator.
+func NewBudgetStage(maxLines uint32, maxBytes uint32, aggregator *statsd.Aggregator) *BudgetStage {
+	return &BudgetStage{
+		maxLines:   uint64(maxLines),
+		maxBytes:   uint64(maxBytes),
+		usage:      make(map[string]*budgetUsage),
+		aggregator: aggregator,
+	}
+}
+
+// Process drops the lines over their request's budget
+func (s *BudgetStage) Process(lines []logserver.LogLine) []logserver.LogLine {
+	kept := lines[:0:0]
+	dropped := 0
+	for _, line := range lines {
+		usage := s.requestUsage(line.RequestID)
+		if usage.exceeded || s.exceeds(usage, line) {
+			if !usage.exceeded {
+				logger.WithRequestID(line.RequestID).Warnln("Request exceeded its function log budget; further lines are dropped")
+				usage.exceeded = true
+			}
+			dropped++
+			continue
+		}
+
+		usage.lines++
+		usage.bytes += uint64(len(line.Content))
+		kept = append(kept, line)
+	}
+
+	if dropped > 0 {
+		s.aggregator.Add(statsd.Sample{
+			Name:       budgetDroppedMetric,
+			Type:       statsd.Counter,
+			Value:      float64(dropped),
+			SampleRate: 1,
+			Tags:       map[string]string{"source": "budget"},
+		})
+	}
+	return kept
+}
+
+func (s *BudgetStage) exceeds(usage *budgetUsage, line logserver.LogLine) bool {
+	if s.maxLines > 0 && usage.lines+1 > s.maxLines {
+		return true
+	}
+	return s.maxBytes > 0 && usage.bytes+uint64(len(line.Content)) > s.maxBytes
+}
+
+// requestUsage returns the usage of a request, forgetting the oldest request when there are
+// too many
+func (s *BudgetStage) requestUsage(requestID string) *budgetUsage {
+	if usage, ok := s.usage[requestID]; ok {
+		return usage
+	}
+
+	if len(s.requests) == maxBudgetedRequests {
+		delete(s.usage, s.requests[0])
+		s.requests = s.requests[1:]
+	}
+	usage := &budgetUsage{}
+	s.usage[requestID] = usage
+	s.requests = append(s.requests, requestID)
+	return usage
+}
+
+// Harvest returns the count of dropped lines
+func (s *BudgetStage) Harvest(now time.Time, force bool) []apm.Metric {
+	return s.aggregator.Harvest(now, force)
+}
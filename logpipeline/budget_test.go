@@ -0,0 +1,64 @@
+package logpipeline
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/statsd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetStageLines(t *testing.T) {
+	start := time.Now()
+	stage := NewBudgetStage(2, 0, statsd.NewAggregator(time.Minute, nil, start))
+	at := time.Now()
+
+	kept := stage.Process([]logserver.LogLine{
+		requestLine("a", at, "one"),
+		requestLine("b", at, "one"),
+		requestLine("a", at, "two"),
+		requestLine("a", at, "three"),
+	})
+	assert.Equal(t, []string{"one", "one", "two"}, contents(kept))
+
+	kept = stage.Process([]logserver.LogLine{
+		requestLine("a", at, "four"),
+		requestLine("b", at, "two"),
+	})
+	assert.Equal(t, []string{"two"}, contents(kept))
+
+	metrics := stage.Harvest(start, true)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "newrelic.extension.logs.dropped", metrics[0].Name)
+	assert.Equal(t, "count", metrics[0].Type)
+	assert.Equal(t, 2.0, metrics[0].Value)
+	assert.Equal(t, map[string]interface{}{"source": "budget"}, metrics[0].Attributes)
+}
+
+func TestBudgetStageBytes(t *testing.T) {
+	stage := NewBudgetStage(0, 10, statsd.NewAggregator(time.Minute, nil, time.Now()))
+	at := time.Now()
+
+	kept := stage.Process([]logserver.LogLine{
+		requestLine("a", at, "12345"),
+		requestLine("a", at, "123456"),
+		// Once over budget, even lines that would fit are dropped
+		requestLine("a", at, "1234"),
+	})
+	assert.Equal(t, []string{"12345"}, contents(kept))
+	assert.Len(t, stage.Harvest(time.Now(), true), 1)
+}
+
+func TestBudgetStageForgetsOldRequests(t *testing.T) {
+	stage := NewBudgetStage(1, 0, statsd.NewAggregator(time.Minute, nil, time.Now()))
+	at := time.Now()
+
+	for i := 0; i < maxBudgetedRequests*2; i++ {
+		stage.Process([]logserver.LogLine{requestLine(fmt.Sprintf("request-%d", i), at, "line")})
+	}
+	assert.Len(t, stage.usage, maxBudgetedRequests)
+	assert.Len(t, stage.requests, maxBudgetedRequests)
+	assert.Empty(t, stage.Harvest(time.Now(), true))
+}
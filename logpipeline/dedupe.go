@@ -0,0 +1,110 @@
+package logpipeline
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+// repeatCountAttribute is the number of lines a deduplicated record stands for
+const repeatCountAttribute = "repeat.count"
+
+// dedupeDigits matches the numbers that near-identical lines, such as retries and timestamps,
+// differ by
+var dedupeDigits = regexp.MustCompile(`[0-9]+`)
+
+// repeatedRecord is the first of a run of repeated lines
+type repeatedRecord struct {
+	line  logserver.LogLine
+	key   string
+	count int
+	// updated is when the line was last repeated
+	updated time.Time
+}
+
+// DedupeStage collapses runs of identical or near-identical consecutive lines, for the same
+// request, into the first line of the run, with a repeat.count attribute. Lines are near-identical
+// when they differ only by their numbers. A run ends when a different line arrives, or the window
+// has passed since its first line.
+type DedupeStage struct {
+	lock    sync.Mutex
+	window  time.Duration
+	pending map[string]*repeatedRecord
+}
+
+// NewDedupeStage creates a DedupeStage
+func NewDedupeStage(window time.Duration) *DedupeStage {
+	return &DedupeStage{
+		window:  window,
+		pending: make(map[string]*repeatedRecord),
+	}
+}
+
+// Process counts repeated lines. The last line of each request is held, in case it's repeated;
+// Expire returns it once the window has passed.
+func (s *DedupeStage) Process(lines []logserver.LogLine) []logserver.LogLine {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	var complete []logserver.LogLine
+	for _, line := range lines {
+		key := dedupeKey(line.Content)
+		record := s.pending[line.RequestID]
+		if record != nil && record.key == key && line.Time.Sub(record.line.Time) < s.window {
+			record.count++
+			record.updated = now
+			continue
+		}
+
+		if record != nil {
+			complete = append(complete, record.record())
+		}
+		s.pending[line.RequestID] = &repeatedRecord{line: line, key: key, count: 1, updated: now}
+	}
+
+	return complete
+}
+
+// Expire returns the lines that haven't been repeated for the window, or all of them when force
+// is true
+func (s *DedupeStage) Expire(now time.Time, force bool) []logserver.LogLine {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var expired []logserver.LogLine
+	for requestID, record := range s.pending {
+		if force || now.Sub(record.updated) >= s.window {
+			expired = append(expired, record.record())
+			delete(s.pending, requestID)
+		}
+	}
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].Time.Before(expired[j].Time)
+	})
+	return expired
+}
+
+// record is the line, with the number of times it was repeated
+func (r *repeatedRecord) record() logserver.LogLine {
+	if r.count == 1 {
+		return r.line
+	}
+
+	line := r.line
+	line.Attributes = make(map[string]interface{}, len(r.line.Attributes)+1)
+	for k, v := range r.line.Attributes {
+		line.Attributes[k] = v
+	}
+	line.Attributes[repeatCountAttribute] = r.count
+	return line
+}
+
+// dedupeKey is the content with its numbers masked, so that near-identical lines share a key
+func dedupeKey(content []byte) string {
+	return string(dedupeDigits.ReplaceAll(content, []byte("0")))
+}
@@ -0,0 +1,74 @@
+package logpipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupeStage(t *testing.T) {
+	stage := NewDedupeStage(time.Second)
+	at := time.Now()
+
+	complete := stage.Process([]logserver.LogLine{
+		requestLine("a", at, "connecting"),
+		requestLine("a", at, "retrying in 100ms (attempt 1)"),
+		requestLine("a", at, "retrying in 200ms (attempt 2)"),
+		requestLine("a", at, "retrying in 400ms (attempt 3)"),
+		requestLine("a", at, "connected"),
+		requestLine("a", at, "connected"),
+	})
+	assert.Equal(t, []string{"connecting", "retrying in 100ms (attempt 1)"}, contents(complete))
+	assert.Nil(t, complete[0].Attributes)
+	assert.Equal(t, map[string]interface{}{"repeat.count": 3}, complete[1].Attributes)
+
+	// The last line may be repeated in the next batch
+	complete = stage.Process([]logserver.LogLine{requestLine("a", at, "connected")})
+	assert.Empty(t, complete)
+	assert.Empty(t, stage.Expire(time.Now(), false))
+
+	expired := stage.Expire(time.Now().Add(time.Second), false)
+	assert.Equal(t, []string{"connected"}, contents(expired))
+	assert.Equal(t, map[string]interface{}{"repeat.count": 3}, expired[0].Attributes)
+}
+
+func TestDedupeStageWindow(t *testing.T) {
+	stage := NewDedupeStage(time.Second)
+	at := time.Now()
+
+	complete := stage.Process([]logserver.LogLine{
+		requestLine("a", at, "polling"),
+		requestLine("a", at.Add(500*time.Millisecond), "polling"),
+		requestLine("a", at.Add(time.Second), "polling"),
+	})
+	assert.Equal(t, []string{"polling"}, contents(complete))
+	assert.Equal(t, 2, complete[0].Attributes["repeat.count"])
+
+	expired := stage.Expire(time.Now(), true)
+	assert.Equal(t, []string{"polling"}, contents(expired))
+	assert.Nil(t, expired[0].Attributes)
+}
+
+func TestDedupeStagePerRequest(t *testing.T) {
+	stage := NewDedupeStage(time.Second)
+	at := time.Now()
+
+	line := requestLine("a", at, "polling")
+	line.Attributes = map[string]interface{}{"level": "INFO"}
+	stage.Process([]logserver.LogLine{
+		line,
+		requestLine("b", at.Add(time.Millisecond), "polling"),
+		line,
+	})
+
+	expired := stage.Expire(time.Now(), true)
+	assert.Equal(t, []string{"polling", "polling"}, contents(expired))
+	assert.Equal(t, "a", expired[0].RequestID)
+	assert.Equal(t, map[string]interface{}{"level": "INFO", "repeat.count": 2}, expired[0].Attributes)
+	assert.Equal(t, "b", expired[1].RequestID)
+	assert.Nil(t, expired[1].Attributes)
+	// The original attributes aren't modified
+	assert.Equal(t, map[string]interface{}{"level": "INFO"}, line.Attributes)
+}
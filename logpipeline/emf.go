@@ -0,0 +1,165 @@
+package logpipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/apm"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/statsd"
+)
+
+// emfMarker is the key of the metadata that makes a JSON log line an EMF document
+var emfMarker = []byte(`"_aws"`)
+
+// emfMetadata is the _aws object of a CloudWatch Embedded Metric Format document
+type emfMetadata struct {
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// EMFStage translates CloudWatch Embedded Metric Format documents in function logs into
+// dimensional metrics. Each value is recorded as a distribution sample, tagged with the
+// namespace, unit and dimensions.
+type EMFStage struct {
+	aggregator *statsd.Aggregator
+	// forwardLogs keeps EMF documents in the function logs, once their metrics are extracted
+	forwardLogs bool
+}
+
+// NewEMFStage creates an EMFStage. Metrics are aggregated by aggregator.
+func NewEMFStage(aggregator *statsd.Aggregator, forwardLogs bool) *EMFStage {
+	return &EMFStage{aggregator: aggregator, forwardLogs: forwardLogs}
+}
+
+// Process extracts the metrics of EMF documents, and drops the documents unless they're forwarded
+func (s *EMFStage) Process(lines []logserver.LogLine) []logserver.LogLine {
+	kept := lines[:0:0]
+	for _, line := range lines {
+		samples, ok := parseEMF(line.Content)
+		for _, sample := range samples {
+			s.aggregator.Add(sample)
+		}
+		if !ok || s.forwardLogs {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// Harvest returns the aggregated metrics
+func (s *EMFStage) Harvest(now time.Time, force bool) []apm.Metric {
+	return s.aggregator.Harvest(now, force)
+}
+
+// parseEMF returns the metric samples of an EMF document, and whether content is one. The
+// runtime may prefix the document with a timestamp, request ID and level.
+func parseEMF(content []byte) ([]statsd.Sample, bool) {
+	if !bytes.Contains(content, emfMarker) {
+		return nil, false
+	}
+	start := bytes.IndexByte(content, '{')
+	if start < 0 {
+		return nil, false
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(bytes.TrimSpace(content[start:]), &document); err != nil {
+		return nil, false
+	}
+	var metadata emfMetadata
+	if err := json.Unmarshal(document["_aws"], &metadata); err != nil || len(metadata.CloudWatchMetrics) == 0 {
+		return nil, false
+	}
+
+	var samples []statsd.Sample
+	for _, directive := range metadata.CloudWatchMetrics {
+		// Each dimension set is a separate CloudWatch metric; dimensional metrics need just the one
+		dimensions := make(map[string]string)
+		for _, dimensionSet := range directive.Dimensions {
+			for _, dimension := range dimensionSet {
+				if value, ok := emfDimensionValue(document[dimension]); ok {
+					dimensions[dimension] = value
+				}
+			}
+		}
+
+		for _, definition := range directive.Metrics {
+			values, ok := emfValues(document[definition.Name])
+			if !ok {
+				logger.Debugf("EMF metric %s has no numeric value", definition.Name)
+				continue
+			}
+
+			tags := make(map[string]string, len(dimensions)+2)
+			for k, v := range dimensions {
+				tags[k] = v
+			}
+			if directive.Namespace != "" {
+				tags["namespace"] = directive.Namespace
+			}
+			if definition.Unit != "" {
+				tags["unit"] = definition.Unit
+			}
+
+			for _, value := range values {
+				samples = append(samples, statsd.Sample{
+					Name:       definition.Name,
+					Type:       statsd.Distribution,
+					Value:      value,
+					SampleRate: 1,
+					Tags:       tags,
+				})
+			}
+		}
+	}
+
+	return samples, true
+}
+
+// emfValues reads a metric's value, which may be a number or an array of numbers
+func emfValues(raw json.RawMessage) ([]float64, bool) {
+	if raw == nil {
+		return nil, false
+	}
+
+	var value float64
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return []float64{value}, true
+	}
+
+	var values []float64
+	if err := json.Unmarshal(raw, &values); err == nil && len(values) > 0 {
+		return values, true
+	}
+
+	return nil, false
+}
+
+// emfDimensionValue reads a dimension's value, which should be a string
+func emfDimensionValue(raw json.RawMessage) (string, bool) {
+	if raw == nil {
+		return "", false
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil || value == nil {
+		return "", false
+	}
+	if str, ok := value.(string); ok {
+		return str, true
+	}
+	return fmt.Sprint(value), true
+}
@@ -0,0 +1,64 @@
+package logpipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/statsd"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+const emfDocument = `{"_aws": {"Timestamp": 1574109732004, "CloudWatchMetrics": [{"Namespace": "orders", "Dimensions": [["service"], ["service", "region"]], "Metrics": [{"Name": "latency", "Unit": "Milliseconds"}, {"Name": "items"}, {"Name": "missing"}]}]}, "service": "checkout", "region": "us-east-1", "latency": [10, 30], "items": 3, "requestId": "a-request-id"}`
+
+func TestParseEMF(t *testing.T) {
+	samples, ok := parseEMF([]byte(emfDocument))
+	assert.True(t, ok)
+
+	latencyTags := map[string]string{"service": "checkout", "region": "us-east-1", "namespace": "orders", "unit": "Milliseconds"}
+	itemsTags := map[string]string{"service": "checkout", "region": "us-east-1", "namespace": "orders"}
+	assert.Equal(t, []statsd.Sample{
+		{Name: "latency", Type: statsd.Distribution, Value: 10, SampleRate: 1, Tags: latencyTags},
+		{Name: "latency", Type: statsd.Distribution, Value: 30, SampleRate: 1, Tags: latencyTags},
+		{Name: "items", Type: statsd.Distribution, Value: 3, SampleRate: 1, Tags: itemsTags},
+	}, samples)
+}
+
+func TestParseEMFPrefixed(t *testing.T) {
+	samples, ok := parseEMF([]byte("2024-01-01T00:00:00.000Z\ta-request-id\tINFO\t" + emfDocument + "\n"))
+	assert.True(t, ok)
+	assert.Len(t, samples, 3)
+}
+
+func TestParseEMFNotEMF(t *testing.T) {
+	for _, content := range []string{
+		"an unrelated line",
+		`{"message": "a JSON line"}`,
+		`the "_aws" key, but not JSON`,
+		`{"_aws": {"Timestamp": 1574109732004}}`,
+		`{"_aws": "not metadata"}`,
+	} {
+		samples, ok := parseEMF([]byte(content))
+		assert.False(t, ok, content)
+		assert.Empty(t, samples, content)
+	}
+}
+
+func TestEMFStage(t *testing.T) {
+	start := time.Now()
+	lines := logLines("an unrelated line", emfDocument)
+
+	forwarding := NewEMFStage(statsd.NewAggregator(time.Minute, map[string]string{"faas.name": "my-function"}, start), true)
+	assert.Equal(t, lines, forwarding.Process(lines))
+
+	metrics := metricsByName(forwarding.Harvest(start.Add(time.Minute), false))
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, &telemetry.Summary{Count: 2, Sum: 40, Min: 10, Max: 30}, metrics["latency"].Summary)
+	assert.Equal(t, "my-function", metrics["latency"].Attributes["faas.name"])
+	assert.Equal(t, "Milliseconds", metrics["latency"].Attributes["unit"])
+	assert.Equal(t, &telemetry.Summary{Count: 1, Sum: 3, Min: 3, Max: 3}, metrics["items"].Summary)
+
+	dropping := NewEMFStage(statsd.NewAggregator(time.Minute, nil, start), false)
+	assert.Equal(t, lines[:1], dropping.Process(lines))
+	assert.Len(t, dropping.Harvest(start, true), 2)
+}
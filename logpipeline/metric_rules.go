@@ -0,0 +1,152 @@
+package logpipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/apm"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/statsd"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+// Metric rule types
+const (
+	RuleCount        = "count"
+	RuleDistribution = "distribution"
+)
+
+// valueGroup is the name of the capture group holding a distribution's value. Without it, the
+// first unnamed group is used.
+const valueGroup = "value"
+
+// MetricRule derives a metric from the function log lines that match Pattern. Count rules count
+// the matching lines; distribution rules record the number captured by the pattern. Other named
+// capture groups become attributes of the metric.
+type MetricRule struct {
+	Name       string            `json:"name"`
+	Pattern    string            `json:"pattern"`
+	Type       string            `json:"type,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ParseMetricRules parses a JSON array of rules
+func ParseMetricRules(str string) ([]MetricRule, error) {
+	var rules []MetricRule
+	if err := json.Unmarshal([]byte(str), &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+type compiledRule struct {
+	MetricRule
+	pattern *regexp.Regexp
+	// valueIndex is the submatch holding a distribution's value
+	valueIndex int
+}
+
+// MetricRuleStage aggregates metrics derived from function log lines. Lines are passed on
+// unchanged.
+type MetricRuleStage struct {
+	rules      []compiledRule
+	aggregator *statsd.Aggregator
+}
+
+// NewMetricRuleStage compiles the rules. Metrics are aggregated by aggregator.
+func NewMetricRuleStage(rules []MetricRule, aggregator *statsd.Aggregator) (*MetricRuleStage, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i)
+		}
+		if rule.Type == "" {
+			rule.Type = RuleCount
+		}
+		if rule.Type != RuleCount && rule.Type != RuleDistribution {
+			return nil, fmt.Errorf("rule %s has unknown type %q", rule.Name, rule.Type)
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+
+		valueIndex := pattern.SubexpIndex(valueGroup)
+		if valueIndex < 0 {
+			for j, name := range pattern.SubexpNames() {
+				if j > 0 && name == "" {
+					valueIndex = j
+					break
+				}
+			}
+		}
+		if rule.Type == RuleDistribution && valueIndex < 0 {
+			return nil, fmt.Errorf("rule %s has no capture group for its value", rule.Name)
+		}
+
+		compiled = append(compiled, compiledRule{MetricRule: rule, pattern: pattern, valueIndex: valueIndex})
+	}
+
+	return &MetricRuleStage{rules: compiled, aggregator: aggregator}, nil
+}
+
+// Process matches each line against the rules
+func (s *MetricRuleStage) Process(lines []logserver.LogLine) []logserver.LogLine {
+	for _, line := range lines {
+		for _, rule := range s.rules {
+			s.match(rule, line.Content)
+		}
+	}
+	return lines
+}
+
+func (s *MetricRuleStage) match(rule compiledRule, content []byte) {
+	match := rule.pattern.FindSubmatch(content)
+	if match == nil {
+		return
+	}
+
+	sample := statsd.Sample{
+		Name:       rule.Name,
+		Type:       statsd.Counter,
+		Value:      1,
+		SampleRate: 1,
+		Tags:       ruleAttributes(rule, match),
+	}
+
+	if rule.Type == RuleDistribution {
+		value, err := strconv.ParseFloat(string(match[rule.valueIndex]), 64)
+		if err != nil {
+			logger.With(util.Fields{"rule": rule.Name}).Debugf("Log metric value %q is not a number", match[rule.valueIndex])
+			return
+		}
+		sample.Type = statsd.Distribution
+		sample.Value = value
+	}
+
+	s.aggregator.Add(sample)
+}
+
+// ruleAttributes are the rule's attributes, and its named capture groups
+func ruleAttributes(rule compiledRule, match [][]byte) map[string]string {
+	attributes := make(map[string]string, len(rule.Attributes))
+	for k, v := range rule.Attributes {
+		attributes[k] = v
+	}
+	for i, name := range rule.pattern.SubexpNames() {
+		if name == "" || i == rule.valueIndex || match[i] == nil {
+			continue
+		}
+		attributes[name] = string(match[i])
+	}
+	return attributes
+}
+
+// Harvest returns the aggregated metrics
+func (s *MetricRuleStage) Harvest(now time.Time, force bool) []apm.Metric {
+	return s.aggregator.Harvest(now, force)
+}
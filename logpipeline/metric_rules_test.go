@@ -0,0 +1,101 @@
+package logpipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/statsd"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+func logLines(contents ...string) []logserver.LogLine {
+	lines := make([]logserver.LogLine, 0, len(contents))
+	for _, content := range contents {
+		lines = append(lines, logserver.LogLine{
+			Time:      time.Now(),
+			RequestID: "a-request-id",
+			Content:   []byte(content),
+		})
+	}
+	return lines
+}
+
+func metricsByName(metrics []telemetry.Metric) map[string]telemetry.Metric {
+	byName := make(map[string]telemetry.Metric, len(metrics))
+	for _, metric := range metrics {
+		byName[metric.Name] = metric
+	}
+	return byName
+}
+
+func TestParseMetricRules(t *testing.T) {
+	rules, err := ParseMetricRules(`[
+		{"name": "app.errors", "pattern": "ERROR"},
+		{"name": "app.latency", "pattern": "latency=(\\d+)ms", "type": "distribution", "attributes": {"unit": "ms"}}
+	]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []MetricRule{
+		{Name: "app.errors", Pattern: "ERROR"},
+		{Name: "app.latency", Pattern: `latency=(\d+)ms`, Type: RuleDistribution, Attributes: map[string]string{"unit": "ms"}},
+	}, rules)
+
+	_, err = ParseMetricRules(`{"name": "app.errors"`)
+	assert.Error(t, err)
+}
+
+func TestNewMetricRuleStageInvalid(t *testing.T) {
+	aggregator := statsd.NewAggregator(time.Minute, nil, time.Now())
+
+	for _, rule := range []MetricRule{
+		{Pattern: "ERROR"},
+		{Name: "app.errors", Pattern: "ERROR", Type: "gauge"},
+		{Name: "app.errors", Pattern: "ERROR("},
+		{Name: "app.latency", Pattern: "latency=\\d+ms", Type: RuleDistribution},
+	} {
+		_, err := NewMetricRuleStage([]MetricRule{rule}, aggregator)
+		assert.Error(t, err, rule)
+	}
+}
+
+func TestMetricRuleStage(t *testing.T) {
+	start := time.Now()
+	aggregator := statsd.NewAggregator(time.Minute, map[string]string{"faas.name": "my-function"}, start)
+	stage, err := NewMetricRuleStage([]MetricRule{
+		{Name: "app.errors", Pattern: "ERROR"},
+		{Name: "app.latency", Pattern: `latency=(\d+)ms`, Type: RuleDistribution},
+		{Name: "app.requests", Pattern: `status=(?P<status>\d+) took (?P<value>[\d.]+)`, Type: RuleDistribution, Attributes: map[string]string{"service": "orders"}},
+	}, aggregator)
+	assert.NoError(t, err)
+
+	lines := logLines(
+		"ERROR something broke",
+		"handled request latency=12ms",
+		"handled request latency=30ms",
+		"handled request latency=ms",
+		"ERROR something else broke, latency=3ms",
+		"status=200 took 1.5",
+		"an unrelated line",
+	)
+	assert.Equal(t, lines, stage.Process(lines))
+
+	assert.Empty(t, stage.Harvest(start.Add(time.Second), false))
+
+	metrics := metricsByName(stage.Harvest(start.Add(time.Minute), false))
+	assert.Len(t, metrics, 3)
+
+	errors := metrics["app.errors"]
+	assert.Equal(t, "count", errors.Type)
+	assert.Equal(t, 2.0, errors.Value)
+	assert.Equal(t, start.UnixMilli(), errors.Timestamp)
+	assert.Equal(t, map[string]interface{}{"faas.name": "my-function"}, errors.Attributes)
+
+	latency := metrics["app.latency"]
+	assert.Equal(t, "summary", latency.Type)
+	assert.Equal(t, &telemetry.Summary{Count: 3, Sum: 45, Min: 3, Max: 30}, latency.Summary)
+
+	requests := metrics["app.requests"]
+	assert.Equal(t, &telemetry.Summary{Count: 1, Sum: 1.5, Min: 1.5, Max: 1.5}, requests.Summary)
+	assert.Equal(t, map[string]interface{}{"faas.name": "my-function", "service": "orders", "status": "200"}, requests.Attributes)
+}
@@ -0,0 +1,178 @@
+// Package logpipeline processes function logs between the Logs API and New Relic. Each stage
+// sees the lines of a batch in order, and may derive metrics from them.
+package logpipeline
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/apm"
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/statsd"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+var logger = util.NewComponentLogger("logpipeline")
+
+// Stage processes a batch of function log lines, returning the lines to pass on
+type Stage interface {
+	Process(lines []logserver.LogLine) []logserver.LogLine
+}
+
+// MetricStage is a Stage that derives metrics from the lines it processes
+type MetricStage interface {
+	Stage
+	// Harvest returns the metrics aggregated over the harvest window, once it has elapsed, or
+	// right away when force is true
+	Harvest(now time.Time, force bool) []apm.Metric
+}
+
+// BufferingStage is a Stage that holds lines back across batches
+type BufferingStage interface {
+	Stage
+	// Expire returns the held lines that are due, or all of them when force is true
+	Expire(now time.Time, force bool) []logserver.LogLine
+}
+
+// Pipeline runs function log batches through its stages, and harvests the metrics they derive
+type Pipeline struct {
+	// lock keeps lines passing through the stages in order
+	lock   sync.Mutex
+	stages []Stage
+}
+
+// New creates a Pipeline of the given stages
+func New(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Configured is true when conf enables any stage
+func Configured(conf *config.Configuration) bool {
+	return conf.LogStitchingEnabled ||
+		conf.LogMetricRules != "" ||
+		conf.EMFEnabled ||
+		conf.LogSeverityEnabled ||
+		len(conf.LogSamplingRates) > 0 ||
+		conf.LogDedupeEnabled ||
+		conf.LogBudgetLines > 0 ||
+		conf.LogBudgetBytes > 0
+}
+
+// Start creates the Pipeline configured in conf. Multi-line records are stitched first, so that
+// later stages see them whole. Derived metrics are aggregated over the harvest ripe window, and
+// tagged like StatsD metrics.
+func Start(conf *config.Configuration, functionName string, functionVersion string) (*Pipeline, error) {
+	var stages []Stage
+
+	window := time.Duration(conf.RipeMillis) * time.Millisecond
+	attributes := statsd.MetricAttributes(functionName, functionVersion)
+
+	if conf.LogStitchingEnabled {
+		start := RuntimeStartPattern()
+		if conf.LogStitchingPattern != "" {
+			pattern, err := regexp.Compile(conf.LogStitchingPattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log stitching pattern: %v", err)
+			}
+			start = pattern
+		}
+		stages = append(stages, NewStitchStage(start, int(conf.LogStitchingMaxSize), conf.LogStitchingTimeout))
+		logger.Debugf("Stitching multi-line function logs that don't match %s", start)
+	}
+
+	if conf.LogMetricRules != "" {
+		rules, err := ParseMetricRules(conf.LogMetricRules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log metric rules: %v", err)
+		}
+
+		stage, err := NewMetricRuleStage(rules, statsd.NewAggregator(window, attributes, time.Now()))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log metric rules: %v", err)
+		}
+		stages = append(stages, stage)
+		logger.Debugf("Deriving metrics from function logs with %d rules", len(rules))
+	}
+
+	if conf.EMFEnabled {
+		stages = append(stages, NewEMFStage(statsd.NewAggregator(window, attributes, time.Now()), conf.EMFForwardLogs))
+		logger.Debugln("Translating CloudWatch EMF metrics in function logs")
+	}
+
+	// Sampling comes after the metric stages, so that metrics are derived from every line
+	if conf.LogSeverityEnabled || len(conf.LogSamplingRates) > 0 {
+		stages = append(stages, NewSeverityStage(conf.LogSamplingRates))
+		logger.Debugf("Detecting the level of function logs, sampled at %v", conf.LogSamplingRates)
+	}
+
+	if conf.LogDedupeEnabled {
+		stages = append(stages, NewDedupeStage(conf.LogDedupeWindow))
+		logger.Debugf("Collapsing repeated function logs within %v", conf.LogDedupeWindow)
+	}
+
+	// The budget is spent on what would be sent
+	if conf.LogBudgetLines > 0 || conf.LogBudgetBytes > 0 {
+		stages = append(stages, NewBudgetStage(conf.LogBudgetLines, conf.LogBudgetBytes, statsd.NewAggregator(window, attributes, time.Now())))
+		logger.Debugf("Limiting function logs to %d lines and %d bytes an invocation", conf.LogBudgetLines, conf.LogBudgetBytes)
+	}
+
+	return New(stages...), nil
+}
+
+// Process runs a batch of lines through each stage in turn
+func (p *Pipeline) Process(lines []logserver.LogLine) []logserver.LogLine {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return process(p.stages, lines)
+}
+
+func process(stages []Stage, lines []logserver.LogLine) []logserver.LogLine {
+	for _, stage := range stages {
+		if len(lines) == 0 {
+			break
+		}
+		lines = stage.Process(lines)
+	}
+	return lines
+}
+
+// Buffering is true when stages hold lines back, so Expire needs to be called
+func (p *Pipeline) Buffering() bool {
+	for _, stage := range p.stages {
+		if _, ok := stage.(BufferingStage); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Expire returns the lines that stages have held back, once they're due, after running them
+// through the rest of the pipeline. When force is true, every held line is returned.
+func (p *Pipeline) Expire(now time.Time, force bool) []logserver.LogLine {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var expired []logserver.LogLine
+	for i, stage := range p.stages {
+		if bufferingStage, ok := stage.(BufferingStage); ok {
+			expired = append(expired, process(p.stages[i+1:], bufferingStage.Expire(now, force))...)
+		}
+	}
+	return expired
+}
+
+// Harvest returns the metrics derived by the stages once the harvest window has elapsed, or
+// right away when force is true
+func (p *Pipeline) Harvest(now time.Time, force bool) []apm.Metric {
+	var metrics []apm.Metric
+	for _, stage := range p.stages {
+		if metricStage, ok := stage.(MetricStage); ok {
+			metrics = append(metrics, metricStage.Harvest(now, force)...)
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,68 @@
+package logpipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/stretchr/testify/assert"
+)
+
+// dropStage drops lines containing its text
+type dropStage string
+
+func (s dropStage) Process(lines []logserver.LogLine) []logserver.LogLine {
+	var kept []logserver.LogLine
+	for _, line := range lines {
+		if string(line.Content) != string(s) {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+func TestPipelineProcess(t *testing.T) {
+	pipeline := New(dropStage("a"), dropStage("b"))
+
+	processed := pipeline.Process(logLines("a", "b", "c"))
+	assert.Len(t, processed, 1)
+	assert.Equal(t, "c", string(processed[0].Content))
+
+	assert.Empty(t, pipeline.Process(logLines("a")))
+	assert.Empty(t, New().Process(nil))
+}
+
+func TestPipelineHarvest(t *testing.T) {
+	conf := &config.Configuration{
+		RipeMillis:     config.DefaultRipeMillis,
+		LogMetricRules: `[{"name": "app.errors", "pattern": "ERROR"}]`,
+	}
+	pipeline, err := Start(conf, "my-function", "$LATEST")
+	assert.NoError(t, err)
+
+	pipeline.Process(logLines("ERROR one", "INFO two", "ERROR three"))
+
+	assert.Empty(t, pipeline.Harvest(time.Now(), false))
+
+	metrics := pipeline.Harvest(time.Now(), true)
+	assert.Len(t, metrics, 1)
+
+	metric := metrics[0]
+	assert.Equal(t, "app.errors", metric.Name)
+	assert.Equal(t, "count", metric.Type)
+	assert.Equal(t, 2.0, metric.Value)
+	assert.Equal(t, "my-function", metric.Attributes["faas.name"])
+	assert.Equal(t, "$LATEST", metric.Attributes["faas.version"])
+
+	// Nothing new to send
+	assert.Empty(t, pipeline.Harvest(time.Now(), true))
+}
+
+func TestStartInvalidRules(t *testing.T) {
+	_, err := Start(&config.Configuration{LogMetricRules: `[{"name": "app.errors", "pattern": "("}]`}, "my-function", "$LATEST")
+	assert.Error(t, err)
+
+	_, err = Start(&config.Configuration{LogMetricRules: `not json`}, "my-function", "$LATEST")
+	assert.Error(t, err)
+}
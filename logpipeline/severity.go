@@ -0,0 +1,131 @@
+package logpipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+// levelAttribute is the log record attribute holding the detected severity
+const levelAttribute = "level"
+
+var (
+	// pythonLevel matches the Lambda Python runtime's log handler: [LEVEL]\ttimestamp\trequestId\tmessage
+	pythonLevel = regexp.MustCompile(`^\[([A-Za-z]+)\]\t`)
+	// lambdaLevel matches the Lambda Node and Java runtimes' format: timestamp\trequestId\tLEVEL\tmessage
+	lambdaLevel = regexp.MustCompile(`^\S+\t\S+\t([A-Za-z]+)\t`)
+	// pythonLoggingLevel matches Python's default logging format: LEVEL:logger:message
+	pythonLoggingLevel = regexp.MustCompile(`^(DEBUG|INFO|WARNING|ERROR|CRITICAL):`)
+)
+
+// NormalizeLevel maps a severity onto TRACE, DEBUG, INFO, WARN, ERROR or FATAL. It returns
+// false when level isn't one of them.
+func NormalizeLevel(level string) (string, bool) {
+	switch level = strings.ToUpper(strings.TrimSpace(level)); level {
+	case "TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL":
+		return level, true
+	case "WARNING":
+		return "WARN", true
+	case "CRITICAL":
+		return "FATAL", true
+	default:
+		return "", false
+	}
+}
+
+// DetectLevel finds the severity of a log line written by the Lambda runtimes' log formats,
+// Python's logging module, or as JSON with a level field
+func DetectLevel(content []byte) (string, bool) {
+	trimmed := bytes.TrimLeft(content, " \t")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var record struct {
+			Level string `json:"level"`
+		}
+		// Stitched records may have lines after the JSON object
+		if err := json.NewDecoder(bytes.NewReader(trimmed)).Decode(&record); err == nil {
+			return NormalizeLevel(record.Level)
+		}
+		return "", false
+	}
+
+	for _, pattern := range []*regexp.Regexp{pythonLevel, lambdaLevel, pythonLoggingLevel} {
+		if match := pattern.FindSubmatch(content); match != nil {
+			return NormalizeLevel(string(match[1]))
+		}
+	}
+	return "", false
+}
+
+// SeverityStage sets the level attribute of log lines whose severity it detects, and samples
+// them by level. Sampling is by request ID, so an invocation's lines of a level are all kept,
+// or all dropped. Lines without a detected level are always kept.
+type SeverityStage struct {
+	sampleRates map[string]float64
+}
+
+// NewSeverityStage creates a SeverityStage. sampleRates holds the fraction of requests whose
+// lines are kept for each level; levels without a rate are kept.
+func NewSeverityStage(sampleRates map[string]float64) *SeverityStage {
+	normalized := make(map[string]float64, len(sampleRates))
+	for level, rate := range sampleRates {
+		if normalizedLevel, ok := NormalizeLevel(level); ok {
+			normalized[normalizedLevel] = rate
+		} else {
+			logger.Warnf("Ignoring the sample rate of unknown log level %s", level)
+		}
+	}
+	return &SeverityStage{sampleRates: normalized}
+}
+
+// Process sets the level of each line, and drops the lines that aren't sampled
+func (s *SeverityStage) Process(lines []logserver.LogLine) []logserver.LogLine {
+	kept := lines[:0:0]
+	sampledOut := 0
+	for _, line := range lines {
+		level, ok := DetectLevel(line.Content)
+		if !ok {
+			kept = append(kept, line)
+			continue
+		}
+
+		if rate, ok := s.sampleRates[level]; ok && !sampled(line.RequestID, rate) {
+			sampledOut++
+			continue
+		}
+
+		attributes := make(map[string]interface{}, len(line.Attributes)+1)
+		for k, v := range line.Attributes {
+			attributes[k] = v
+		}
+		if _, ok := attributes[levelAttribute]; !ok {
+			attributes[levelAttribute] = level
+		}
+		line.Attributes = attributes
+		kept = append(kept, line)
+	}
+
+	if sampledOut > 0 {
+		logger.Debugf("Sampled out %d function log lines", sampledOut)
+	}
+	return kept
+}
+
+// sampled decides whether a request's lines are kept, at the given rate. The decision depends
+// only on the request ID, so it's the same for each of the request's lines, and a request kept
+// at one rate is kept at every higher rate.
+func sampled(requestID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(requestID))
+	return float64(hash.Sum32())/(1<<32) < rate
+}
@@ -0,0 +1,106 @@
+package logpipeline
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLevel(t *testing.T) {
+	for content, expected := range map[string]string{
+		"[INFO]\t2024-01-01T00:00:00.000Z\ta-request-id\tstarted":                   "INFO",
+		"[WARNING]\t2024-01-01T00:00:00.000Z\ta-request-id\tslow":                   "WARN",
+		"2024-01-01T00:00:00.000Z\ta-request-id\tERROR\tInvoke Error":               "ERROR",
+		"2024-01-01T00:00:00.000Z\ta-request-id\tdebug\tdetails":                    "DEBUG",
+		"CRITICAL:root:out of memory":                                               "FATAL",
+		`{"timestamp": "2024-01-01T00:00:00Z", "level": "warn", "message": "slow"}`: "WARN",
+		"{\"level\": \"TRACE\"}\n    at stitched":                                   "TRACE",
+	} {
+		level, ok := DetectLevel([]byte(content))
+		assert.True(t, ok, content)
+		assert.Equal(t, expected, level, content)
+	}
+
+	for _, content := range []string{
+		"a plain print",
+		"[NOTICE]\t2024-01-01T00:00:00.000Z\ta-request-id\tunknown level",
+		`{"message": "no level"}`,
+		`{"level": 3}`,
+		"{not JSON",
+		"",
+	} {
+		_, ok := DetectLevel([]byte(content))
+		assert.False(t, ok, content)
+	}
+}
+
+func TestSeverityStageLevels(t *testing.T) {
+	stage := NewSeverityStage(nil)
+
+	lines := logLines(
+		"[ERROR]\t2024-01-01T00:00:00.000Z\ta-request-id\tfailed",
+		"a plain print",
+	)
+	lines = append(lines, logserver.LogLine{
+		RequestID:  "a-request-id",
+		Content:    []byte("[INFO]\t2024-01-01T00:00:00.000Z\ta-request-id\tingested"),
+		Attributes: map[string]interface{}{"level": "NOTICE", "source": "ingest"},
+	})
+
+	processed := stage.Process(lines)
+	assert.Len(t, processed, 3)
+	assert.Equal(t, map[string]interface{}{"level": "ERROR"}, processed[0].Attributes)
+	assert.Nil(t, processed[1].Attributes)
+	// Levels that were already set are kept
+	assert.Equal(t, map[string]interface{}{"level": "NOTICE", "source": "ingest"}, processed[2].Attributes)
+}
+
+func TestSeverityStageSampling(t *testing.T) {
+	stage := NewSeverityStage(map[string]float64{"debug": 0.5, "WARNING": 0, "verbose": 0.1})
+	assert.Equal(t, map[string]float64{"DEBUG": 0.5, "WARN": 0}, stage.sampleRates)
+
+	keptRequests := 0
+	for i := 0; i < 1000; i++ {
+		requestID := fmt.Sprintf("request-%d", i)
+		var lines []logserver.LogLine
+		for _, level := range []string{"DEBUG", "DEBUG", "INFO", "WARN"} {
+			lines = append(lines, logserver.LogLine{
+				Time:      time.Now(),
+				RequestID: requestID,
+				Content:   []byte(fmt.Sprintf("[%s]\t2024-01-01T00:00:00.000Z\t%s\tmessage", level, requestID)),
+			})
+		}
+
+		processed := stage.Process(lines)
+		switch len(processed) {
+		case 3:
+			// The request's debug lines are kept together
+			keptRequests++
+			assert.Equal(t, "DEBUG", processed[0].Attributes["level"])
+			assert.Equal(t, "DEBUG", processed[1].Attributes["level"])
+			assert.Equal(t, "INFO", processed[2].Attributes["level"])
+		case 1:
+			assert.Equal(t, "INFO", processed[0].Attributes["level"])
+		default:
+			t.Fatalf("request %s kept %d lines", requestID, len(processed))
+		}
+	}
+	assert.InDelta(t, 500, keptRequests, 75)
+}
+
+func TestSampled(t *testing.T) {
+	assert.True(t, sampled("a-request-id", 1))
+	assert.False(t, sampled("a-request-id", 0))
+
+	// A request kept at one rate is kept at higher rates
+	for i := 0; i < 100; i++ {
+		requestID := fmt.Sprintf("request-%d", i)
+		if sampled(requestID, 0.2) {
+			assert.True(t, sampled(requestID, 0.6), requestID)
+		}
+		assert.Equal(t, sampled(requestID, 0.4), sampled(requestID, 0.4), requestID)
+	}
+}
@@ -0,0 +1,134 @@
+package logpipeline
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+// Start patterns recognize the first line of a log record. Lines that don't match continue the
+// record before them, as the lines of a stack trace do.
+var (
+	// timestampStart matches lines that start with a timestamp, as Node's console and most
+	// logging frameworks write them
+	timestampStart = `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}`
+	// pythonStart matches the Lambda Python runtime's log handler, and Python's default format
+	pythonStart = `\[(NOTSET|DEBUG|INFO|WARNING|ERROR|CRITICAL)\]\s|(DEBUG|INFO|WARNING|ERROR|CRITICAL):\S*:`
+	// javaStart matches Log4j and Logback levels, which may follow the timestamp
+	javaStart = `(TRACE|DEBUG|INFO|WARN|ERROR|FATAL)\s`
+	// jsonStart matches structured log lines
+	jsonStart = `\{`
+
+	runtimeStartPatterns = map[string]*regexp.Regexp{
+		"python": regexp.MustCompile(`^(` + timestampStart + `|` + pythonStart + `|` + jsonStart + `)`),
+		"java":   regexp.MustCompile(`^(` + timestampStart + `|` + javaStart + `|` + jsonStart + `)`),
+		"node":   regexp.MustCompile(`^(` + timestampStart + `|` + jsonStart + `)`),
+	}
+	defaultStartPattern = regexp.MustCompile(`^(` + timestampStart + `|` + pythonStart + `|` + javaStart + `|` + jsonStart + `)`)
+)
+
+// RuntimeStartPattern is the start pattern for the function's runtime, from AWS_EXECUTION_ENV
+func RuntimeStartPattern() *regexp.Regexp {
+	executionEnv := strings.ToLower(os.Getenv("AWS_EXECUTION_ENV"))
+	for runtime, pattern := range runtimeStartPatterns {
+		if strings.Contains(executionEnv, runtime) {
+			return pattern
+		}
+	}
+	return defaultStartPattern
+}
+
+// pendingRecord is a record that may yet be continued
+type pendingRecord struct {
+	line logserver.LogLine
+	// updated is when the record was last added to
+	updated time.Time
+}
+
+// StitchStage joins the lines of multi-line log records, such as stack traces, that the runtime
+// wrote as separate lines. Records are stitched per request, and held until a line starts a new
+// record, they reach the maximum size, or no line has continued them for the timeout.
+type StitchStage struct {
+	lock    sync.Mutex
+	start   *regexp.Regexp
+	maxSize int
+	timeout time.Duration
+	pending map[string]*pendingRecord
+}
+
+// NewStitchStage creates a StitchStage. Lines matching start begin a new record.
+func NewStitchStage(start *regexp.Regexp, maxSize int, timeout time.Duration) *StitchStage {
+	return &StitchStage{
+		start:   start,
+		maxSize: maxSize,
+		timeout: timeout,
+		pending: make(map[string]*pendingRecord),
+	}
+}
+
+// Process stitches continuation lines onto the records before them. Records are held back until
+// they're complete; Expire returns them once they've timed out.
+func (s *StitchStage) Process(lines []logserver.LogLine) []logserver.LogLine {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	var complete []logserver.LogLine
+	for _, line := range lines {
+		record := s.pending[line.RequestID]
+		if record != nil && s.continues(record, line) {
+			content := bytes.TrimRight(record.line.Content, "\n")
+			content = append(content, '\n')
+			record.line.Content = append(content, line.Content...)
+			record.updated = now
+			continue
+		}
+
+		if record != nil {
+			complete = append(complete, record.line)
+		}
+
+		// Copy the content, since it will be appended to
+		line.Content = append([]byte(nil), line.Content...)
+		s.pending[line.RequestID] = &pendingRecord{line: line, updated: now}
+	}
+
+	return complete
+}
+
+// continues is true when line belongs to the record
+func (s *StitchStage) continues(record *pendingRecord, line logserver.LogLine) bool {
+	if s.start.Match(line.Content) {
+		return false
+	}
+	if line.Time.Sub(record.line.Time) > s.timeout {
+		return false
+	}
+	return len(record.line.Content)+1+len(line.Content) <= s.maxSize
+}
+
+// Expire returns the records that haven't been continued for the timeout, or all of them when
+// force is true
+func (s *StitchStage) Expire(now time.Time, force bool) []logserver.LogLine {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var expired []logserver.LogLine
+	for requestID, record := range s.pending {
+		if force || now.Sub(record.updated) >= s.timeout {
+			expired = append(expired, record.line)
+			delete(s.pending, requestID)
+		}
+	}
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].Time.Before(expired[j].Time)
+	})
+	return expired
+}
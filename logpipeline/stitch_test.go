@@ -0,0 +1,160 @@
+package logpipeline
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/stretchr/testify/assert"
+)
+
+func requestLine(requestID string, at time.Time, content string) logserver.LogLine {
+	return logserver.LogLine{Time: at, RequestID: requestID, Content: []byte(content)}
+}
+
+func contents(lines []logserver.LogLine) []string {
+	var strs []string
+	for _, line := range lines {
+		strs = append(strs, string(line.Content))
+	}
+	return strs
+}
+
+func TestStitchStagePython(t *testing.T) {
+	stage := NewStitchStage(runtimeStartPatterns["python"], 1024, time.Second)
+	at := time.Now()
+
+	complete := stage.Process([]logserver.LogLine{
+		requestLine("a", at, "[INFO]\t2024-01-01T00:00:00.000Z\ta\tstarting\n"),
+		requestLine("a", at, "[ERROR]\t2024-01-01T00:00:00.000Z\ta\tfailed\n"),
+		requestLine("a", at, "Traceback (most recent call last):\n"),
+		requestLine("a", at, "  File \"/var/task/app.py\", line 3, in handler\n"),
+		requestLine("a", at, "ValueError: boom\n"),
+	})
+	assert.Equal(t, []string{"[INFO]\t2024-01-01T00:00:00.000Z\ta\tstarting\n"}, contents(complete))
+
+	// The stack trace may be continued by the next batch
+	assert.Empty(t, stage.Expire(time.Now(), false))
+
+	expired := stage.Expire(time.Now().Add(time.Second), false)
+	assert.Equal(t, []string{
+		"[ERROR]\t2024-01-01T00:00:00.000Z\ta\tfailed\n" +
+			"Traceback (most recent call last):\n" +
+			"  File \"/var/task/app.py\", line 3, in handler\n" +
+			"ValueError: boom\n",
+	}, contents(expired))
+	assert.Equal(t, "a", expired[0].RequestID)
+	assert.Equal(t, at, expired[0].Time)
+}
+
+func TestStitchStageJava(t *testing.T) {
+	stage := NewStitchStage(runtimeStartPatterns["java"], 1024, time.Second)
+	at := time.Now()
+
+	complete := stage.Process([]logserver.LogLine{
+		requestLine("a", at, "java.lang.IllegalStateException: boom"),
+		requestLine("a", at, "\tat com.example.Handler.handleRequest(Handler.java:12)"),
+		requestLine("a", at, "Caused by: java.io.IOException: closed"),
+		requestLine("a", at, "\t... 3 more"),
+		requestLine("a", at, "2024-01-01 00:00:00 INFO Handler - done"),
+	})
+	assert.Equal(t, []string{
+		"java.lang.IllegalStateException: boom\n" +
+			"\tat com.example.Handler.handleRequest(Handler.java:12)\n" +
+			"Caused by: java.io.IOException: closed\n" +
+			"\t... 3 more",
+	}, contents(complete))
+	assert.Equal(t, []string{"2024-01-01 00:00:00 INFO Handler - done"}, contents(stage.Expire(time.Now(), true)))
+}
+
+func TestStitchStageNode(t *testing.T) {
+	stage := NewStitchStage(runtimeStartPatterns["node"], 1024, time.Second)
+	at := time.Now()
+
+	stage.Process([]logserver.LogLine{
+		requestLine("a", at, "2024-01-01T00:00:00.000Z\ta\tERROR\tInvoke Error \tTypeError: boom"),
+		requestLine("a", at, "    at Runtime.handler (/var/task/index.js:3:9)"),
+	})
+	stage.Process([]logserver.LogLine{
+		requestLine("a", at.Add(10*time.Millisecond), "    at Runtime.handleOnceNonStreaming (file:///var/runtime/index.mjs:1173:29)"),
+	})
+	assert.Equal(t, []string{
+		"2024-01-01T00:00:00.000Z\ta\tERROR\tInvoke Error \tTypeError: boom\n" +
+			"    at Runtime.handler (/var/task/index.js:3:9)\n" +
+			"    at Runtime.handleOnceNonStreaming (file:///var/runtime/index.mjs:1173:29)",
+	}, contents(stage.Expire(time.Now(), true)))
+}
+
+func TestStitchStagePerRequest(t *testing.T) {
+	stage := NewStitchStage(runtimeStartPatterns["node"], 1024, time.Second)
+	at := time.Now()
+
+	stage.Process([]logserver.LogLine{
+		requestLine("a", at, "Error: a"),
+		requestLine("b", at.Add(time.Millisecond), "Error: b"),
+		requestLine("a", at, "    at a"),
+		requestLine("b", at.Add(time.Millisecond), "    at b"),
+	})
+	assert.Equal(t, []string{"Error: a\n    at a", "Error: b\n    at b"}, contents(stage.Expire(time.Now(), true)))
+	assert.Empty(t, stage.Expire(time.Now(), true))
+}
+
+func TestStitchStageLimits(t *testing.T) {
+	stage := NewStitchStage(runtimeStartPatterns["node"], 24, time.Second)
+	at := time.Now()
+
+	complete := stage.Process([]logserver.LogLine{
+		requestLine("a", at, "Error: boom"),
+		requestLine("a", at, "    at one"),
+		requestLine("a", at, "    at two"),
+		// Too long after the record started to belong to it
+		requestLine("a", at.Add(2*time.Second), "    at three"),
+	})
+	assert.Equal(t, []string{"Error: boom\n    at one", "    at two"}, contents(complete))
+	assert.Equal(t, []string{"    at three"}, contents(stage.Expire(time.Now(), true)))
+}
+
+func TestStitchStageDoesNotModifyInput(t *testing.T) {
+	stage := NewStitchStage(runtimeStartPatterns["node"], 1024, time.Second)
+	content := make([]byte, 0, 64)
+	content = append(content, "Error: boom"...)
+
+	stage.Process([]logserver.LogLine{
+		{RequestID: "a", Content: content},
+		{RequestID: "a", Content: []byte("    at one")},
+	})
+	assert.Equal(t, "Error: boom", string(content))
+}
+
+func TestRuntimeStartPattern(t *testing.T) {
+	defer os.Unsetenv("AWS_EXECUTION_ENV")
+
+	os.Setenv("AWS_EXECUTION_ENV", "AWS_Lambda_python3.12")
+	assert.Equal(t, runtimeStartPatterns["python"], RuntimeStartPattern())
+
+	os.Setenv("AWS_EXECUTION_ENV", "AWS_Lambda_java21")
+	assert.Equal(t, runtimeStartPatterns["java"], RuntimeStartPattern())
+
+	os.Setenv("AWS_EXECUTION_ENV", "AWS_Lambda_nodejs20.x")
+	assert.Equal(t, runtimeStartPatterns["node"], RuntimeStartPattern())
+
+	os.Unsetenv("AWS_EXECUTION_ENV")
+	assert.Equal(t, defaultStartPattern, RuntimeStartPattern())
+}
+
+func TestPipelineExpire(t *testing.T) {
+	pipeline := New(NewStitchStage(regexp.MustCompile(`^\S`), 1024, time.Second), dropStage("dropped"))
+	assert.True(t, pipeline.Buffering())
+	assert.False(t, New(dropStage("dropped")).Buffering())
+
+	at := time.Now()
+	assert.Empty(t, pipeline.Process([]logserver.LogLine{
+		requestLine("a", at, "kept"),
+		requestLine("b", at, "dropped"),
+	}))
+
+	assert.Empty(t, pipeline.Expire(time.Now(), false))
+	assert.Equal(t, []string{"kept"}, contents(pipeline.Expire(time.Now(), true)))
+}
@@ -13,7 +13,12 @@ import (
 
 	"github.com/newrelic/newrelic-lambda-extension/apm"
 	"github.com/newrelic/newrelic-lambda-extension/checks"
+	"github.com/newrelic/newrelic-lambda-extension/ingest"
 	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/logpipeline"
+	"github.com/newrelic/newrelic-lambda-extension/otlp"
+	"github.com/newrelic/newrelic-lambda-extension/procsampler"
+	"github.com/newrelic/newrelic-lambda-extension/statsd"
 	"github.com/newrelic/newrelic-lambda-extension/util"
 
 	"github.com/newrelic/newrelic-lambda-extension/config"
@@ -27,6 +32,7 @@ var (
 	invokedFunctionARN string
 	lastEventStart     time.Time
 	lastRequestId      string
+	shutdownReason     api.ShutdownReason
 	rootCtx            context.Context
 	LambdaFunctionName string
 	LambdaAccountId    string
@@ -38,6 +44,44 @@ var (
     entityLock sync.RWMutex
 )
 
+// statsdListener aggregates StatsD metrics from function code, when enabled
+var statsdListener *statsd.Listener
+
+// logPipeline processes function logs before they're sent, when configured
+var logPipeline *logpipeline.Pipeline
+
+// logPipelineExpiryInterval is how often the function logs held back by the log pipeline are checked
+const logPipelineExpiryInterval = 100 * time.Millisecond
+
+// invocationEvents adds an AwsLambdaInvocation event to the batch for each platform report
+var invocationEvents bool
+
+// memoryHistory remembers the sandbox's recent memory usage, to report with out-of-memory errors
+var memoryHistory = telemetry.NewMemoryHistory()
+
+// headroomTracker warns when the sandbox's memory or timeout headroom is low, when enabled
+var headroomTracker *apm.HeadroomTracker
+
+// costEstimator estimates the cost of each invocation, when enabled
+var costEstimator *apm.CostEstimator
+
+// resourceSampler samples the sandbox's resource usage from /proc during each invocation, when enabled
+var resourceSampler *procsampler.Sampler
+
+// overheadTracker times how long the extension holds each invocation open, when enabled
+var overheadTracker *telemetry.OverheadTracker
+
+// platformSpanTracker turns the platform's phases of each invocation into spans, when enabled
+var platformSpanTracker *telemetry.PlatformSpanTracker
+
+// exporter sends harvested telemetry, function logs and custom data
+var exporter telemetry.Exporter
+
+// diagnostics collects the extension's warnings and errors, to send with each harvest
+var diagnostics *telemetry.DiagnosticSink
+
+var logger = util.NewComponentLogger("extension")
+
 func init() {
 	rootCtx = context.Background()
 }
@@ -54,7 +98,7 @@ func main() {
 	go func() {
 		s := <-sigs
 		cancel()
-		util.Logf("Received %v Exiting", s)
+		logger.Logf("Received %v Exiting", s)
 	}()
 
 	// Allow extension to be interrupted with CTRL-C
@@ -71,9 +115,10 @@ func main() {
 	conf := config.ConfigurationFromEnvironment()
 
 	// Optionally enable debug logging, disabled by default
+	util.SetLogFormat(conf.LogFormat)
 	util.ConfigLogger(conf.LogsEnabled, conf.LogLevel)
 
-	util.Logf("Initializing version %s of the New Relic Lambda Extension...", util.Version)
+	logger.Logf("Initializing version %s of the New Relic Lambda Extension...", util.Version)
 
 	// Extensions must register
 	registrationClient := client.New(http.Client{})
@@ -92,19 +137,19 @@ func main() {
 
 	// If extension disabled, go into no op mode
 	if !conf.ExtensionEnabled {
-		util.Logln("Extension telemetry processing disabled")
+		logger.Logln("Extension telemetry processing disabled")
 		noopLoop(ctx, invocationClient)
 		return
 	}
 
 	if conf.APMLambdaMode {
-		util.Logln("APM Lambda mode enabled")
+		logger.Logln("APM Lambda mode enabled")
 	}
 
 	// Attempt to find the license key for telemetry sending
 	licenseKey, err := credentials.GetNewRelicLicenseKey(ctx, conf)
 	if err != nil {
-		util.Logln("Failed to retrieve New Relic license key", err)
+		logger.Logln("Failed to retrieve New Relic license key", err)
 		// We fail open; telemetry will go to CloudWatch instead
 		noopLoop(ctx, invocationClient)
 		return
@@ -115,7 +160,7 @@ func main() {
 	if err != nil {
 		err2 := invocationClient.InitError(ctx, "logServer.start", err)
 		if err2 != nil {
-			util.Logln(err2)
+			logger.Logln(err2)
 		}
 		util.Panic("Failed to start logs HTTP server", err)
 	}
@@ -132,7 +177,7 @@ func main() {
 	if err != nil {
 		err2 := invocationClient.InitError(ctx, "logServer.register", err)
 		if err2 != nil {
-			util.Logln(err2)
+			logger.Logln(err2)
 		}
 		util.Panic("Failed to register with Logs API", err)
 	}
@@ -142,21 +187,129 @@ func main() {
 	if err != nil {
 		err2 := invocationClient.InitError(ctx, "telemetryClient.init", err)
 		if err2 != nil {
-			util.Logln(err2)
+			logger.Logln(err2)
 		}
 		util.Panic("telemetry pipe init failed: ", err)
 	}
 	// Set up the telemetry buffer
-	batch := telemetry.NewBatch(int64(conf.RipeMillis), int64(conf.RotMillis), conf.CollectTraceID)
+	// Platform spans are linked to the agent's trace, so its trace IDs are needed
+	batch := telemetry.NewBatch(int64(conf.RipeMillis), int64(conf.RotMillis), conf.CollectTraceID || conf.PlatformSpansEnabled)
 	// In APM Lambda mode, we don't send telemetry
 	telemetryClient := telemetry.New(registrationResponse.FunctionName, licenseKey, conf.TelemetryEndpoint, conf.LogEndpoint, batch, conf.CollectTraceID, conf.ClientTimeout)
-	
+	telemetryClient.SetCustomDataEndpoints(conf.AccountID, conf.MetricEndpoint, conf.EventEndpoint)
+	telemetryClient.SetOTLPEndpoint(conf.OTLPEndpoint)
+	telemetryClient.SetTraceEndpoint(conf.TraceEndpoint)
+
+	// Accept custom data from function code. It is buffered in the batch, so this isn't available in APM Lambda mode.
+	var ingestServer *ingest.Server
+	if conf.IngestAPIEnabled && conf.APMLambdaMode {
+		logger.Logln("The ingest API is not supported in APM Lambda mode")
+	} else if conf.IngestAPIEnabled {
+		ingestServer, err = ingest.Start(conf, batch, logServer.LastRequestID)
+		if err != nil {
+			// We fail open; function code will get connection errors
+			logger.Warnln("Failed to start ingest API server", err)
+		}
+	}
+
+	if conf.StatsDEnabled {
+		statsdListener, err = statsd.Start(conf, LambdaFunctionName, LambdaFunctionVersion)
+		if err != nil {
+			// We fail open; StatsD metrics will be lost
+			logger.Warnln("Failed to start StatsD listener", err)
+		}
+	}
+
+	if logpipeline.Configured(conf) {
+		logPipeline, err = logpipeline.Start(conf, LambdaFunctionName, LambdaFunctionVersion)
+		if err != nil {
+			// We fail open; function logs are sent as they are
+			logger.Warnln("Failed to start log pipeline", err)
+		}
+	}
+
+	// Accept OTLP data from OpenTelemetry SDKs, and forward it with each harvest
+	var otlpReceiver *otlp.Receiver
+	if conf.OTLPReceiverEnabled {
+		otlpReceiver, err = otlp.Start(conf, batch, logServer.LastRequestID)
+		if err != nil {
+			// We fail open; OTLP exports will fail in function code
+			logger.Warnln("Failed to start OTLP receiver", err)
+		}
+	}
+
+	// In APM Lambda mode, New Relic data goes to the APM entity
+	var internalAPMApp *apm.InternalAPMApp
+	var newRelicExporter telemetry.Exporter = telemetryClient
+	if conf.APMLambdaMode {
+		internalAPMApp = apm.NewApp(ctx, conf, LambdaFunctionName, LambdaAccountId, LambdaFunctionVersion)
+		newRelicExporter = apm.NewExporter(telemetryClient, internalAPMApp, currentEntityGUID)
+	}
+
+	exporter = newRelicExporter
+	if configured, err := telemetry.NewExporter(conf, telemetryClient, newRelicExporter); err != nil {
+		// We fail open; data goes to New Relic instead
+		logger.Warnln("Failed to create exporter", err)
+	} else {
+		exporter = configured
+	}
+
+	// Extension logs already reach New Relic when they're subscribed to
+	if conf.DiagnosticLogsEnabled && !conf.SendExtensionLogs && !conf.APMLambdaMode {
+		diagnostics = telemetry.NewDiagnosticSink(int(conf.DiagnosticLogsRate))
+		util.AddLogSink(diagnostics)
+	}
+
+	// Platform reports are only batched in standard mode
+	if conf.InvocationEventsEnabled && conf.APMLambdaMode {
+		logger.Logln("Invocation events are not supported in APM Lambda mode")
+	} else if conf.InvocationEventsEnabled {
+		invocationEvents = true
+		if exporter == newRelicExporter && !telemetryClient.CanSendEvents() {
+			logger.Warnln("Invocation events require NEW_RELIC_ACCOUNT_ID to be set")
+		}
+	}
+
+	if conf.HeadroomWarningsEnabled {
+		headroomTracker = apm.NewHeadroomTracker(conf.MemoryHeadroomThreshold, conf.TimeoutHeadroomThreshold, conf.HeadroomWarningInterval)
+		if exporter == newRelicExporter && !telemetryClient.CanSendEvents() {
+			logger.Warnln("Headroom warning events require NEW_RELIC_ACCOUNT_ID to be set")
+		}
+	}
+
+	if conf.CostMetricsEnabled {
+		costEstimator, err = apm.StartCostEstimator(conf)
+		if err != nil {
+			// We fail open; invocations have no cost metrics
+			logger.Warnln("Failed to start cost estimation", err)
+		}
+	}
+
+	if conf.ResourceSamplerEnabled {
+		resourceSampler, err = procsampler.Start(conf, telemetryClient.SentBytes)
+		if err != nil {
+			// We fail open; invocations have no resource metrics
+			logger.Warnln("Failed to start resource sampler", err)
+		}
+	}
+
+	if conf.OverheadMetricsEnabled {
+		overheadTracker = telemetry.NewOverheadTracker()
+	}
+
+	if conf.PlatformSpansEnabled {
+		platformSpanTracker = telemetry.NewPlatformSpanTracker()
+	}
+
+	if conf.SandboxEventsEnabled && exporter == newRelicExporter && !telemetryClient.CanSendEvents() {
+		logger.Warnln("Sandbox events require NEW_RELIC_ACCOUNT_ID to be set")
+	}
 
 	// Run startup checks
 	go func() {
 		if conf.IgnoreExtensionChecks["all"] || conf.APMLambdaMode{
 			// Ignore extension checks in APM Mode
-			util.Debugf("Ignoring all extension checks")
+			logger.Debugf("Ignoring all extension checks")
 			return
 		}
 		checks.RunChecks(ctx, conf, registrationResponse, telemetryClient)
@@ -169,61 +322,175 @@ func main() {
 	go func() {
 		defer backgroundTasks.Done()
 		if !conf.APMLambdaMode {
-			logShipLoop(ctx, logServer, telemetryClient, conf.APMLambdaMode)
+			logShipLoop(ctx, logServer)
 		}
 	}()
 
+	// Ship the function logs the log pipeline holds back, such as multi-line records, once they're due
+	stopLogPipelineExpiry := make(chan struct{})
+	if logPipeline != nil && logPipeline.Buffering() {
+		backgroundTasks.Add(1)
+		go func() {
+			defer backgroundTasks.Done()
+			logPipelineExpiryLoop(ctx, stopLogPipelineExpiry)
+		}()
+	}
+
 	var eventCounter int
-	var internalAPMApp *apm.InternalAPMApp
 	// Call next, and process telemetry, until we're shut down
 	if conf.APMLambdaMode {
-		internalAPMApp = apm.NewApp(ctx, conf, LambdaFunctionName, LambdaAccountId, LambdaFunctionVersion)
 		go getAPMEntityGUID(ctx, internalAPMApp, internalAPMApp.LambdaLogChan)
-		go APMlogShipLoop(ctx, logServer, telemetryClient, internalAPMApp)
-		eventCounter = mainAPMLoop(ctx, invocationClient, telemetryChan, logServer, conf, internalAPMApp)
+		go APMlogShipLoop(ctx, logServer)
+		eventCounter = mainAPMLoop(ctx, invocationClient, batch, telemetryChan, logServer, telemetryClient, otlpReceiver != nil)
 	} else {
 		// In non-APM mode, we process telemetry and platform logs
 		eventCounter = mainLoop(ctx, invocationClient, batch, telemetryChan, logServer, telemetryClient, extensionStartup)
 	}
 
-	util.Logf("New Relic Extension shutting down after %v events\n", eventCounter)
+	logger.Logf("New Relic Extension shutting down after %v events\n", eventCounter)
 	if conf.APMLambdaMode {
-		pollLogAPMServer(ctx, logServer, conf)
+		pollLogAPMServer(ctx, logServer, batch, telemetryClient)
 	} else {
-		pollLogServer(logServer, batch)
+		pollLogServer(logServer, batch, telemetryClient)
 	}
 	err = logServer.Close()
 	if err != nil {
-		util.Logln("Error shutting down Log API server", err)
+		logger.Warnln("Error shutting down Log API server", err)
+	}
+	if ingestServer != nil {
+		err = ingestServer.Close()
+		if err != nil {
+			logger.Warnln("Error shutting down ingest API server", err)
+		}
+	}
+	if statsdListener != nil {
+		err = statsdListener.Close()
+		if err != nil {
+			logger.Warnln("Error shutting down StatsD listener", err)
+		}
+	}
+	if otlpReceiver != nil {
+		err = otlpReceiver.Close()
+		if err != nil {
+			logger.Warnln("Error shutting down OTLP receiver", err)
+		}
+	}
+	if conf.SandboxEventsEnabled {
+		addSandboxEvent(ctx, batch, sandboxLifecycle(extensionStartup, eventCounter, logServer, telemetryClient))
 	}
-	if !conf.APMLambdaMode {
+	if !conf.APMLambdaMode || otlpReceiver != nil {
 		finalHarvest := batch.Close()
 		shipHarvest(ctx, finalHarvest, telemetryClient)
 	}
-	util.Debugln("Waiting for background tasks to complete")
+	logger.Debugln("Waiting for background tasks to complete")
+	close(stopLogPipelineExpiry)
 	backgroundTasks.Wait()
+	// Function logs have all been processed, so send what's held back, and what was derived from them
+	if logPipeline != nil {
+		if heldLogs := logPipeline.Expire(time.Now(), true); len(heldLogs) > 0 {
+			shipFunctionLogs(ctx, heldLogs)
+		}
+	}
+	flushStatsD(ctx, true)
+	if diagnostics != nil {
+		util.RemoveLogSinks()
+		diagnostics = nil
+	}
 
 	shutdownAt := time.Now()
 	ranFor := shutdownAt.Sub(extensionStartup)
-	util.Logf("Extension shutdown after %vms", ranFor.Milliseconds())
+	logger.Logf("Extension shutdown after %vms", ranFor.Milliseconds())
 }
 
 // logShipLoop ships function logs to New Relic as they arrive.
-func logShipLoop(ctx context.Context, logServer *logserver.LogServer, telemetryClient *telemetry.Client, isAPMLambdaMode bool) {
+func logShipLoop(ctx context.Context, logServer *logserver.LogServer) {
 	for {
 		functionLogs, more := logServer.AwaitFunctionLogs()
 		if !more {
 			return
 		}
-		err := telemetryClient.SendFunctionLogs(ctx, invokedFunctionARN, functionLogs, "")
-		if err != nil {
-			util.Logf("Failed to send %d function logs", len(functionLogs))
+		functionLogs = processFunctionLogs(functionLogs)
+		if len(functionLogs) == 0 {
+			continue
+		}
+		shipFunctionLogs(ctx, functionLogs)
+	}
+}
+
+// shipFunctionLogs sends function logs through the exporter
+func shipFunctionLogs(ctx context.Context, functionLogs []logserver.LogLine) {
+	if err := exporter.ExportLogs(ctx, invokedFunctionARN, functionLogs); err != nil {
+		logger.With(util.Fields{"lines": len(functionLogs)}).Errorf("Failed to send function logs: %s", err)
+	}
+}
+
+// logPipelineExpiryLoop ships the function logs the log pipeline has held back, once they're due,
+// until stop is closed
+func logPipelineExpiryLoop(ctx context.Context, stop chan struct{}) {
+	ticker := time.NewTicker(logPipelineExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if heldLogs := logPipeline.Expire(now, false); len(heldLogs) > 0 {
+				shipFunctionLogs(ctx, heldLogs)
+			}
 		}
 	}
 }
 
+// processFunctionLogs runs function logs through the log pipeline, if there is one
+func processFunctionLogs(functionLogs []logserver.LogLine) []logserver.LogLine {
+	if logPipeline == nil {
+		return functionLogs
+	}
+	return logPipeline.Process(functionLogs)
+}
+
+// currentEntityGUID returns the APM entity's GUID, once it's known
+func currentEntityGUID() string {
+	entityLock.RLock()
+	defer entityLock.RUnlock()
+	return entityGuid
+}
+
+// exportAgentPayload sends an agent payload through the exporter. The batch isn't harvested in APM
+// Lambda mode, so it's sent right away.
+func exportAgentPayload(ctx context.Context, requestId string, payload []byte) {
+	harvested := []*telemetry.Invocation{telemetry.AgentPayloadInvocation(requestId, time.Now(), payload)}
+	if err := exporter.ExportAgentPayloads(ctx, invokedFunctionARN, harvested); err != nil {
+		logger.WithRequestID(requestId).Errorf("Failed to send agent payload: %s", err)
+	}
+}
+
+// exportAPMError sends a timeout or platform fault through the exporter, in APM Lambda mode
+func exportAPMError(ctx context.Context, platformError telemetry.PlatformError) {
+	inv := telemetry.NewInvocation(platformError.RequestID, platformError.Time)
+	inv.Errors = append(inv.Errors, platformError)
+	if err := exporter.ExportAgentPayloads(ctx, invokedFunctionARN, []*telemetry.Invocation{&inv}); err != nil {
+		logger.WithRequestID(platformError.RequestID).Errorf("Failed to send %s error: %s", platformError.Type, err)
+	}
+}
+
+// exportLambdaMetrics sends the metrics of a platform report or fault through the exporter, in APM
+// Lambda mode
+func exportLambdaMetrics(ctx context.Context, lambdaMetrics *apm.LambdaMetrics, entityGuid string) {
+	metrics := lambdaMetrics.ConvertToMetrics(apm.MetricPrefix, entityGuid, LambdaFunctionName)
+	if costEstimator != nil {
+		metrics = append(metrics, lambdaMetrics.ConvertToCostMetrics(apm.MetricPrefix, entityGuid, LambdaFunctionName, costEstimator)...)
+	}
+	if err := exporter.ExportMetrics(ctx, invokedFunctionARN, metrics); err != nil {
+		logger.WithRequestID(lambdaMetrics.RequestID).Errorf("Error sending metric: %v", err)
+	}
+}
+
 func getAPMEntityGUID(ctx context.Context, internalAPMApp *apm.InternalAPMApp, waitChannel chan string) {
-	util.Debugf("Waiting for APM EntityGUID...")
+	logger.Debugf("Waiting for APM EntityGUID...")
 
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
@@ -234,13 +501,13 @@ func getAPMEntityGUID(ctx context.Context, internalAPMApp *apm.InternalAPMApp, w
 				entityLock.Lock()
 				entityGuid = internalAPMApp.Run.Reply.EntityGUID
 				entityLock.Unlock()
-				util.Debugf("EntityGUID received: %s", entityGuid)
+				logger.Debugf("EntityGUID received: %s", entityGuid)
 				return
 			} else {
-				util.Debugf("Awaiting EntityGUID through channel")
+				logger.Debugf("Awaiting EntityGUID through channel")
 			}
 		} else {
-			util.Debugf("Run or Reply not yet initialized")
+			logger.Debugf("Run or Reply not yet initialized")
 		}
 
 		select {
@@ -249,31 +516,31 @@ func getAPMEntityGUID(ctx context.Context, internalAPMApp *apm.InternalAPMApp, w
 				entityLock.Lock()
 				entityGuid = internalAPMApp.Run.Reply.EntityGUID
 				entityLock.Unlock()
-				util.Debugf("Entity received after channel communication, GUID: %s", entityGuid)
+				logger.Debugf("Entity received after channel communication, GUID: %s", entityGuid)
 				return
 			}
 		case <-ticker.C:
 			// Continue loop until context times out or is canceled
 		case <-ctx.Done():
-			util.Debugf("Context cancelled or timed out: %v", ctx.Err())
+			logger.Debugf("Context cancelled or timed out: %v", ctx.Err())
 			return
 		}
 	}
 }
 
-func APMlogShipLoop(ctx context.Context, logServer *logserver.LogServer, telemetryClient *telemetry.Client, internalAPMApp *apm.InternalAPMApp) {
+func APMlogShipLoop(ctx context.Context, logServer *logserver.LogServer) {
 	GetEntityLoop:
 		for {
 			select {
 			case <-ctx.Done():
-				util.Debugf("Polling logs context canceled or timed out.")
+				logger.Debugf("Polling logs context canceled or timed out.")
 				return
 			default:
 				entityLock.RLock()
 				guid := entityGuid
 				entityLock.RUnlock()
 				if guid != "" {
-					util.Debugf("Entity GUID obtained: %s", guid)
+					logger.Debugf("Entity GUID obtained: %s", guid)
 					break GetEntityLoop
 				}
 				time.Sleep(100 * time.Millisecond)
@@ -285,10 +552,11 @@ func APMlogShipLoop(ctx context.Context, logServer *logserver.LogServer, telemet
 		if !more {
 			return
 		}
-		err := telemetryClient.SendFunctionLogs(ctx, invokedFunctionARN, functionLogs, entityGuid)
-		if err != nil {
-			util.Logf("Failed to send %d function logs", len(functionLogs))
+		functionLogs = processFunctionLogs(functionLogs)
+		if len(functionLogs) == 0 {
+			continue
 		}
+		shipFunctionLogs(ctx, functionLogs)
 	}
 }
 
@@ -304,23 +572,31 @@ func mainLoop(ctx context.Context, invocationClient *client.InvocationClient, ba
 			return eventCounter
 		default:
 			// Our call to next blocks. It is likely that the container is frozen immediately after we call NextEvent.
-			util.Debugln("mainLoop: waiting for next lambda invocation event...")
+			logger.Debugln("mainLoop: waiting for next lambda invocation event...")
+			releaseInvocation(lastRequestId)
 			event, err := invocationClient.NextEvent(ctx)
 
 			// We've thawed.
 			eventStart := time.Now()
 
 			if err != nil {
-				util.Logln(err)
+				logger.Logln(err)
 				err = invocationClient.ExitError(ctx, "NextEventError.Main", err)
 				if err != nil {
-					util.Logln(err)
+					logger.Logln(err)
 				}
 				continue
 			}
 
 			eventCounter++
 
+			// The last invocation ended when the sandbox was frozen
+			var sampledRequestId string
+			var resourceMetrics []telemetry.Metric
+			if resourceSampler != nil {
+				sampledRequestId, resourceMetrics = resourceSampler.End()
+			}
+
 			if probablyTimeout {
 				// We suspect a timeout. Either way, we've gotten to the next event, so telemetry will
 				// have arrived for the last request if it's going to. Non-blocking poll for telemetry.
@@ -329,14 +605,16 @@ func mainLoop(ctx context.Context, invocationClient *client.InvocationClient, ba
 				select {
 				case telemetryBytes := <-telemetryChan:
 					// We received telemetry
-					util.Debugf("Agent telemetry bytes: %s", base64.URLEncoding.EncodeToString(telemetryBytes))
+					logger.WithRequestID(lastRequestId).Debugf("Agent telemetry bytes: %s", base64.URLEncoding.EncodeToString(telemetryBytes))
 					batch.AddTelemetry(lastRequestId, telemetryBytes, true)
-					util.Logf("We suspected a timeout for request %s but got telemetry anyway", lastRequestId)
+					logger.WithRequestID(lastRequestId).Logln("We suspected a timeout but got telemetry anyway")
 				default:
 				}
 			}
 
 			if event.EventType == api.Shutdown {
+				shutdownReason = event.ShutdownReason
+				addResourceMetrics(batch, sampledRequestId, resourceMetrics)
 				if event.ShutdownReason == api.Timeout && lastRequestId != "" {
 					// Synthesize the timeout error message that the platform produces, and LLC parses
 					if lastEventStart.IsZero() {
@@ -351,10 +629,22 @@ func mainLoop(ctx context.Context, invocationClient *client.InvocationClient, ba
 						timeoutSecs,
 					)
 					batch.AddTelemetry(lastRequestId, []byte(timeoutMessage), false)
+					batch.AddError(lastRequestId, telemetry.PlatformError{
+						RequestID: lastRequestId,
+						Time:      timestamp,
+						Type:      telemetry.PlatformErrorTimeout,
+						Message:   fmt.Sprintf("Task timed out after %.2f seconds", timeoutSecs),
+					})
 				} else if event.ShutdownReason == api.Failure && lastRequestId != "" {
 					// Synthesize a generic platform error. Probably an OOM, though it could be any runtime crash.
 					errorMessage := fmt.Sprintf("RequestId: %s AWS Lambda platform fault caused a shutdown", lastRequestId)
 					batch.AddTelemetry(lastRequestId, []byte(errorMessage), false)
+					batch.AddError(lastRequestId, telemetry.PlatformError{
+						RequestID: lastRequestId,
+						Time:      eventStart,
+						Type:      telemetry.PlatformErrorFault,
+						Message:   errorMessage,
+					})
 				}
 
 				return eventCounter
@@ -369,11 +659,21 @@ func mainLoop(ctx context.Context, invocationClient *client.InvocationClient, ba
 
 			// Create an invocation record to hold telemetry
 			batch.AddInvocation(lastRequestId, eventStart)
+			addResourceMetrics(batch, sampledRequestId, resourceMetrics)
+			if platformSpanTracker != nil {
+				platformSpanTracker.Invocation(lastRequestId, eventStart)
+			}
+			if resourceSampler != nil {
+				resourceSampler.Begin(lastRequestId, eventStart)
+			}
 
 			// Await agent telemetry, which may time out.
 
 			// timeoutInstant is when the invocation will time out
 			timeoutInstant := time.Unix(0, event.DeadlineMs*int64(time.Millisecond))
+			if headroomTracker != nil {
+				headroomTracker.AddInvocation(event.RequestID, eventStart, timeoutInstant)
+			}
 
 			// Set the timeout timer for a smidge before the actual timeout; we can recover from false timeouts.
 			timeoutWatchBegins := 200 * time.Millisecond
@@ -382,8 +682,9 @@ func mainLoop(ctx context.Context, invocationClient *client.InvocationClient, ba
 			// Before we begin to await telemetry, harvest and ship. Ripe telemetry will mostly be handled here. Even that is a
 			// minority of invocations. Putting this here lets us run the HTTP request to send to NR in parallel with the Lambda
 			// handler, reducing or eliminating our latency impact.
-			pollLogServer(logServer, batch)
+			pollLogServer(logServer, batch, telemetryClient)
 			shipHarvest(ctx, batch.Harvest(time.Now()), telemetryClient)
+			flushStatsD(ctx, false)
 
 			select {
 			case <-timeLimitContext.Done():
@@ -396,15 +697,15 @@ func mainLoop(ctx context.Context, invocationClient *client.InvocationClient, ba
 				timeLimitCancel()
 
 				// We received telemetry
-				util.Debugf("Agent telemetry bytes: %s", base64.URLEncoding.EncodeToString(telemetryBytes))
+				logger.WithRequestID(lastRequestId).Debugf("Agent telemetry bytes: %s", base64.URLEncoding.EncodeToString(telemetryBytes))
 				inv := batch.AddTelemetry(lastRequestId, telemetryBytes, true)
 				if inv == nil {
-					util.Logf("Failed to add telemetry for request %v", lastRequestId)
+					logger.WithRequestID(lastRequestId).Logln("Failed to add telemetry")
 				}
 
 				// Opportunity for an aggressive harvest, in which case, we definitely want to wait for the HTTP POST
 				// to complete. Mostly, nothing really happens here.
-				pollLogServer(logServer, batch)
+				pollLogServer(logServer, batch, telemetryClient)
 				shipHarvest(ctx, batch.Harvest(time.Now()), telemetryClient)
 			}
 
@@ -415,9 +716,11 @@ func mainLoop(ctx context.Context, invocationClient *client.InvocationClient, ba
 
 
 // mainAPMLoop repeatedly calls the /next api, and processes telemetry and platform logs. The timing is rather complicated.
-func mainAPMLoop(ctx context.Context, invocationClient *client.InvocationClient, telemetryChan chan []byte, logServer *logserver.LogServer, conf *config.Configuration, app *apm.InternalAPMApp) int {
+func mainAPMLoop(ctx context.Context, invocationClient *client.InvocationClient, batch *telemetry.Batch, telemetryChan chan []byte, logServer *logserver.LogServer, telemetryClient *telemetry.Client, otlpEnabled bool) int {
 	eventCounter := 0
 	probablyTimeout := false
+	// requestId is the invocation being processed
+	var requestId string
 
 	for {
 		select {
@@ -426,22 +729,33 @@ func mainAPMLoop(ctx context.Context, invocationClient *client.InvocationClient,
 			return eventCounter
 		default:
 			// Our call to next blocks. It is likely that the container is frozen immediately after we call NextEvent.
-			util.Debugln("Extension in APM Mode waiting next invocation event...")
+			logger.Debugln("Extension in APM Mode waiting next invocation event...")
+			releaseInvocation(requestId)
 			event, err := invocationClient.NextEvent(ctx)
 			// We've thawed.
 			eventStart := time.Now()
 
 			if err != nil {
-				util.Logln(err)
+				logger.Logln(err)
 				err = invocationClient.ExitError(ctx, "NextEventError.Main", err)
 				if err != nil {
-					util.Logln(err)
+					logger.Logln(err)
 				}
 				continue
 			}
 
 			eventCounter++
 
+			// The last invocation ended when the sandbox was frozen. The batch isn't harvested in
+			// APM Lambda mode, so its resource metrics are sent now.
+			if resourceSampler != nil {
+				if _, resourceMetrics := resourceSampler.End(); len(resourceMetrics) > 0 {
+					if err := exporter.ExportMetrics(ctx, invokedFunctionARN, resourceMetrics); err != nil {
+						logger.Errorf("Failed to send %d resource metrics: %s", len(resourceMetrics), err)
+					}
+				}
+			}
+
 			if probablyTimeout {
 				// We suspect a timeout. Either way, we've gotten to the next event, so telemetry will
 				// have arrived for the last request if it's going to. Non-blocking poll for telemetry.
@@ -449,35 +763,30 @@ func mainAPMLoop(ctx context.Context, invocationClient *client.InvocationClient,
 				// timed out, this will catch us up to the current state of telemetry, allowing us to resume.
 				select {
 				case telemetryBytes := <-telemetryChan:
-					app.DataChan <- telemetryBytes
+					exportAgentPayload(ctx, requestId, telemetryBytes)
 				default:
 				}
 			}
 
 			if event.EventType == api.Shutdown {
-				if event.ShutdownReason == api.Timeout {
-					timeoutSecs := eventStart.Sub(lastEventStart).Seconds()
-					errorMessage := fmt.Sprintf(
-						"Task timed out after %.2f seconds",
-						timeoutSecs,
-					)
-					app.ErrorEventChan <- []interface{}{"Lambda.Timedout", 
-																		fmt.Sprintf("%f", timeoutSecs), 
-																		lastRequestId, 
-																		errorMessage,
-																		LambdaFunctionName, 
-																		LambdaAccountId, 
-																		LambdaFunctionVersion}
-				} else if event.ShutdownReason == api.Failure {
-					errorMessage := fmt.Sprintf("RequestId: %s AWS Lambda platform fault caused a shutdown", lastRequestId)
-					timeoutSecs := eventStart.Sub(lastEventStart).Seconds()
-					app.ErrorEventChan <- []interface{}{"Lambda.PlatformFault", 
-																		fmt.Sprintf("%f", timeoutSecs), 
-																		lastRequestId, 
-																		errorMessage,
-																		LambdaFunctionName, 
-																		LambdaAccountId, 
-																		LambdaFunctionVersion}
+				shutdownReason = event.ShutdownReason
+				if event.ShutdownReason == api.Timeout && requestId != "" {
+					timeout := eventStart.Sub(lastEventStart)
+					exportAPMError(ctx, telemetry.PlatformError{
+						RequestID: requestId,
+						Time:      eventStart,
+						Type:      telemetry.PlatformErrorTimeout,
+						Message:   fmt.Sprintf("Task timed out after %.2f seconds", timeout.Seconds()),
+						Duration:  timeout,
+					})
+				} else if event.ShutdownReason == api.Failure && requestId != "" {
+					exportAPMError(ctx, telemetry.PlatformError{
+						RequestID: requestId,
+						Time:      eventStart,
+						Type:      telemetry.PlatformErrorFault,
+						Message:   fmt.Sprintf("RequestId: %s AWS Lambda platform fault caused a shutdown", requestId),
+						Duration:  eventStart.Sub(lastEventStart),
+					})
 				}
 
 				return eventCounter
@@ -488,11 +797,29 @@ func mainAPMLoop(ctx context.Context, invocationClient *client.InvocationClient,
 
 			// timeoutInstant is when the invocation will time out
 			timeoutInstant := time.Unix(0, event.DeadlineMs*int64(time.Millisecond))
+			if headroomTracker != nil {
+				headroomTracker.AddInvocation(event.RequestID, eventStart, timeoutInstant)
+			}
+			requestId = event.RequestID
+			if platformSpanTracker != nil {
+				platformSpanTracker.Invocation(requestId, eventStart)
+			}
+			if resourceSampler != nil {
+				resourceSampler.Begin(event.RequestID, eventStart)
+			}
 
 			// Set the timeout timer for a smidge before the actual timeout; we can recover from false timeouts.
 			timeoutWatchBegins := 200 * time.Millisecond
 			timeLimitContext, timeLimitCancel := context.WithDeadline(ctx, timeoutInstant.Add(-timeoutWatchBegins))
-			pollLogAPMServer(ctx, logServer, conf)
+			invokedFunctionARN = event.InvokedFunctionARN
+			// The batch only holds OTLP data in APM Lambda mode
+			if otlpEnabled {
+				batch.DiscardEmpty()
+				batch.AddInvocation(event.RequestID, eventStart)
+				shipHarvest(ctx, batch.Harvest(time.Now()), telemetryClient)
+			}
+			pollLogAPMServer(ctx, logServer, batch, telemetryClient)
+			flushStatsD(ctx, false)
 			select {
 			case <-timeLimitContext.Done():
 				timeLimitCancel()
@@ -500,7 +827,8 @@ func mainAPMLoop(ctx context.Context, invocationClient *client.InvocationClient,
 				probablyTimeout = true
 				continue
 			case telemetryBytes := <-telemetryChan:
-				app.DataChan <- telemetryBytes
+				rememberTraceID(batch, requestId, telemetryBytes)
+				exportAgentPayload(ctx, requestId, telemetryBytes)
 			}
 
 			lastEventStart = eventStart
@@ -509,19 +837,19 @@ func mainAPMLoop(ctx context.Context, invocationClient *client.InvocationClient,
 }
 
 // pollLogAPMServer polls for platform logs, and send as APM telemetry
-func pollLogAPMServer(ctx context.Context, logServer *logserver.LogServer, conf *config.Configuration) {
+func pollLogAPMServer(ctx context.Context, logServer *logserver.LogServer, batch *telemetry.Batch, telemetryClient *telemetry.Client) {
 	GetEntityLoop:
 		for {
 			select {
 			case <-ctx.Done():
-				util.Debugf("pollLogAPMServer context canceled or timed out.")
+				logger.Debugf("pollLogAPMServer context canceled or timed out.")
 				return
 			default:
 				entityLock.RLock()
 				guid := entityGuid
 				entityLock.RUnlock()
 				if guid != "" {
-					util.Debugf("Entity GUID obtained: %s", guid)
+					logger.Debugf("Entity GUID obtained: %s", guid)
 					break GetEntityLoop
 				}
 				time.Sleep(100 * time.Millisecond)
@@ -529,46 +857,437 @@ func pollLogAPMServer(ctx context.Context, logServer *logserver.LogServer, conf
 		}
 
 	for _, platformLog := range logServer.PollPlatformChannel() {
-		lambdaMetrics, _ := apm.ParseLambdaReportLog(string(platformLog.Content))
-		metrics := lambdaMetrics.ConvertToMetrics("apm.lambda.transaction", entityGuid, LambdaFunctionName)
-		statusCode, responseBody, err := apm.SendMetrics(conf.LicenseKey, conf.MetricEndpoint, metrics, true)
+		// The report is parsed once, for everything that uses it
+		report, err := telemetry.ParsePlatformLog(platformLog)
 		if err != nil {
-			util.Logf("Error sending metric: %v", err)
+			continue
+		}
+		if outOfMemory := detectOutOfMemory(report, platformLog.Time); outOfMemory != nil {
+			exportAPMError(ctx, *outOfMemory)
+		}
+		lambdaMetrics := apm.NewLambdaMetrics(report)
+		if headroomTracker != nil {
+			headroomTracker.AddReport(lambdaMetrics)
+		}
+		if overheadTracker != nil {
+			overheadTracker.Report(report.RequestID, report.Duration)
+		}
+		if platformSpanTracker != nil {
+			platformSpanTracker.Report(report.RequestID)
+		}
+		exportLambdaMetrics(ctx, lambdaMetrics, entityGuid)
+	}
+	for _, fault := range logServer.TakeOutOfMemoryFaults() {
+		if outOfMemory := detectOutOfMemoryFault(fault); outOfMemory != nil {
+			exportAPMError(ctx, *outOfMemory)
+		}
+		// Faults are sent as error metrics
+		exportLambdaMetrics(ctx, &apm.LambdaMetrics{
+			RequestID: fault.RequestID,
+			Error:     "error",
+			ErrorType: telemetry.ErrorTypeOutOfMemory,
+		}, entityGuid)
+	}
+
+	// The batch isn't harvested in APM Lambda mode, so these are sent now
+	if metrics := overheadMetrics(logServer); len(metrics) > 0 {
+		if err := exporter.ExportMetrics(ctx, invokedFunctionARN, metrics); err != nil {
+			logger.Errorf("Failed to send %d overhead metrics: %s", len(metrics), err)
+		}
+	}
+	if metrics := logDropMetrics(logServer.TakeDropStats(), telemetryClient.TakeLogDeliveryStats()); len(metrics) > 0 {
+		if err := exporter.ExportMetrics(ctx, invokedFunctionARN, metrics); err != nil {
+			logger.Errorf("Failed to send %d log drop metrics: %s", len(metrics), err)
+		}
+	}
+	if spans := platformSpans(logServer, batch); len(spans) > 0 {
+		if err := exporter.ExportSpans(ctx, invokedFunctionARN, spans); err != nil {
+			logger.Errorf("Failed to send %d platform spans: %s", len(spans), err)
+		}
+	}
+	if headroomTracker != nil {
+		if warnings := headroomTracker.Warnings(time.Now()); len(warnings) > 0 {
+			if err := exporter.ExportEvents(ctx, invokedFunctionARN, warnings); err != nil {
+				logger.Errorf("Failed to send %d headroom warning events: %s", len(warnings), err)
+			}
 		}
-		util.Debugf("Response Status: %d\n", statusCode)
-		util.Debugf("Response Body: %s\n", responseBody)
 	}
 }
 
 // pollLogServer polls for platform logs, and annotates telemetry
-func pollLogServer(logServer *logserver.LogServer, batch *telemetry.Batch) {
+func pollLogServer(logServer *logserver.LogServer, batch *telemetry.Batch, telemetryClient *telemetry.Client) {
 	for _, platformLog := range logServer.PollPlatformChannel() {
 		inv := batch.AddTelemetry(platformLog.RequestID, platformLog.Content, false)
 		if inv == nil {
-			util.Debugf("Skipping platform log for request %v", platformLog.RequestID)
+			logger.WithRequestID(platformLog.RequestID).Debugf("Skipping platform log")
+		}
+
+		// The report is parsed once, for everything that uses it
+		report, err := telemetry.ParsePlatformLog(platformLog)
+		if err != nil {
+			continue
+		}
+		if outOfMemory := detectOutOfMemory(report, platformLog.Time); outOfMemory != nil {
+			addOutOfMemoryLog(batch, outOfMemory)
+		}
+		batch.AddReport(platformLog.RequestID, *report)
+		if invocationEvents {
+			addInvocationEvent(batch, report, platformLog.Time)
+		}
+		lambdaMetrics := apm.NewLambdaMetrics(report)
+		if headroomTracker != nil {
+			headroomTracker.AddReport(lambdaMetrics)
+		}
+		if costEstimator != nil {
+			addCostMetrics(batch, lambdaMetrics, platformLog.Time)
+		}
+		if overheadTracker != nil {
+			overheadTracker.Report(report.RequestID, report.Duration)
+		}
+		if platformSpanTracker != nil {
+			platformSpanTracker.Report(report.RequestID)
+		}
+	}
+	for _, fault := range logServer.TakeOutOfMemoryFaults() {
+		if outOfMemory := detectOutOfMemoryFault(fault); outOfMemory != nil {
+			addOutOfMemoryLog(batch, outOfMemory)
+		}
+	}
+
+	if metrics := overheadMetrics(logServer); len(metrics) > 0 {
+		requestId := logServer.LastRequestID()
+		if batch.AddMetrics(requestId, metrics) == nil {
+			logger.WithRequestID(requestId).Debugf("Skipping overhead metrics")
+		}
+	}
+
+	if spans := platformSpans(logServer, batch); len(spans) > 0 {
+		requestId := logServer.LastRequestID()
+		if batch.AddSpans(requestId, spans) == nil {
+			logger.WithRequestID(requestId).Debugf("Skipping platform spans")
 		}
 	}
+
+	if headroomTracker != nil {
+		if warnings := headroomTracker.Warnings(time.Now()); len(warnings) > 0 {
+			requestId := logServer.LastRequestID()
+			if batch.AddEvents(requestId, warnings) == nil {
+				logger.WithRequestID(requestId).Debugf("Skipping headroom warning events")
+			}
+		}
+	}
+
+	if metrics := logDropMetrics(logServer.TakeDropStats(), telemetryClient.TakeLogDeliveryStats()); len(metrics) > 0 {
+		requestId := logServer.LastRequestID()
+		if batch.AddMetrics(requestId, metrics) == nil {
+			logger.WithRequestID(requestId).Debugf("Skipping log drop metrics")
+		}
+	}
+}
+
+// addInvocationEvent adds the event for a platform report to its invocation
+func addInvocationEvent(batch *telemetry.Batch, report *telemetry.PlatformReport, timestamp time.Time) {
+	if batch.AddEvents(report.RequestID, []telemetry.CustomEvent{report.Event(timestamp)}) == nil {
+		logger.WithRequestID(report.RequestID).Debugf("Skipping invocation event")
+	}
+}
+
+// releaseInvocation records that the extension is done with an invocation, and is calling next
+func releaseInvocation(requestId string) {
+	if overheadTracker != nil && requestId != "" {
+		overheadTracker.Released(requestId, time.Now())
+	}
+}
+
+// overheadMetrics correlates the platform's runtimeDone records with when the extension released
+// each invocation, and returns the overhead metrics of the invocations whose timings are known
+func overheadMetrics(logServer *logserver.LogServer) []telemetry.Metric {
+	if overheadTracker == nil {
+		return nil
+	}
+	for _, runtimeDone := range logServer.TakeRuntimeDone() {
+		overheadTracker.RuntimeDone(runtimeDone.RequestID, runtimeDone.Time, runtimeDone.Duration)
+	}
+	return overheadTracker.Metrics()
+}
+
+// platformSpans correlates the platform's phase spans with the invocations they're of, and returns
+// the spans of the invocations that have been reported, in the agent's trace when it's known
+func platformSpans(logServer *logserver.LogServer, batch *telemetry.Batch) []telemetry.Span {
+	if platformSpanTracker == nil {
+		return nil
+	}
+	platformSpanTracker.AddPhases(logServer.TakePlatformSpans())
+	return platformSpanTracker.Spans(batch.RetrieveTraceID)
+}
+
+// rememberTraceID keeps the trace ID of an agent payload, which the batch doesn't see in APM
+// Lambda mode, to link the invocation's platform spans to
+func rememberTraceID(batch *telemetry.Batch, requestId string, telemetryBytes []byte) {
+	if platformSpanTracker == nil || requestId == "" {
+		return
+	}
+	traceId, err := telemetry.ExtractTraceID([]byte(base64.StdEncoding.EncodeToString(telemetryBytes)))
+	if err != nil {
+		logger.Debugln(err)
+		return
+	}
+	batch.SetTraceIDValue(requestId, traceId)
+}
+
+// sandboxLifecycle summarizes the sandbox, as it shuts down. Payloads of the final harvest aren't
+// counted, as it's yet to be sent.
+func sandboxLifecycle(extensionStartup time.Time, eventCounter int, logServer *logserver.LogServer, telemetryClient *telemetry.Client) telemetry.SandboxLifecycle {
+	invocations := eventCounter
+	if shutdownReason != "" {
+		// The shutdown event isn't an invocation
+		invocations--
+	}
+
+	return telemetry.SandboxLifecycle{
+		Start:                       extensionStartup,
+		End:                         time.Now(),
+		InitType:                    os.Getenv("AWS_LAMBDA_INITIALIZATION_TYPE"),
+		ShutdownReason:              string(shutdownReason),
+		Invocations:                 invocations,
+		AcceptedBytesBeforeShutdown: telemetryClient.AcceptedBytes(),
+		SendFailures:                telemetryClient.FailedPayloads(),
+		DroppedLogs:                 logServer.TotalDropStats().DroppedLines(),
+	}
+}
+
+// addSandboxEvent adds the sandbox's lifecycle event to the final harvest. Without an invocation to
+// hold it, as in APM Lambda mode, it's sent now.
+func addSandboxEvent(ctx context.Context, batch *telemetry.Batch, sandbox telemetry.SandboxLifecycle) {
+	logger.Logf(
+		"Sandbox ran for %vms: %d invocations, shutdown reason %q",
+		sandbox.End.Sub(sandbox.Start).Milliseconds(),
+		sandbox.Invocations,
+		sandbox.ShutdownReason,
+	)
+
+	events := []telemetry.CustomEvent{sandbox.Event()}
+	if batch.AddEvents(lastRequestId, events) != nil {
+		return
+	}
+	if err := exporter.ExportEvents(ctx, invokedFunctionARN, events); err != nil {
+		logger.Errorf("Failed to send sandbox event: %s", err)
+	}
+}
+
+// addResourceMetrics adds the resource metrics of an invocation to it, or to the latest
+// invocation when it's been harvested
+func addResourceMetrics(batch *telemetry.Batch, requestId string, metrics []telemetry.Metric) {
+	if len(metrics) == 0 {
+		return
+	}
+	if batch.AddMetrics(requestId, metrics) == nil {
+		logger.WithRequestID(requestId).Debugf("Skipping resource metrics")
+	}
+}
+
+// addCostMetrics adds the GB-seconds and estimated cost of a platform report to its invocation
+func addCostMetrics(batch *telemetry.Batch, lambdaMetrics *apm.LambdaMetrics, timestamp time.Time) {
+	if lambdaMetrics.BilledDuration == 0 || lambdaMetrics.MemorySize == 0 {
+		return
+	}
+
+	gbSeconds, cost := costEstimator.Estimate(lambdaMetrics)
+	attributes := map[string]interface{}{
+		"aws.requestId":           lambdaMetrics.RequestID,
+		"aws.lambda.architecture": costEstimator.Architecture,
+	}
+	gauge := func(name string, value float64) telemetry.Metric {
+		return telemetry.Metric{
+			Name:       name,
+			Type:       "gauge",
+			Value:      value,
+			Timestamp:  timestamp.UnixMilli(),
+			Attributes: attributes,
+		}
+	}
+
+	metrics := []telemetry.Metric{
+		gauge(apm.MetricPrefix+".gb_seconds", gbSeconds),
+		gauge(apm.MetricPrefix+".estimated_cost", cost),
+	}
+	if batch.AddMetrics(lambdaMetrics.RequestID, metrics) == nil {
+		logger.WithRequestID(lambdaMetrics.RequestID).Debugf("Skipping cost metrics")
+	}
+}
+
+// detectOutOfMemory records the memory usage of a platform report, and returns an error when the
+// report shows that the invocation ran out of memory. The error's message includes the sandbox's
+// recent memory headroom.
+func detectOutOfMemory(report *telemetry.PlatformReport, timestamp time.Time) *telemetry.PlatformError {
+	memoryHistory.Add(*report)
+	if !report.OutOfMemory() {
+		return nil
+	}
+	usage := fmt.Sprintf(": used %d of %d MB", report.MaxMemoryUsed, report.MemorySize)
+	duration := time.Duration(report.Duration * float64(time.Millisecond))
+	return outOfMemoryError(report.RequestID, timestamp, usage, duration)
+}
+
+// detectOutOfMemoryFault returns an error for an out-of-memory platform fault, as the invocation's
+// report may not show it
+func detectOutOfMemoryFault(fault logserver.OutOfMemoryFault) *telemetry.PlatformError {
+	return outOfMemoryError(fault.RequestID, fault.Time, "", 0)
+}
+
+// outOfMemoryError builds the error for an invocation that ran out of memory, unless it was
+// already built from the invocation's fault or report
+func outOfMemoryError(requestId string, timestamp time.Time, usage string, duration time.Duration) *telemetry.PlatformError {
+	if !memoryHistory.MarkOutOfMemory(requestId) {
+		return nil
+	}
+	logger.WithRequestID(requestId).Logln("Function ran out of memory")
+	return &telemetry.PlatformError{
+		RequestID: requestId,
+		Time:      timestamp,
+		Type:      telemetry.PlatformErrorOutOfMemory,
+		Message: fmt.Sprintf(
+			"RequestId: %s Function ran out of memory%s. Memory headroom of recent invocations, oldest first: %s",
+			requestId,
+			usage,
+			memoryHistory.HeadroomSummary(),
+		),
+		Duration: duration,
+	}
+}
+
+// addOutOfMemoryLog adds a log record for an out-of-memory error to its invocation
+func addOutOfMemoryLog(batch *telemetry.Batch, outOfMemory *telemetry.PlatformError) {
+	line := logserver.LogLine{
+		Time:      outOfMemory.Time,
+		RequestID: outOfMemory.RequestID,
+		Content:   []byte(outOfMemory.Message),
+		Attributes: map[string]interface{}{
+			"level":           "ERROR",
+			"error.class":     outOfMemory.Type,
+			"memory.headroom": memoryHistory.HeadroomSummary(),
+		},
+	}
+	if batch.AddLogs(outOfMemory.RequestID, []logserver.LogLine{line}) == nil {
+		logger.WithRequestID(outOfMemory.RequestID).Debugf("Skipping out-of-memory log")
+	}
+}
+
+// logDropMetrics reports the function logs dropped by the extension's log queue, and by the
+// platform, and those the Log API rejected or that were truncated, as count metrics
+func logDropMetrics(stats logserver.DropStats, delivery telemetry.LogDeliveryStats) []telemetry.Metric {
+	if stats.IsEmpty() && delivery.IsEmpty() {
+		return nil
+	}
+	if !stats.IsEmpty() {
+		logger.Logf(
+			"Function logs were dropped: %d lines by the extension, %d records (%d bytes) by the platform",
+			stats.QueueDroppedLines,
+			stats.PlatformDroppedRecords,
+			stats.PlatformDroppedBytes,
+		)
+	}
+
+	count := func(name string, value uint64, source string) telemetry.Metric {
+		return telemetry.Metric{
+			Name:       name,
+			Type:       "count",
+			Value:      float64(value),
+			Timestamp:  stats.Start.UnixMilli(),
+			Interval:   stats.End.Sub(stats.Start).Milliseconds(),
+			Attributes: map[string]interface{}{"source": source},
+		}
+	}
+
+	var metrics []telemetry.Metric
+	if stats.QueueDroppedLines > 0 {
+		metrics = append(metrics, count("newrelic.extension.logs.dropped", stats.QueueDroppedLines, "extension"))
+	}
+	if stats.PlatformDropEvents > 0 {
+		metrics = append(metrics,
+			count("newrelic.extension.logs.dropped", stats.PlatformDroppedRecords, "platform"),
+			count("newrelic.extension.logs.droppedBytes", stats.PlatformDroppedBytes, "platform"),
+			count("newrelic.extension.logs.dropEvents", stats.PlatformDropEvents, "platform"),
+		)
+	}
+	if delivery.RejectedPayloads > 0 {
+		metrics = append(metrics, count("newrelic.extension.logs.rejectedPayloads", delivery.RejectedPayloads, "extension"))
+	}
+	if delivery.TruncatedMessages > 0 {
+		metrics = append(metrics, count("newrelic.extension.logs.truncated", delivery.TruncatedMessages, "extension"))
+	}
+	return metrics
 }
 
 
 func shipHarvest(ctx context.Context, harvested []*telemetry.Invocation, telemetryClient *telemetry.Client) {
 	if len(harvested) > 0 {
-		util.Debugf("shipHarvest: harvesting agent telemetry")
-		telemetrySlice := make([][]byte, 0, 2*len(harvested))
+		logger.Debugf("shipHarvest: harvesting agent telemetry")
+		var events []telemetry.CustomEvent
+		var metrics []telemetry.Metric
+		var logs []logserver.LogLine
+		var otlpPayloads []telemetry.OTLPPayload
+		var spans []telemetry.Span
 		for _, inv := range harvested {
-			telemetrySlice = append(telemetrySlice, inv.Telemetry...)
+			events = append(events, inv.Events...)
+			metrics = append(metrics, inv.Metrics...)
+			logs = append(logs, inv.Logs...)
+			otlpPayloads = append(otlpPayloads, inv.OTLP...)
+			spans = append(spans, inv.Spans...)
 		}
-		util.Debugf("shipHarveset: %d telemetry payloads harvested", len(telemetrySlice))
 
-		err, _ := telemetryClient.SendTelemetry(ctx, invokedFunctionARN, telemetrySlice)
-		if err != nil {
-			util.Logf("Failed to send harvested telemetry for %d invocations %s", len(harvested), err)
+		if err := exporter.ExportAgentPayloads(ctx, invokedFunctionARN, harvested); err != nil {
+			logger.Errorf("Failed to send harvested telemetry for %d invocations %s", len(harvested), err)
 		}
+
+		// Custom data from the ingest API
+		if err := exporter.ExportEvents(ctx, invokedFunctionARN, events); err != nil {
+			logger.Errorf("Failed to send %d custom events: %s", len(events), err)
+		}
+		if err := exporter.ExportMetrics(ctx, invokedFunctionARN, metrics); err != nil {
+			logger.Errorf("Failed to send %d custom metrics: %s", len(metrics), err)
+		}
+		if err := exporter.ExportLogs(ctx, invokedFunctionARN, logs); err != nil {
+			logger.Errorf("Failed to send %d custom log records: %s", len(logs), err)
+		}
+		if err := exporter.ExportSpans(ctx, invokedFunctionARN, spans); err != nil {
+			logger.Errorf("Failed to send %d platform spans: %s", len(spans), err)
+		}
+
+		// OTLP data from the OTLP receiver. In APM Lambda mode, resources are linked to the APM entity.
+		if err := telemetryClient.SendOTLP(ctx, invokedFunctionARN, otlpPayloads, currentEntityGUID()); err != nil {
+			logger.Errorf("Failed to send %d OTLP payloads: %s", len(otlpPayloads), err)
+		}
+	}
+
+	// The extension's own warnings and errors
+	if diagnostics != nil {
+		if diagnosticLogs := diagnostics.Drain(); len(diagnosticLogs) > 0 {
+			if err := exporter.ExportLogs(ctx, invokedFunctionARN, diagnosticLogs); err != nil {
+				// Not a warning, which would feed back into the sink
+				logger.Logf("Failed to send %d extension log records: %s", len(diagnosticLogs), err)
+			}
+		}
+	}
+}
+
+// flushStatsD sends aggregated StatsD metrics, and metrics derived from function logs, once the
+// harvest window has elapsed, or right away when force is true
+func flushStatsD(ctx context.Context, force bool) {
+	var metrics []telemetry.Metric
+	if statsdListener != nil {
+		metrics = append(metrics, statsdListener.Harvest(time.Now(), force)...)
+	}
+	if logPipeline != nil {
+		metrics = append(metrics, logPipeline.Harvest(time.Now(), force)...)
+	}
+	if err := exporter.ExportMetrics(ctx, invokedFunctionARN, metrics); err != nil {
+		logger.Errorf("Failed to send %d StatsD and log metrics: %s", len(metrics), err)
 	}
 }
 
 func noopLoop(ctx context.Context, invocationClient *client.InvocationClient) {
-	util.Logln("Starting no-op mode, no telemetry will be sent")
+	logger.Logln("Starting no-op mode, no telemetry will be sent")
 
 	for {
 		select {
@@ -577,10 +1296,10 @@ func noopLoop(ctx context.Context, invocationClient *client.InvocationClient) {
 		default:
 			event, err := invocationClient.NextEvent(ctx)
 			if err != nil {
-				util.Logln(err)
+				logger.Logln(err)
 				errErr := invocationClient.ExitError(ctx, "NextEventError.Noop", err)
 				if errErr != nil {
-					util.Logln(errErr)
+					logger.Logln(errErr)
 				}
 				continue
 			}
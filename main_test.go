@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,7 +14,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/newrelic/newrelic-lambda-extension/apm"
+	"github.com/newrelic/newrelic-lambda-extension/config"
 	"github.com/newrelic/newrelic-lambda-extension/lambda/extension/api"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
 	"github.com/newrelic/newrelic-lambda-extension/util"
 
 	"github.com/stretchr/testify/assert"
@@ -748,6 +753,199 @@ func TestMainTimeoutNoPipeWrite(t *testing.T) {
 	assert.NotPanics(t, main)
 }
 
+func TestLogDropMetrics(t *testing.T) {
+	assert.Nil(t, logDropMetrics(logserver.DropStats{}, telemetry.LogDeliveryStats{}))
+
+	start := time.Unix(1700000000, 0)
+	stats := logserver.DropStats{
+		Start:                  start,
+		End:                    start.Add(10 * time.Second),
+		QueueDroppedLines:      5,
+		PlatformDropEvents:     1,
+		PlatformDroppedRecords: 3,
+		PlatformDroppedBytes:   1024,
+	}
+	metrics := logDropMetrics(stats, telemetry.LogDeliveryStats{})
+	assert.Len(t, metrics, 4)
+	assert.Equal(t, "newrelic.extension.logs.dropped", metrics[0].Name)
+	assert.Equal(t, "count", metrics[0].Type)
+	assert.Equal(t, 5.0, metrics[0].Value)
+	assert.Equal(t, start.UnixMilli(), metrics[0].Timestamp)
+	assert.Equal(t, int64(10000), metrics[0].Interval)
+	assert.Equal(t, "extension", metrics[0].Attributes["source"])
+	assert.Equal(t, 3.0, metrics[1].Value)
+	assert.Equal(t, "platform", metrics[1].Attributes["source"])
+
+	// The Log API's rejections and truncations are reported even when nothing was dropped
+	metrics = logDropMetrics(logserver.DropStats{Start: start, End: start.Add(10 * time.Second)}, telemetry.LogDeliveryStats{RejectedPayloads: 2, TruncatedMessages: 1})
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, "newrelic.extension.logs.rejectedPayloads", metrics[0].Name)
+	assert.Equal(t, 2.0, metrics[0].Value)
+	assert.Equal(t, int64(10000), metrics[0].Interval)
+	assert.Equal(t, "newrelic.extension.logs.truncated", metrics[1].Name)
+	assert.Equal(t, 1.0, metrics[1].Value)
+}
+
+func TestPollLogAPMServerDropMetrics(t *testing.T) {
+	var exported bytes.Buffer
+	exporter = telemetry.NewWriterExporter(&exported)
+	entityGuid = "entity-guid"
+	defer func() {
+		exporter = nil
+		entityGuid = ""
+	}()
+
+	logServer, err := logserver.Start(&config.Configuration{LogServerHost: "localhost"})
+	assert.NoError(t, err)
+	defer util.Close(logServer)
+
+	logEvents := []api.LogEvent{
+		{Time: time.Now(), Type: "platform.logsDropped", Record: map[string]interface{}{"reason": "Consumer seems to have fallen behind", "droppedRecords": 3, "droppedBytes": 1024}},
+	}
+	body, err := json.Marshal(logEvents)
+	assert.NoError(t, err)
+	res, err := http.Post(fmt.Sprintf("http://localhost:%d", logServer.Port()), "application/json", bytes.NewBuffer(body))
+	assert.NoError(t, err)
+	util.Close(res.Body)
+
+	// The batch isn't harvested in APM Lambda mode, so the drops are sent when the log server is polled
+	telemetryClient := telemetry.New("my-function", "a mock license key", "", "", &telemetry.Batch{}, false, time.Second)
+	pollLogAPMServer(context.Background(), logServer, telemetry.NewBatch(0, 0, false), telemetryClient)
+	assert.Contains(t, exported.String(), `"name":"newrelic.extension.logs.dropped"`)
+	assert.Contains(t, exported.String(), `"name":"newrelic.extension.logs.droppedBytes"`)
+	assert.True(t, logServer.TakeDropStats().IsEmpty())
+}
+
+func TestAddInvocationEvent(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	batch := telemetry.NewBatch(0, 0, false)
+	batch.AddInvocation("a-request-id", start)
+
+	report, err := telemetry.ParsePlatformLog(logserver.LogLine{
+		RequestID: "a-request-id",
+		Content:   []byte("REPORT RequestId: a-request-id\tDuration: 25.30 ms\tBilled Duration: 26 ms\tMemory Size: 128 MB\tMax Memory Used: 74 MB"),
+		Report:    &logserver.ReportDetails{Status: "timeout"},
+	})
+	assert.NoError(t, err)
+	addInvocationEvent(batch, report, start.Add(time.Second))
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+	assert.Len(t, harvested[0].Events, 1)
+
+	event := harvested[0].Events[0]
+	assert.Equal(t, "AwsLambdaInvocation", event["eventType"])
+	assert.Equal(t, start.Add(time.Second).UnixMilli(), event["timestamp"])
+	assert.Equal(t, 25.3, event["durationMs"])
+	assert.Equal(t, "timeout", event["status"])
+}
+
+func TestDetectOutOfMemory(t *testing.T) {
+	memoryHistory = telemetry.NewMemoryHistory()
+	defer func() { memoryHistory = telemetry.NewMemoryHistory() }()
+
+	start := time.Unix(1700000000, 0)
+	batch := telemetry.NewBatch(0, 0, false)
+	batch.AddInvocation("request-2", start)
+
+	detect := func(platformLog logserver.LogLine) *telemetry.PlatformError {
+		report, err := telemetry.ParsePlatformLog(platformLog)
+		assert.NoError(t, err)
+		return detectOutOfMemory(report, platformLog.Time)
+	}
+
+	outOfMemory := detect(logserver.LogLine{
+		Content: []byte("REPORT RequestId: request-1\tDuration: 25.30 ms\tBilled Duration: 26 ms\tMemory Size: 128 MB\tMax Memory Used: 96 MB"),
+	})
+	assert.Nil(t, outOfMemory)
+
+	// The fault comes first, then the report
+	outOfMemory = detectOutOfMemoryFault(logserver.OutOfMemoryFault{Time: start, RequestID: "request-2"})
+	assert.NotNil(t, outOfMemory)
+	assert.Zero(t, outOfMemory.Duration)
+	assert.Equal(t, "request-2", outOfMemory.RequestID)
+	assert.Equal(t, telemetry.PlatformErrorOutOfMemory, outOfMemory.Type)
+	assert.Equal(t, "RequestId: request-2 Function ran out of memory. Memory headroom of recent invocations, oldest first: 25%", outOfMemory.Message)
+	addOutOfMemoryLog(batch, outOfMemory)
+
+	outOfMemory = detect(logserver.LogLine{
+		Content: []byte("REPORT RequestId: request-2\tDuration: 1000.00 ms\tBilled Duration: 1000 ms\tMemory Size: 128 MB\tMax Memory Used: 128 MB\tStatus: error\tError Type: Runtime.OutOfMemory"),
+	})
+	assert.Nil(t, outOfMemory)
+	assert.Len(t, memoryHistory.Usage(), 2)
+
+	// Using all of the memory is enough
+	outOfMemory = detect(logserver.LogLine{
+		Content: []byte("REPORT RequestId: request-3\tDuration: 500.00 ms\tBilled Duration: 500 ms\tMemory Size: 128 MB\tMax Memory Used: 128 MB"),
+	})
+	assert.NotNil(t, outOfMemory)
+	assert.Equal(t, 500*time.Millisecond, outOfMemory.Duration)
+	assert.Equal(t, "RequestId: request-3 Function ran out of memory: used 128 of 128 MB. Memory headroom of recent invocations, oldest first: 25%, 0%, 0%", outOfMemory.Message)
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+	assert.Len(t, harvested[0].Logs, 1)
+	assert.Equal(t, "request-2", harvested[0].Logs[0].RequestID)
+	assert.Equal(t, "ERROR", harvested[0].Logs[0].Attributes["level"])
+	assert.Equal(t, telemetry.PlatformErrorOutOfMemory, harvested[0].Logs[0].Attributes["error.class"])
+}
+
+func TestAddCostMetrics(t *testing.T) {
+	costEstimator = &apm.CostEstimator{Architecture: apm.ArchitectureX86, Price: apm.Price{GBSecond: 0.00001, Request: 0.0000002}}
+	defer func() { costEstimator = nil }()
+
+	start := time.Unix(1700000000, 0)
+	batch := telemetry.NewBatch(0, 0, false)
+	batch.AddInvocation("a-request-id", start)
+
+	report, err := telemetry.ParsePlatformReport("REPORT RequestId: a-request-id\tDuration: 1999.30 ms\tBilled Duration: 2000 ms\tMemory Size: 512 MB\tMax Memory Used: 74 MB")
+	assert.NoError(t, err)
+	addCostMetrics(batch, apm.NewLambdaMetrics(report), start.Add(time.Second))
+	// Not billed
+	addCostMetrics(batch, &apm.LambdaMetrics{RequestID: "a-request-id", Error: "error", ErrorType: "Runtime.OutOfMemory"}, start)
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+	assert.Len(t, harvested[0].Metrics, 2)
+
+	gbSeconds := harvested[0].Metrics[0]
+	assert.Equal(t, "apm.lambda.transaction.gb_seconds", gbSeconds.Name)
+	assert.Equal(t, "gauge", gbSeconds.Type)
+	assert.Equal(t, 1.0, gbSeconds.Value)
+	assert.Equal(t, start.Add(time.Second).UnixMilli(), gbSeconds.Timestamp)
+	assert.Equal(t, "a-request-id", gbSeconds.Attributes["aws.requestId"])
+	assert.Equal(t, apm.ArchitectureX86, gbSeconds.Attributes["aws.lambda.architecture"])
+
+	assert.Equal(t, "apm.lambda.transaction.estimated_cost", harvested[0].Metrics[1].Name)
+	assert.InDelta(t, 0.0000102, harvested[0].Metrics[1].Value, 1e-12)
+}
+
+func TestAddSandboxEvent(t *testing.T) {
+	lastRequestId = "a-request-id"
+	defer func() { lastRequestId = "" }()
+
+	start := time.Unix(1700000000, 0)
+	batch := telemetry.NewBatch(0, 0, false)
+	batch.AddInvocation("a-request-id", start)
+
+	addSandboxEvent(context.Background(), batch, telemetry.SandboxLifecycle{
+		Start:          start,
+		End:            start.Add(time.Minute),
+		ShutdownReason: "spindown",
+		Invocations:    3,
+	})
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+	assert.Len(t, harvested[0].Events, 1)
+
+	event := harvested[0].Events[0]
+	assert.Equal(t, telemetry.SandboxEventType, event["eventType"])
+	assert.Equal(t, int64(60000), event["lifetimeMs"])
+	assert.Equal(t, 3, event["invocations"])
+	assert.Equal(t, "spindown", event["shutdownReason"])
+}
+
 func overrideContext(ctx context.Context) {
 	rootCtx = ctx
 }
@@ -0,0 +1,164 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+var logger = util.NewComponentLogger("otlp")
+
+const (
+	listenHost = "127.0.0.1"
+	// maxBodyBytes bounds the uncompressed size of an export request
+	maxBodyBytes = 4 * 1024 * 1024
+)
+
+// Receiver accepts OTLP/HTTP traces, metrics and logs from OpenTelemetry SDKs, on localhost
+// inside the sandbox. Export requests are held in the telemetry batch, and forwarded to New
+// Relic's OTLP endpoint with the next harvest.
+type Receiver struct {
+	listenString string
+	server       *http.Server
+	batch        *telemetry.Batch
+	requestID    func() string
+}
+
+// Start starts the OTLP receiver. requestID reports the current invocation, which holds the
+// data received until it is harvested.
+func Start(conf *config.Configuration, batch *telemetry.Batch, requestID func() string) (*Receiver, error) {
+	return startInternal(net.JoinHostPort(listenHost, strconv.Itoa(int(conf.OTLPReceiverPort))), batch, requestID)
+}
+
+func startInternal(address string, batch *telemetry.Batch, requestID func() string) (*Receiver, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	receiver := &Receiver{
+		listenString: listener.Addr().String(),
+		server:       &http.Server{},
+		batch:        batch,
+		requestID:    requestID,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/traces", receiver.handler(telemetry.OTLPTraces))
+	mux.HandleFunc("/v1/metrics", receiver.handler(telemetry.OTLPMetrics))
+	mux.HandleFunc("/v1/logs", receiver.handler(telemetry.OTLPLogs))
+	receiver.server.Handler = mux
+
+	go func() {
+		logger.Logf("Starting OTLP receiver on %s", receiver.listenString)
+		logger.Logf("OTLP receiver terminated: %v\n", receiver.server.Serve(listener))
+	}()
+
+	return receiver, nil
+}
+
+func (r *Receiver) Port() uint16 {
+	_, portStr, _ := net.SplitHostPort(r.listenString)
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+	return uint16(port)
+}
+
+func (r *Receiver) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	ret := r.server.Shutdown(ctx)
+	if ret == context.DeadlineExceeded {
+		ret = nil
+	}
+	return ret
+}
+
+func (r *Receiver) handler(signal string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		defer util.Close(req.Body)
+
+		if req.Method != http.MethodPost {
+			res.Header().Set("Allow", http.MethodPost)
+			http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if contentType != telemetry.OTLPContentTypeProtobuf && contentType != telemetry.OTLPContentTypeJSON {
+			http.Error(res, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, status, err := readBody(res, req)
+		if err != nil {
+			http.Error(res, err.Error(), status)
+			return
+		}
+
+		payload := telemetry.OTLPPayload{Signal: signal, ContentType: contentType, Body: body}
+		if err = telemetry.ValidateOTLP(payload); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		inv := r.batch.AddOTLP(r.requestID(), payload)
+		if inv == nil {
+			logger.Debugf("Dropped OTLP %s payload; there is no invocation to attach it to", signal)
+			http.Error(res, "no invocation in progress", http.StatusServiceUnavailable)
+			return
+		}
+		logger.WithRequestID(inv.RequestId).Debugf("Accepted OTLP %s payload", signal)
+
+		// An empty Export*ServiceResponse signals full success
+		res.Header().Set("Content-Type", contentType)
+		res.WriteHeader(http.StatusOK)
+		if contentType == telemetry.OTLPContentTypeJSON {
+			_, _ = res.Write([]byte("{}"))
+		}
+	}
+}
+
+// readBody reads a request body, which may be gzip-compressed. On failure, it returns the
+// status code to respond with.
+func readBody(res http.ResponseWriter, req *http.Request) ([]byte, int, error) {
+	var reader io.Reader = http.MaxBytesReader(res, req.Body, maxBodyBytes)
+
+	switch strings.ToLower(req.Header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		defer util.Close(gzipReader)
+		reader = io.LimitReader(gzipReader, maxBodyBytes+1)
+	default:
+		return nil, http.StatusUnsupportedMediaType, errors.New("unsupported content encoding")
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, http.StatusRequestEntityTooLarge, errors.New("request body too large")
+		}
+		return nil, http.StatusBadRequest, err
+	}
+	if len(body) > maxBodyBytes {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("request body too large")
+	}
+
+	return body, 0, nil
+}
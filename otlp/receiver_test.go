@@ -0,0 +1,131 @@
+package otlp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRequestId = "test-request-id"
+
+// testSpans is an ExportTraceServiceRequest with one ResourceSpans holding an empty Resource
+var testSpans = []byte{0x0a, 0x02, 0x0a, 0x00}
+
+func startTestReceiver(t *testing.T, withInvocation bool) (*Receiver, *telemetry.Batch) {
+	batch := telemetry.NewBatch(1000, 10000, false)
+	if withInvocation {
+		batch.AddInvocation(testRequestId, time.Now())
+	}
+
+	receiver, err := startInternal("localhost:0", batch, func() string { return testRequestId })
+	assert.NoError(t, err)
+
+	return receiver, batch
+}
+
+func post(t *testing.T, receiver *Receiver, path string, contentType string, contentEncoding string, body []byte) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%d%s", receiver.Port(), path), bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+
+	return res.StatusCode, string(resBody)
+}
+
+func TestReceiverProtobuf(t *testing.T) {
+	receiver, batch := startTestReceiver(t, true)
+	defer receiver.Close()
+
+	status, body := post(t, receiver, "/v1/traces", "application/x-protobuf", "", testSpans)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, body)
+
+	compressed, err := util.Compress(testSpans)
+	assert.NoError(t, err)
+	status, _ = post(t, receiver, "/v1/metrics", "application/x-protobuf", "gzip", compressed.Bytes())
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = post(t, receiver, "/v1/traces", "application/x-protobuf", "", []byte{0x0a, 0x10, 0x01})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+
+	payloads := harvested[0].OTLP
+	assert.Len(t, payloads, 2)
+	assert.Equal(t, telemetry.OTLPTraces, payloads[0].Signal)
+	assert.Equal(t, telemetry.OTLPMetrics, payloads[1].Signal)
+	assert.Equal(t, testSpans, payloads[1].Body)
+}
+
+func TestReceiverJSON(t *testing.T) {
+	receiver, batch := startTestReceiver(t, true)
+	defer receiver.Close()
+
+	status, body := post(t, receiver, "/v1/logs", "application/json; charset=utf-8", "", []byte(`{"resourceLogs": []}`))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "{}", body)
+
+	status, _ = post(t, receiver, "/v1/logs", "application/json", "", []byte(`not json`))
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+	assert.Equal(t, telemetry.OTLPContentTypeJSON, harvested[0].OTLP[0].ContentType)
+}
+
+func TestReceiverRejects(t *testing.T) {
+	receiver, _ := startTestReceiver(t, true)
+	defer receiver.Close()
+
+	status, _ := post(t, receiver, "/v1/traces", "text/plain", "", testSpans)
+	assert.Equal(t, http.StatusUnsupportedMediaType, status)
+
+	status, _ = post(t, receiver, "/v1/traces", "application/x-protobuf", "br", testSpans)
+	assert.Equal(t, http.StatusUnsupportedMediaType, status)
+
+	status, _ = post(t, receiver, "/v1/traces", "application/x-protobuf", "gzip", testSpans)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = post(t, receiver, "/v1/traces", "application/x-protobuf", "", make([]byte, maxBodyBytes+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+
+	res, err := http.Get(fmt.Sprintf("http://localhost:%d/v1/traces", receiver.Port()))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestReceiverWithoutInvocation(t *testing.T) {
+	receiver, _ := startTestReceiver(t, false)
+	defer receiver.Close()
+
+	status, _ := post(t, receiver, "/v1/traces", "application/x-protobuf", "", testSpans)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestStart(t *testing.T) {
+	conf := &config.Configuration{OTLPReceiverPort: 0}
+	receiver, err := Start(conf, telemetry.NewBatch(1000, 10000, false), func() string { return "" })
+	assert.NoError(t, err)
+	defer receiver.Close()
+
+	assert.NotZero(t, receiver.Port())
+}
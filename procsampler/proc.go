@@ -0,0 +1,234 @@
+package procsampler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+// clockTicksPerSecond is USER_HZ, the unit of /proc/stat's CPU times on Linux
+const clockTicksPerSecond = 100
+
+// cpuTimes are the sandbox's CPU times, in clock ticks, from the cpu line of /proc/stat
+type cpuTimes struct {
+	user   uint64
+	system uint64
+	steal  uint64
+}
+
+// processCPUTimes are a process's CPU times, in clock ticks, from /proc/<pid>/stat
+type processCPUTimes struct {
+	user   uint64
+	system uint64
+}
+
+// processUsage is the usage of the sandbox's processes, other than the extension, from
+// /proc/<pid>
+type processUsage struct {
+	// rss is in bytes
+	rss uint64
+	fds uint64
+}
+
+// networkUsage is the bytes the sandbox's network interfaces, other than loopback, have
+// received and sent, from /proc/net/dev
+type networkUsage struct {
+	rxBytes uint64
+	txBytes uint64
+}
+
+// readCPU reads the cpu line of /proc/stat. User time includes nice time, and system time
+// includes interrupts.
+func readCPU(proc string) (cpuTimes, error) {
+	file, err := os.Open(filepath.Join(proc, "stat"))
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	defer util.Close(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 9 || fields[0] != "cpu" {
+			continue
+		}
+		values := make([]uint64, 8)
+		for i := range values {
+			values[i], err = strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return cpuTimes{}, fmt.Errorf("error parsing cpu line: %v", err)
+			}
+		}
+		// user nice system idle iowait irq softirq steal
+		return cpuTimes{
+			user:   values[0] + values[1],
+			system: values[2] + values[5] + values[6],
+			steal:  values[7],
+		}, nil
+	}
+	return cpuTimes{}, fmt.Errorf("no cpu line in %s", file.Name())
+}
+
+// readProcessCPU reads the utime and stime of a process from /proc/<pid>/stat
+func readProcessCPU(proc string, pid int) (processCPUTimes, error) {
+	path := filepath.Join(proc, strconv.Itoa(pid), "stat")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return processCPUTimes{}, err
+	}
+
+	// The process's name is in parentheses, and may have spaces, so fields are counted after it
+	end := strings.LastIndex(string(content), ")")
+	if end < 0 {
+		return processCPUTimes{}, fmt.Errorf("error parsing %s", path)
+	}
+	// state is the 3rd field, and utime and stime the 14th and 15th
+	fields := strings.Fields(string(content)[end+1:])
+	if len(fields) < 13 {
+		return processCPUTimes{}, fmt.Errorf("error parsing %s", path)
+	}
+	user, userErr := strconv.ParseUint(fields[11], 10, 64)
+	system, systemErr := strconv.ParseUint(fields[12], 10, 64)
+	if userErr != nil || systemErr != nil {
+		return processCPUTimes{}, fmt.Errorf("error parsing %s", path)
+	}
+	return processCPUTimes{user: user, system: system}, nil
+}
+
+// readMemoryUsed reads the memory in use, in bytes, from /proc/meminfo, as MemTotal less
+// MemAvailable
+func readMemoryUsed(proc string) (uint64, error) {
+	file, err := os.Open(filepath.Join(proc, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer util.Close(file)
+
+	var total, available uint64
+	var found int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, value, ok := parseKilobytes(scanner.Text())
+		if !ok {
+			continue
+		}
+		switch name {
+		case "MemTotal":
+			total = value
+			found++
+		case "MemAvailable":
+			available = value
+			found++
+		}
+	}
+	if found < 2 || available > total {
+		return 0, fmt.Errorf("no memory totals in %s", file.Name())
+	}
+	return total - available, nil
+}
+
+// readProcesses sums the RSS and open file descriptors of each process, except self
+func readProcesses(proc string, self int) (processUsage, error) {
+	entries, err := os.ReadDir(proc)
+	if err != nil {
+		return processUsage{}, err
+	}
+
+	var usage processUsage
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		// Processes may exit while they're read
+		if rss, err := readRSS(filepath.Join(proc, entry.Name(), "status")); err == nil {
+			usage.rss += rss
+		}
+		if fds, err := os.ReadDir(filepath.Join(proc, entry.Name(), "fd")); err == nil {
+			usage.fds += uint64(len(fds))
+		}
+	}
+	return usage, nil
+}
+
+// readRSS reads a process's VmRSS, in bytes, from its status. Kernel threads have none.
+func readRSS(status string) (uint64, error) {
+	file, err := os.Open(status)
+	if err != nil {
+		return 0, err
+	}
+	defer util.Close(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if name, value, ok := parseKilobytes(scanner.Text()); ok && name == "VmRSS" {
+			return value, nil
+		}
+	}
+	return 0, nil
+}
+
+// readNetwork sums the bytes received and sent by each interface in /proc/net/dev, except
+// loopback
+func readNetwork(proc string) (networkUsage, error) {
+	file, err := os.Open(filepath.Join(proc, "net", "dev"))
+	if err != nil {
+		return networkUsage{}, err
+	}
+	defer util.Close(file)
+
+	var usage networkUsage
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// The first two lines are headers, without a colon after the interface
+		name, counters, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, rxErr := strconv.ParseUint(fields[0], 10, 64)
+		tx, txErr := strconv.ParseUint(fields[8], 10, 64)
+		if rxErr != nil || txErr != nil {
+			continue
+		}
+		usage.rxBytes += rx
+		usage.txBytes += tx
+	}
+	return usage, nil
+}
+
+// diskUsed is the bytes used on the file system holding path
+func diskUsed(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return (stat.Blocks - stat.Bfree) * uint64(stat.Bsize), nil
+}
+
+// parseKilobytes parses a "Name:   1234 kB" line, as in /proc/meminfo and /proc/<pid>/status,
+// returning the value in bytes
+func parseKilobytes(line string) (string, uint64, bool) {
+	name, rest, found := strings.Cut(line, ":")
+	if !found {
+		return "", 0, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) != 2 || fields[1] != "kB" {
+		return "", 0, false
+	}
+	value, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return name, value * 1024, true
+}
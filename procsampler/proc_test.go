@@ -0,0 +1,132 @@
+package procsampler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    5000      50    0    0    0     0          0         0     5000      50    0    0    0     0       0          0
+  eth0: %d     10    0    0    0     0          0         0 %d      20    0    0    0     0       0          0
+`
+
+// writeProc writes a fake proc file system, with a process of the function, and one of the extension
+func writeProc(t *testing.T, proc string, cpuLine string, memAvailableKB int, rssKB int, fds int, rxBytes int, txBytes int) {
+	write := func(name string, content string) {
+		path := filepath.Join(proc, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	write("stat", cpuLine+"\ncpu0 1 2 3 4 5 6 7 8 0 0\nintr 1234\n")
+	write("meminfo", "MemTotal:        1048576 kB\nMemFree:          100000 kB\nMemAvailable:     "+strconv.Itoa(memAvailableKB)+" kB\n")
+	write("net/dev", fmt.Sprintf(testNetDev, rxBytes, txBytes))
+	write("123/status", "Name:\tnode\nVmRSS:\t   "+strconv.Itoa(rssKB)+" kB\nThreads:\t7\n")
+	assert.NoError(t, os.RemoveAll(filepath.Join(proc, "123", "fd")))
+	for i := 0; i < fds; i++ {
+		write(filepath.Join("123", "fd", strconv.Itoa(i)), "")
+	}
+	// The extension's own usage isn't counted
+	self := strconv.Itoa(os.Getpid())
+	write(filepath.Join(self, "status"), "Name:\textension\nVmRSS:\t   99999 kB\n")
+	write(filepath.Join(self, "fd", "0"), "")
+	// Kernel threads have no RSS
+	write("2/status", "Name:\tkthreadd\n")
+}
+
+// writeSelfStat writes the extension's /proc/<pid>/stat, with its utime and stime
+func writeSelfStat(t *testing.T, proc string, utime int, stime int) {
+	path := filepath.Join(proc, strconv.Itoa(os.Getpid()), "stat")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	content := fmt.Sprintf("%d (newrelic lambda) S 1 1 1 0 -1 4194560 100 0 0 0 %d %d 0 0 20 0 8 0 100 0 0\n", os.Getpid(), utime, stime)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestReadProcessCPU(t *testing.T) {
+	proc := t.TempDir()
+	writeSelfStat(t, proc, 30, 10)
+
+	cpu, err := readProcessCPU(proc, os.Getpid())
+	assert.NoError(t, err)
+	assert.Equal(t, processCPUTimes{user: 30, system: 10}, cpu)
+
+	_, err = readProcessCPU(proc, 1)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(proc, strconv.Itoa(os.Getpid()), "stat"), []byte("123 (extension) S 1\n"), 0o644))
+	_, err = readProcessCPU(proc, os.Getpid())
+	assert.Error(t, err)
+}
+
+func TestReadCPU(t *testing.T) {
+	proc := t.TempDir()
+	writeProc(t, proc, "cpu  100 10 50 1000 5 2 3 7 0 0", 0, 0, 0, 0, 0)
+
+	cpu, err := readCPU(proc)
+	assert.NoError(t, err)
+	assert.Equal(t, cpuTimes{user: 110, system: 55, steal: 7}, cpu)
+
+	_, err = readCPU(t.TempDir())
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(proc, "stat"), []byte("intr 1234\n"), 0o644))
+	_, err = readCPU(proc)
+	assert.Error(t, err)
+}
+
+func TestReadMemoryUsed(t *testing.T) {
+	proc := t.TempDir()
+	writeProc(t, proc, "cpu  0 0 0 0 0 0 0 0", 524288, 0, 0, 0, 0)
+
+	used, err := readMemoryUsed(proc)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(524288*1024), used)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(proc, "meminfo"), []byte("MemTotal: 1048576 kB\n"), 0o644))
+	_, err = readMemoryUsed(proc)
+	assert.Error(t, err)
+}
+
+func TestReadProcesses(t *testing.T) {
+	proc := t.TempDir()
+	writeProc(t, proc, "cpu  0 0 0 0 0 0 0 0", 0, 2048, 3, 0, 0)
+
+	usage, err := readProcesses(proc, os.Getpid())
+	assert.NoError(t, err)
+	assert.Equal(t, processUsage{rss: 2048 * 1024, fds: 3}, usage)
+}
+
+func TestReadNetwork(t *testing.T) {
+	proc := t.TempDir()
+	writeProc(t, proc, "cpu  0 0 0 0 0 0 0 0", 0, 0, 0, 1500, 700)
+
+	usage, err := readNetwork(proc)
+	assert.NoError(t, err)
+	assert.Equal(t, networkUsage{rxBytes: 1500, txBytes: 700}, usage)
+}
+
+func TestDiskUsed(t *testing.T) {
+	_, err := diskUsed(t.TempDir())
+	assert.NoError(t, err)
+
+	_, err = diskUsed(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestParseKilobytes(t *testing.T) {
+	name, value, ok := parseKilobytes("VmRSS:\t   1234 kB")
+	assert.True(t, ok)
+	assert.Equal(t, "VmRSS", name)
+	assert.Equal(t, uint64(1234*1024), value)
+
+	_, _, ok = parseKilobytes("Threads:\t7")
+	assert.False(t, ok)
+	_, _, ok = parseKilobytes("HugePages_Total:       0")
+	assert.False(t, ok)
+}
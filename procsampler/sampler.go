@@ -0,0 +1,255 @@
+// Package procsampler samples the resource usage of the Lambda sandbox from /proc, during each
+// invocation, and reports it as metrics.
+package procsampler
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+// metricPrefix names the sandbox's resource metrics
+const metricPrefix = "aws.lambda.sandbox"
+
+var logger = util.NewComponentLogger("procsampler")
+
+// totals are the cumulative counters read at the start and end of an invocation
+type totals struct {
+	cpu     cpuTimes
+	network networkUsage
+	// selfCPU and selfSent are the extension's own CPU times, and the bytes it sent
+	selfCPU  processCPUTimes
+	selfSent uint64
+	// cpuRead, networkRead and selfCPURead are set when the counters could be read
+	cpuRead     bool
+	networkRead bool
+	selfCPURead bool
+}
+
+// peaks are the gauges read throughout an invocation
+type peaks struct {
+	samples    uint64
+	rssSum     uint64
+	rssMax     uint64
+	fdsMax     uint64
+	memUsedMax uint64
+}
+
+// Sampler samples the sandbox's resource usage during an invocation: CPU time from /proc/stat,
+// memory from /proc/meminfo, the RSS and open file descriptors of the function's processes from
+// /proc/<pid>, network bytes from /proc/net/dev, and the disk usage of /tmp.
+//
+// The sandbox is frozen between invocations, so an invocation is sampled until the next starts,
+// including the extension's work after the runtime finished. The extension's own CPU time, from
+// /proc/<pid>/stat, and the bytes it sent are taken out of the sandbox's.
+type Sampler struct {
+	proc     string
+	tmp      string
+	interval time.Duration
+	// self is the extension's pid, whose usage isn't the function's
+	self int
+	// sentBytes returns the bytes the extension has sent since it started, or is nil
+	sentBytes func() uint64
+
+	lock      sync.Mutex
+	requestID string
+	start     time.Time
+	first     totals
+	peaks     peaks
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// New creates a Sampler that reads the proc file system at proc, and the disk usage of tmp.
+// sentBytes returns the bytes the extension has sent, which aren't the function's; it may be nil.
+func New(proc string, tmp string, interval time.Duration, sentBytes func() uint64) *Sampler {
+	return &Sampler{
+		proc:      proc,
+		tmp:       tmp,
+		interval:  interval,
+		self:      os.Getpid(),
+		sentBytes: sentBytes,
+	}
+}
+
+// Start creates the Sampler of the sandbox, when /proc can be read
+func Start(conf *config.Configuration, sentBytes func() uint64) (*Sampler, error) {
+	sampler := New("/proc", os.TempDir(), conf.ResourceSamplerInterval, sentBytes)
+	if _, err := readCPU(sampler.proc); err != nil {
+		return nil, fmt.Errorf("error reading /proc: %v", err)
+	}
+	return sampler, nil
+}
+
+// Begin starts sampling an invocation. An invocation already being sampled is ended, without
+// its metrics.
+func (s *Sampler) Begin(requestID string, now time.Time) {
+	s.End()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requestID = requestID
+	s.start = now
+	s.first = s.readTotals()
+	s.peaks = peaks{}
+	s.samplePeaks()
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.sampleLoop(s.stop, s.done)
+}
+
+// End stops sampling the invocation, and returns its request ID and metrics. It returns nothing
+// when no invocation is being sampled.
+func (s *Sampler) End() (string, []telemetry.Metric) {
+	s.lock.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.lock.Unlock()
+	if stop == nil {
+		return "", nil
+	}
+	close(stop)
+	<-done
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.samplePeaks()
+	return s.requestID, s.metrics(s.readTotals())
+}
+
+// sampleLoop samples the gauges until it's stopped
+func (s *Sampler) sampleLoop(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.lock.Lock()
+			s.samplePeaks()
+			s.lock.Unlock()
+		}
+	}
+}
+
+// readTotals reads the cumulative counters. Counters that can't be read have no metrics.
+func (s *Sampler) readTotals() totals {
+	var t totals
+	var err error
+	if t.cpu, err = readCPU(s.proc); err == nil {
+		t.cpuRead = true
+	} else {
+		logger.Debugf("Failed to read CPU times: %v", err)
+	}
+	if t.network, err = readNetwork(s.proc); err == nil {
+		t.networkRead = true
+	} else {
+		logger.Debugf("Failed to read network usage: %v", err)
+	}
+	if t.selfCPU, err = readProcessCPU(s.proc, s.self); err == nil {
+		t.selfCPURead = true
+	} else {
+		logger.Debugf("Failed to read the extension's CPU times: %v", err)
+	}
+	if s.sentBytes != nil {
+		t.selfSent = s.sentBytes()
+	}
+	return t
+}
+
+// samplePeaks reads the gauges, keeping their peaks
+func (s *Sampler) samplePeaks() {
+	if processes, err := readProcesses(s.proc, s.self); err == nil {
+		s.peaks.samples++
+		s.peaks.rssSum += processes.rss
+		s.peaks.rssMax = max(s.peaks.rssMax, processes.rss)
+		s.peaks.fdsMax = max(s.peaks.fdsMax, processes.fds)
+	} else {
+		logger.Debugf("Failed to read processes: %v", err)
+	}
+	if memUsed, err := readMemoryUsed(s.proc); err == nil {
+		s.peaks.memUsedMax = max(s.peaks.memUsedMax, memUsed)
+	} else {
+		logger.Debugf("Failed to read memory usage: %v", err)
+	}
+}
+
+// metrics are the invocation's usage, as gauges at its start. The sandbox is frozen between
+// invocations, so the counters' increase until the next is the invocation's.
+func (s *Sampler) metrics(last totals) []telemetry.Metric {
+	attributes := map[string]interface{}{"aws.requestId": s.requestID}
+	gauge := func(name string, value float64) telemetry.Metric {
+		return telemetry.Metric{
+			Name:       metricPrefix + "." + name,
+			Type:       "gauge",
+			Value:      value,
+			Timestamp:  s.start.UnixMilli(),
+			Attributes: attributes,
+		}
+	}
+	ticksToMillis := func(ticks uint64) float64 {
+		return float64(ticks) * 1000 / clockTicksPerSecond
+	}
+
+	var metrics []telemetry.Metric
+	if s.first.cpuRead && last.cpuRead {
+		user := delta(s.first.cpu.user, last.cpu.user)
+		system := delta(s.first.cpu.system, last.cpu.system)
+		if s.first.selfCPURead && last.selfCPURead {
+			user = less(user, delta(s.first.selfCPU.user, last.selfCPU.user))
+			system = less(system, delta(s.first.selfCPU.system, last.selfCPU.system))
+		}
+		metrics = append(metrics,
+			gauge("cpu.user_ms", ticksToMillis(user)),
+			gauge("cpu.system_ms", ticksToMillis(system)),
+			gauge("cpu.steal_ms", ticksToMillis(delta(s.first.cpu.steal, last.cpu.steal))),
+		)
+	}
+	if s.first.networkRead && last.networkRead {
+		sent := less(delta(s.first.network.txBytes, last.network.txBytes), delta(s.first.selfSent, last.selfSent))
+		metrics = append(metrics,
+			gauge("network.rx_bytes", float64(delta(s.first.network.rxBytes, last.network.rxBytes))),
+			gauge("network.tx_bytes", float64(sent)),
+		)
+	}
+	if s.peaks.samples > 0 {
+		metrics = append(metrics,
+			gauge("memory.rss.max", float64(s.peaks.rssMax)),
+			gauge("memory.rss.avg", float64(s.peaks.rssSum)/float64(s.peaks.samples)),
+			gauge("fds.max", float64(s.peaks.fdsMax)),
+		)
+	}
+	if s.peaks.memUsedMax > 0 {
+		metrics = append(metrics, gauge("memory.used.max", float64(s.peaks.memUsedMax)))
+	}
+	if tmpUsed, err := diskUsed(s.tmp); err == nil {
+		metrics = append(metrics, gauge("tmp.used_bytes", float64(tmpUsed)))
+	} else {
+		logger.Debugf("Failed to read the disk usage of %s: %v", s.tmp, err)
+	}
+	return metrics
+}
+
+// delta is the increase of a counter, or zero when it was reset
+func delta(first uint64, last uint64) uint64 {
+	if last < first {
+		return 0
+	}
+	return last - first
+}
+
+// less is total less part, or zero when part is more
+func less(total uint64, part uint64) uint64 {
+	return delta(part, total)
+}
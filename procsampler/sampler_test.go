@@ -0,0 +1,100 @@
+package procsampler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+func metricValues(metrics []telemetry.Metric) map[string]float64 {
+	values := make(map[string]float64, len(metrics))
+	for _, metric := range metrics {
+		values[metric.Name] = metric.Value
+	}
+	return values
+}
+
+func TestSampler(t *testing.T) {
+	proc := t.TempDir()
+	writeProc(t, proc, "cpu  100 10 50 1000 5 2 3 7 0 0", 786432, 1024, 2, 1000, 500)
+
+	writeSelfStat(t, proc, 10, 5)
+	var sentBytes uint64
+	sampler := New(proc, t.TempDir(), 5*time.Millisecond, func() uint64 { return sentBytes })
+	requestID, metrics := sampler.End()
+	assert.Equal(t, "", requestID)
+	assert.Nil(t, metrics)
+
+	start := time.Unix(1700000000, 0)
+	sampler.Begin("request-1", start)
+
+	// The function's memory grows, then shrinks
+	writeProc(t, proc, "cpu  100 10 50 1000 5 2 3 7 0 0", 524288, 4096, 5, 1000, 500)
+	assert.Eventually(t, func() bool {
+		sampler.lock.Lock()
+		defer sampler.lock.Unlock()
+		return sampler.peaks.rssMax == 4096*1024
+	}, time.Second, time.Millisecond)
+	writeProc(t, proc, "cpu  150 20 60 1100 5 2 3 9 0 0", 786432, 1024, 2, 3000, 1500)
+	// The extension's own CPU time and sent bytes aren't the function's
+	writeSelfStat(t, proc, 30, 10)
+	sentBytes = 400
+
+	requestID, metrics = sampler.End()
+	assert.Equal(t, "request-1", requestID)
+	for _, metric := range metrics {
+		assert.Equal(t, "gauge", metric.Type)
+		assert.Equal(t, start.UnixMilli(), metric.Timestamp)
+		assert.Equal(t, "request-1", metric.Attributes["aws.requestId"])
+	}
+
+	values := metricValues(metrics)
+	assert.Equal(t, 400.0, values["aws.lambda.sandbox.cpu.user_ms"])
+	assert.Equal(t, 50.0, values["aws.lambda.sandbox.cpu.system_ms"])
+	assert.Equal(t, 20.0, values["aws.lambda.sandbox.cpu.steal_ms"])
+	assert.Equal(t, 2000.0, values["aws.lambda.sandbox.network.rx_bytes"])
+	assert.Equal(t, 600.0, values["aws.lambda.sandbox.network.tx_bytes"])
+	assert.Equal(t, float64(4096*1024), values["aws.lambda.sandbox.memory.rss.max"])
+	assert.Greater(t, values["aws.lambda.sandbox.memory.rss.avg"], float64(1024*1024))
+	assert.Less(t, values["aws.lambda.sandbox.memory.rss.avg"], float64(4096*1024))
+	assert.Equal(t, 5.0, values["aws.lambda.sandbox.fds.max"])
+	assert.Equal(t, float64(524288*1024), values["aws.lambda.sandbox.memory.used.max"])
+	assert.Contains(t, values, "aws.lambda.sandbox.tmp.used_bytes")
+
+	// Ended already
+	_, metrics = sampler.End()
+	assert.Nil(t, metrics)
+}
+
+func TestSamplerUnreadable(t *testing.T) {
+	sampler := New(t.TempDir(), t.TempDir(), time.Hour, nil)
+	sampler.Begin("request-1", time.Now())
+	// Beginning again ends the last invocation
+	sampler.Begin("request-2", time.Now())
+
+	requestID, metrics := sampler.End()
+	assert.Equal(t, "request-2", requestID)
+	// Only the processes, of which there are none, and /tmp can be read
+	assert.ElementsMatch(t, []string{
+		"aws.lambda.sandbox.memory.rss.max",
+		"aws.lambda.sandbox.memory.rss.avg",
+		"aws.lambda.sandbox.fds.max",
+		"aws.lambda.sandbox.tmp.used_bytes",
+	}, func() []string {
+		var names []string
+		for name := range metricValues(metrics) {
+			names = append(names, name)
+		}
+		return names
+	}())
+}
+
+func TestStart(t *testing.T) {
+	sampler, err := Start(&config.Configuration{ResourceSamplerInterval: time.Second}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/proc", sampler.proc)
+	assert.Equal(t, time.Second, sampler.interval)
+}
@@ -0,0 +1,175 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/apm"
+)
+
+// Aggregator accumulates samples over a harvest window. Counters are summed, gauges keep their
+// last value, timers, histograms and distributions become summaries, and sets count their
+// unique members.
+type Aggregator struct {
+	lock        sync.Mutex
+	window      time.Duration
+	windowStart time.Time
+	attributes  map[string]string
+	series      map[string]*series
+	// lastGauges holds gauge values from earlier windows, which +N and -N adjust
+	lastGauges map[string]float64
+}
+
+// series is the aggregate of the samples sharing a name, type and tags
+type series struct {
+	name    string
+	kind    string
+	tags    map[string]string
+	value   float64
+	summary apm.Summary
+	members map[string]struct{}
+}
+
+// NewAggregator creates an Aggregator. The attributes are added to every metric.
+func NewAggregator(window time.Duration, attributes map[string]string, now time.Time) *Aggregator {
+	return &Aggregator{
+		window:      window,
+		windowStart: now,
+		attributes:  attributes,
+		series:      make(map[string]*series),
+		lastGauges:  make(map[string]float64),
+	}
+}
+
+// Add aggregates a sample into the current window
+func (a *Aggregator) Add(sample Sample) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	kind := sample.Type
+	if kind == Timer || kind == Histogram || kind == Distribution {
+		kind = Timer
+	}
+
+	key := seriesKey(sample.Name, kind, sample.Tags)
+	s, ok := a.series[key]
+	if !ok {
+		s = &series{name: sample.Name, kind: kind, tags: sample.Tags}
+		if kind == Gauge {
+			s.value = a.lastGauges[key]
+		}
+		a.series[key] = s
+	}
+
+	switch kind {
+	case Counter:
+		s.value += sample.Value / sample.SampleRate
+	case Gauge:
+		if sample.GaugeDelta {
+			s.value += sample.Value
+		} else {
+			s.value = sample.Value
+		}
+	case Timer:
+		if s.summary.Count == 0 {
+			s.summary.Min = math.Inf(1)
+			s.summary.Max = math.Inf(-1)
+		}
+		s.summary.Count += 1 / sample.SampleRate
+		s.summary.Sum += sample.Value / sample.SampleRate
+		s.summary.Min = math.Min(s.summary.Min, sample.Value)
+		s.summary.Max = math.Max(s.summary.Max, sample.Value)
+	case Set:
+		if s.members == nil {
+			s.members = make(map[string]struct{})
+		}
+		s.members[sample.SetValue] = struct{}{}
+	}
+}
+
+// Harvest returns the metrics aggregated over the window, once it has elapsed, and starts a new
+// window. When force is true, the metrics are returned even if the window hasn't elapsed.
+func (a *Aggregator) Harvest(now time.Time, force bool) []apm.Metric {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if !force && now.Sub(a.windowStart) < a.window {
+		return nil
+	}
+
+	interval := now.Sub(a.windowStart).Milliseconds()
+	if interval <= 0 {
+		interval = 1
+	}
+	timestamp := a.windowStart.UnixMilli()
+
+	metrics := make([]apm.Metric, 0, len(a.series))
+	for key, s := range a.series {
+		metric := apm.Metric{
+			Name:       s.name,
+			Timestamp:  timestamp,
+			Attributes: a.metricAttributes(s.tags),
+		}
+
+		switch s.kind {
+		case Counter:
+			metric.Type = "count"
+			metric.Value = s.value
+			metric.Interval = interval
+		case Gauge:
+			metric.Type = "gauge"
+			metric.Value = s.value
+			a.lastGauges[key] = s.value
+		case Timer:
+			summary := s.summary
+			metric.Type = "summary"
+			metric.Summary = &summary
+			metric.Interval = interval
+		case Set:
+			metric.Type = "gauge"
+			metric.Value = float64(len(s.members))
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	a.series = make(map[string]*series, len(a.series))
+	a.windowStart = now
+
+	return metrics
+}
+
+func (a *Aggregator) metricAttributes(tags map[string]string) map[string]interface{} {
+	attributes := make(map[string]interface{}, len(a.attributes)+len(tags))
+	for k, v := range a.attributes {
+		attributes[k] = v
+	}
+	for k, v := range tags {
+		attributes[k] = v
+	}
+	return attributes
+}
+
+// seriesKey identifies a series by its name, type and sorted tags
+func seriesKey(name string, kind string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	builder.WriteString(name)
+	builder.WriteString("|")
+	builder.WriteString(kind)
+	for _, k := range keys {
+		builder.WriteString("|")
+		builder.WriteString(k)
+		builder.WriteString(":")
+		builder.WriteString(tags[k])
+	}
+	return builder.String()
+}
@@ -0,0 +1,107 @@
+package statsd
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+var windowStart = time.Unix(1603821157, 0)
+
+func sortedMetrics(metrics []telemetry.Metric) []telemetry.Metric {
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Name != metrics[j].Name {
+			return metrics[i].Name < metrics[j].Name
+		}
+		return len(metrics[i].Attributes) < len(metrics[j].Attributes)
+	})
+	return metrics
+}
+
+func addLines(t *testing.T, aggregator *Aggregator, lines ...string) {
+	for _, line := range lines {
+		sample, err := ParseLine(line)
+		assert.NoError(t, err)
+		aggregator.Add(*sample)
+	}
+}
+
+func TestAggregatorHarvest(t *testing.T) {
+	aggregator := NewAggregator(time.Second, map[string]string{"faas.name": "my-function"}, windowStart)
+
+	addLines(t, aggregator,
+		"page.views:1|c",
+		"page.views:1|c|@0.5",
+		"page.views:1|c|#env:prod",
+		"queue.depth:7|g",
+		"queue.depth:9|g",
+		"db.query:10|ms",
+		"db.query:30|h",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+	)
+
+	assert.Nil(t, aggregator.Harvest(windowStart.Add(500*time.Millisecond), false))
+
+	metrics := sortedMetrics(aggregator.Harvest(windowStart.Add(2*time.Second), false))
+	assert.Len(t, metrics, 5)
+
+	assert.Equal(t, telemetry.Metric{
+		Name:       "db.query",
+		Type:       "summary",
+		Timestamp:  windowStart.UnixMilli(),
+		Interval:   2000,
+		Attributes: map[string]interface{}{"faas.name": "my-function"},
+		Summary:    &telemetry.Summary{Count: 2, Sum: 40, Min: 10, Max: 30},
+	}, metrics[0])
+
+	assert.Equal(t, "page.views", metrics[1].Name)
+	assert.Equal(t, "count", metrics[1].Type)
+	assert.Equal(t, float64(3), metrics[1].Value)
+	assert.Equal(t, int64(2000), metrics[1].Interval)
+
+	assert.Equal(t, "page.views", metrics[2].Name)
+	assert.Equal(t, float64(1), metrics[2].Value)
+	assert.Equal(t, map[string]interface{}{"faas.name": "my-function", "env": "prod"}, metrics[2].Attributes)
+
+	assert.Equal(t, "queue.depth", metrics[3].Name)
+	assert.Equal(t, "gauge", metrics[3].Type)
+	assert.Equal(t, float64(9), metrics[3].Value)
+
+	assert.Equal(t, "users", metrics[4].Name)
+	assert.Equal(t, "gauge", metrics[4].Type)
+	assert.Equal(t, float64(2), metrics[4].Value)
+
+	// The window was reset
+	assert.Empty(t, aggregator.Harvest(windowStart.Add(4*time.Second), false))
+}
+
+func TestAggregatorGaugeDelta(t *testing.T) {
+	aggregator := NewAggregator(time.Second, nil, windowStart)
+
+	addLines(t, aggregator, "queue.depth:7|g", "queue.depth:+3|g")
+	metrics := aggregator.Harvest(windowStart, true)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, float64(10), metrics[0].Value)
+
+	// Deltas adjust the value from the earlier window
+	addLines(t, aggregator, "queue.depth:-4|g")
+	metrics = aggregator.Harvest(windowStart.Add(time.Second), false)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, float64(6), metrics[0].Value)
+}
+
+func TestAggregatorForceHarvest(t *testing.T) {
+	aggregator := NewAggregator(time.Minute, nil, windowStart)
+	addLines(t, aggregator, "page.views:1|c")
+
+	assert.Nil(t, aggregator.Harvest(windowStart, false))
+
+	metrics := aggregator.Harvest(windowStart, true)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, int64(1), metrics[0].Interval)
+}
@@ -0,0 +1,118 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/apm"
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/telemetry"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+var logger = util.NewComponentLogger("statsd")
+
+const (
+	listenHost = "127.0.0.1"
+	// maxPacketSize is the largest UDP payload
+	maxPacketSize = 65535
+)
+
+// Listener receives StatsD and DogStatsD metrics over UDP, on localhost inside the sandbox,
+// and aggregates them to be sent with the extension's metrics.
+type Listener struct {
+	conn       net.PacketConn
+	aggregator *Aggregator
+	wg         sync.WaitGroup
+}
+
+// Start starts the StatsD listener. Metrics are aggregated over the harvest ripe window, and
+// tagged with the function name and version, and NR_TAGS.
+func Start(conf *config.Configuration, functionName string, functionVersion string) (*Listener, error) {
+	window := time.Duration(conf.RipeMillis) * time.Millisecond
+	aggregator := NewAggregator(window, MetricAttributes(functionName, functionVersion), time.Now())
+	address := net.JoinHostPort(listenHost, strconv.Itoa(int(conf.StatsDPort)))
+
+	return startInternal(address, aggregator)
+}
+
+// MetricAttributes are the attributes of metrics aggregated by the extension: the function name
+// and version, and NR_TAGS
+func MetricAttributes(functionName string, functionVersion string) map[string]string {
+	attributes := map[string]string{
+		"faas.name":    functionName,
+		"faas.version": functionVersion,
+		"plugin":       util.Id,
+	}
+
+	tags := make(map[string]interface{})
+	telemetry.GetNewRelicTags(tags)
+	for k, v := range tags {
+		attributes[k] = fmt.Sprint(v)
+	}
+	return attributes
+}
+
+func startInternal(address string, aggregator *Aggregator) (*Listener, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	listener := &Listener{
+		conn:       conn,
+		aggregator: aggregator,
+	}
+
+	listener.wg.Add(1)
+	go listener.serve()
+
+	logger.Logf("Started StatsD listener on %s", conn.LocalAddr())
+	return listener, nil
+}
+
+func (l *Listener) serve() {
+	defer l.wg.Done()
+
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, _, err := l.conn.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Logf("StatsD listener terminated: %v", err)
+			}
+			return
+		}
+
+		samples, errs := ParsePacket(buffer[:n])
+		for _, err := range errs {
+			logger.Debugln(err)
+		}
+		for _, sample := range samples {
+			l.aggregator.Add(sample)
+		}
+	}
+}
+
+func (l *Listener) Port() uint16 {
+	_, portStr, _ := net.SplitHostPort(l.conn.LocalAddr().String())
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+	return uint16(port)
+}
+
+// Close stops receiving metrics. Call Harvest afterwards for what has been aggregated.
+func (l *Listener) Close() error {
+	err := l.conn.Close()
+	l.wg.Wait()
+	return err
+}
+
+// Harvest returns the aggregated metrics once the harvest window has elapsed, or right away
+// when force is true
+func (l *Listener) Harvest(now time.Time, force bool) []apm.Metric {
+	return l.aggregator.Harvest(now, force)
+}
@@ -0,0 +1,58 @@
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListener(t *testing.T) {
+	aggregator := NewAggregator(time.Minute, map[string]string{"faas.name": "my-function"}, time.Now())
+	listener, err := startInternal("localhost:0", aggregator)
+	assert.NoError(t, err)
+
+	conn, err := net.Dial("udp", fmt.Sprintf("localhost:%d", listener.Port()))
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("page.views:1|c\npage.views:2|c|#env:prod"))
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Close())
+
+	// Wait for the packet to be aggregated
+	assert.Eventually(t, func() bool {
+		aggregator.lock.Lock()
+		defer aggregator.lock.Unlock()
+		return len(aggregator.series) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, listener.Close())
+
+	assert.Empty(t, listener.Harvest(time.Now(), false))
+
+	metrics := listener.Harvest(time.Now(), true)
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, "my-function", metrics[0].Attributes["faas.name"])
+
+	// Nothing left to send
+	assert.Empty(t, listener.Harvest(time.Now(), true))
+}
+
+func TestStart(t *testing.T) {
+	os.Setenv("NR_TAGS", "env:prod;team:orders")
+	defer os.Unsetenv("NR_TAGS")
+
+	listener, err := Start(&config.Configuration{RipeMillis: 1000}, "my-function", "$LATEST")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	assert.NotZero(t, listener.Port())
+	assert.Equal(t, time.Second, listener.aggregator.window)
+	assert.Equal(t, "my-function", listener.aggregator.attributes["faas.name"])
+	assert.Equal(t, "$LATEST", listener.aggregator.attributes["faas.version"])
+	assert.Equal(t, "prod", listener.aggregator.attributes["env"])
+	assert.Equal(t, "orders", listener.aggregator.attributes["team"])
+}
@@ -0,0 +1,131 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Metric types, as they appear on the wire
+const (
+	Counter      = "c"
+	Gauge        = "g"
+	Timer        = "ms"
+	Histogram    = "h"
+	Distribution = "d"
+	Set          = "s"
+)
+
+// Sample is a single parsed StatsD or DogStatsD metric line
+type Sample struct {
+	Name  string
+	Type  string
+	Value float64
+	// SetValue is the member of a set, which may not be numeric
+	SetValue string
+	// GaugeDelta is true for gauges written as +N or -N, which adjust the current value
+	GaugeDelta bool
+	SampleRate float64
+	Tags       map[string]string
+}
+
+// ParsePacket parses the newline-separated lines of a UDP packet. Lines that can't be
+// parsed are skipped, and reported in the returned errors.
+func ParsePacket(packet []byte) ([]Sample, []error) {
+	var samples []Sample
+	var errs []error
+
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || isDogStatsDEvent(line) {
+			continue
+		}
+
+		sample, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		samples = append(samples, *sample)
+	}
+
+	return samples, errs
+}
+
+// isDogStatsDEvent is true for DogStatsD events and service checks, which aren't metrics
+func isDogStatsDEvent(line string) bool {
+	return strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|")
+}
+
+// ParseLine parses a line such as "page.views:1|c|@0.5|#env:prod,region:us-east-1"
+func ParseLine(line string) (*Sample, error) {
+	nameEnd := strings.LastIndex(strings.SplitN(line, "|", 2)[0], ":")
+	if nameEnd <= 0 {
+		return nil, fmt.Errorf("malformed StatsD line %q: missing metric name", line)
+	}
+
+	sample := &Sample{
+		Name:       line[:nameEnd],
+		SampleRate: 1,
+	}
+
+	fields := strings.Split(line[nameEnd+1:], "|")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("malformed StatsD line %q: missing metric type", line)
+	}
+
+	rawValue := fields[0]
+	sample.Type = fields[1]
+
+	switch sample.Type {
+	case Counter, Gauge, Timer, Histogram, Distribution:
+		value, err := strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed StatsD line %q: invalid value", line)
+		}
+		sample.Value = value
+		sample.GaugeDelta = sample.Type == Gauge && (strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-"))
+	case Set:
+		sample.SetValue = rawValue
+	default:
+		return nil, fmt.Errorf("malformed StatsD line %q: unsupported metric type %q", line, sample.Type)
+	}
+
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("malformed StatsD line %q: invalid sample rate", line)
+			}
+			sample.SampleRate = rate
+		case strings.HasPrefix(field, "#"):
+			sample.Tags = parseTags(field[1:])
+		default:
+			// DogStatsD container IDs (c:) and timestamps (T) aren't used
+		}
+	}
+
+	return sample, nil
+}
+
+// parseTags parses DogStatsD tags. Tags without a value are kept with an empty value.
+func parseTags(str string) map[string]string {
+	tags := make(map[string]string)
+
+	for _, tag := range strings.Split(str, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		keyValue := strings.SplitN(tag, ":", 2)
+		if len(keyValue) == 2 {
+			tags[keyValue[0]] = keyValue[1]
+		} else {
+			tags[keyValue[0]] = ""
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,64 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected Sample
+	}{
+		{"page.views:1|c", Sample{Name: "page.views", Type: Counter, Value: 1, SampleRate: 1}},
+		{"page.views:2|c|@0.5", Sample{Name: "page.views", Type: Counter, Value: 2, SampleRate: 0.5}},
+		{"queue.depth:7|g", Sample{Name: "queue.depth", Type: Gauge, Value: 7, SampleRate: 1}},
+		{"queue.depth:-2|g", Sample{Name: "queue.depth", Type: Gauge, Value: -2, SampleRate: 1, GaugeDelta: true}},
+		{"queue.depth:+3|g", Sample{Name: "queue.depth", Type: Gauge, Value: 3, SampleRate: 1, GaugeDelta: true}},
+		{"db.query:12.5|ms", Sample{Name: "db.query", Type: Timer, Value: 12.5, SampleRate: 1}},
+		{"payload.size:512|h|#env:prod,canary", Sample{Name: "payload.size", Type: Histogram, Value: 512, SampleRate: 1, Tags: map[string]string{"env": "prod", "canary": ""}}},
+		{"latency:3|d|@1|#region:us-east-1|c:abc123|T1656581400", Sample{Name: "latency", Type: Distribution, Value: 3, SampleRate: 1, Tags: map[string]string{"region": "us-east-1"}}},
+		{"users:alice|s", Sample{Name: "users", Type: Set, SetValue: "alice", SampleRate: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			sample, err := ParseLine(tt.line)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, *sample)
+		})
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"page.views", `malformed StatsD line "page.views": missing metric name`},
+		{":1|c", `malformed StatsD line ":1|c": missing metric name`},
+		{"page.views:1", `malformed StatsD line "page.views:1": missing metric type`},
+		{"page.views:one|c", `malformed StatsD line "page.views:one|c": invalid value`},
+		{"page.views:1|x", `malformed StatsD line "page.views:1|x": unsupported metric type "x"`},
+		{"page.views:1|c|@2", `malformed StatsD line "page.views:1|c|@2": invalid sample rate`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			sample, err := ParseLine(tt.line)
+			assert.Nil(t, sample)
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	packet := []byte("page.views:1|c\n\n_e{5,4}:title|text\n_sc|check|0\nbroken\nqueue.depth:7|g\n")
+
+	samples, errs := ParsePacket(packet)
+	assert.Len(t, samples, 2)
+	assert.Equal(t, "page.views", samples[0].Name)
+	assert.Equal(t, "queue.depth", samples[1].Name)
+	assert.Len(t, errs, 1)
+}
@@ -6,7 +6,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/newrelic/newrelic-lambda-extension/util"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
 )
 
 // The Unix epoch instant; used as a nil time for eldest and lastHarvest
@@ -19,6 +19,7 @@ type Batch struct {
 	ripeDuration    time.Duration
 	veryOldDuration time.Duration
 	invocations     map[string]*Invocation
+	latestRequestId string
 	lock            sync.RWMutex
 	storeTraceID    map[string]string
 }
@@ -49,6 +50,7 @@ func (b *Batch) AddInvocation(requestId string, start time.Time) {
 
 	invocation := NewInvocation(requestId, start)
 	b.invocations[requestId] = &invocation
+	b.latestRequestId = requestId
 }
 
 // AddTelemetry attaches telemetry to an existing Invocation, identified by requestId
@@ -59,6 +61,11 @@ func (b *Batch) AddTelemetry(requestId string, telemetry []byte, isAPMTelemetry
 	inv, ok := b.invocations[requestId]
 	if ok {
 		inv.Telemetry = append(inv.Telemetry, telemetry)
+		if isAPMTelemetry {
+			inv.agentTelemetry = append(inv.agentTelemetry, telemetry)
+		} else {
+			inv.platformTelemetry = append(inv.platformTelemetry, telemetry)
+		}
 		if b.eldest.Equal(epochStart) {
 			b.eldest = inv.Start
 		}
@@ -66,7 +73,7 @@ func (b *Batch) AddTelemetry(requestId string, telemetry []byte, isAPMTelemetry
 			telemetryBytesEncoded := []byte(base64.StdEncoding.EncodeToString(telemetry))
 			traceId, err := ExtractTraceID(telemetryBytesEncoded)
 			if err != nil {
-				util.Debugln(err)
+				logger.Debugln(err)
 			}
 
 			// We don't want to unset a previously set trace ID
@@ -80,6 +87,126 @@ func (b *Batch) AddTelemetry(requestId string, telemetry []byte, isAPMTelemetry
 	return nil
 }
 
+// AddReport attaches a parsed platform report to an existing Invocation, identified by requestId.
+// Its REPORT line is added with AddTelemetry.
+func (b *Batch) AddReport(requestId string, report PlatformReport) *Invocation {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	inv, ok := b.invocations[requestId]
+	if ok {
+		inv.reports = append(inv.reports, report)
+		return inv
+	}
+	return nil
+}
+
+// AddError attaches a synthesized platform error to an existing Invocation, identified by requestId
+func (b *Batch) AddError(requestId string, platformError PlatformError) *Invocation {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	inv, ok := b.invocations[requestId]
+	if ok {
+		inv.Errors = append(inv.Errors, platformError)
+		if b.eldest.Equal(epochStart) {
+			b.eldest = inv.Start
+		}
+		return inv
+	}
+	return nil
+}
+
+// AddEvents attaches custom events to an Invocation. When the request is unknown, or has
+// already been harvested, the events are attached to the latest invocation instead.
+func (b *Batch) AddEvents(requestId string, events []CustomEvent) *Invocation {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	inv := b.customDataInvocation(requestId)
+	if inv != nil {
+		inv.Events = append(inv.Events, events...)
+	}
+	return inv
+}
+
+// AddMetrics attaches custom metrics to an Invocation, like AddEvents
+func (b *Batch) AddMetrics(requestId string, metrics []Metric) *Invocation {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	inv := b.customDataInvocation(requestId)
+	if inv != nil {
+		inv.Metrics = append(inv.Metrics, metrics...)
+	}
+	return inv
+}
+
+// AddSpans attaches spans to an Invocation, like AddEvents
+func (b *Batch) AddSpans(requestId string, spans []Span) *Invocation {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	inv := b.customDataInvocation(requestId)
+	if inv != nil {
+		inv.Spans = append(inv.Spans, spans...)
+	}
+	return inv
+}
+
+// AddLogs attaches custom log records to an Invocation, like AddEvents
+func (b *Batch) AddLogs(requestId string, logs []logserver.LogLine) *Invocation {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	inv := b.customDataInvocation(requestId)
+	if inv != nil {
+		inv.Logs = append(inv.Logs, logs...)
+	}
+	return inv
+}
+
+// AddOTLP attaches an OTLP export request to an Invocation, like AddEvents
+func (b *Batch) AddOTLP(requestId string, payload OTLPPayload) *Invocation {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	inv := b.customDataInvocation(requestId)
+	if inv != nil {
+		inv.OTLP = append(inv.OTLP, payload)
+	}
+	return inv
+}
+
+// DiscardEmpty removes invocations that received no data. In APM Lambda mode, invocations only
+// exist to hold OTLP data, and would otherwise accumulate.
+func (b *Batch) DiscardEmpty() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for k, v := range b.invocations {
+		if v.IsEmpty() {
+			delete(b.invocations, k)
+		}
+	}
+}
+
+// customDataInvocation finds the invocation to hold custom data. The caller must hold the lock.
+func (b *Batch) customDataInvocation(requestId string) *Invocation {
+	inv, ok := b.invocations[requestId]
+	if !ok {
+		inv, ok = b.invocations[b.latestRequestId]
+	}
+	if !ok {
+		return nil
+	}
+
+	if b.eldest.Equal(epochStart) {
+		b.eldest = inv.Start
+	}
+	return inv
+}
+
 // Harvest checks to see if it's time to harvest, and returns harvested invocations, or nil. The caller must ensure that harvested invocations are sent.
 func (b *Batch) Harvest(now time.Time) []*Invocation {
 	b.lock.Lock()
@@ -123,7 +250,7 @@ func (b *Batch) aggressiveHarvest(now time.Time) []*Invocation {
 		b.lastHarvest = now
 		b.eldest = epochStart
 	}
-	util.Debugf("Aggressive harvest yielded %d invocations\n", len(ret))
+	logger.Debugf("Aggressive harvest yielded %d invocations\n", len(ret))
 	return ret
 }
 
@@ -143,7 +270,7 @@ func (b *Batch) ripeHarvest(now time.Time) []*Invocation {
 	if len(ret) > 0 {
 		b.lastHarvest = now
 	}
-	util.Debugf("Ripe harvest yielded %d invocations\n", len(ret))
+	logger.Debugf("Ripe harvest yielded %d invocations\n", len(ret))
 	return ret
 }
 
@@ -165,6 +292,22 @@ type Invocation struct {
 	RequestId string
 	TraceId   string
 	Telemetry [][]byte
+	// Events, Metrics and Logs hold custom data reported by function code through the ingest API
+	Events  []CustomEvent
+	Metrics []Metric
+	Logs    []logserver.LogLine
+	// OTLP holds export requests received by the OTLP receiver
+	OTLP []OTLPPayload
+	// Spans holds the spans of the platform's phases of invocations
+	Spans []Span
+	// Errors holds timeouts and platform faults, which are also in Telemetry as text
+	Errors []PlatformError
+
+	// agentTelemetry and platformTelemetry split Telemetry by its source
+	agentTelemetry    [][]byte
+	platformTelemetry [][]byte
+	// reports are the parsed platform reports among platformTelemetry
+	reports []PlatformReport
 }
 
 // NewInvocation creates an Invocation, which can hold telemetry
@@ -176,12 +319,31 @@ func NewInvocation(requestId string, start time.Time) Invocation {
 	}
 }
 
+// AgentPayloadInvocation creates an Invocation holding agent payloads that weren't batched, as in
+// APM Lambda mode, so that they can be exported
+func AgentPayloadInvocation(requestId string, start time.Time, payloads ...[]byte) *Invocation {
+	inv := NewInvocation(requestId, start)
+	inv.Telemetry = append(inv.Telemetry, payloads...)
+	inv.agentTelemetry = payloads
+	return &inv
+}
+
+// AgentTelemetry returns the agent payloads in Telemetry
+func (inv *Invocation) AgentTelemetry() [][]byte {
+	return inv.agentTelemetry
+}
+
+// PlatformTelemetry returns the platform logs and synthesized errors in Telemetry
+func (inv *Invocation) PlatformTelemetry() [][]byte {
+	return inv.platformTelemetry
+}
+
 // IsRipe indicates that an Invocation has all the telemetry it's likely to get. Sending a ripe invocation won't omit data.
 func (inv *Invocation) IsRipe() bool {
 	return len(inv.Telemetry) >= 2
 }
 
-// IsEmpty is true when the invocation has no telemetry. The invocation has begun, but has received no agent payload, nor platform logs.
+// IsEmpty is true when the invocation has no telemetry. The invocation has begun, but has received no agent payload, platform logs, custom data, OTLP data, nor spans.
 func (inv *Invocation) IsEmpty() bool {
-	return len(inv.Telemetry) == 0
+	return len(inv.Telemetry) == 0 && len(inv.Events) == 0 && len(inv.Metrics) == 0 && len(inv.Logs) == 0 && len(inv.OTLP) == 0 && len(inv.Spans) == 0 && len(inv.Errors) == 0
 }
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -315,3 +316,81 @@ func TestAddTelemetry2(t *testing.T) {
 	assert.Equal(t, expectedTraceID, storedTraceId)
 
 }
+
+func TestAddCustomData(t *testing.T) {
+	batch := NewBatch(ripe, rot, false)
+
+	assert.Nil(t, batch.AddEvents(testRequestId, []CustomEvent{{"eventType": "Order"}}))
+
+	batch.AddInvocation(testRequestId, requestStart)
+	batch.AddInvocation(testRequestId2, requestStart.Add(100*time.Millisecond))
+
+	inv := batch.AddEvents(testRequestId, []CustomEvent{{"eventType": "Order"}})
+	assert.Equal(t, testRequestId, inv.RequestId)
+	assert.Len(t, inv.Events, 1)
+	assert.False(t, inv.IsEmpty())
+	assert.False(t, inv.IsRipe())
+
+	// Unknown requests fall back to the latest invocation
+	inv = batch.AddMetrics(testNoSuchRequestId, []Metric{{Name: "orders", Type: "count", Value: 1}})
+	assert.Equal(t, testRequestId2, inv.RequestId)
+	assert.Len(t, inv.Metrics, 1)
+
+	inv = batch.AddLogs("", []logserver.LogLine{{Content: []byte("order placed")}})
+	assert.Equal(t, testRequestId2, inv.RequestId)
+	assert.Len(t, inv.Logs, 1)
+
+	inv = batch.AddOTLP(testRequestId2, OTLPPayload{Signal: OTLPTraces, ContentType: OTLPContentTypeJSON, Body: []byte("{}")})
+	assert.Len(t, inv.OTLP, 1)
+
+	inv = batch.AddSpans(testRequestId, []Span{{ID: "0000000000000001"}})
+	assert.Equal(t, testRequestId, inv.RequestId)
+	assert.Len(t, inv.Spans, 1)
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 2)
+}
+
+func TestDiscardEmpty(t *testing.T) {
+	batch := NewBatch(ripe, rot, false)
+
+	batch.AddInvocation(testRequestId, requestStart)
+	batch.AddInvocation(testRequestId2, requestStart.Add(100*time.Millisecond))
+	batch.AddOTLP(testRequestId2, OTLPPayload{Signal: OTLPTraces, ContentType: OTLPContentTypeJSON, Body: []byte("{}")})
+
+	batch.DiscardEmpty()
+	assert.Nil(t, batch.AddTelemetry(testRequestId, []byte("a"), false))
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+	assert.Equal(t, testRequestId2, harvested[0].RequestId)
+}
+
+func TestTelemetrySources(t *testing.T) {
+	batch := NewBatch(ripe, rot, false)
+
+	assert.Nil(t, batch.AddError(testRequestId, PlatformError{RequestID: testRequestId, Type: PlatformErrorTimeout}))
+
+	batch.AddInvocation(testRequestId, requestStart)
+	batch.AddTelemetry(testRequestId, []byte("agent payload"), false)
+	batch.AddTelemetry(testRequestId, []byte("REPORT RequestId: test_a"), false)
+	inv := batch.AddError(testRequestId, PlatformError{RequestID: testRequestId, Type: PlatformErrorTimeout})
+	assert.Len(t, inv.Errors, 1)
+
+	batch.AddInvocation(testRequestId2, requestStart)
+	inv = batch.AddTelemetry(testRequestId2, []byte("[2, \"payload\"]"), true)
+
+	assert.Len(t, inv.Telemetry, 1)
+	assert.Len(t, inv.AgentTelemetry(), 1)
+	assert.Empty(t, inv.PlatformTelemetry())
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 2)
+	for _, inv := range harvested {
+		if inv.RequestId == testRequestId {
+			assert.Len(t, inv.Telemetry, 2)
+			assert.Len(t, inv.PlatformTelemetry(), 2)
+			assert.Empty(t, inv.AgentTelemetry())
+		}
+	}
+}
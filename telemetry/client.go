@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	crypto_rand "crypto/rand"
@@ -35,6 +36,8 @@ const (
 	httpClientTimeout time.Duration = 2400 * time.Millisecond
 )
 
+var logger = util.NewComponentLogger("telemetry")
+
 type Client struct {
 	httpClient        *http.Client
 	batch             *Batch
@@ -42,8 +45,24 @@ type Client struct {
 	licenseKey        string
 	telemetryEndpoint string
 	logEndpoint       string
+	metricEndpoint    string
+	eventEndpoint     string
+	otlpEndpoint      string
+	traceEndpoint     string
 	functionName      string
 	collectTraceID    bool
+
+	// Function log payloads the Log API rejected, and records that were cut short to fit its limits
+	rejectedLogPayloads  atomic.Uint64
+	truncatedLogMessages atomic.Uint64
+	// The totals TakeLogDeliveryStats last returned up to
+	reportedRejectedLogPayloads  atomic.Uint64
+	reportedTruncatedLogMessages atomic.Uint64
+	// Bytes of the payloads New Relic accepted, and payloads that weren't
+	acceptedBytes  atomic.Uint64
+	failedPayloads atomic.Uint64
+	// Bytes of every attempt to send a payload, including retries
+	sentBytes atomic.Uint64
 }
 
 // New creates a telemetry client with sensible defaults
@@ -107,7 +126,7 @@ func getLogEndpointURL(licenseKey string, logEndpointOverride string) string {
 }
 
 func (c *Client) SendTelemetry(ctx context.Context, invokedFunctionARN string, telemetry [][]byte) (error, int) {
-	util.Debugf("SendTelemetry: sending telemetry to New Relic...")
+	logger.Debugf("SendTelemetry: sending telemetry to New Relic...")
 	start := time.Now()
 	logEvents := make([]LogsEvent, 0, len(telemetry))
 	for _, payload := range telemetry {
@@ -115,7 +134,7 @@ func (c *Client) SendTelemetry(ctx context.Context, invokedFunctionARN string, t
 		logEvents = append(logEvents, logEvent)
 	}
 
-	util.Debugf("SendTelemetry: compressing telemetry payloads...")
+	logger.Debugf("SendTelemetry: compressing telemetry payloads...")
 	compressedPayloads, err := CompressedPayloadsForLogEvents(logEvents, c.functionName, invokedFunctionARN)
 	if err != nil {
 		return err, 0
@@ -130,7 +149,7 @@ func (c *Client) SendTelemetry(ctx context.Context, invokedFunctionARN string, t
 	end := time.Now()
 	totalTime := end.Sub(start)
 	transmissionTime := end.Sub(transmitStart)
-	util.Logf(
+	logger.Logf(
 		"Sent %d/%d New Relic Telemetry payload batches with %d log events successfully with certainty in %.3fms (%dms to transmit %.1fkB).\n",
 		successCount,
 		len(compressedPayloads),
@@ -169,17 +188,22 @@ func (c *Client) sendPayloads(compressedPayloads []*bytes.Buffer, builder reques
 		case response = <-data:
 		}
 
+		// Not warnings, which would feed back into the diagnostic sink, whose records are sent
+		// here too while the endpoint is failing
 		if response.Error != nil {
-			util.Logf("Telemetry client error: %s, payload size: %d bytes", response.Error, payloadSize)
+			logger.Logf("Telemetry client error: %s, payload size: %d bytes", response.Error, payloadSize)
 			sentBytes -= payloadSize
+			c.failedPayloads.Add(1)
 		} else if response.Response.StatusCode >= 300 {
-			util.Logf("Telemetry client response: [%s] %s", response.Response.Status, response.ResponseBody)
+			logger.Logf("Telemetry client response: [%s] %s", response.Response.Status, response.ResponseBody)
+			c.failedPayloads.Add(1)
 		} else {
 			successCount += 1
+			c.acceptedBytes.Add(uint64(payloadSize))
 		}
 	}
 
-	util.Debugf("sendPayloads: took %s to finish sending all payloads", time.Since(sendPayloadsStartTime).String())
+	logger.Debugf("sendPayloads: took %s to finish sending all payloads", time.Since(sendPayloadsStartTime).String())
 	return successCount, sentBytes
 }
 
@@ -195,7 +219,7 @@ func (c *Client) attemptSend(ctx context.Context, currentPayloadBytes []byte, bu
 	for attempts := 0; attempts < SendTimeoutMaxRetries; attempts++ {
 		select {
 		case <-ctx.Done():
-			util.Debugln("attemptSend: thread was quit by context timeout")
+			logger.Debugln("attemptSend: thread was quit by context timeout")
 			return
 		default:
 			// Construct request for this try
@@ -207,6 +231,7 @@ func (c *Client) attemptSend(ctx context.Context, currentPayloadBytes []byte, bu
 				return
 			}
 			//Make request, check for timeout
+			c.sentBytes.Add(uint64(len(currentPayloadBytes)))
 			res, err := c.httpClient.Do(req)
 
 			// send response data and exit
@@ -228,14 +253,14 @@ func (c *Client) attemptSend(ctx context.Context, currentPayloadBytes []byte, bu
 					ResponseBody: string(bodyBytes),
 					Response:     res,
 				}
-				util.Debugln("attemptSend: data sent to New Relic succesfully")
+				logger.Debugln("attemptSend: data sent to New Relic succesfully")
 				return
 			}
 
 			// if error is http timeout, retry
 			if err, ok := err.(net.Error); ok && err.Timeout() {
 				timeout := baseSleepTime + time.Duration(math_rand.Intn(200))
-				util.Debugf("attemptSend: timeout error, retrying after %s: %v", timeout.String(), err)
+				logger.Debugf("attemptSend: timeout error, retrying after %s: %v", timeout.String(), err)
 				time.Sleep(timeout)
 
 				// double wait time after 3 time out attempts
@@ -260,7 +285,7 @@ func (c *Client) attemptSend(ctx context.Context, currentPayloadBytes []byte, bu
 func (c *Client) SendFunctionLogs(ctx context.Context, invokedFunctionARN string, lines []logserver.LogLine, entityGuid string) error {
 	start := time.Now()
 	if len(lines) == 0 {
-		util.Debugln("client.SendFunctionLogs invoked with 0 log lines. Returning without sending a payload to New Relic")
+		logger.Debugln("client.SendFunctionLogs invoked with 0 log lines. Returning without sending a payload to New Relic")
 		return nil
 	}
 
@@ -271,9 +296,13 @@ func (c *Client) SendFunctionLogs(ctx context.Context, invokedFunctionARN string
 
 	transmitStart := time.Now()
 	successCount, sentBytes := c.sendPayloads(compressedPayloads, builder)
+	if rejected := len(compressedPayloads) - successCount; rejected > 0 {
+		total := c.rejectedLogPayloads.Add(uint64(rejected))
+		logger.Logf("%d function log batches were not accepted (%d since startup)", rejected, total)
+	}
 	totalTime := time.Since(start)
 	transmissionTime := time.Since(transmitStart)
-	util.Logf(
+	logger.Logf(
 		"Sent %d/%d New Relic function log batches successfully with certainty in %.3fms (%dms to transmit %.1fkB).\n",
 		successCount,
 		len(compressedPayloads),
@@ -285,6 +314,53 @@ func (c *Client) SendFunctionLogs(ctx context.Context, invokedFunctionARN string
 	return nil
 }
 
+// RejectedLogPayloads returns how many function log payloads were not accepted since startup
+func (c *Client) RejectedLogPayloads() uint64 {
+	return c.rejectedLogPayloads.Load()
+}
+
+// TruncatedLogMessages returns how many function log records were truncated since startup
+func (c *Client) TruncatedLogMessages() uint64 {
+	return c.truncatedLogMessages.Load()
+}
+
+// LogDeliveryStats counts the function log payloads the Log API rejected, and the records that were
+// truncated to fit its limits
+type LogDeliveryStats struct {
+	RejectedPayloads  uint64
+	TruncatedMessages uint64
+}
+
+// IsEmpty is true when every function log was delivered intact
+func (s LogDeliveryStats) IsEmpty() bool {
+	return s.RejectedPayloads == 0 && s.TruncatedMessages == 0
+}
+
+// TakeLogDeliveryStats returns the rejected payloads and truncated records since the last call
+func (c *Client) TakeLogDeliveryStats() LogDeliveryStats {
+	rejected := c.rejectedLogPayloads.Load()
+	truncated := c.truncatedLogMessages.Load()
+	return LogDeliveryStats{
+		RejectedPayloads:  rejected - c.reportedRejectedLogPayloads.Swap(rejected),
+		TruncatedMessages: truncated - c.reportedTruncatedLogMessages.Swap(truncated),
+	}
+}
+
+// AcceptedBytes returns the compressed size of the payloads New Relic accepted since startup
+func (c *Client) AcceptedBytes() uint64 {
+	return c.acceptedBytes.Load()
+}
+
+// SentBytes returns the compressed size of the payloads sent since startup, counting each attempt
+func (c *Client) SentBytes() uint64 {
+	return c.sentBytes.Load()
+}
+
+// FailedPayloads returns how many payloads couldn't be sent, or weren't accepted, since startup
+func (c *Client) FailedPayloads() uint64 {
+	return c.failedPayloads.Load()
+}
+
 // getNewRelicTags adds tags to the logs if NR_TAGS has values
 func GetNewRelicTags(common map[string]interface{}) {
     nrTagsStr := os.Getenv("NR_TAGS")
@@ -334,17 +410,23 @@ func (c *Client) buildLogPayloads(ctx context.Context, invokedFunctionARN string
 			// logs being sent. Not sure if worth the performance hit yet.
 			traceId = c.batch.RetrieveTraceID(l.RequestID)
 		}
-		logMessages = append(logMessages, NewFunctionLogMessage(ts, l.RequestID, traceId, string(l.Content)))
+		logMessage := NewFunctionLogMessage(ts, l.RequestID, traceId, string(l.Content))
+		for k, v := range l.Attributes {
+			logMessage.Attributes[k] = v
+		}
+
+		// JSON parsing and attributes can take a record past the Log API limits
+		parts, truncated := SplitFunctionLogMessage(logMessage)
+		if truncated {
+			c.truncatedLogMessages.Add(1)
+		}
+		logMessages = append(logMessages, parts...)
 	}
-	// The Log API expects an array
-	logData := []DetailedFunctionLog{NewDetailedFunctionLog(common, logMessages)}
 
-	// Since the Log API won't send us more than 1MB, we shouldn't have any issues with payload size.
-	compressedPayload, err := CompressedJsonPayload(logData)
+	compressedPayloads, err := CompressedPayloadsForFunctionLogs(common, logMessages)
 	if err != nil {
 		return nil, nil, err
 	}
-	compressedPayloads := []*bytes.Buffer{compressedPayload}
 
 	var builder requestBuilder = func(buffer *bytes.Buffer) (*http.Request, error) {
 		req, err := BuildVortexRequest(ctx, c.logEndpoint, buffer, util.Name, c.licenseKey)
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -64,6 +65,9 @@ func TestClientSend(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, 1, successCount)
+	assert.NotZero(t, client.AcceptedBytes())
+	assert.Equal(t, client.AcceptedBytes(), client.SentBytes())
+	assert.Zero(t, client.FailedPayloads())
 
 	client = New("", "mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
 	assert.NotNil(t, client)
@@ -580,3 +584,27 @@ func TestGetNewRelicTags(t *testing.T) {
 		})
 	}
 }
+
+func TestSendFunctionLogsRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer srv.Close()
+
+	client := NewWithHTTPClient(srv.Client(), "", "a mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
+
+	logLines := []logserver.LogLine{
+		{Time: time.Now(), RequestID: "test-request-1", Content: []byte(strings.Repeat("a", maxLogMessageLen+1))},
+		{Time: time.Now(), RequestID: "test-request-2", Content: []byte("test content"), Attributes: map[string]interface{}{"long": strings.Repeat("a", maxLogAttributeLen+1)}},
+	}
+	assert.NoError(t, client.SendFunctionLogs(context.Background(), testARN, logLines, ""))
+	assert.Equal(t, uint64(1), client.RejectedLogPayloads())
+	assert.Equal(t, uint64(1), client.TruncatedLogMessages())
+	assert.Equal(t, LogDeliveryStats{RejectedPayloads: 1, TruncatedMessages: 1}, client.TakeLogDeliveryStats())
+	assert.True(t, client.TakeLogDeliveryStats().IsEmpty())
+	assert.Equal(t, uint64(1), client.RejectedLogPayloads())
+	assert.Equal(t, uint64(1), client.FailedPayloads())
+	assert.Zero(t, client.AcceptedBytes())
+	// Rejected payloads were sent all the same
+	assert.NotZero(t, client.SentBytes())
+}
@@ -0,0 +1,233 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+const (
+	EventEndpointEU  string = "https://insights-collector.eu01.nr-data.net/v1/accounts/%s/events"
+	EventEndpointUS  string = "https://insights-collector.newrelic.com/v1/accounts/%s/events"
+	MetricEndpointEU string = "https://metric-api.eu.newrelic.com/metric/v1"
+	MetricEndpointUS string = "https://metric-api.newrelic.com/metric/v1"
+)
+
+// CustomEvent is an event reported by function code, in Event API form. It must have an eventType.
+type CustomEvent map[string]interface{}
+
+// Metric is a dimensional metric, in Metric API form. It's reported by function code, or
+// derived by the extension from platform reports, StatsD and function logs.
+type Metric struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Value      float64                `json:"value"`
+	Timestamp  int64                  `json:"timestamp"`
+	Interval   int64                  `json:"interval.ms,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// Summary holds the value of a summary metric, in place of Value
+	Summary *Summary `json:"-"`
+}
+
+// Summary is the value of a summary metric
+type Summary struct {
+	Count float64 `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// MarshalJSON writes the summary, when present, as the metric value
+func (m Metric) MarshalJSON() ([]byte, error) {
+	type metric Metric
+	if m.Summary == nil {
+		return json.Marshal(metric(m))
+	}
+
+	return json.Marshal(struct {
+		metric
+		Value *Summary `json:"value"`
+	}{metric(m), m.Summary})
+}
+
+type metricCommon struct {
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type metricData struct {
+	Common  metricCommon `json:"common"`
+	Metrics []Metric     `json:"metrics"`
+}
+
+// SetCustomDataEndpoints configures where custom events and metrics are sent. Events need
+// the New Relic account ID, and are dropped when it is empty.
+func (c *Client) SetCustomDataEndpoints(accountId string, metricEndpointOverride string, eventEndpointOverride string) {
+	c.metricEndpoint = getMetricEndpointURL(c.licenseKey, metricEndpointOverride)
+	c.eventEndpoint = getEventEndpointURL(c.licenseKey, accountId, eventEndpointOverride)
+}
+
+// getMetricEndpointURL returns the Metric API endpoint for the provided license key
+func getMetricEndpointURL(licenseKey string, metricEndpointOverride string) string {
+	if metricEndpointOverride != "" {
+		return metricEndpointOverride
+	}
+
+	if strings.HasPrefix(licenseKey, "eu") {
+		return MetricEndpointEU
+	}
+
+	return MetricEndpointUS
+}
+
+// getEventEndpointURL returns the Event API endpoint for the provided license key and account
+func getEventEndpointURL(licenseKey string, accountId string, eventEndpointOverride string) string {
+	if eventEndpointOverride != "" {
+		return eventEndpointOverride
+	}
+
+	if accountId == "" {
+		return ""
+	}
+
+	if strings.HasPrefix(licenseKey, "eu") {
+		return fmt.Sprintf(EventEndpointEU, accountId)
+	}
+
+	return fmt.Sprintf(EventEndpointUS, accountId)
+}
+
+// CanSendEvents is true when an Event API endpoint is configured
+func (c *Client) CanSendEvents() bool {
+	return c.eventEndpoint != ""
+}
+
+// customDataAttributes are added to all custom events and metrics
+func (c *Client) customDataAttributes(invokedFunctionARN string) map[string]interface{} {
+	common := map[string]interface{}{
+		"plugin":    util.Id,
+		"faas.arn":  invokedFunctionARN,
+		"faas.name": c.functionName,
+	}
+	GetNewRelicTags(common)
+
+	return common
+}
+
+// SendCustomEvents sends events reported through the ingest API to the Event API
+func (c *Client) SendCustomEvents(ctx context.Context, invokedFunctionARN string, events []CustomEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if !c.CanSendEvents() {
+		return fmt.Errorf("unable to send %d custom events; NEW_RELIC_ACCOUNT_ID is not set", len(events))
+	}
+
+	start := time.Now()
+	common := c.customDataAttributes(invokedFunctionARN)
+	for _, event := range events {
+		for k, v := range common {
+			if _, ok := event[k]; !ok {
+				event[k] = v
+			}
+		}
+	}
+
+	compressedPayloads, err := compressedPayloadsForItems(len(events), func(lo, hi int) interface{} {
+		return events[lo:hi]
+	})
+	if err != nil {
+		return err
+	}
+
+	var builder requestBuilder = func(buffer *bytes.Buffer) (*http.Request, error) {
+		return BuildVortexRequest(ctx, c.eventEndpoint, buffer, util.Name, c.licenseKey)
+	}
+
+	successCount, sentBytes := c.sendPayloads(compressedPayloads, builder)
+	logger.Logf(
+		"Sent %d/%d New Relic custom event batches with %d events successfully in %.3fms (%.1fkB).\n",
+		successCount,
+		len(compressedPayloads),
+		len(events),
+		float64(time.Since(start).Microseconds())/1000.0,
+		float64(sentBytes)/1024.0,
+	)
+
+	return nil
+}
+
+// SendMetrics sends metrics to the Metric API
+func (c *Client) SendMetrics(ctx context.Context, invokedFunctionARN string, metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	metricEndpoint := c.metricEndpoint
+	if metricEndpoint == "" {
+		metricEndpoint = getMetricEndpointURL(c.licenseKey, "")
+	}
+
+	start := time.Now()
+	common := metricCommon{Attributes: c.customDataAttributes(invokedFunctionARN)}
+
+	compressedPayloads, err := compressedPayloadsForItems(len(metrics), func(lo, hi int) interface{} {
+		// The Metric API expects an array
+		return []metricData{{Common: common, Metrics: metrics[lo:hi]}}
+	})
+	if err != nil {
+		return err
+	}
+
+	var builder requestBuilder = func(buffer *bytes.Buffer) (*http.Request, error) {
+		return BuildVortexRequest(ctx, metricEndpoint, buffer, util.Name, c.licenseKey)
+	}
+
+	successCount, sentBytes := c.sendPayloads(compressedPayloads, builder)
+	logger.Logf(
+		"Sent %d/%d New Relic metric batches with %d metrics successfully in %.3fms (%.1fkB).\n",
+		successCount,
+		len(compressedPayloads),
+		len(metrics),
+		float64(time.Since(start).Microseconds())/1000.0,
+		float64(sentBytes)/1024.0,
+	)
+
+	return nil
+}
+
+// compressedPayloadsForItems compresses the payload built for a range of items, splitting the
+// range in half, recursively, until each payload fits
+func compressedPayloadsForItems(count int, build func(lo, hi int) interface{}) ([]*bytes.Buffer, error) {
+	var split func(lo, hi int) ([]*bytes.Buffer, error)
+	split = func(lo, hi int) ([]*bytes.Buffer, error) {
+		compressed, err := CompressedJsonPayload(build(lo, hi))
+		if err != nil {
+			return nil, err
+		}
+
+		if compressed.Len() <= maxCompressedPayloadLen || hi-lo <= 1 {
+			return []*bytes.Buffer{compressed}, nil
+		}
+
+		mid := lo + (hi-lo)/2
+		leftRet, err := split(lo, mid)
+		if err != nil {
+			return nil, err
+		}
+
+		rightRet, err := split(mid, hi)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(leftRet, rightRet...), nil
+	}
+
+	return split(0, count)
+}
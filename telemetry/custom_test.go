@@ -0,0 +1,170 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func uncompressedRequestBody(t *testing.T, r *http.Request) []byte {
+	reqBytes, err := io.ReadAll(r.Body)
+	assert.NoError(t, err)
+	defer util.Close(r.Body)
+
+	reqBody, err := util.Uncompress(reqBytes)
+	assert.NoError(t, err)
+
+	return reqBody
+}
+
+func generateRandomString(length int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = letters[rand.Intn(len(letters))]
+	}
+
+	return string(b)
+}
+
+func TestSendCustomEvents(t *testing.T) {
+	var received []CustomEvent
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/accounts/12345/events", r.URL.Path)
+		assert.Equal(t, "a mock license key", r.Header.Get("X-License-Key"))
+		assert.NoError(t, json.Unmarshal(uncompressedRequestBody(t, r), &received))
+
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	client := NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
+
+	events := []CustomEvent{{"eventType": "Order", "total": 12.5, "faas.name": "overridden"}}
+	err := client.SendCustomEvents(context.Background(), testARN, events)
+	assert.EqualError(t, err, "unable to send 1 custom events; NEW_RELIC_ACCOUNT_ID is not set")
+	assert.False(t, client.CanSendEvents())
+
+	client.SetCustomDataEndpoints("12345", "", srv.URL+"/v1/accounts/12345/events")
+	assert.True(t, client.CanSendEvents())
+
+	assert.NoError(t, client.SendCustomEvents(context.Background(), testARN, events))
+	assert.Len(t, received, 1)
+	assert.Equal(t, "Order", received[0]["eventType"])
+	assert.Equal(t, 12.5, received[0]["total"])
+	assert.Equal(t, "overridden", received[0]["faas.name"])
+	assert.Equal(t, testARN, received[0]["faas.arn"])
+
+	assert.NoError(t, client.SendCustomEvents(context.Background(), testARN, nil))
+}
+
+func TestSendMetrics(t *testing.T) {
+	var received []metricData
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "a mock license key", r.Header.Get("X-License-Key"))
+		assert.NoError(t, json.Unmarshal(uncompressedRequestBody(t, r), &received))
+
+		w.WriteHeader(202)
+	}))
+	defer srv.Close()
+
+	client := NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
+	client.SetCustomDataEndpoints("", srv.URL, "")
+
+	metrics := []Metric{
+		{Name: "orders", Type: "count", Value: 2, Timestamp: 1000, Interval: 1000},
+		{Name: "queue.depth", Type: "gauge", Value: 7, Timestamp: 1000, Attributes: map[string]interface{}{"queue": "a"}},
+	}
+	assert.NoError(t, client.SendMetrics(context.Background(), testARN, metrics))
+
+	assert.Len(t, received, 1)
+	assert.Equal(t, "my-function", received[0].Common.Attributes["faas.name"])
+	assert.Equal(t, metrics, received[0].Metrics)
+}
+
+func TestMetricMarshalJSON(t *testing.T) {
+	gauge, err := json.Marshal(Metric{Name: "gauge", Type: "gauge", Value: 2.5, Timestamp: 1000})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"gauge","type":"gauge","value":2.5,"timestamp":1000}`, string(gauge))
+
+	summary, err := json.Marshal(Metric{
+		Name:      "latency",
+		Type:      "summary",
+		Timestamp: 1000,
+		Interval:  10000,
+		Summary:   &Summary{Count: 2, Sum: 30, Min: 10, Max: 20},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"latency","type":"summary","value":{"count":2,"sum":30,"min":10,"max":20},"timestamp":1000,"interval.ms":10000}`, string(summary))
+}
+
+func TestGetCustomDataEndpointURLs(t *testing.T) {
+	assert.Equal(t, MetricEndpointUS, getMetricEndpointURL("us_mock_license_key", ""))
+	assert.Equal(t, MetricEndpointEU, getMetricEndpointURL("eu_mock_license_key", ""))
+	assert.Equal(t, "mock_endpoint", getMetricEndpointURL("us_mock_license_key", "mock_endpoint"))
+
+	assert.Equal(t, "", getEventEndpointURL("us_mock_license_key", "", ""))
+	assert.Equal(t, "https://insights-collector.newrelic.com/v1/accounts/1/events", getEventEndpointURL("us_mock_license_key", "1", ""))
+	assert.Equal(t, "https://insights-collector.eu01.nr-data.net/v1/accounts/1/events", getEventEndpointURL("eu_mock_license_key", "1", ""))
+	assert.Equal(t, "mock_endpoint", getEventEndpointURL("us_mock_license_key", "", "mock_endpoint"))
+}
+
+func TestCompressedPayloadsForItemsSplit(t *testing.T) {
+	events := make([]CustomEvent, 4)
+	for i := range events {
+		events[i] = CustomEvent{"eventType": "Big", "payload": strings.Repeat("a", maxCompressedPayloadLen)}
+	}
+
+	payloads, err := compressedPayloadsForItems(len(events), func(lo, hi int) interface{} {
+		return events[lo:hi]
+	})
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	// Random data doesn't compress, forcing a split
+	for i := range events {
+		events[i]["payload"] = generateRandomString(maxCompressedPayloadLen)
+	}
+	payloads, err = compressedPayloadsForItems(len(events), func(lo, hi int) interface{} {
+		return events[lo:hi]
+	})
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 4)
+}
+
+func TestSendFunctionLogsAttributes(t *testing.T) {
+	var received []DetailedFunctionLog
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.Unmarshal(uncompressedRequestBody(t, r), &received))
+		w.WriteHeader(202)
+	}))
+	defer srv.Close()
+
+	client := NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
+
+	lines := []logserver.LogLine{{
+		Time:       time.Now(),
+		RequestID:  testRequestId,
+		Content:    []byte("order placed"),
+		Attributes: map[string]interface{}{"level": "INFO"},
+	}}
+	assert.NoError(t, client.SendFunctionLogs(context.Background(), testARN, lines, ""))
+
+	assert.Len(t, received, 1)
+	assert.Equal(t, "INFO", received[0].Logs[0].Attributes["level"])
+	assert.Equal(t, testRequestId, received[0].Logs[0].Attributes["faas.execution"])
+}
@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+const (
+	// maxBufferedDiagnostics bounds the entries held between harvests
+	maxBufferedDiagnostics = 100
+	diagnosticsRateWindow  = time.Minute
+)
+
+// DiagnosticSink collects the extension's own warnings and errors, so they can be sent as log
+// records with each harvest. At most perMinute entries are kept each minute; the rest are counted,
+// and reported in a single record.
+type DiagnosticSink struct {
+	lock        sync.Mutex
+	perMinute   int
+	windowStart time.Time
+	windowCount int
+	lines       []logserver.LogLine
+	dropped     int
+}
+
+// NewDiagnosticSink creates a sink that keeps up to perMinute entries a minute
+func NewDiagnosticSink(perMinute int) *DiagnosticSink {
+	return &DiagnosticSink{perMinute: perMinute}
+}
+
+// WriteLog implements util.LogSink
+func (s *DiagnosticSink) WriteLog(entry util.LogEntry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if entry.Time.Sub(s.windowStart) >= diagnosticsRateWindow {
+		s.windowStart = entry.Time
+		s.windowCount = 0
+	}
+	if s.windowCount >= s.perMinute || len(s.lines) >= maxBufferedDiagnostics {
+		s.dropped++
+		return
+	}
+	s.windowCount++
+
+	attributes := map[string]interface{}{"level": entry.Level}
+	if entry.Component != "" {
+		attributes["component"] = entry.Component
+	}
+	requestId, _ := entry.Fields["requestId"].(string)
+
+	s.lines = append(s.lines, logserver.LogLine{
+		Time:       entry.Time,
+		RequestID:  requestId,
+		Content:    []byte(entry.Message),
+		Attributes: attributes,
+	})
+}
+
+// Drain returns the collected entries, and empties the sink
+func (s *DiagnosticSink) Drain() []logserver.LogLine {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	lines := s.lines
+	if s.dropped > 0 {
+		lines = append(lines, logserver.LogLine{
+			Time:       time.Now(),
+			Content:    []byte(fmt.Sprintf("%d extension log entries were not sent, because of rate limiting", s.dropped)),
+			Attributes: map[string]interface{}{"level": util.LogLevelWarn},
+		})
+	}
+
+	s.lines = nil
+	s.dropped = 0
+	return lines
+}
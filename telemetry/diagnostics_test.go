@@ -0,0 +1,48 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+func TestDiagnosticSink(t *testing.T) {
+	sink := NewDiagnosticSink(2)
+	now := time.Now()
+
+	sink.WriteLog(util.LogEntry{Time: now, Level: util.LogLevelWarn, Message: "first"})
+	sink.WriteLog(util.LogEntry{Time: now, Level: util.LogLevelError, Component: "telemetry", Fields: util.Fields{"requestId": testRequestId}, Message: "second"})
+	sink.WriteLog(util.LogEntry{Time: now, Level: util.LogLevelError, Message: "third"})
+
+	lines := sink.Drain()
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "first", string(lines[0].Content))
+	assert.Equal(t, util.LogLevelWarn, lines[0].Attributes["level"])
+	assert.Equal(t, util.LogLevelError, lines[1].Attributes["level"])
+	assert.Equal(t, "telemetry", lines[1].Attributes["component"])
+	assert.Equal(t, testRequestId, lines[1].RequestID)
+	assert.Contains(t, string(lines[2].Content), "1 extension log entries were not sent")
+	assert.Empty(t, sink.Drain())
+
+	// The limit applies per minute
+	sink.WriteLog(util.LogEntry{Time: now.Add(time.Second), Level: util.LogLevelWarn, Message: "same minute"})
+	sink.WriteLog(util.LogEntry{Time: now.Add(time.Minute), Level: util.LogLevelWarn, Message: "next minute"})
+	lines = sink.Drain()
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "next minute", string(lines[0].Content))
+	assert.Contains(t, string(lines[1].Content), "1 extension log entries were not sent")
+}
+
+func TestDiagnosticSinkBuffer(t *testing.T) {
+	sink := NewDiagnosticSink(1000)
+	for i := 0; i < maxBufferedDiagnostics+5; i++ {
+		sink.WriteLog(util.LogEntry{Time: time.Now(), Level: util.LogLevelWarn, Message: "warning"})
+	}
+
+	lines := sink.Drain()
+	assert.Len(t, lines, maxBufferedDiagnostics+1)
+	assert.Contains(t, string(lines[maxBufferedDiagnostics].Content), "5 extension log entries")
+}
@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+// Exporter sends the data the extension collects to a backend
+type Exporter interface {
+	// ExportAgentPayloads sends the agent payloads and platform telemetry of harvested invocations
+	ExportAgentPayloads(ctx context.Context, invokedFunctionARN string, harvested []*Invocation) error
+	// ExportLogs sends function logs, and log records from the ingest API
+	ExportLogs(ctx context.Context, invokedFunctionARN string, lines []logserver.LogLine) error
+	// ExportMetrics sends dimensional metrics, from the ingest API and derived by the extension
+	ExportMetrics(ctx context.Context, invokedFunctionARN string, metrics []Metric) error
+	// ExportEvents sends custom events from the ingest API
+	ExportEvents(ctx context.Context, invokedFunctionARN string, events []CustomEvent) error
+	// ExportSpans sends spans, such as the platform's phases of invocations
+	ExportSpans(ctx context.Context, invokedFunctionARN string, spans []Span) error
+}
+
+// NewExporter creates the exporter selected by the configuration. newRelic sends to New Relic: the
+// telemetry client itself, or the APM exporter in APM Lambda mode. The OTLP exporter sends agent
+// payloads through it, since they have no OTLP form.
+func NewExporter(conf *config.Configuration, client *Client, newRelic Exporter) (Exporter, error) {
+	switch conf.Exporter {
+	case "", config.ExporterNewRelic:
+		return newRelic, nil
+	case config.ExporterOTLP:
+		return &OTLPExporter{client: client, newRelic: newRelic}, nil
+	case config.ExporterStdout:
+		return NewWriterExporter(os.Stdout), nil
+	case config.ExporterFile:
+		file, err := os.OpenFile(conf.ExporterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open exporter file: %v", err)
+		}
+		return NewWriterExporter(file), nil
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", conf.Exporter)
+	}
+}
+
+// ExportAgentPayloads sends agent payloads and platform logs to the telemetry endpoint
+func (c *Client) ExportAgentPayloads(ctx context.Context, invokedFunctionARN string, harvested []*Invocation) error {
+	telemetrySlice := make([][]byte, 0, 2*len(harvested))
+	for _, inv := range harvested {
+		telemetrySlice = append(telemetrySlice, inv.Telemetry...)
+	}
+	if len(telemetrySlice) == 0 {
+		return nil
+	}
+
+	err, _ := c.SendTelemetry(ctx, invokedFunctionARN, telemetrySlice)
+	return err
+}
+
+// ExportLogs sends logs to the Log API
+func (c *Client) ExportLogs(ctx context.Context, invokedFunctionARN string, lines []logserver.LogLine) error {
+	return c.SendFunctionLogs(ctx, invokedFunctionARN, lines, "")
+}
+
+// ExportMetrics sends metrics to the Metric API
+func (c *Client) ExportMetrics(ctx context.Context, invokedFunctionARN string, metrics []Metric) error {
+	return c.SendMetrics(ctx, invokedFunctionARN, metrics)
+}
+
+// ExportEvents sends events to the Event API
+func (c *Client) ExportEvents(ctx context.Context, invokedFunctionARN string, events []CustomEvent) error {
+	return c.SendCustomEvents(ctx, invokedFunctionARN, events)
+}
+
+// ExportSpans sends spans to the Trace API
+func (c *Client) ExportSpans(ctx context.Context, invokedFunctionARN string, spans []Span) error {
+	return c.SendSpans(ctx, invokedFunctionARN, spans)
+}
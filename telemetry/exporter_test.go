@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/config"
+)
+
+func TestNewExporter(t *testing.T) {
+	client := New("my-function", "a mock license key", "", "", &Batch{}, false, clientTestingTimeout)
+
+	exporter, err := NewExporter(&config.Configuration{}, client, client)
+	assert.NoError(t, err)
+	assert.Equal(t, client, exporter)
+
+	exporter, err = NewExporter(&config.Configuration{Exporter: config.ExporterNewRelic}, client, client)
+	assert.NoError(t, err)
+	assert.Equal(t, client, exporter)
+
+	// The New Relic exporter of APM Lambda mode
+	writer := NewWriterExporter(&bytes.Buffer{})
+	exporter, err = NewExporter(&config.Configuration{Exporter: config.ExporterNewRelic}, client, writer)
+	assert.NoError(t, err)
+	assert.Equal(t, writer, exporter)
+
+	exporter, err = NewExporter(&config.Configuration{Exporter: config.ExporterOTLP}, client, writer)
+	assert.NoError(t, err)
+	assert.IsType(t, &OTLPExporter{}, exporter)
+	assert.Equal(t, writer, exporter.(*OTLPExporter).newRelic)
+
+	exporter, err = NewExporter(&config.Configuration{Exporter: config.ExporterStdout}, client, client)
+	assert.NoError(t, err)
+	assert.IsType(t, &WriterExporter{}, exporter)
+
+	path := filepath.Join(t.TempDir(), "telemetry.jsonl")
+	exporter, err = NewExporter(&config.Configuration{Exporter: config.ExporterFile, ExporterFile: path}, client, client)
+	assert.NoError(t, err)
+	assert.NoError(t, exporter.ExportEvents(context.Background(), testARN, []CustomEvent{{"eventType": "Test"}}))
+	written, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(written), `"type":"event"`)
+
+	_, err = NewExporter(&config.Configuration{Exporter: config.ExporterFile, ExporterFile: filepath.Join(path, "missing")}, client, client)
+	assert.Error(t, err)
+
+	_, err = NewExporter(&config.Configuration{Exporter: "kafka"}, client, client)
+	assert.Error(t, err)
+}
+
+func TestClientExportAgentPayloads(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	client := NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
+
+	assert.NoError(t, client.ExportAgentPayloads(context.Background(), testARN, []*Invocation{{RequestId: testRequestId}}))
+	assert.Equal(t, 0, requests)
+
+	harvested := []*Invocation{{RequestId: testRequestId, Telemetry: [][]byte{[]byte("agent payload")}}}
+	assert.NoError(t, client.ExportAgentPayloads(context.Background(), testARN, harvested))
+	assert.Equal(t, 1, requests)
+}
@@ -0,0 +1,86 @@
+package telemetry
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// memoryHistorySize is how many invocations' memory usage a MemoryHistory remembers
+const memoryHistorySize = 10
+
+// MemoryUsage is the memory an invocation used, in MB, as in its platform report
+type MemoryUsage struct {
+	RequestID     string
+	MemorySize    int64
+	MaxMemoryUsed int64
+}
+
+// Headroom is the fraction of the function's memory the invocation left unused
+func (u MemoryUsage) Headroom() float64 {
+	if u.MemorySize <= 0 {
+		return 0
+	}
+	return float64(u.MemorySize-u.MaxMemoryUsed) / float64(u.MemorySize)
+}
+
+// MemoryHistory remembers the memory usage of the sandbox's last invocations, so that an
+// out-of-memory error can show how the headroom shrank before it
+type MemoryHistory struct {
+	lock  sync.Mutex
+	usage []MemoryUsage
+	// outOfMemory is the last request reported as out of memory, which both its fault and its
+	// report may show
+	outOfMemory string
+}
+
+// NewMemoryHistory creates an empty MemoryHistory
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{usage: make([]MemoryUsage, 0, memoryHistorySize)}
+}
+
+// Add records the memory usage of a report, forgetting the oldest when the history is full
+func (h *MemoryHistory) Add(report PlatformReport) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.usage) == memoryHistorySize {
+		h.usage = append(h.usage[:0], h.usage[1:]...)
+	}
+	h.usage = append(h.usage, MemoryUsage{
+		RequestID:     report.RequestID,
+		MemorySize:    report.MemorySize,
+		MaxMemoryUsed: report.MaxMemoryUsed,
+	})
+}
+
+// Usage returns the remembered memory usage, oldest first
+func (h *MemoryHistory) Usage() []MemoryUsage {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return append([]MemoryUsage(nil), h.usage...)
+}
+
+// MarkOutOfMemory records that a request ran out of memory. It returns false when the request
+// was already marked.
+func (h *MemoryHistory) MarkOutOfMemory(requestID string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.outOfMemory == requestID {
+		return false
+	}
+	h.outOfMemory = requestID
+	return true
+}
+
+// HeadroomSummary formats the remembered headroom as percentages, oldest first
+func (h *MemoryHistory) HeadroomSummary() string {
+	usage := h.Usage()
+	headroom := make([]string, len(usage))
+	for i, u := range usage {
+		headroom[i] = fmt.Sprintf("%.0f%%", u.Headroom()*100)
+	}
+	return strings.Join(headroom, ", ")
+}
@@ -0,0 +1,37 @@
+package telemetry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUsageHeadroom(t *testing.T) {
+	assert.Equal(t, 0.25, MemoryUsage{MemorySize: 128, MaxMemoryUsed: 96}.Headroom())
+	assert.Equal(t, 0.0, MemoryUsage{MemorySize: 128, MaxMemoryUsed: 128}.Headroom())
+	assert.Equal(t, 0.0, MemoryUsage{}.Headroom())
+}
+
+func TestMemoryHistory(t *testing.T) {
+	history := NewMemoryHistory()
+	assert.Empty(t, history.Usage())
+	assert.Equal(t, "", history.HeadroomSummary())
+
+	for i := 0; i < memoryHistorySize+2; i++ {
+		history.Add(PlatformReport{RequestID: fmt.Sprintf("request-%d", i), MemorySize: 100, MaxMemoryUsed: int64(50 + i)})
+	}
+
+	usage := history.Usage()
+	assert.Len(t, usage, memoryHistorySize)
+	assert.Equal(t, "request-2", usage[0].RequestID)
+	assert.Equal(t, "request-11", usage[memoryHistorySize-1].RequestID)
+	assert.Equal(t, "48%, 47%, 46%, 45%, 44%, 43%, 42%, 41%, 40%, 39%", history.HeadroomSummary())
+}
+
+func TestMemoryHistoryMarkOutOfMemory(t *testing.T) {
+	history := NewMemoryHistory()
+	assert.True(t, history.MarkOutOfMemory("request-1"))
+	assert.False(t, history.MarkOutOfMemory("request-1"))
+	assert.True(t, history.MarkOutOfMemory("request-2"))
+}
@@ -0,0 +1,467 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+const (
+	OTLPEndpointEU string = "https://otlp.eu01.nr-data.net"
+	OTLPEndpointUS string = "https://otlp.nr-data.net"
+
+	// OTLP signals, as they appear in the OTLP/HTTP request path
+	OTLPTraces  = "traces"
+	OTLPMetrics = "metrics"
+	OTLPLogs    = "logs"
+
+	OTLPContentTypeProtobuf = "application/x-protobuf"
+	OTLPContentTypeJSON     = "application/json"
+
+	// maxOTLPBatchBytes bounds the uncompressed size of the export requests merged into one POST
+	maxOTLPBatchBytes = 1000 * 1000
+)
+
+// Protobuf field numbers. otlpExportRequestField is the ResourceSpans, ResourceMetrics or
+// ResourceLogs field of an export request, and otlpResourceField the Resource within it.
+const (
+	otlpExportRequestField protowire.Number = 1
+	otlpResourceField      protowire.Number = 1
+	otlpAttributesField    protowire.Number = 1
+	otlpKeyField           protowire.Number = 1
+	otlpValueField         protowire.Number = 2
+	otlpStringValueField   protowire.Number = 1
+)
+
+// otlpJSONResourceKeys are the top-level keys of JSON-encoded export requests
+var otlpJSONResourceKeys = map[string]string{
+	OTLPTraces:  "resourceSpans",
+	OTLPMetrics: "resourceMetrics",
+	OTLPLogs:    "resourceLogs",
+}
+
+// OTLPPayload is an OTLP/HTTP export request, as received from function code
+type OTLPPayload struct {
+	Signal      string
+	ContentType string
+	Body        []byte
+}
+
+// SetOTLPEndpoint configures where OTLP data is sent. The override is the base URL; the
+// signal path is appended to it.
+func (c *Client) SetOTLPEndpoint(otlpEndpointOverride string) {
+	c.otlpEndpoint = getOTLPEndpointURL(c.licenseKey, otlpEndpointOverride)
+}
+
+// getOTLPEndpointURL returns the OTLP endpoint for the provided license key
+func getOTLPEndpointURL(licenseKey string, otlpEndpointOverride string) string {
+	if otlpEndpointOverride != "" {
+		return strings.TrimRight(otlpEndpointOverride, "/")
+	}
+
+	if strings.HasPrefix(licenseKey, "eu") {
+		return OTLPEndpointEU
+	}
+
+	return OTLPEndpointUS
+}
+
+// otlpResourceAttributes are added to the resource of all OTLP data, unless it already has them
+func (c *Client) otlpResourceAttributes(invokedFunctionARN string, entityGuid string) map[string]string {
+	attributes := map[string]string{
+		"faas.name":    c.functionName,
+		"faas.arn":     invokedFunctionARN,
+		"cloud.region": os.Getenv("AWS_REGION"),
+		"entity.guid":  entityGuid,
+	}
+	for k, v := range attributes {
+		if v == "" {
+			delete(attributes, k)
+		}
+	}
+
+	return attributes
+}
+
+// SendOTLP enriches OTLP export requests received from function code with the function's
+// resource attributes, and forwards them to New Relic's OTLP endpoint
+func (c *Client) SendOTLP(ctx context.Context, invokedFunctionARN string, payloads []OTLPPayload, entityGuid string) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	attributes := c.otlpResourceAttributes(invokedFunctionARN, entityGuid)
+
+	// Export requests are merged per signal and encoding
+	type group struct {
+		signal      string
+		contentType string
+	}
+	grouped := make(map[group][][]byte)
+	var order []group
+	for _, payload := range payloads {
+		body, err := AddOTLPResourceAttributes(payload, attributes)
+		if err != nil {
+			logger.Logf("Dropping OTLP %s payload: %v", payload.Signal, err)
+			continue
+		}
+
+		g := group{signal: payload.Signal, contentType: payload.ContentType}
+		if _, ok := grouped[g]; !ok {
+			order = append(order, g)
+		}
+		grouped[g] = append(grouped[g], body)
+	}
+
+	for _, g := range order {
+		if err := c.sendOTLPBodies(ctx, g.signal, g.contentType, grouped[g]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendOTLPBodies merges export requests of one signal and encoding, and sends them
+func (c *Client) sendOTLPBodies(ctx context.Context, signal string, contentType string, bodies [][]byte) error {
+	otlpEndpoint := c.otlpEndpoint
+	if otlpEndpoint == "" {
+		otlpEndpoint = getOTLPEndpointURL(c.licenseKey, "")
+	}
+
+	start := time.Now()
+	merged, err := mergeOTLPBodies(signal, contentType, bodies)
+	if err != nil {
+		return err
+	}
+
+	compressedPayloads := make([]*bytes.Buffer, 0, len(merged))
+	for _, body := range merged {
+		compressed, err := util.Compress(body)
+		if err != nil {
+			return fmt.Errorf("error compressing data: %v", err)
+		}
+		compressedPayloads = append(compressedPayloads, compressed)
+	}
+
+	url := otlpEndpoint + "/v1/" + signal
+	var builder requestBuilder = func(buffer *bytes.Buffer) (*http.Request, error) {
+		return buildOTLPRequest(ctx, url, buffer, contentType, c.licenseKey)
+	}
+
+	successCount, sentBytes := c.sendPayloads(compressedPayloads, builder)
+	logger.Logf(
+		"Sent %d/%d OTLP %s batches successfully in %.3fms (%.1fkB).\n",
+		successCount,
+		len(compressedPayloads),
+		signal,
+		float64(time.Since(start).Microseconds())/1000.0,
+		float64(sentBytes)/1024.0,
+	)
+
+	return nil
+}
+
+// buildOTLPRequest builds an OTLP/HTTP export request. The OTLP endpoint takes the license key
+// in the api-key header.
+func buildOTLPRequest(ctx context.Context, url string, compressed *bytes.Buffer, contentType string, licenseKey string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Add("Content-Encoding", "gzip")
+	req.Header.Add("Content-Type", contentType)
+	req.Header.Add("User-Agent", util.Name)
+	req.Header.Add("api-key", licenseKey)
+
+	return req, nil
+}
+
+// ValidateOTLP checks that a payload is a well-formed export request for its signal
+func ValidateOTLP(payload OTLPPayload) error {
+	_, err := AddOTLPResourceAttributes(payload, nil)
+	return err
+}
+
+// AddOTLPResourceAttributes returns the payload body with the attributes added to the resource of
+// every ResourceSpans, ResourceMetrics or ResourceLogs. Attributes that a resource already has
+// are left alone.
+func AddOTLPResourceAttributes(payload OTLPPayload, attributes map[string]string) ([]byte, error) {
+	switch payload.ContentType {
+	case OTLPContentTypeProtobuf:
+		return addProtobufResourceAttributes(payload.Body, attributes)
+	case OTLPContentTypeJSON:
+		return addJSONResourceAttributes(payload.Signal, payload.Body, attributes)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP content type %q", payload.ContentType)
+	}
+}
+
+func addProtobufResourceAttributes(body []byte, attributes map[string]string) ([]byte, error) {
+	ret := make([]byte, 0, len(body))
+	for len(body) > 0 {
+		num, typ, n := protowire.ConsumeTag(body)
+		if n < 0 {
+			return nil, fmt.Errorf("malformed OTLP protobuf payload: %v", protowire.ParseError(n))
+		}
+		fieldLen := protowire.ConsumeFieldValue(num, typ, body[n:])
+		if fieldLen < 0 {
+			return nil, fmt.Errorf("malformed OTLP protobuf payload: %v", protowire.ParseError(fieldLen))
+		}
+
+		if num == otlpExportRequestField && typ == protowire.BytesType {
+			resourceData, _ := protowire.ConsumeBytes(body[n:])
+			enriched, err := enrichResourceData(resourceData, attributes)
+			if err != nil {
+				return nil, err
+			}
+			ret = protowire.AppendTag(ret, num, protowire.BytesType)
+			ret = protowire.AppendBytes(ret, enriched)
+		} else {
+			ret = append(ret, body[:n+fieldLen]...)
+		}
+
+		body = body[n+fieldLen:]
+	}
+
+	return ret, nil
+}
+
+// enrichResourceData adds attributes to the Resource of a ResourceSpans, ResourceMetrics or
+// ResourceLogs message. Repeated Resource fields are merged, as a protobuf parser would.
+func enrichResourceData(data []byte, attributes map[string]string) ([]byte, error) {
+	var resource []byte
+	rest := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, fmt.Errorf("malformed OTLP protobuf payload: %v", protowire.ParseError(n))
+		}
+		fieldLen := protowire.ConsumeFieldValue(num, typ, data[n:])
+		if fieldLen < 0 {
+			return nil, fmt.Errorf("malformed OTLP protobuf payload: %v", protowire.ParseError(fieldLen))
+		}
+
+		if num == otlpResourceField && typ == protowire.BytesType {
+			value, _ := protowire.ConsumeBytes(data[n:])
+			resource = append(resource, value...)
+		} else {
+			rest = append(rest, data[:n+fieldLen]...)
+		}
+
+		data = data[n+fieldLen:]
+	}
+
+	existing, err := protobufAttributeKeys(resource)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range sortedKeys(attributes) {
+		if existing[k] {
+			continue
+		}
+		var value []byte
+		value = protowire.AppendTag(value, otlpStringValueField, protowire.BytesType)
+		value = protowire.AppendString(value, attributes[k])
+
+		var keyValue []byte
+		keyValue = protowire.AppendTag(keyValue, otlpKeyField, protowire.BytesType)
+		keyValue = protowire.AppendString(keyValue, k)
+		keyValue = protowire.AppendTag(keyValue, otlpValueField, protowire.BytesType)
+		keyValue = protowire.AppendBytes(keyValue, value)
+
+		resource = protowire.AppendTag(resource, otlpAttributesField, protowire.BytesType)
+		resource = protowire.AppendBytes(resource, keyValue)
+	}
+
+	ret := make([]byte, 0, len(resource)+len(rest)+8)
+	if resource != nil {
+		ret = protowire.AppendTag(ret, otlpResourceField, protowire.BytesType)
+		ret = protowire.AppendBytes(ret, resource)
+	}
+	return append(ret, rest...), nil
+}
+
+// protobufAttributeKeys returns the keys of the attributes of a Resource message
+func protobufAttributeKeys(resource []byte) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	for len(resource) > 0 {
+		num, typ, n := protowire.ConsumeTag(resource)
+		if n < 0 {
+			return nil, fmt.Errorf("malformed OTLP resource: %v", protowire.ParseError(n))
+		}
+		fieldLen := protowire.ConsumeFieldValue(num, typ, resource[n:])
+		if fieldLen < 0 {
+			return nil, fmt.Errorf("malformed OTLP resource: %v", protowire.ParseError(fieldLen))
+		}
+
+		if num == otlpAttributesField && typ == protowire.BytesType {
+			keyValue, _ := protowire.ConsumeBytes(resource[n:])
+			key, err := protobufAttributeKey(keyValue)
+			if err != nil {
+				return nil, err
+			}
+			keys[key] = true
+		}
+
+		resource = resource[n+fieldLen:]
+	}
+
+	return keys, nil
+}
+
+func protobufAttributeKey(keyValue []byte) (string, error) {
+	var key string
+	for len(keyValue) > 0 {
+		num, typ, n := protowire.ConsumeTag(keyValue)
+		if n < 0 {
+			return "", fmt.Errorf("malformed OTLP attribute: %v", protowire.ParseError(n))
+		}
+		fieldLen := protowire.ConsumeFieldValue(num, typ, keyValue[n:])
+		if fieldLen < 0 {
+			return "", fmt.Errorf("malformed OTLP attribute: %v", protowire.ParseError(fieldLen))
+		}
+
+		if num == otlpKeyField && typ == protowire.BytesType {
+			value, _ := protowire.ConsumeString(keyValue[n:])
+			key = value
+		}
+
+		keyValue = keyValue[n+fieldLen:]
+	}
+
+	return key, nil
+}
+
+func addJSONResourceAttributes(signal string, body []byte, attributes map[string]string) ([]byte, error) {
+	resourceKey, ok := otlpJSONResourceKeys[signal]
+	if !ok {
+		return nil, fmt.Errorf("unsupported OTLP signal %q", signal)
+	}
+
+	var request map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// OTLP JSON may hold integers that don't fit a float64
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil {
+		return nil, fmt.Errorf("malformed OTLP JSON payload: %v", err)
+	}
+
+	resources, _ := request[resourceKey].([]interface{})
+	for _, item := range resources {
+		resourceData, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("malformed OTLP JSON payload: %s must hold objects", resourceKey)
+		}
+
+		resource, _ := resourceData["resource"].(map[string]interface{})
+		if resource == nil {
+			resource = make(map[string]interface{})
+			resourceData["resource"] = resource
+		}
+
+		existing := make(map[string]bool)
+		resourceAttributes, _ := resource["attributes"].([]interface{})
+		for _, attribute := range resourceAttributes {
+			if keyValue, ok := attribute.(map[string]interface{}); ok {
+				if key, ok := keyValue["key"].(string); ok {
+					existing[key] = true
+				}
+			}
+		}
+
+		for _, k := range sortedKeys(attributes) {
+			if existing[k] {
+				continue
+			}
+			resourceAttributes = append(resourceAttributes, map[string]interface{}{
+				"key":   k,
+				"value": map[string]interface{}{"stringValue": attributes[k]},
+			})
+		}
+		if len(resourceAttributes) > 0 {
+			resource["attributes"] = resourceAttributes
+		}
+	}
+
+	return json.Marshal(request)
+}
+
+// mergeOTLPBodies merges export requests of the same signal and encoding into as few requests as
+// fit under maxOTLPBatchBytes. Serialized protobuf messages merge by concatenation.
+func mergeOTLPBodies(signal string, contentType string, bodies [][]byte) ([][]byte, error) {
+	var ret [][]byte
+	var current [][]byte
+	currentLen := 0
+
+	flush := func() error {
+		if len(current) == 0 {
+			return nil
+		}
+		merged, err := mergeOTLPBatch(signal, contentType, current)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, merged)
+		current = nil
+		currentLen = 0
+		return nil
+	}
+
+	for _, body := range bodies {
+		if currentLen > 0 && currentLen+len(body) > maxOTLPBatchBytes {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		current = append(current, body)
+		currentLen += len(body)
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func mergeOTLPBatch(signal string, contentType string, bodies [][]byte) ([]byte, error) {
+	if len(bodies) == 1 {
+		return bodies[0], nil
+	}
+
+	if contentType == OTLPContentTypeProtobuf {
+		return bytes.Join(bodies, nil), nil
+	}
+
+	resourceKey := otlpJSONResourceKeys[signal]
+	var merged []json.RawMessage
+	for _, body := range bodies {
+		var request map[string][]json.RawMessage
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, fmt.Errorf("malformed OTLP JSON payload: %v", err)
+		}
+		merged = append(merged, request[resourceKey]...)
+	}
+
+	return json.Marshal(map[string][]json.RawMessage{resourceKey: merged})
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
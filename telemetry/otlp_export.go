@@ -0,0 +1,687 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+// OTLP log severity numbers
+const (
+	otlpSeverityTrace = 1
+	otlpSeverityDebug = 5
+	otlpSeverityInfo  = 9
+	otlpSeverityWarn  = 13
+	otlpSeverityError = 17
+	otlpSeverityFatal = 21
+)
+
+// otlpAggregationTemporalityDelta is AGGREGATION_TEMPORALITY_DELTA
+const otlpAggregationTemporalityDelta = 1
+
+// otlpLogRecord is a LogRecord, before encoding
+type otlpLogRecord struct {
+	time         time.Time
+	severity     int
+	severityText string
+	body         string
+	attributes   map[string]interface{}
+	traceId      []byte
+}
+
+// Kinds of otlpMetric
+const (
+	otlpGauge = iota
+	otlpSum
+	otlpHistogram
+)
+
+// OTLP span kinds
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+)
+
+// otlpSpan is a Span, before encoding
+type otlpSpan struct {
+	traceId    []byte
+	spanId     []byte
+	parentId   []byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+}
+
+// otlpMetric is a Metric with a single data point, before encoding. Histograms hold one
+// observation, or a summary's; sums are monotonic delta counts.
+type otlpMetric struct {
+	name        string
+	description string
+	unit        string
+	kind        int
+	start       time.Time
+	end         time.Time
+	value       float64
+	summary     *Summary
+	attributes  map[string]interface{}
+}
+
+// OTLPExporter sends function logs, platform metrics, synthesized errors and custom data to the
+// OTLP endpoint. Agent payloads have no OTLP form, so they are still sent to New Relic.
+type OTLPExporter struct {
+	client *Client
+	// newRelic sends the agent payloads
+	newRelic Exporter
+}
+
+func (e *OTLPExporter) ExportAgentPayloads(ctx context.Context, invokedFunctionARN string, harvested []*Invocation) error {
+	var agentPayloads []*Invocation
+	var reports []PlatformReport
+	var platformErrors []PlatformError
+	for _, inv := range harvested {
+		if payloads := inv.AgentTelemetry(); len(payloads) > 0 {
+			agentPayloads = append(agentPayloads, AgentPayloadInvocation(inv.RequestId, inv.Start, payloads...))
+		}
+		reports = append(reports, inv.PlatformReports()...)
+		platformErrors = append(platformErrors, inv.Errors...)
+	}
+
+	if len(agentPayloads) > 0 {
+		if err := e.newRelic.ExportAgentPayloads(ctx, invokedFunctionARN, agentPayloads); err != nil {
+			return err
+		}
+	}
+
+	return e.client.SendPlatformOTLP(ctx, invokedFunctionARN, reports, platformErrors)
+}
+
+func (e *OTLPExporter) ExportLogs(ctx context.Context, invokedFunctionARN string, lines []logserver.LogLine) error {
+	return e.client.SendFunctionLogsOTLP(ctx, invokedFunctionARN, lines)
+}
+
+// ExportMetrics sends gauges as OTLP gauges, counts as delta sums, and summaries as delta
+// histograms with a single bucket
+func (e *OTLPExporter) ExportMetrics(ctx context.Context, invokedFunctionARN string, metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	otlpMetrics := make([]otlpMetric, 0, len(metrics))
+	for _, metric := range metrics {
+		// As in the Metric API, a count's timestamp is the start of its interval
+		start := time.UnixMilli(metric.Timestamp)
+		converted := otlpMetric{
+			name:       metric.Name,
+			kind:       otlpGauge,
+			start:      start,
+			end:        start,
+			value:      metric.Value,
+			attributes: metric.Attributes,
+		}
+		if metric.Summary != nil {
+			converted.kind = otlpHistogram
+			converted.summary = metric.Summary
+			converted.end = start.Add(time.Duration(metric.Interval) * time.Millisecond)
+		} else if metric.Type == "count" {
+			converted.kind = otlpSum
+			converted.end = start.Add(time.Duration(metric.Interval) * time.Millisecond)
+		}
+		otlpMetrics = append(otlpMetrics, converted)
+	}
+
+	body := encodeOTLPMetrics(e.client.otlpExportResource(invokedFunctionARN), otlpMetrics)
+	return e.client.sendOTLPBodies(ctx, OTLPMetrics, OTLPContentTypeProtobuf, [][]byte{body})
+}
+
+// ExportEvents sends events as OTLP log records, named by their eventType
+func (e *OTLPExporter) ExportEvents(ctx context.Context, invokedFunctionARN string, events []CustomEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	records := make([]otlpLogRecord, 0, len(events))
+	for _, event := range events {
+		eventType, _ := event["eventType"].(string)
+		attributes := map[string]interface{}{"event.name": eventType}
+		for k, v := range event {
+			if k != "eventType" && k != "timestamp" {
+				attributes[k] = v
+			}
+		}
+
+		records = append(records, otlpLogRecord{
+			time:       eventTime(event["timestamp"]),
+			body:       eventType,
+			attributes: attributes,
+		})
+	}
+
+	body := encodeOTLPLogs(e.client.otlpExportResource(invokedFunctionARN), records)
+	return e.client.sendOTLPBodies(ctx, OTLPLogs, OTLPContentTypeProtobuf, [][]byte{body})
+}
+
+// ExportSpans sends spans as OTLP spans. Root spans are server spans, and their children are
+// internal.
+func (e *OTLPExporter) ExportSpans(ctx context.Context, invokedFunctionARN string, spans []Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		attributes := map[string]interface{}{}
+		for k, v := range span.Attributes {
+			if k != "name" && k != "duration.ms" && k != "parent.id" {
+				attributes[k] = v
+			}
+		}
+		if requestId, ok := attributes["aws.requestId"]; ok {
+			attributes["faas.invocation_id"] = requestId
+		}
+
+		start := time.UnixMilli(span.Timestamp)
+		converted := otlpSpan{
+			traceId:    otlpTraceID(span.TraceID),
+			spanId:     otlpSpanID(span.ID),
+			name:       span.Name(),
+			kind:       otlpSpanKindServer,
+			start:      start,
+			end:        start.Add(time.Duration(span.Duration() * float64(time.Millisecond))),
+			attributes: attributes,
+		}
+		if parentId := span.ParentID(); parentId != "" {
+			converted.parentId = otlpSpanID(parentId)
+			converted.kind = otlpSpanKindInternal
+		}
+		otlpSpans = append(otlpSpans, converted)
+	}
+
+	body := encodeOTLPSpans(e.client.otlpExportResource(invokedFunctionARN), otlpSpans)
+	return e.client.sendOTLPBodies(ctx, OTLPTraces, OTLPContentTypeProtobuf, [][]byte{body})
+}
+
+// eventTime converts an event timestamp, in milliseconds, to a time. Events without a valid
+// timestamp get the current time.
+func eventTime(timestamp interface{}) time.Time {
+	switch v := timestamp.(type) {
+	case int64:
+		return time.UnixMilli(v)
+	case float64:
+		return time.UnixMilli(int64(v))
+	default:
+		return time.Now()
+	}
+}
+
+// otlpExportResource returns the resource attributes of the data the extension exports, per the
+// OpenTelemetry FaaS and cloud semantic conventions
+func (c *Client) otlpExportResource(invokedFunctionARN string) map[string]interface{} {
+	resource := map[string]interface{}{
+		"service.name":   c.functionName,
+		"faas.name":      c.functionName,
+		"cloud.provider": "aws",
+		"cloud.platform": "aws_lambda",
+		"plugin":         util.Id,
+	}
+	if invokedFunctionARN != "" {
+		resource["cloud.resource_id"] = invokedFunctionARN
+		resource["faas.arn"] = invokedFunctionARN
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		resource["cloud.region"] = region
+	}
+	if version := os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"); version != "" {
+		resource["faas.version"] = version
+	}
+	if instance := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME"); instance != "" {
+		resource["faas.instance"] = instance
+	}
+	if memory, err := strconv.ParseInt(os.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE"), 10, 64); err == nil {
+		resource["faas.max_memory"] = memory * 1024 * 1024
+	}
+	GetNewRelicTags(resource)
+
+	return resource
+}
+
+// SendFunctionLogsOTLP sends function logs to the OTLP endpoint, as OTLP log records
+func (c *Client) SendFunctionLogsOTLP(ctx context.Context, invokedFunctionARN string, lines []logserver.LogLine) error {
+	if len(lines) == 0 {
+		logger.Debugln("client.SendFunctionLogsOTLP invoked with 0 log lines. Returning without sending a payload to New Relic")
+		return nil
+	}
+
+	records := make([]otlpLogRecord, 0, len(lines))
+	for _, l := range lines {
+		attributes := map[string]interface{}{
+			"faas.invocation_id": l.RequestID,
+		}
+		for k, v := range l.Attributes {
+			attributes[k] = v
+		}
+
+		record := otlpLogRecord{
+			time:       l.Time,
+			body:       string(l.Content),
+			attributes: attributes,
+		}
+		if level, ok := l.Attributes["level"].(string); ok {
+			record.severity, record.severityText = otlpSeverity(level)
+		}
+		if c.batch != nil && c.collectTraceID {
+			record.traceId = otlpTraceID(c.batch.RetrieveTraceID(l.RequestID))
+		}
+
+		records = append(records, record)
+	}
+
+	body := encodeOTLPLogs(c.otlpExportResource(invokedFunctionARN), records)
+	return c.sendOTLPBodies(ctx, OTLPLogs, OTLPContentTypeProtobuf, [][]byte{body})
+}
+
+// SendPlatformOTLP sends platform REPORT metrics, and synthesized errors, to the OTLP endpoint.
+// Errors are sent as log records, and counted in the faas.timeouts and faas.errors metrics.
+func (c *Client) SendPlatformOTLP(ctx context.Context, invokedFunctionARN string, reports []PlatformReport, platformErrors []PlatformError) error {
+	if len(reports) == 0 && len(platformErrors) == 0 {
+		return nil
+	}
+
+	resource := c.otlpExportResource(invokedFunctionARN)
+
+	var metrics []otlpMetric
+	for _, report := range reports {
+		metrics = append(metrics, report.otlpMetrics()...)
+	}
+
+	records := make([]otlpLogRecord, 0, len(platformErrors))
+	for _, platformError := range platformErrors {
+		records = append(records, otlpLogRecord{
+			time:         platformError.Time,
+			severity:     otlpSeverityError,
+			severityText: "ERROR",
+			body:         platformError.Message,
+			attributes: map[string]interface{}{
+				"faas.invocation_id": platformError.RequestID,
+				"exception.type":     platformError.Type,
+				"exception.message":  platformError.Message,
+			},
+		})
+
+		name := "faas.errors"
+		description := "Number of invocation errors"
+		if platformError.Type == PlatformErrorTimeout {
+			name = "faas.timeouts"
+			description = "Number of invocation timeouts"
+		}
+		metrics = append(metrics, otlpMetric{
+			name:        name,
+			description: description,
+			unit:        "{error}",
+			kind:        otlpSum,
+			start:       platformError.Time,
+			end:         platformError.Time,
+			value:       1,
+		})
+	}
+
+	if len(metrics) > 0 {
+		body := encodeOTLPMetrics(resource, metrics)
+		if err := c.sendOTLPBodies(ctx, OTLPMetrics, OTLPContentTypeProtobuf, [][]byte{body}); err != nil {
+			return err
+		}
+	}
+
+	if len(records) > 0 {
+		body := encodeOTLPLogs(resource, records)
+		if err := c.sendOTLPBodies(ctx, OTLPLogs, OTLPContentTypeProtobuf, [][]byte{body}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// otlpMetrics converts a REPORT line to the FaaS semantic convention metrics. Durations are in
+// seconds, and memory in bytes.
+func (r PlatformReport) otlpMetrics() []otlpMetric {
+	end := r.Start.Add(time.Duration(r.Duration * float64(time.Millisecond)))
+
+	metrics := []otlpMetric{
+		{
+			name:        "faas.invocations",
+			description: "Number of successful invocations",
+			unit:        "{invocation}",
+			kind:        otlpSum,
+			start:       r.Start,
+			end:         end,
+			value:       1,
+		},
+		{
+			name:        "faas.invoke_duration",
+			description: "Measures the duration of the function's logic execution",
+			unit:        "s",
+			kind:        otlpHistogram,
+			start:       r.Start,
+			end:         end,
+			value:       r.Duration / 1000,
+		},
+		{
+			name:        "aws.lambda.billed_duration",
+			description: "The duration billed for the invocation",
+			unit:        "s",
+			kind:        otlpHistogram,
+			start:       r.Start,
+			end:         end,
+			value:       r.BilledDuration / 1000,
+		},
+		{
+			name:        "faas.mem_usage",
+			description: "Distribution of max memory usage per invocation",
+			unit:        "By",
+			kind:        otlpHistogram,
+			start:       r.Start,
+			end:         end,
+			value:       float64(r.MaxMemoryUsed * 1024 * 1024),
+		},
+	}
+
+	if r.InitDuration != nil {
+		metrics = append(metrics,
+			otlpMetric{
+				name:        "faas.init_duration",
+				description: "Measures the duration of the function's initialization, such as a cold start",
+				unit:        "s",
+				kind:        otlpHistogram,
+				start:       r.Start,
+				end:         end,
+				value:       *r.InitDuration / 1000,
+			},
+			otlpMetric{
+				name:        "faas.coldstarts",
+				description: "Number of invocation cold starts",
+				unit:        "{coldstart}",
+				kind:        otlpSum,
+				start:       r.Start,
+				end:         end,
+				value:       1,
+			},
+		)
+	}
+
+	for i := range metrics {
+		metrics[i].attributes = map[string]interface{}{"faas.invocation_id": r.RequestID}
+	}
+
+	return metrics
+}
+
+// otlpSeverity maps a log level to an OTLP severity number
+func otlpSeverity(level string) (int, string) {
+	switch strings.ToUpper(level) {
+	case "TRACE":
+		return otlpSeverityTrace, "TRACE"
+	case "DEBUG":
+		return otlpSeverityDebug, "DEBUG"
+	case "INFO":
+		return otlpSeverityInfo, "INFO"
+	case "WARN", "WARNING":
+		return otlpSeverityWarn, "WARN"
+	case "ERROR":
+		return otlpSeverityError, "ERROR"
+	case "FATAL", "CRITICAL":
+		return otlpSeverityFatal, "FATAL"
+	default:
+		return 0, level
+	}
+}
+
+// otlpTraceID decodes a hex trace ID, left-padding shorter IDs to 16 bytes. It returns nil
+// when the trace ID isn't valid.
+func otlpTraceID(traceId string) []byte {
+	if traceId == "" || len(traceId) > 32 {
+		return nil
+	}
+
+	decoded, err := hex.DecodeString(strings.Repeat("0", 32-len(traceId)) + traceId)
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// otlpSpanID decodes a hex span ID. It returns nil when the span ID isn't valid.
+func otlpSpanID(spanId string) []byte {
+	decoded, err := hex.DecodeString(spanId)
+	if err != nil || len(decoded) != 8 {
+		return nil
+	}
+	return decoded
+}
+
+// encodeOTLPSpans encodes an ExportTraceServiceRequest
+func encodeOTLPSpans(resource map[string]interface{}, spans []otlpSpan) []byte {
+	var scopeSpans []byte
+	scopeSpans = appendOTLPMessage(scopeSpans, 1, encodeOTLPScope())
+	for _, span := range spans {
+		scopeSpans = appendOTLPMessage(scopeSpans, 2, span.encode())
+	}
+
+	var resourceSpans []byte
+	resourceSpans = appendOTLPMessage(resourceSpans, otlpResourceField, encodeOTLPResource(resource))
+	resourceSpans = appendOTLPMessage(resourceSpans, 2, scopeSpans)
+
+	return appendOTLPMessage(nil, otlpExportRequestField, resourceSpans)
+}
+
+func (s otlpSpan) encode() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.traceId)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.spanId)
+	if s.parentId != nil {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.parentId)
+	}
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendString(b, s.name)
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(s.kind))
+	b = protowire.AppendTag(b, 7, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.start.UnixNano()))
+	b = protowire.AppendTag(b, 8, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.end.UnixNano()))
+	b = appendOTLPAttributes(b, 9, s.attributes)
+	return b
+}
+
+// encodeOTLPLogs encodes an ExportLogsServiceRequest
+func encodeOTLPLogs(resource map[string]interface{}, records []otlpLogRecord) []byte {
+	var scopeLogs []byte
+	scopeLogs = appendOTLPMessage(scopeLogs, 1, encodeOTLPScope())
+	for _, record := range records {
+		scopeLogs = appendOTLPMessage(scopeLogs, 2, record.encode())
+	}
+
+	var resourceLogs []byte
+	resourceLogs = appendOTLPMessage(resourceLogs, otlpResourceField, encodeOTLPResource(resource))
+	resourceLogs = appendOTLPMessage(resourceLogs, 2, scopeLogs)
+
+	return appendOTLPMessage(nil, otlpExportRequestField, resourceLogs)
+}
+
+func (r otlpLogRecord) encode() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(r.time.UnixNano()))
+	if r.severity != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.severity))
+	}
+	if r.severityText != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, r.severityText)
+	}
+	b = appendOTLPMessage(b, 5, encodeOTLPAnyValue(r.body))
+	b = appendOTLPAttributes(b, 6, r.attributes)
+	if r.traceId != nil {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, r.traceId)
+	}
+	b = protowire.AppendTag(b, 11, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(time.Now().UnixNano()))
+	return b
+}
+
+// encodeOTLPMetrics encodes an ExportMetricsServiceRequest
+func encodeOTLPMetrics(resource map[string]interface{}, metrics []otlpMetric) []byte {
+	var scopeMetrics []byte
+	scopeMetrics = appendOTLPMessage(scopeMetrics, 1, encodeOTLPScope())
+	for _, metric := range metrics {
+		scopeMetrics = appendOTLPMessage(scopeMetrics, 2, metric.encode())
+	}
+
+	var resourceMetrics []byte
+	resourceMetrics = appendOTLPMessage(resourceMetrics, otlpResourceField, encodeOTLPResource(resource))
+	resourceMetrics = appendOTLPMessage(resourceMetrics, 2, scopeMetrics)
+
+	return appendOTLPMessage(nil, otlpExportRequestField, resourceMetrics)
+}
+
+func (m otlpMetric) encode() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, m.name)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, m.description)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, m.unit)
+
+	var point []byte
+	point = protowire.AppendTag(point, 2, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, uint64(m.start.UnixNano()))
+	point = protowire.AppendTag(point, 3, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, uint64(m.end.UnixNano()))
+
+	var data []byte
+	switch m.kind {
+	case otlpHistogram:
+		// A single observation, or a summary's, in one bucket with no bounds
+		summary := Summary{Count: 1, Sum: m.value, Min: m.value, Max: m.value}
+		if m.summary != nil {
+			summary = *m.summary
+		}
+		count := uint64(math.Round(summary.Count))
+		point = protowire.AppendTag(point, 4, protowire.Fixed64Type)
+		point = protowire.AppendFixed64(point, count)
+		point = appendOTLPDouble(point, 5, summary.Sum)
+		point = protowire.AppendTag(point, 6, protowire.BytesType)
+		point = protowire.AppendBytes(point, protowire.AppendFixed64(nil, count))
+		point = appendOTLPAttributes(point, 9, m.attributes)
+		point = appendOTLPDouble(point, 11, summary.Min)
+		point = appendOTLPDouble(point, 12, summary.Max)
+
+		data = appendOTLPMessage(data, 1, point)
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, otlpAggregationTemporalityDelta)
+		b = appendOTLPMessage(b, 9, data)
+	case otlpSum:
+		point = appendOTLPDouble(point, 4, m.value)
+		point = appendOTLPAttributes(point, 7, m.attributes)
+
+		data = appendOTLPMessage(data, 1, point)
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, otlpAggregationTemporalityDelta)
+		data = protowire.AppendTag(data, 3, protowire.VarintType)
+		data = protowire.AppendVarint(data, protowire.EncodeBool(true))
+		b = appendOTLPMessage(b, 7, data)
+	default:
+		point = appendOTLPDouble(point, 4, m.value)
+		point = appendOTLPAttributes(point, 7, m.attributes)
+
+		data = appendOTLPMessage(data, 1, point)
+		b = appendOTLPMessage(b, 5, data)
+	}
+
+	return b
+}
+
+// encodeOTLPScope encodes the InstrumentationScope of the data the extension exports
+func encodeOTLPScope() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, util.Name)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, util.Version)
+	return b
+}
+
+func encodeOTLPResource(attributes map[string]interface{}) []byte {
+	return appendOTLPAttributes(nil, otlpAttributesField, attributes)
+}
+
+// appendOTLPAttributes appends KeyValue fields, in key order
+func appendOTLPAttributes(b []byte, field protowire.Number, attributes map[string]interface{}) []byte {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var keyValue []byte
+		keyValue = protowire.AppendTag(keyValue, otlpKeyField, protowire.BytesType)
+		keyValue = protowire.AppendString(keyValue, k)
+		keyValue = appendOTLPMessage(keyValue, otlpValueField, encodeOTLPAnyValue(attributes[k]))
+		b = appendOTLPMessage(b, field, keyValue)
+	}
+	return b
+}
+
+// encodeOTLPAnyValue encodes an AnyValue. Types without an AnyValue field are sent as strings.
+func encodeOTLPAnyValue(value interface{}) []byte {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = protowire.AppendTag(b, otlpStringValueField, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case bool:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case int:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case int64:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case float64:
+		b = appendOTLPDouble(b, 4, v)
+	default:
+		b = protowire.AppendTag(b, otlpStringValueField, protowire.BytesType)
+		b = protowire.AppendString(b, fmt.Sprint(v))
+	}
+	return b
+}
+
+func appendOTLPMessage(b []byte, field protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func appendOTLPDouble(b []byte, field protowire.Number, value float64) []byte {
+	b = protowire.AppendTag(b, field, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(value))
+}
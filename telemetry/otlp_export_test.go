@@ -0,0 +1,314 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+type protoField struct {
+	typ    protowire.Type
+	bytes  []byte
+	scalar uint64
+}
+
+// decodeProtoFields decodes a message's fields, by field number
+func decodeProtoFields(t *testing.T, b []byte) map[protowire.Number][]protoField {
+	fields := make(map[protowire.Number][]protoField)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if !assert.Greater(t, n, 0) {
+			return fields
+		}
+		b = b[n:]
+
+		field := protoField{typ: typ}
+		switch typ {
+		case protowire.BytesType:
+			field.bytes, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			field.scalar, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			field.scalar, n = protowire.ConsumeFixed64(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if !assert.Greater(t, n, 0) {
+			return fields
+		}
+		b = b[n:]
+
+		fields[num] = append(fields[num], field)
+	}
+	return fields
+}
+
+// decodeProtoAttributes decodes the KeyValue fields of a message
+func decodeProtoAttributes(t *testing.T, fields []protoField) map[string]interface{} {
+	attributes := make(map[string]interface{})
+	for _, field := range fields {
+		keyValue := decodeProtoFields(t, field.bytes)
+		key := string(keyValue[otlpKeyField][0].bytes)
+		anyValue := decodeProtoFields(t, keyValue[otlpValueField][0].bytes)
+		switch {
+		case len(anyValue[1]) > 0:
+			attributes[key] = string(anyValue[1][0].bytes)
+		case len(anyValue[3]) > 0:
+			attributes[key] = int64(anyValue[3][0].scalar)
+		case len(anyValue[4]) > 0:
+			attributes[key] = math.Float64frombits(anyValue[4][0].scalar)
+		}
+	}
+	return attributes
+}
+
+// decodeOTLPExport returns the resource attributes, and the records of the single scope, of an
+// export request holding one ResourceLogs or ResourceMetrics
+func decodeOTLPExport(t *testing.T, request []byte) (map[string]interface{}, [][]byte) {
+	resourceData := decodeProtoFields(t, decodeProtoFields(t, request)[otlpExportRequestField][0].bytes)
+	resource := decodeProtoFields(t, resourceData[otlpResourceField][0].bytes)
+	scope := decodeProtoFields(t, resourceData[2][0].bytes)
+
+	var records [][]byte
+	for _, field := range scope[2] {
+		records = append(records, field.bytes)
+	}
+	return decodeProtoAttributes(t, resource[otlpAttributesField]), records
+}
+
+func startOTLPTestServer(t *testing.T, received map[string][]byte) (*httptest.Server, *Client) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, OTLPContentTypeProtobuf, r.Header.Get("Content-Type"))
+		received[r.URL.Path] = uncompressedRequestBody(t, r)
+		w.WriteHeader(200)
+	}))
+
+	client := NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
+	client.SetOTLPEndpoint(srv.URL)
+
+	return srv, client
+}
+
+func TestSendFunctionLogsOTLP(t *testing.T) {
+	os.Setenv("AWS_REGION", "us-west-2")
+	os.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "128")
+	defer func() {
+		os.Unsetenv("AWS_REGION")
+		os.Unsetenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE")
+	}()
+
+	received := make(map[string][]byte)
+	srv, client := startOTLPTestServer(t, received)
+	defer srv.Close()
+
+	logTime := time.Unix(1700000000, 0)
+	lines := []logserver.LogLine{
+		{Time: logTime, RequestID: testRequestId, Content: []byte("hello")},
+		{Time: logTime, RequestID: testRequestId, Content: []byte("oops"), Attributes: map[string]interface{}{"level": "warning"}},
+	}
+	assert.NoError(t, client.SendFunctionLogsOTLP(context.Background(), testARN, lines))
+
+	resource, records := decodeOTLPExport(t, received["/v1/logs"])
+	assert.Equal(t, "my-function", resource["service.name"])
+	assert.Equal(t, "my-function", resource["faas.name"])
+	assert.Equal(t, testARN, resource["cloud.resource_id"])
+	assert.Equal(t, "aws_lambda", resource["cloud.platform"])
+	assert.Equal(t, "us-west-2", resource["cloud.region"])
+	assert.Equal(t, int64(128*1024*1024), resource["faas.max_memory"])
+
+	assert.Len(t, records, 2)
+	first := decodeProtoFields(t, records[0])
+	assert.Equal(t, uint64(logTime.UnixNano()), first[1][0].scalar)
+	assert.Empty(t, first[2])
+	assert.Equal(t, "hello", string(decodeProtoFields(t, first[5][0].bytes)[1][0].bytes))
+	assert.Equal(t, testRequestId, decodeProtoAttributes(t, first[6])["faas.invocation_id"])
+
+	second := decodeProtoFields(t, records[1])
+	assert.Equal(t, uint64(otlpSeverityWarn), second[2][0].scalar)
+	assert.Equal(t, "WARN", string(second[3][0].bytes))
+}
+
+func TestSendPlatformOTLP(t *testing.T) {
+	received := make(map[string][]byte)
+	srv, client := startOTLPTestServer(t, received)
+	defer srv.Close()
+
+	start := time.Unix(1700000000, 0)
+	initDuration := 250.0
+	reports := []PlatformReport{
+		{RequestID: testRequestId, Start: start, Duration: 1500, BilledDuration: 1500, MaxMemoryUsed: 64, InitDuration: &initDuration},
+	}
+	platformErrors := []PlatformError{
+		{RequestID: testRequestId2, Time: start, Type: PlatformErrorTimeout, Message: "Task timed out after 3.00 seconds"},
+	}
+	assert.NoError(t, client.SendPlatformOTLP(context.Background(), testARN, reports, platformErrors))
+
+	_, metrics := decodeOTLPExport(t, received["/v1/metrics"])
+	byName := make(map[string]map[protowire.Number][]protoField)
+	for _, metric := range metrics {
+		fields := decodeProtoFields(t, metric)
+		byName[string(fields[1][0].bytes)] = fields
+	}
+	assert.Len(t, byName, 7)
+
+	invokeDuration := byName["faas.invoke_duration"]
+	assert.Equal(t, "s", string(invokeDuration[3][0].bytes))
+	histogram := decodeProtoFields(t, invokeDuration[9][0].bytes)
+	assert.Equal(t, uint64(otlpAggregationTemporalityDelta), histogram[2][0].scalar)
+	point := decodeProtoFields(t, histogram[1][0].bytes)
+	assert.Equal(t, uint64(start.UnixNano()), point[2][0].scalar)
+	assert.Equal(t, uint64(start.Add(1500*time.Millisecond).UnixNano()), point[3][0].scalar)
+	assert.Equal(t, uint64(1), point[4][0].scalar)
+	assert.Equal(t, 1.5, math.Float64frombits(point[5][0].scalar))
+	assert.Equal(t, testRequestId, decodeProtoAttributes(t, point[9])["faas.invocation_id"])
+
+	memUsage := decodeProtoFields(t, decodeProtoFields(t, byName["faas.mem_usage"][9][0].bytes)[1][0].bytes)
+	assert.Equal(t, float64(64*1024*1024), math.Float64frombits(memUsage[5][0].scalar))
+
+	timeouts := decodeProtoFields(t, byName["faas.timeouts"][7][0].bytes)
+	assert.Equal(t, uint64(1), timeouts[3][0].scalar)
+	assert.Equal(t, 1.0, math.Float64frombits(decodeProtoFields(t, timeouts[1][0].bytes)[4][0].scalar))
+	assert.NotNil(t, byName["faas.coldstarts"])
+	assert.Nil(t, byName["faas.errors"])
+
+	_, records := decodeOTLPExport(t, received["/v1/logs"])
+	assert.Len(t, records, 1)
+	record := decodeProtoFields(t, records[0])
+	assert.Equal(t, uint64(otlpSeverityError), record[2][0].scalar)
+	attributes := decodeProtoAttributes(t, record[6])
+	assert.Equal(t, PlatformErrorTimeout, attributes["exception.type"])
+	assert.Equal(t, testRequestId2, attributes["faas.invocation_id"])
+}
+
+func TestOTLPTraceID(t *testing.T) {
+	assert.Nil(t, otlpTraceID(""))
+	assert.Nil(t, otlpTraceID("not hex"))
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}, otlpTraceID("0102030405060708"))
+	assert.Len(t, otlpTraceID("4bf92f3577b34da6a3ce929d0e0e4736"), 16)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(map[string][]byte)
+	srv, client := startOTLPTestServer(t, received)
+	defer srv.Close()
+
+	exporter := &OTLPExporter{client: client}
+	ctx := context.Background()
+
+	timestamp := time.Unix(1700000000, 0)
+	metrics := []Metric{
+		{Name: "orders", Type: "count", Value: 3, Timestamp: timestamp.UnixMilli(), Interval: 1000},
+		{Name: "queue.depth", Type: "gauge", Value: 7, Timestamp: timestamp.UnixMilli()},
+		{Name: "db.query", Type: "summary", Timestamp: timestamp.UnixMilli(), Interval: 1000, Summary: &Summary{Count: 2, Sum: 40, Min: 10, Max: 30}},
+	}
+	assert.NoError(t, exporter.ExportMetrics(ctx, testARN, metrics))
+
+	_, records := decodeOTLPExport(t, received["/v1/metrics"])
+	assert.Len(t, records, 3)
+	count := decodeProtoFields(t, records[0])
+	assert.Equal(t, "orders", string(count[1][0].bytes))
+	sum := decodeProtoFields(t, count[7][0].bytes)
+	point := decodeProtoFields(t, sum[1][0].bytes)
+	assert.Equal(t, uint64(timestamp.UnixNano()), point[2][0].scalar)
+	assert.Equal(t, uint64(timestamp.Add(time.Second).UnixNano()), point[3][0].scalar)
+	assert.Equal(t, 3.0, math.Float64frombits(point[4][0].scalar))
+	gauge := decodeProtoFields(t, records[1])
+	assert.NotEmpty(t, gauge[5])
+	histogram := decodeProtoFields(t, records[2])
+	point = decodeProtoFields(t, decodeProtoFields(t, histogram[9][0].bytes)[1][0].bytes)
+	assert.Equal(t, uint64(2), point[4][0].scalar)
+	assert.Equal(t, 40.0, math.Float64frombits(point[5][0].scalar))
+	assert.Equal(t, 10.0, math.Float64frombits(point[11][0].scalar))
+	assert.Equal(t, 30.0, math.Float64frombits(point[12][0].scalar))
+
+	events := []CustomEvent{{"eventType": "Purchase", "timestamp": timestamp.UnixMilli(), "amount": 12.5}}
+	assert.NoError(t, exporter.ExportEvents(ctx, testARN, events))
+
+	_, records = decodeOTLPExport(t, received["/v1/logs"])
+	assert.Len(t, records, 1)
+	record := decodeProtoFields(t, records[0])
+	assert.Equal(t, uint64(timestamp.UnixNano()), record[1][0].scalar)
+	attributes := decodeProtoAttributes(t, record[6])
+	assert.Equal(t, "Purchase", attributes["event.name"])
+	assert.Equal(t, 12.5, attributes["amount"])
+	assert.Nil(t, attributes["timestamp"])
+}
+
+func TestOTLPExporterSpans(t *testing.T) {
+	received := make(map[string][]byte)
+	srv, client := startOTLPTestServer(t, received)
+	defer srv.Close()
+
+	exporter := &OTLPExporter{client: client}
+
+	timestamp := time.Unix(1700000000, 0)
+	spans := []Span{
+		{
+			ID:         "0000000000000001",
+			TraceID:    "0af7651916cd43dd8448eb211c80319c",
+			Timestamp:  timestamp.UnixMilli(),
+			Attributes: map[string]interface{}{"name": InvocationSpanName, "duration.ms": 50.0, "aws.requestId": testRequestId},
+		},
+		{
+			ID:         "0000000000000002",
+			TraceID:    "0af7651916cd43dd8448eb211c80319c",
+			Timestamp:  timestamp.UnixMilli(),
+			Attributes: map[string]interface{}{"name": "responseLatency", "duration.ms": 20.0, "parent.id": "0000000000000001"},
+		},
+	}
+	assert.NoError(t, exporter.ExportSpans(context.Background(), testARN, spans))
+	assert.NoError(t, exporter.ExportSpans(context.Background(), testARN, nil))
+
+	_, records := decodeOTLPExport(t, received["/v1/traces"])
+	assert.Len(t, records, 2)
+
+	root := decodeProtoFields(t, records[0])
+	assert.Equal(t, otlpTraceID("0af7651916cd43dd8448eb211c80319c"), root[1][0].bytes)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1}, root[2][0].bytes)
+	assert.Empty(t, root[4])
+	assert.Equal(t, InvocationSpanName, string(root[5][0].bytes))
+	assert.Equal(t, uint64(otlpSpanKindServer), root[6][0].scalar)
+	assert.Equal(t, uint64(timestamp.UnixNano()), root[7][0].scalar)
+	assert.Equal(t, uint64(timestamp.Add(50*time.Millisecond).UnixNano()), root[8][0].scalar)
+	attributes := decodeProtoAttributes(t, root[9])
+	assert.Equal(t, testRequestId, attributes["faas.invocation_id"])
+	assert.Nil(t, attributes["duration.ms"])
+
+	child := decodeProtoFields(t, records[1])
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1}, child[4][0].bytes)
+	assert.Equal(t, "responseLatency", string(child[5][0].bytes))
+	assert.Equal(t, uint64(otlpSpanKindInternal), child[6][0].scalar)
+}
+
+func TestOTLPExporterAgentPayloads(t *testing.T) {
+	received := make(map[string][]byte)
+	srv, client := startOTLPTestServer(t, received)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	exporter := &OTLPExporter{client: client, newRelic: NewWriterExporter(&buf)}
+
+	batch := NewBatch(1000, 10000, false)
+	batch.AddInvocation(testRequestId, time.Now())
+	batch.AddTelemetry(testRequestId, []byte("agent payload"), true)
+	batch.AddTelemetry(testRequestId, []byte("platform log"), false)
+	batch.AddInvocation(testRequestId2, time.Now())
+	batch.AddTelemetry(testRequestId2, []byte("platform log"), false)
+	assert.NoError(t, exporter.ExportAgentPayloads(context.Background(), testARN, batch.Close()))
+
+	// Only the agent payloads go to New Relic
+	records := decodeExportRecords(t, &buf)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "agentPayload", records[0]["type"])
+	assert.Equal(t, testRequestId, records[0]["requestId"])
+}
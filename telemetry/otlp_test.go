@@ -0,0 +1,228 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoResourceSpans encodes an ExportTraceServiceRequest with a ResourceSpans per resource.
+// Each ResourceSpans also holds an opaque ScopeSpans field, which must survive enrichment.
+func protoResourceSpans(resources ...map[string]string) []byte {
+	var request []byte
+	for _, attributes := range resources {
+		var resourceSpans []byte
+		if attributes != nil {
+			var resource []byte
+			for _, k := range sortedKeys(attributes) {
+				var value []byte
+				value = protowire.AppendTag(value, otlpStringValueField, protowire.BytesType)
+				value = protowire.AppendString(value, attributes[k])
+
+				var keyValue []byte
+				keyValue = protowire.AppendTag(keyValue, otlpKeyField, protowire.BytesType)
+				keyValue = protowire.AppendString(keyValue, k)
+				keyValue = protowire.AppendTag(keyValue, otlpValueField, protowire.BytesType)
+				keyValue = protowire.AppendBytes(keyValue, value)
+
+				resource = protowire.AppendTag(resource, otlpAttributesField, protowire.BytesType)
+				resource = protowire.AppendBytes(resource, keyValue)
+			}
+			resourceSpans = protowire.AppendTag(resourceSpans, otlpResourceField, protowire.BytesType)
+			resourceSpans = protowire.AppendBytes(resourceSpans, resource)
+		}
+		resourceSpans = protowire.AppendTag(resourceSpans, 2, protowire.BytesType)
+		resourceSpans = protowire.AppendBytes(resourceSpans, []byte("scope spans"))
+
+		request = protowire.AppendTag(request, otlpExportRequestField, protowire.BytesType)
+		request = protowire.AppendBytes(request, resourceSpans)
+	}
+	return request
+}
+
+// decodeProtoResources returns the resource attributes, and the count of ScopeSpans, of each
+// ResourceSpans in an ExportTraceServiceRequest
+func decodeProtoResources(t *testing.T, request []byte) ([]map[string]string, []int) {
+	var resources []map[string]string
+	var scopeCounts []int
+
+	forEachField(t, request, func(num protowire.Number, value []byte) {
+		attributes := make(map[string]string)
+		scopes := 0
+		forEachField(t, value, func(num protowire.Number, value []byte) {
+			if num == 2 {
+				assert.Equal(t, "scope spans", string(value))
+				scopes++
+				return
+			}
+			forEachField(t, value, func(_ protowire.Number, keyValue []byte) {
+				var key, str string
+				forEachField(t, keyValue, func(num protowire.Number, value []byte) {
+					if num == otlpKeyField {
+						key = string(value)
+						return
+					}
+					forEachField(t, value, func(_ protowire.Number, value []byte) {
+						str = string(value)
+					})
+				})
+				attributes[key] = str
+			})
+		})
+		resources = append(resources, attributes)
+		scopeCounts = append(scopeCounts, scopes)
+	})
+
+	return resources, scopeCounts
+}
+
+func forEachField(t *testing.T, b []byte, fn func(num protowire.Number, value []byte)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		assert.Greater(t, n, 0)
+		assert.Equal(t, protowire.BytesType, typ)
+		value, m := protowire.ConsumeBytes(b[n:])
+		assert.Greater(t, m, 0)
+		fn(num, value)
+		b = b[n+m:]
+	}
+}
+
+func TestAddOTLPResourceAttributesProtobuf(t *testing.T) {
+	request := protoResourceSpans(map[string]string{"service.name": "checkout", "faas.name": "mine"}, nil)
+	attributes := map[string]string{"faas.name": "my-function", "cloud.region": "us-west-2"}
+
+	enriched, err := AddOTLPResourceAttributes(OTLPPayload{Signal: OTLPTraces, ContentType: OTLPContentTypeProtobuf, Body: request}, attributes)
+	assert.NoError(t, err)
+
+	resources, scopeCounts := decodeProtoResources(t, enriched)
+	assert.Equal(t, []map[string]string{
+		{"service.name": "checkout", "faas.name": "mine", "cloud.region": "us-west-2"},
+		{"faas.name": "my-function", "cloud.region": "us-west-2"},
+	}, resources)
+	assert.Equal(t, []int{1, 1}, scopeCounts)
+
+	_, err = AddOTLPResourceAttributes(OTLPPayload{Signal: OTLPTraces, ContentType: OTLPContentTypeProtobuf, Body: []byte{0x0a, 0x10, 0x01}}, attributes)
+	assert.Error(t, err)
+}
+
+func TestAddOTLPResourceAttributesJSON(t *testing.T) {
+	request := `{"resourceLogs": [
+		{"resource": {"attributes": [{"key": "faas.name", "value": {"stringValue": "mine"}}]}, "scopeLogs": [{"logRecords": [{"timeUnixNano": "1700000000000000000", "severityNumber": 9}]}]},
+		{"scopeLogs": []}
+	]}`
+	attributes := map[string]string{"faas.name": "my-function", "faas.arn": testARN}
+
+	enriched, err := AddOTLPResourceAttributes(OTLPPayload{Signal: OTLPLogs, ContentType: OTLPContentTypeJSON, Body: []byte(request)}, attributes)
+	assert.NoError(t, err)
+
+	var decoded struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string `json:"key"`
+					Value struct {
+						StringValue string `json:"stringValue"`
+					} `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []json.RawMessage `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	assert.NoError(t, json.Unmarshal(enriched, &decoded))
+	assert.Len(t, decoded.ResourceLogs, 2)
+
+	first := decoded.ResourceLogs[0].Resource.Attributes
+	assert.Len(t, first, 2)
+	assert.Equal(t, "mine", first[0].Value.StringValue)
+	assert.Equal(t, "faas.arn", first[1].Key)
+	assert.Len(t, decoded.ResourceLogs[0].ScopeLogs, 1)
+	assert.Contains(t, string(enriched), `"severityNumber":9`)
+
+	second := decoded.ResourceLogs[1].Resource.Attributes
+	assert.Len(t, second, 2)
+	assert.Equal(t, "faas.name", second[1].Key)
+	assert.Equal(t, "my-function", second[1].Value.StringValue)
+
+	assert.Error(t, ValidateOTLP(OTLPPayload{Signal: OTLPLogs, ContentType: OTLPContentTypeJSON, Body: []byte("not json")}))
+	assert.Error(t, ValidateOTLP(OTLPPayload{Signal: "profiles", ContentType: OTLPContentTypeJSON, Body: []byte("{}")}))
+}
+
+func TestMergeOTLPBodies(t *testing.T) {
+	first := protoResourceSpans(map[string]string{"service.name": "a"})
+	second := protoResourceSpans(map[string]string{"service.name": "b"})
+
+	merged, err := mergeOTLPBodies(OTLPTraces, OTLPContentTypeProtobuf, [][]byte{first, second})
+	assert.NoError(t, err)
+	assert.Len(t, merged, 1)
+	resources, _ := decodeProtoResources(t, merged[0])
+	assert.Len(t, resources, 2)
+
+	merged, err = mergeOTLPBodies(OTLPMetrics, OTLPContentTypeJSON, [][]byte{
+		[]byte(`{"resourceMetrics": [{"scopeMetrics": []}]}`),
+		[]byte(`{"resourceMetrics": [{"scopeMetrics": []}, {"scopeMetrics": []}]}`),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, merged, 1)
+	assert.JSONEq(t, `{"resourceMetrics": [{"scopeMetrics": []}, {"scopeMetrics": []}, {"scopeMetrics": []}]}`, string(merged[0]))
+
+	big := make([]byte, maxOTLPBatchBytes-10)
+	merged, err = mergeOTLPBodies(OTLPTraces, OTLPContentTypeProtobuf, [][]byte{big, first, second})
+	assert.NoError(t, err)
+	assert.Len(t, merged, 2)
+}
+
+func TestGetOTLPEndpointURL(t *testing.T) {
+	assert.Equal(t, OTLPEndpointUS, getOTLPEndpointURL("us license key", ""))
+	assert.Equal(t, OTLPEndpointEU, getOTLPEndpointURL("eu license key", ""))
+	assert.Equal(t, "https://otlp.example.com", getOTLPEndpointURL("us license key", "https://otlp.example.com/"))
+}
+
+func TestSendOTLP(t *testing.T) {
+	os.Setenv("AWS_REGION", "us-west-2")
+	defer os.Unsetenv("AWS_REGION")
+
+	var paths []string
+	var resources []map[string]string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, "a mock license key", r.Header.Get("api-key"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+
+		if r.Header.Get("Content-Type") == OTLPContentTypeProtobuf {
+			resources, _ = decodeProtoResources(t, uncompressedRequestBody(t, r))
+		}
+
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	client := NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
+	client.SetOTLPEndpoint(srv.URL)
+
+	payloads := []OTLPPayload{
+		{Signal: OTLPTraces, ContentType: OTLPContentTypeProtobuf, Body: protoResourceSpans(map[string]string{"service.name": "a"})},
+		{Signal: OTLPTraces, ContentType: OTLPContentTypeProtobuf, Body: protoResourceSpans(nil)},
+		{Signal: OTLPLogs, ContentType: OTLPContentTypeJSON, Body: []byte(`{"resourceLogs": []}`)},
+		{Signal: OTLPTraces, ContentType: OTLPContentTypeProtobuf, Body: []byte{0xff}},
+	}
+	err := client.SendOTLP(context.Background(), testARN, payloads, "entity guid")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"/v1/traces", "/v1/logs"}, paths)
+	assert.Len(t, resources, 2)
+	for _, resource := range resources {
+		assert.Equal(t, "my-function", resource["faas.name"])
+		assert.Equal(t, testARN, resource["faas.arn"])
+		assert.Equal(t, "us-west-2", resource["cloud.region"])
+		assert.Equal(t, "entity guid", resource["entity.guid"])
+	}
+	assert.Equal(t, "a", resources[0]["service.name"])
+}
@@ -0,0 +1,120 @@
+package telemetry
+
+import (
+	"sync"
+	"time"
+)
+
+// Extension overhead metrics
+const (
+	// OverheadMetric is how long the extension held an invocation open, after the runtime
+	// finished it, before calling next
+	OverheadMetric = "newrelic.extension.overhead_ms"
+	// PostRuntimeMetric is how much longer the platform reported the invocation's duration than
+	// the runtime's, which is the work of every extension after the runtime finished
+	PostRuntimeMetric = "newrelic.extension.post_runtime_ms"
+)
+
+// maxTrackedOverhead is how many invocations' timings are remembered, until they're complete
+const maxTrackedOverhead = 16
+
+// invocationTimings are what's known of an invocation's end
+type invocationTimings struct {
+	released        time.Time
+	runtimeDone     time.Time
+	runtimeDuration *float64
+	reportDuration  *float64
+	overheadSent    bool
+	postRuntimeSent bool
+}
+
+// OverheadTracker times how long the extension holds each invocation open. An invocation is
+// held open from platform.runtimeDone, when the runtime finished it, until the extension calls
+// next; the extension's own work is in between. The platform's report of the invocation's
+// duration, less the runtime's, is every extension's work.
+type OverheadTracker struct {
+	lock        sync.Mutex
+	invocations map[string]*invocationTimings
+	requests    []string
+}
+
+// NewOverheadTracker creates an OverheadTracker
+func NewOverheadTracker() *OverheadTracker {
+	return &OverheadTracker{invocations: make(map[string]*invocationTimings)}
+}
+
+// Released records when the extension called next, after an invocation
+func (t *OverheadTracker) Released(requestId string, at time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.timings(requestId).released = at
+}
+
+// RuntimeDone records when the runtime finished an invocation, and its duration, in
+// milliseconds, when it's known
+func (t *OverheadTracker) RuntimeDone(requestId string, at time.Time, duration *float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	timings := t.timings(requestId)
+	timings.runtimeDone = at
+	timings.runtimeDuration = duration
+}
+
+// Report records an invocation's duration, in milliseconds, as the platform reported it
+func (t *OverheadTracker) Report(requestId string, duration float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.timings(requestId).reportDuration = &duration
+}
+
+// Metrics returns the metrics of the invocations whose timings are known, once each
+func (t *OverheadTracker) Metrics() []Metric {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var metrics []Metric
+	for requestId, timings := range t.invocations {
+		gauge := func(name string, value float64) Metric {
+			return Metric{
+				Name:       name,
+				Type:       "gauge",
+				Value:      value,
+				Timestamp:  timings.runtimeDone.UnixMilli(),
+				Attributes: map[string]interface{}{"aws.requestId": requestId},
+			}
+		}
+
+		if !timings.overheadSent && !timings.released.IsZero() && !timings.runtimeDone.IsZero() {
+			// The extension may have called next before the runtime finished
+			overhead := max(timings.released.Sub(timings.runtimeDone), 0)
+			metrics = append(metrics, gauge(OverheadMetric, float64(overhead)/float64(time.Millisecond)))
+			timings.overheadSent = true
+		}
+		if !timings.postRuntimeSent && timings.runtimeDuration != nil && timings.reportDuration != nil {
+			postRuntime := max(*timings.reportDuration-*timings.runtimeDuration, 0)
+			metrics = append(metrics, gauge(PostRuntimeMetric, postRuntime))
+			timings.postRuntimeSent = true
+		}
+	}
+	return metrics
+}
+
+// timings finds the timings of a request, forgetting the oldest request when there are too
+// many. The caller must hold the lock.
+func (t *OverheadTracker) timings(requestId string) *invocationTimings {
+	if timings, ok := t.invocations[requestId]; ok {
+		return timings
+	}
+
+	if len(t.requests) == maxTrackedOverhead {
+		delete(t.invocations, t.requests[0])
+		t.requests = t.requests[1:]
+	}
+	timings := &invocationTimings{}
+	t.invocations[requestId] = timings
+	t.requests = append(t.requests, requestId)
+	return timings
+}
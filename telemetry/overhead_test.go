@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverheadTracker(t *testing.T) {
+	tracker := NewOverheadTracker()
+	runtimeDone := time.Unix(1700000000, 0)
+	runtimeDuration := 100.0
+
+	tracker.Released("request-1", runtimeDone.Add(25*time.Millisecond))
+	assert.Empty(t, tracker.Metrics())
+
+	tracker.RuntimeDone("request-1", runtimeDone, &runtimeDuration)
+	metrics := tracker.Metrics()
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, OverheadMetric, metrics[0].Name)
+	assert.Equal(t, "gauge", metrics[0].Type)
+	assert.Equal(t, 25.0, metrics[0].Value)
+	assert.Equal(t, runtimeDone.UnixMilli(), metrics[0].Timestamp)
+	assert.Equal(t, "request-1", metrics[0].Attributes["aws.requestId"])
+
+	tracker.Report("request-1", 130.5)
+	metrics = tracker.Metrics()
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, PostRuntimeMetric, metrics[0].Name)
+	assert.Equal(t, 30.5, metrics[0].Value)
+
+	// Once each
+	assert.Empty(t, tracker.Metrics())
+}
+
+func TestOverheadTrackerReleasedEarly(t *testing.T) {
+	tracker := NewOverheadTracker()
+	runtimeDone := time.Unix(1700000000, 0)
+
+	// The extension called next before the runtime finished, so it held nothing open
+	tracker.Released("request-1", runtimeDone.Add(-time.Millisecond))
+	tracker.RuntimeDone("request-1", runtimeDone, nil)
+	tracker.Report("request-1", 130.5)
+
+	metrics := tracker.Metrics()
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, OverheadMetric, metrics[0].Name)
+	assert.Equal(t, 0.0, metrics[0].Value)
+}
+
+func TestOverheadTrackerForgetsOldest(t *testing.T) {
+	tracker := NewOverheadTracker()
+	for i := 0; i < maxTrackedOverhead+1; i++ {
+		tracker.Released(fmt.Sprintf("request-%d", i), time.Now())
+	}
+	assert.Len(t, tracker.invocations, maxTrackedOverhead)
+	assert.NotContains(t, tracker.invocations, "request-0")
+	assert.Equal(t, "request-1", tracker.requests[0])
+}
@@ -0,0 +1,187 @@
+package telemetry
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+// Synthesized platform error types
+const (
+	PlatformErrorTimeout     = "Lambda.Timedout"
+	PlatformErrorFault       = "Lambda.PlatformFault"
+	PlatformErrorOutOfMemory = "Lambda.OutOfMemory"
+)
+
+// ErrorTypeOutOfMemory is the error type of invocations the platform stopped for running out of
+// memory
+const ErrorTypeOutOfMemory = "Runtime.OutOfMemory"
+
+var (
+	reportRe        = regexp.MustCompile(`RequestId: (\S+)\s+Duration: ([\d.]+) ms\s+Billed Duration: (\d+) ms\s+Memory Size: (\d+) MB\s+Max Memory Used: (\d+) MB`)
+	initReportRe    = regexp.MustCompile(`Init Duration: ([\d.]+) ms`)
+	restoreReportRe = regexp.MustCompile(`Restore Duration: ([\d.]+) ms`)
+	statusReportRe  = regexp.MustCompile(`Status: (\S+)`)
+	errorTypeRe     = regexp.MustCompile(`Error Type: (\S+)`)
+)
+
+// InvocationEventType is the type of the events built from platform reports
+const InvocationEventType = "AwsLambdaInvocation"
+
+// ReportStatusSuccess is the status of a successful invocation, which REPORT lines leave out
+const ReportStatusSuccess = "success"
+
+// PlatformReport holds the metrics of a platform REPORT line
+type PlatformReport struct {
+	RequestID string
+	// Start is when the invocation began
+	Start time.Time
+	// Durations are in milliseconds, and memory in MB, as in the REPORT line
+	Duration       float64
+	BilledDuration float64
+	MemorySize     int64
+	MaxMemoryUsed  int64
+	InitDuration   *float64
+	// RestoreDuration is set for SnapStart restores
+	RestoreDuration *float64
+	// Status is success, error, timeout or failure
+	Status    string
+	ErrorType string
+}
+
+// PlatformError is a timeout or platform fault the extension synthesizes for an invocation
+type PlatformError struct {
+	RequestID string
+	Time      time.Time
+	Type      string
+	Message   string
+	// Duration is how long the invocation ran, when it's known
+	Duration time.Duration
+}
+
+// ParsePlatformReport parses a REPORT line, as the log server formats it
+func ParsePlatformReport(logLine string) (*PlatformReport, error) {
+	matches := reportRe.FindStringSubmatch(logLine)
+	if matches == nil {
+		return nil, fmt.Errorf("not a platform report: %s", logLine)
+	}
+
+	duration, err := strconv.ParseFloat(matches[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing duration: %v", err)
+	}
+	billedDuration, err := strconv.ParseInt(matches[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing billed duration: %v", err)
+	}
+	memorySize, err := strconv.ParseInt(matches[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing memory size: %v", err)
+	}
+	maxMemoryUsed, err := strconv.ParseInt(matches[5], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing max memory used: %v", err)
+	}
+
+	report := &PlatformReport{
+		RequestID:      matches[1],
+		Duration:       duration,
+		BilledDuration: float64(billedDuration),
+		MemorySize:     memorySize,
+		MaxMemoryUsed:  maxMemoryUsed,
+		Status:         ReportStatusSuccess,
+	}
+	report.InitDuration = parseReportDuration(initReportRe, logLine)
+	report.RestoreDuration = parseReportDuration(restoreReportRe, logLine)
+	if statusMatches := statusReportRe.FindStringSubmatch(logLine); statusMatches != nil {
+		report.Status = statusMatches[1]
+	}
+	if errorTypeMatches := errorTypeRe.FindStringSubmatch(logLine); errorTypeMatches != nil {
+		report.ErrorType = errorTypeMatches[1]
+	}
+
+	return report, nil
+}
+
+// ParsePlatformLog parses a platform report the log server passes on, with the values it carries
+// alongside the REPORT line
+func ParsePlatformLog(platformLog logserver.LogLine) (*PlatformReport, error) {
+	report, err := ParsePlatformReport(string(platformLog.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	if details := platformLog.Report; details != nil {
+		if details.RestoreDuration != nil {
+			report.RestoreDuration = details.RestoreDuration
+		}
+		if details.Status != "" {
+			report.Status = details.Status
+		}
+		if details.ErrorType != "" {
+			report.ErrorType = details.ErrorType
+		}
+	}
+	return report, nil
+}
+
+// parseReportDuration parses an optional duration of a REPORT line
+func parseReportDuration(re *regexp.Regexp, logLine string) *float64 {
+	matches := re.FindStringSubmatch(logLine)
+	if matches == nil {
+		return nil
+	}
+	duration, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return nil
+	}
+	return &duration
+}
+
+// Event is the report as an AwsLambdaInvocation event. Durations are in milliseconds, and memory
+// in MB, as in the Telemetry API's report metrics.
+func (r PlatformReport) Event(timestamp time.Time) CustomEvent {
+	event := CustomEvent{
+		"eventType":        InvocationEventType,
+		"timestamp":        timestamp.UnixMilli(),
+		"aws.requestId":    r.RequestID,
+		"durationMs":       r.Duration,
+		"billedDurationMs": r.BilledDuration,
+		"memorySizeMB":     r.MemorySize,
+		"maxMemoryUsedMB":  r.MaxMemoryUsed,
+		"coldStart":        r.InitDuration != nil,
+		"status":           r.Status,
+	}
+	if r.InitDuration != nil {
+		event["initDurationMs"] = *r.InitDuration
+	}
+	if r.RestoreDuration != nil {
+		event["restoreDurationMs"] = *r.RestoreDuration
+	}
+	if r.ErrorType != "" {
+		event["errorType"] = r.ErrorType
+	}
+	return event
+}
+
+// OutOfMemory reports whether the invocation ran out of memory: the platform says so, or it used
+// all of the function's memory
+func (r PlatformReport) OutOfMemory() bool {
+	if r.ErrorType == ErrorTypeOutOfMemory {
+		return true
+	}
+	return r.MemorySize > 0 && r.MaxMemoryUsed >= r.MemorySize
+}
+
+// PlatformReports returns the invocation's parsed platform reports
+func (inv *Invocation) PlatformReports() []PlatformReport {
+	reports := make([]PlatformReport, 0, len(inv.reports))
+	for _, report := range inv.reports {
+		report.Start = inv.Start
+		reports = append(reports, report)
+	}
+	return reports
+}
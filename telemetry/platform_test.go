@@ -0,0 +1,122 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+func TestParsePlatformReport(t *testing.T) {
+	report, err := ParsePlatformReport("REPORT RequestId: abc-123\tDuration: 12.50 ms\tBilled Duration: 13 ms\tMemory Size: 128 MB\tMax Memory Used: 64 MB")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc-123", report.RequestID)
+	assert.Equal(t, 12.5, report.Duration)
+	assert.Equal(t, 13.0, report.BilledDuration)
+	assert.Equal(t, int64(128), report.MemorySize)
+	assert.Equal(t, int64(64), report.MaxMemoryUsed)
+	assert.Nil(t, report.InitDuration)
+	assert.Nil(t, report.RestoreDuration)
+	assert.Equal(t, ReportStatusSuccess, report.Status)
+	assert.Empty(t, report.ErrorType)
+
+	_, err = ParsePlatformReport("RequestId: abc-123 AWS Lambda platform fault caused a shutdown")
+	assert.Error(t, err)
+}
+
+func TestParsePlatformReportStatus(t *testing.T) {
+	report, err := ParsePlatformReport("REPORT RequestId: abc-123\tDuration: 3000.00 ms\tBilled Duration: 3000 ms\tMemory Size: 128 MB\tMax Memory Used: 128 MB\tRestore Duration: 310.25 ms\tStatus: error\tError Type: Runtime.OutOfMemory")
+	assert.NoError(t, err)
+	assert.Equal(t, 310.25, *report.RestoreDuration)
+	assert.Equal(t, "error", report.Status)
+	assert.Equal(t, "Runtime.OutOfMemory", report.ErrorType)
+}
+
+func TestParsePlatformLog(t *testing.T) {
+	restoreDuration := 310.25
+	report, err := ParsePlatformLog(logserver.LogLine{
+		Content: []byte("REPORT RequestId: abc-123\tDuration: 3000.00 ms\tBilled Duration: 3000 ms\tMemory Size: 128 MB\tMax Memory Used: 128 MB"),
+		Report:  &logserver.ReportDetails{RestoreDuration: &restoreDuration, Status: "error", ErrorType: "Runtime.OutOfMemory"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3000.0, report.Duration)
+	assert.Equal(t, 310.25, *report.RestoreDuration)
+	assert.Equal(t, "error", report.Status)
+	assert.Equal(t, "Runtime.OutOfMemory", report.ErrorType)
+
+	// Reports of the older schema have no details
+	report, err = ParsePlatformLog(logserver.LogLine{
+		Content: []byte("REPORT RequestId: abc-123\tDuration: 12.50 ms\tBilled Duration: 13 ms\tMemory Size: 128 MB\tMax Memory Used: 64 MB"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ReportStatusSuccess, report.Status)
+
+	_, err = ParsePlatformLog(logserver.LogLine{Content: []byte("START RequestId: abc-123 Version: $LATEST")})
+	assert.Error(t, err)
+}
+
+func TestPlatformReportEvent(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	initDuration := 100.0
+
+	event := PlatformReport{
+		RequestID:      "abc-123",
+		Duration:       12.5,
+		BilledDuration: 13,
+		MemorySize:     128,
+		MaxMemoryUsed:  64,
+		InitDuration:   &initDuration,
+		Status:         "error",
+		ErrorType:      "Runtime.ExitError",
+	}.Event(timestamp)
+	assert.Equal(t, CustomEvent{
+		"eventType":        "AwsLambdaInvocation",
+		"timestamp":        timestamp.UnixMilli(),
+		"aws.requestId":    "abc-123",
+		"durationMs":       12.5,
+		"billedDurationMs": 13.0,
+		"memorySizeMB":     int64(128),
+		"maxMemoryUsedMB":  int64(64),
+		"initDurationMs":   100.0,
+		"coldStart":        true,
+		"status":           "error",
+		"errorType":        "Runtime.ExitError",
+	}, event)
+
+	restoreDuration := 310.0
+	event = PlatformReport{RequestID: "abc-123", RestoreDuration: &restoreDuration, Status: ReportStatusSuccess}.Event(timestamp)
+	assert.Equal(t, 310.0, event["restoreDurationMs"])
+	assert.Equal(t, false, event["coldStart"])
+	assert.NotContains(t, event, "initDurationMs")
+	assert.NotContains(t, event, "errorType")
+}
+
+func TestPlatformReportOutOfMemory(t *testing.T) {
+	assert.False(t, PlatformReport{MemorySize: 128, MaxMemoryUsed: 127}.OutOfMemory())
+	assert.True(t, PlatformReport{MemorySize: 128, MaxMemoryUsed: 128}.OutOfMemory())
+	assert.True(t, PlatformReport{MemorySize: 128, MaxMemoryUsed: 90, Status: "error", ErrorType: ErrorTypeOutOfMemory}.OutOfMemory())
+	assert.False(t, PlatformReport{}.OutOfMemory())
+}
+
+func TestPlatformReports(t *testing.T) {
+	start := time.Now()
+	batch := NewBatch(1000, 10000, false)
+	batch.AddInvocation("abc-123", start)
+	batch.AddTelemetry("abc-123", []byte("agent payload"), true)
+	report, err := ParsePlatformReport("REPORT RequestId: abc-123\tDuration: 12.50 ms\tBilled Duration: 13 ms\tMemory Size: 128 MB\tMax Memory Used: 64 MB\tInit Duration: 100.00 ms")
+	assert.NoError(t, err)
+	assert.NotNil(t, batch.AddReport("abc-123", *report))
+	assert.Nil(t, batch.AddReport("unknown", *report))
+
+	harvested := batch.Close()
+	assert.Len(t, harvested, 1)
+
+	reports := harvested[0].PlatformReports()
+	assert.Len(t, reports, 1)
+	assert.Equal(t, "abc-123", reports[0].RequestID)
+	assert.Equal(t, start, reports[0].Start)
+	assert.Equal(t, 12.5, reports[0].Duration)
+	assert.Equal(t, 100.0, *reports[0].InitDuration)
+}
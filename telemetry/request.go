@@ -6,12 +6,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"unicode/utf8"
 
 	"github.com/newrelic/newrelic-lambda-extension/util"
 )
 
 const (
 	maxCompressedPayloadLen = 1000 * 1024
+
+	// Log API limits. Longer messages are split into parts, up to maxLogMessageParts, and longer
+	// attribute values are truncated.
+	maxLogMessageLen   = 128 * 1024
+	maxLogMessageParts = 8
+	maxLogAttributeLen = 4094
+
+	// logTruncatedAttribute marks log records whose message or attributes were cut short
+	logTruncatedAttribute = "truncated"
+	// logMessagePartAttribute numbers the parts of a message that was split, starting at 1
+	logMessagePartAttribute = "message.part"
 )
 
 // DetailedFunctionLog is the Logs API payload
@@ -141,6 +153,95 @@ func CompressedPayloadsForLogEvents(logsEvents []LogsEvent, functionName string,
 	}
 }
 
+// CompressedPayloadsForFunctionLogs builds Log API payloads, splitting the messages across as many
+// payloads as it takes to keep each one under the size limit
+func CompressedPayloadsForFunctionLogs(common map[string]interface{}, logMessages []FunctionLogMessage) ([]*bytes.Buffer, error) {
+	// The Log API expects an array
+	logData := []DetailedFunctionLog{NewDetailedFunctionLog(common, logMessages)}
+
+	compressed, err := CompressedJsonPayload(logData)
+	if err != nil {
+		return nil, err
+	}
+
+	if compressed.Len() <= maxCompressedPayloadLen || len(logMessages) <= 1 {
+		// A single message is at most maxLogMessageLen, so it fits once compressed
+		return []*bytes.Buffer{compressed}, nil
+	}
+
+	// Payload is too large, split in half, recursively
+	split := len(logMessages) / 2
+	leftRet, err := CompressedPayloadsForFunctionLogs(common, logMessages[0:split])
+	if err != nil {
+		return nil, err
+	}
+
+	rightRet, err := CompressedPayloadsForFunctionLogs(common, logMessages[split:])
+	if err != nil {
+		return nil, err
+	}
+
+	return append(leftRet, rightRet...), nil
+}
+
+// SplitFunctionLogMessage fits a message within the Log API limits. An overlong message is split
+// into parts, each with its part number, and what is beyond maxLogMessageParts is dropped. Overlong
+// string attributes are truncated. Records whose content was cut are marked as truncated, and the
+// second return value reports whether anything was dropped.
+func SplitFunctionLogMessage(logMessage FunctionLogMessage) ([]FunctionLogMessage, bool) {
+	truncated := false
+	for k, v := range logMessage.Attributes {
+		if str, ok := v.(string); ok && len(str) > maxLogAttributeLen {
+			logMessage.Attributes[k] = truncateUTF8(str, maxLogAttributeLen)
+			truncated = true
+		}
+	}
+	if truncated {
+		logMessage.Attributes[logTruncatedAttribute] = true
+	}
+
+	if len(logMessage.Message) <= maxLogMessageLen {
+		return []FunctionLogMessage{logMessage}, truncated
+	}
+
+	var parts []FunctionLogMessage
+	remaining := logMessage.Message
+	for len(remaining) > 0 && len(parts) < maxLogMessageParts {
+		part := truncateUTF8(remaining, maxLogMessageLen)
+		remaining = remaining[len(part):]
+
+		attributes := make(map[string]interface{}, len(logMessage.Attributes)+2)
+		for k, v := range logMessage.Attributes {
+			attributes[k] = v
+		}
+		attributes[logMessagePartAttribute] = len(parts) + 1
+
+		parts = append(parts, FunctionLogMessage{
+			Message:    part,
+			Timestamp:  logMessage.Timestamp,
+			Attributes: attributes,
+		})
+	}
+
+	// The last part is cut short
+	if len(remaining) > 0 {
+		parts[len(parts)-1].Attributes[logTruncatedAttribute] = true
+		truncated = true
+	}
+	return parts, truncated
+}
+
+// truncateUTF8 shortens s to at most n bytes, without splitting a multi-byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 // BuildVortexRequest builds a Vortex HTTP request
 func BuildVortexRequest(ctx context.Context, url string, compressed *bytes.Buffer, userAgent string, licenseKey string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", url, compressed)
@@ -1,9 +1,14 @@
 package telemetry
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/newrelic/newrelic-lambda-extension/util"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,3 +26,80 @@ func TestSerialize_DetailedFunctionLog(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "{\"common\":{\"attributes\":{\"foo\":\"bar\"}},\"logs\":[{\"message\":\"message1\",\"timestamp\":1234,\"attributes\":{\"aws\":{\"lambda_request_id\":\"test1\"},\"faas.execution\":\"test1\",\"trace.id\":\"123456789\"}},{\"message\":\"message2\",\"timestamp\":1235,\"attributes\":{\"aws\":{\"lambda_request_id\":\"test2\"},\"faas.execution\":\"test2\",\"trace.id\":\"123456789\"}}]}", string(json_bytes))
 }
+
+func TestSplitFunctionLogMessage(t *testing.T) {
+	message := NewFunctionLogMessage(1234, "test1", "", "short")
+	parts, truncated := SplitFunctionLogMessage(message)
+	assert.Equal(t, []FunctionLogMessage{message}, parts)
+	assert.False(t, truncated)
+
+	message = NewFunctionLogMessage(1234, "test1", "", "short")
+	message.Attributes["long"] = strings.Repeat("é", maxLogAttributeLen)
+	parts, truncated = SplitFunctionLogMessage(message)
+	assert.True(t, truncated)
+	assert.Len(t, parts, 1)
+	assert.Equal(t, maxLogAttributeLen, len(parts[0].Attributes["long"].(string)))
+	assert.Equal(t, true, parts[0].Attributes[logTruncatedAttribute])
+
+	message = NewFunctionLogMessage(1234, "test1", "", strings.Repeat("a", 2*maxLogMessageLen+1))
+	parts, truncated = SplitFunctionLogMessage(message)
+	assert.False(t, truncated)
+	assert.Len(t, parts, 3)
+	assert.Equal(t, 3, parts[2].Attributes[logMessagePartAttribute])
+	assert.Equal(t, "a", parts[2].Message)
+	assert.Equal(t, "test1", parts[2].Attributes["faas.execution"])
+	// Nothing was cut, so no part is marked
+	for _, part := range parts {
+		assert.NotContains(t, part.Attributes, logTruncatedAttribute)
+	}
+
+	message = NewFunctionLogMessage(1234, "test1", "", strings.Repeat("a", (maxLogMessageParts+1)*maxLogMessageLen))
+	parts, truncated = SplitFunctionLogMessage(message)
+	assert.True(t, truncated)
+	assert.Len(t, parts, maxLogMessageParts)
+	assert.NotContains(t, parts[0].Attributes, logTruncatedAttribute)
+	assert.Equal(t, true, parts[maxLogMessageParts-1].Attributes[logTruncatedAttribute])
+
+	// Truncated attributes are in every part
+	message = NewFunctionLogMessage(1234, "test1", "", strings.Repeat("a", maxLogMessageLen+1))
+	message.Attributes["long"] = strings.Repeat("a", maxLogAttributeLen+1)
+	parts, truncated = SplitFunctionLogMessage(message)
+	assert.True(t, truncated)
+	assert.Len(t, parts, 2)
+	assert.Equal(t, true, parts[0].Attributes[logTruncatedAttribute])
+	assert.Equal(t, true, parts[1].Attributes[logTruncatedAttribute])
+}
+
+func TestCompressedPayloadsForFunctionLogs(t *testing.T) {
+	common := map[string]interface{}{"foo": "bar"}
+
+	payloads, err := CompressedPayloadsForFunctionLogs(common, []FunctionLogMessage{NewFunctionLogMessage(1234, "test1", "", "message1")})
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	// Random data doesn't compress, so this won't fit in one payload
+	var messages []FunctionLogMessage
+	random := make([]byte, 96*1024)
+	for i := 0; i < 24; i++ {
+		_, err = rand.Read(random)
+		assert.NoError(t, err)
+		messages = append(messages, NewFunctionLogMessage(1234, "test1", "", base64.StdEncoding.EncodeToString(random)))
+	}
+
+	payloads, err = CompressedPayloadsForFunctionLogs(common, messages)
+	assert.NoError(t, err)
+	assert.Greater(t, len(payloads), 1)
+
+	count := 0
+	for _, payload := range payloads {
+		assert.LessOrEqual(t, payload.Len(), maxCompressedPayloadLen)
+
+		body, err := util.Uncompress(payload.Bytes())
+		assert.NoError(t, err)
+		var logData []DetailedFunctionLog
+		assert.NoError(t, json.Unmarshal(body, &logData))
+		assert.Equal(t, "bar", logData[0].Common.Attributes["foo"])
+		count += len(logData[0].Logs)
+	}
+	assert.Equal(t, len(messages), count)
+}
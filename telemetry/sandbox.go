@@ -0,0 +1,49 @@
+package telemetry
+
+import (
+	"time"
+)
+
+// SandboxEventType is the type of the event sent when the sandbox shuts down
+const SandboxEventType = "AwsLambdaSandbox"
+
+// SandboxLifecycle is what happened in the sandbox, from when the extension started until it
+// shut down
+type SandboxLifecycle struct {
+	Start time.Time
+	End   time.Time
+	// InitType is on-demand, provisioned-concurrency or snap-start, when the platform says
+	InitType string
+	// ShutdownReason is spindown, timeout or failure, or empty when the extension didn't receive
+	// a shutdown event
+	ShutdownReason string
+	Invocations    int
+	// AcceptedBytesBeforeShutdown is the compressed size of the payloads New Relic accepted from
+	// the telemetry client, and SendFailures the payloads it didn't, until the sandbox shut down.
+	// Neither counts the final harvest, which is yet to be sent, nor the APM collector's payloads.
+	AcceptedBytesBeforeShutdown uint64
+	SendFailures                uint64
+	// DroppedLogs are the function log lines dropped by the extension and the platform
+	DroppedLogs uint64
+}
+
+// Event is the lifecycle as an AwsLambdaSandbox event, at the end of the sandbox
+func (s SandboxLifecycle) Event() CustomEvent {
+	event := CustomEvent{
+		"eventType":                   SandboxEventType,
+		"timestamp":                   s.End.UnixMilli(),
+		"sandboxStart":                s.Start.UnixMilli(),
+		"lifetimeMs":                  s.End.Sub(s.Start).Milliseconds(),
+		"invocations":                 s.Invocations,
+		"acceptedBytesBeforeShutdown": int64(s.AcceptedBytesBeforeShutdown),
+		"sendFailures":                int64(s.SendFailures),
+		"droppedLogs":                 int64(s.DroppedLogs),
+	}
+	if s.InitType != "" {
+		event["initType"] = s.InitType
+	}
+	if s.ShutdownReason != "" {
+		event["shutdownReason"] = s.ShutdownReason
+	}
+	return event
+}
@@ -0,0 +1,41 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSandboxLifecycleEvent(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	sandbox := SandboxLifecycle{
+		Start:                       start,
+		End:                         start.Add(90 * time.Second),
+		InitType:                    "on-demand",
+		ShutdownReason:              "spindown",
+		Invocations:                 12,
+		AcceptedBytesBeforeShutdown: 4096,
+		SendFailures:                1,
+		DroppedLogs:                 3,
+	}
+
+	assert.Equal(t, CustomEvent{
+		"eventType":                   SandboxEventType,
+		"timestamp":                   start.Add(90 * time.Second).UnixMilli(),
+		"sandboxStart":                start.UnixMilli(),
+		"lifetimeMs":                  int64(90000),
+		"initType":                    "on-demand",
+		"shutdownReason":              "spindown",
+		"invocations":                 12,
+		"acceptedBytesBeforeShutdown": int64(4096),
+		"sendFailures":                int64(1),
+		"droppedLogs":                 int64(3),
+	}, sandbox.Event())
+
+	sandbox.InitType = ""
+	sandbox.ShutdownReason = ""
+	event := sandbox.Event()
+	assert.NotContains(t, event, "initType")
+	assert.NotContains(t, event, "shutdownReason")
+}
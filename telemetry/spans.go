@@ -0,0 +1,295 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+	"github.com/newrelic/newrelic-lambda-extension/util"
+)
+
+const (
+	TraceEndpointEU string = "https://trace-api.eu.newrelic.com/trace/v1"
+	TraceEndpointUS string = "https://trace-api.newrelic.com/trace/v1"
+)
+
+// InvocationSpanName names the root span of an invocation, after the Telemetry API's invoke phase
+const InvocationSpanName = "invoke"
+
+// maxTrackedSpans is how many invocations' phases are remembered, until they're reported
+const maxTrackedSpans = 16
+
+// Span is a span in the Trace API's New Relic format. Its attributes include name and
+// duration.ms, and parent.id, unless it's a root span.
+type Span struct {
+	ID         string                 `json:"id"`
+	TraceID    string                 `json:"trace.id"`
+	Timestamp  int64                  `json:"timestamp"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Name is the span's name
+func (s Span) Name() string {
+	name, _ := s.Attributes["name"].(string)
+	return name
+}
+
+// ParentID is the ID of the span's parent, or empty for a root span
+func (s Span) ParentID() string {
+	parentId, _ := s.Attributes["parent.id"].(string)
+	return parentId
+}
+
+// Duration is the span's duration, in milliseconds
+func (s Span) Duration() float64 {
+	duration, _ := s.Attributes["duration.ms"].(float64)
+	return duration
+}
+
+type spanCommon struct {
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type spanData struct {
+	Common spanCommon `json:"common"`
+	Spans  []Span     `json:"spans"`
+}
+
+// invocationPhases are what's known of an invocation's phases
+type invocationPhases struct {
+	start    time.Time
+	phases   []logserver.PlatformSpan
+	reported bool
+}
+
+// PlatformSpanTracker turns the phase spans of the platform's records into spans of each
+// invocation: a root span, and a child span per phase. The sandbox's initialization is a phase
+// of its first invocation. An invocation's spans are built once it's reported, as the platform
+// sends its phases first.
+type PlatformSpanTracker struct {
+	lock        sync.Mutex
+	invocations map[string]*invocationPhases
+	requests    []string
+	initPhases  []logserver.PlatformSpan
+}
+
+// NewPlatformSpanTracker creates a PlatformSpanTracker
+func NewPlatformSpanTracker() *PlatformSpanTracker {
+	return &PlatformSpanTracker{invocations: make(map[string]*invocationPhases)}
+}
+
+// Invocation records when an invocation started
+func (t *PlatformSpanTracker) Invocation(requestId string, start time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.phasesOf(requestId).start = start
+}
+
+// AddPhases records the spans of platform records
+func (t *PlatformSpanTracker) AddPhases(records []logserver.PlatformSpans) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, record := range records {
+		if record.RequestID == "" {
+			t.initPhases = append(t.initPhases, record.Spans...)
+			continue
+		}
+		invocation := t.phasesOf(record.RequestID)
+		invocation.phases = append(invocation.phases, record.Spans...)
+	}
+}
+
+// Report records that the platform reported an invocation
+func (t *PlatformSpanTracker) Report(requestId string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.phasesOf(requestId).reported = true
+}
+
+// Spans returns the spans of the reported invocations that have phases, once each. Their trace
+// ID is the agent's, when traceID finds it, or a new one.
+func (t *PlatformSpanTracker) Spans(traceID func(requestId string) string) []Span {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var spans []Span
+	remaining := t.requests[:0]
+	for _, requestId := range t.requests {
+		invocation := t.invocations[requestId]
+		if !invocation.reported {
+			remaining = append(remaining, requestId)
+			continue
+		}
+		delete(t.invocations, requestId)
+
+		phases := invocation.phases
+		if len(t.initPhases) > 0 {
+			phases = append(t.initPhases, phases...)
+			t.initPhases = nil
+		}
+		if len(phases) > 0 {
+			spans = append(spans, invocationSpans(requestId, traceID(requestId), invocation.start, phases)...)
+		}
+	}
+	t.requests = remaining
+	return spans
+}
+
+// phasesOf finds the phases of a request, forgetting the oldest request when there are too
+// many. The caller must hold the lock.
+func (t *PlatformSpanTracker) phasesOf(requestId string) *invocationPhases {
+	if invocation, ok := t.invocations[requestId]; ok {
+		return invocation
+	}
+
+	if len(t.requests) == maxTrackedSpans {
+		delete(t.invocations, t.requests[0])
+		t.requests = t.requests[1:]
+	}
+	invocation := &invocationPhases{}
+	t.invocations[requestId] = invocation
+	t.requests = append(t.requests, requestId)
+	return invocation
+}
+
+// invocationSpans builds the root span of an invocation, covering its start and its phases, and
+// a child span for each phase
+func invocationSpans(requestId string, traceId string, start time.Time, phases []logserver.PlatformSpan) []Span {
+	if traceId == "" {
+		traceId = newID(16)
+	}
+
+	var end time.Time
+	for _, phase := range phases {
+		if start.IsZero() || phase.Start.Before(start) {
+			start = phase.Start
+		}
+		if phaseEnd := phase.Start.Add(millis(phase.Duration)); phaseEnd.After(end) {
+			end = phaseEnd
+		}
+	}
+
+	root := Span{
+		ID:        newID(8),
+		TraceID:   traceId,
+		Timestamp: start.UnixMilli(),
+		Attributes: map[string]interface{}{
+			"name":          InvocationSpanName,
+			"duration.ms":   float64(max(end.Sub(start), 0)) / float64(time.Millisecond),
+			"aws.requestId": requestId,
+		},
+	}
+
+	spans := []Span{root}
+	for _, phase := range phases {
+		spans = append(spans, Span{
+			ID:        newID(8),
+			TraceID:   traceId,
+			Timestamp: phase.Start.UnixMilli(),
+			Attributes: map[string]interface{}{
+				"name":          phase.Name,
+				"duration.ms":   phase.Duration,
+				"parent.id":     root.ID,
+				"aws.requestId": requestId,
+			},
+		})
+	}
+	return spans
+}
+
+// millis converts milliseconds to a duration
+func millis(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// newID creates a random identifier of n bytes, as a hex string
+func newID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SetTraceEndpoint configures where spans are sent
+func (c *Client) SetTraceEndpoint(traceEndpointOverride string) {
+	c.traceEndpoint = getTraceEndpointURL(c.licenseKey, traceEndpointOverride)
+}
+
+// getTraceEndpointURL returns the Trace API endpoint for the provided license key
+func getTraceEndpointURL(licenseKey string, traceEndpointOverride string) string {
+	if traceEndpointOverride != "" {
+		return traceEndpointOverride
+	}
+
+	if strings.HasPrefix(licenseKey, "eu") {
+		return TraceEndpointEU
+	}
+
+	return TraceEndpointUS
+}
+
+// SendSpans sends spans to the Trace API
+func (c *Client) SendSpans(ctx context.Context, invokedFunctionARN string, spans []Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	traceEndpoint := c.traceEndpoint
+	if traceEndpoint == "" {
+		traceEndpoint = getTraceEndpointURL(c.licenseKey, "")
+	}
+
+	start := time.Now()
+	common := c.customDataAttributes(invokedFunctionARN)
+	common["service.name"] = c.functionName
+
+	compressedPayloads, err := compressedPayloadsForItems(len(spans), func(lo, hi int) interface{} {
+		// The Trace API expects an array
+		return []spanData{{Common: spanCommon{Attributes: common}, Spans: spans[lo:hi]}}
+	})
+	if err != nil {
+		return err
+	}
+
+	var builder requestBuilder = func(buffer *bytes.Buffer) (*http.Request, error) {
+		return buildTraceRequest(ctx, traceEndpoint, buffer, c.licenseKey)
+	}
+
+	successCount, sentBytes := c.sendPayloads(compressedPayloads, builder)
+	logger.Logf(
+		"Sent %d/%d New Relic span batches with %d spans successfully in %.3fms (%.1fkB).\n",
+		successCount,
+		len(compressedPayloads),
+		len(spans),
+		float64(time.Since(start).Microseconds())/1000.0,
+		float64(sentBytes)/1024.0,
+	)
+
+	return nil
+}
+
+// buildTraceRequest builds a Trace API request, of spans in the New Relic format
+func buildTraceRequest(ctx context.Context, url string, compressed *bytes.Buffer, licenseKey string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Add("Content-Encoding", "gzip")
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("User-Agent", util.Name)
+	req.Header.Add("Api-Key", licenseKey)
+	req.Header.Add("Data-Format", "newrelic")
+	req.Header.Add("Data-Format-Version", "1")
+
+	return req, nil
+}
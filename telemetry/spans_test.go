@@ -0,0 +1,136 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+func noTraceID(string) string {
+	return ""
+}
+
+func TestPlatformSpanTracker(t *testing.T) {
+	tracker := NewPlatformSpanTracker()
+
+	initStart := time.Unix(1700000000, 0)
+	invocationStart := initStart.Add(300 * time.Millisecond)
+	tracker.AddPhases([]logserver.PlatformSpans{
+		{Spans: []logserver.PlatformSpan{{Name: logserver.InitSpanName, Start: initStart, Duration: 250}}},
+	})
+	tracker.Invocation("request-1", invocationStart)
+	tracker.AddPhases([]logserver.PlatformSpans{
+		{
+			RequestID: "request-1",
+			Spans: []logserver.PlatformSpan{
+				{Name: "responseLatency", Start: invocationStart.Add(10 * time.Millisecond), Duration: 40},
+				{Name: "responseDuration", Start: invocationStart.Add(50 * time.Millisecond), Duration: 5},
+			},
+		},
+	})
+
+	// Not reported yet
+	assert.Empty(t, tracker.Spans(noTraceID))
+
+	tracker.Report("request-1")
+	spans := tracker.Spans(func(requestId string) string {
+		assert.Equal(t, "request-1", requestId)
+		return "agent-trace"
+	})
+	assert.Len(t, spans, 4)
+
+	root := spans[0]
+	assert.Equal(t, InvocationSpanName, root.Name())
+	assert.Empty(t, root.ParentID())
+	assert.Len(t, root.ID, 16)
+	assert.Equal(t, "agent-trace", root.TraceID)
+	// The initialization is part of the first invocation
+	assert.Equal(t, initStart.UnixMilli(), root.Timestamp)
+	assert.InDelta(t, 355.0, root.Duration(), 0.001)
+	assert.Equal(t, "request-1", root.Attributes["aws.requestId"])
+
+	assert.Equal(t, []string{logserver.InitSpanName, "responseLatency", "responseDuration"}, []string{spans[1].Name(), spans[2].Name(), spans[3].Name()})
+	for _, child := range spans[1:] {
+		assert.Equal(t, root.ID, child.ParentID())
+		assert.Equal(t, "agent-trace", child.TraceID)
+		assert.NotEqual(t, root.ID, child.ID)
+	}
+	assert.Equal(t, 40.0, spans[2].Duration())
+	assert.Equal(t, invocationStart.Add(10*time.Millisecond).UnixMilli(), spans[2].Timestamp)
+
+	// Spans are returned once
+	assert.Empty(t, tracker.Spans(noTraceID))
+}
+
+func TestPlatformSpanTrackerWithoutPhases(t *testing.T) {
+	tracker := NewPlatformSpanTracker()
+
+	// The older schema has no spans
+	tracker.Invocation("request-1", time.Now())
+	tracker.Report("request-1")
+	assert.Empty(t, tracker.Spans(noTraceID))
+	assert.Empty(t, tracker.invocations)
+
+	// Without the agent's trace ID, the spans have their own
+	start := time.Unix(1700000000, 0)
+	tracker.AddPhases([]logserver.PlatformSpans{
+		{RequestID: "request-2", Spans: []logserver.PlatformSpan{{Name: "responseLatency", Start: start, Duration: 1}}},
+	})
+	tracker.Report("request-2")
+	spans := tracker.Spans(noTraceID)
+	assert.Len(t, spans, 2)
+	assert.Len(t, spans[0].TraceID, 32)
+	assert.Equal(t, spans[0].TraceID, spans[1].TraceID)
+	assert.Equal(t, start.UnixMilli(), spans[0].Timestamp)
+}
+
+func TestPlatformSpanTrackerLimit(t *testing.T) {
+	tracker := NewPlatformSpanTracker()
+
+	for i := 0; i < maxTrackedSpans+1; i++ {
+		tracker.Invocation(fmt.Sprintf("request-%d", i), time.Now())
+	}
+	assert.Len(t, tracker.invocations, maxTrackedSpans)
+	assert.NotContains(t, tracker.invocations, "request-0")
+	assert.Equal(t, "request-1", tracker.requests[0])
+}
+
+func TestSendSpans(t *testing.T) {
+	var received []spanData
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "a mock license key", r.Header.Get("Api-Key"))
+		assert.Equal(t, "newrelic", r.Header.Get("Data-Format"))
+		assert.Equal(t, "1", r.Header.Get("Data-Format-Version"))
+		assert.NoError(t, json.Unmarshal(uncompressedRequestBody(t, r), &received))
+
+		w.WriteHeader(202)
+	}))
+	defer srv.Close()
+
+	client := NewWithHTTPClient(srv.Client(), "my-function", "a mock license key", srv.URL, srv.URL, &Batch{}, false, clientTestingTimeout)
+	client.SetTraceEndpoint(srv.URL)
+
+	spans := []Span{{ID: "0000000000000001", TraceID: "trace", Timestamp: 1700000000000, Attributes: map[string]interface{}{"name": InvocationSpanName}}}
+	assert.NoError(t, client.SendSpans(context.Background(), testARN, spans))
+	assert.Len(t, received, 1)
+	assert.Equal(t, "my-function", received[0].Common.Attributes["service.name"])
+	assert.Equal(t, testARN, received[0].Common.Attributes["faas.arn"])
+	assert.Equal(t, spans, received[0].Spans)
+
+	assert.NoError(t, client.SendSpans(context.Background(), testARN, nil))
+}
+
+func TestGetTraceEndpointURL(t *testing.T) {
+	assert.Equal(t, TraceEndpointUS, getTraceEndpointURL("us license key", ""))
+	assert.Equal(t, TraceEndpointEU, getTraceEndpointURL("eu license key", ""))
+	assert.Equal(t, "endpoint", getTraceEndpointURL("us license key", "endpoint"))
+}
@@ -0,0 +1,122 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+// WriterExporter writes data as JSON lines, one per record, for local debugging
+type WriterExporter struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+// exportRecord is a line written by the WriterExporter
+type exportRecord struct {
+	Type      string      `json:"type"`
+	FaaSARN   string      `json:"faas.arn,omitempty"`
+	RequestId string      `json:"requestId,omitempty"`
+	Timestamp int64       `json:"timestamp,omitempty"`
+	Data      interface{} `json:"data"`
+}
+
+// NewWriterExporter creates an exporter that writes to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{writer: w}
+}
+
+func (e *WriterExporter) ExportAgentPayloads(ctx context.Context, invokedFunctionARN string, harvested []*Invocation) error {
+	var records []exportRecord
+	for _, inv := range harvested {
+		for _, payload := range inv.AgentTelemetry() {
+			records = append(records, exportRecord{Type: "agentPayload", RequestId: inv.RequestId, Data: string(payload)})
+		}
+		for _, platformLog := range inv.PlatformTelemetry() {
+			records = append(records, exportRecord{Type: "platform", RequestId: inv.RequestId, Data: string(platformLog)})
+		}
+		for _, platformError := range inv.Errors {
+			records = append(records, exportRecord{Type: "error", RequestId: inv.RequestId, Timestamp: platformError.Time.UnixMilli(), Data: platformError})
+		}
+	}
+
+	return e.write(invokedFunctionARN, records)
+}
+
+func (e *WriterExporter) ExportLogs(ctx context.Context, invokedFunctionARN string, lines []logserver.LogLine) error {
+	records := make([]exportRecord, 0, len(lines))
+	for _, l := range lines {
+		records = append(records, exportRecord{
+			Type:      "log",
+			RequestId: l.RequestID,
+			Timestamp: l.Time.UnixMilli(),
+			Data: map[string]interface{}{
+				"message":    string(l.Content),
+				"attributes": l.Attributes,
+			},
+		})
+	}
+
+	return e.write(invokedFunctionARN, records)
+}
+
+func (e *WriterExporter) ExportMetrics(ctx context.Context, invokedFunctionARN string, metrics []Metric) error {
+	records := make([]exportRecord, 0, len(metrics))
+	for _, metric := range metrics {
+		records = append(records, exportRecord{Type: "metric", Timestamp: metric.Timestamp, Data: metric})
+	}
+
+	return e.write(invokedFunctionARN, records)
+}
+
+func (e *WriterExporter) ExportEvents(ctx context.Context, invokedFunctionARN string, events []CustomEvent) error {
+	records := make([]exportRecord, 0, len(events))
+	for _, event := range events {
+		records = append(records, exportRecord{Type: "event", Data: event})
+	}
+
+	return e.write(invokedFunctionARN, records)
+}
+
+func (e *WriterExporter) ExportSpans(ctx context.Context, invokedFunctionARN string, spans []Span) error {
+	records := make([]exportRecord, 0, len(spans))
+	for _, span := range spans {
+		requestId, _ := span.Attributes["aws.requestId"].(string)
+		records = append(records, exportRecord{Type: "span", RequestId: requestId, Timestamp: span.Timestamp, Data: span})
+	}
+
+	return e.write(invokedFunctionARN, records)
+}
+
+// write encodes records as JSON lines. Records are written together, so that lines from
+// concurrent exports don't interleave.
+func (e *WriterExporter) write(invokedFunctionARN string, records []exportRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	now := time.Now().UnixMilli()
+	var buf []byte
+	for _, record := range records {
+		record.FaaSARN = invokedFunctionARN
+		if record.Timestamp == 0 {
+			record.Timestamp = now
+		}
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	_, err := e.writer.Write(buf)
+	return err
+}
@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/newrelic-lambda-extension/lambda/logserver"
+)
+
+func decodeExportRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	buf.Reset()
+	return records
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := NewWriterExporter(&buf)
+	ctx := context.Background()
+
+	batch := NewBatch(1000, 10000, false)
+	batch.AddInvocation(testRequestId, time.Now())
+	batch.AddTelemetry(testRequestId, []byte("agent payload"), true)
+	batch.AddTelemetry(testRequestId, []byte("platform log"), false)
+	batch.AddError(testRequestId, PlatformError{RequestID: testRequestId, Time: time.Unix(1700000000, 0), Type: PlatformErrorTimeout})
+	assert.NoError(t, exporter.ExportAgentPayloads(ctx, testARN, batch.Close()))
+
+	records := decodeExportRecords(t, &buf)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "agentPayload", records[0]["type"])
+	assert.Equal(t, "agent payload", records[0]["data"])
+	assert.Equal(t, testARN, records[0]["faas.arn"])
+	assert.Equal(t, testRequestId, records[0]["requestId"])
+	assert.Equal(t, "platform", records[1]["type"])
+	assert.Equal(t, "error", records[2]["type"])
+	assert.Equal(t, float64(1700000000000), records[2]["timestamp"])
+
+	lines := []logserver.LogLine{{Time: time.Unix(1700000000, 0), RequestID: testRequestId, Content: []byte("hello")}}
+	assert.NoError(t, exporter.ExportLogs(ctx, testARN, lines))
+	records = decodeExportRecords(t, &buf)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "log", records[0]["type"])
+	assert.Equal(t, "hello", records[0]["data"].(map[string]interface{})["message"])
+
+	assert.NoError(t, exporter.ExportMetrics(ctx, testARN, []Metric{{Name: "orders", Type: "count", Value: 1, Timestamp: 1700000000000}}))
+	assert.NoError(t, exporter.ExportEvents(ctx, testARN, []CustomEvent{{"eventType": "Purchase"}}))
+	records = decodeExportRecords(t, &buf)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "metric", records[0]["type"])
+	assert.Equal(t, "event", records[1]["type"])
+	assert.NotZero(t, records[1]["timestamp"])
+
+	spans := []Span{{ID: "0000000000000001", TraceID: "trace", Timestamp: 1700000000000, Attributes: map[string]interface{}{"name": InvocationSpanName, "aws.requestId": testRequestId}}}
+	assert.NoError(t, exporter.ExportSpans(ctx, testARN, spans))
+	records = decodeExportRecords(t, &buf)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "span", records[0]["type"])
+	assert.Equal(t, testRequestId, records[0]["requestId"])
+	assert.Equal(t, "trace", records[0]["data"].(map[string]interface{})["trace.id"])
+
+	assert.NoError(t, exporter.ExportEvents(ctx, testARN, nil))
+	assert.Zero(t, buf.Len())
+}
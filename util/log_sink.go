@@ -0,0 +1,56 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// LogEntry is a line written by the extension logger
+type LogEntry struct {
+	Time      time.Time
+	Level     string
+	Component string
+	Fields    Fields
+	Message   string
+}
+
+// LogSink receives the extension's warnings and errors, in addition to stdout. WriteLog is
+// called while logging, so it must not block, or log itself.
+type LogSink interface {
+	WriteLog(entry LogEntry)
+}
+
+var (
+	sinksLock sync.RWMutex
+	sinks     []LogSink
+)
+
+// AddLogSink registers a sink. Entries are written to sinks even when stdout logging is disabled.
+func AddLogSink(sink LogSink) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+
+	sinks = append(sinks, sink)
+}
+
+// RemoveLogSinks unregisters all sinks
+func RemoveLogSinks() {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+
+	sinks = nil
+}
+
+// isSinkLevel is true for the levels written to sinks
+func isSinkLevel(level string) bool {
+	return level == LogLevelWarn || level == LogLevelError
+}
+
+func writeToSinks(entry LogEntry) {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+
+	for _, sink := range sinks {
+		sink.WriteLog(entry)
+	}
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSink struct {
+	entries []LogEntry
+}
+
+func (s *testSink) WriteLog(entry LogEntry) {
+	s.entries = append(s.entries, entry)
+}
+
+func TestLogSinks(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	warnings := &testSink{}
+	AddLogSink(warnings)
+	defer RemoveLogSinks()
+
+	// Sinks get entries even when stdout logging is disabled
+	ConfigLogger(false, "DEBUG")
+	Debugf("Debug %s", "message")
+	Logf("Info %s", "message")
+	Warnf("Warn %s\n", "message")
+	Errorln("Error message")
+
+	assert.Empty(t, buf.String())
+	assert.Len(t, warnings.entries, 2)
+	assert.Equal(t, LogLevelWarn, warnings.entries[0].Level)
+	assert.Equal(t, "Warn message", warnings.entries[0].Message)
+	assert.Equal(t, LogLevelError, warnings.entries[1].Level)
+	assert.False(t, warnings.entries[1].Time.IsZero())
+
+	NewComponentLogger("telemetry").WithRequestID("abc-123").Warnln("Warn message")
+	assert.Equal(t, "telemetry", warnings.entries[2].Component)
+	assert.Equal(t, "abc-123", warnings.entries[2].Fields["requestId"])
+
+	RemoveLogSinks()
+	Errorln("Error message")
+	assert.Len(t, warnings.entries, 3)
+}
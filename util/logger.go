@@ -1,28 +1,49 @@
 package util
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
     LogLevelInfo  = "INFO"
     LogLevelDebug = "DEBUG"
+    LogLevelWarn  = "WARN"
+    LogLevelError = "ERROR"
+
+    LogFormatText = "text"
+    LogFormatJSON = "json"
 )
 
+// levelRanks orders log levels, from the most verbose
+var levelRanks = map[string]int{
+    LogLevelDebug: 0,
+    LogLevelInfo:  1,
+    LogLevelWarn:  2,
+    LogLevelError: 3,
+}
+
 var logger = Logger{
     isEnabled:      true,
     isDebugEnabled: false,
     logLevel:       LogLevelInfo,
+    format:         LogFormatText,
 }
 
 type Logger struct {
     isEnabled      bool
     isDebugEnabled bool
     logLevel       string
+    format         string
 }
 
+// Fields are structured data added to a log line
+type Fields map[string]interface{}
+
 func ConfigLogger(logsEnabled bool, logLevel string) {
     // Go Logging config
     log.SetPrefix("")
@@ -33,56 +54,220 @@ func ConfigLogger(logsEnabled bool, logLevel string) {
     logger.isDebugEnabled = (logger.logLevel == LogLevelDebug)
 
     if logger.isEnabled {
-        log.Printf("[NR_EXT %s] New Relic Lambda Extension starting up\n", logger.logLevel)
+        logger.emit(logger.logLevel, "", nil, "New Relic Lambda Extension starting up")
     }
 }
 
-func (l Logger) Debugf(format string, v ...interface{}) {
-    if l.isEnabled && l.isDebugEnabled {
-        log.Printf("[NR_EXT %s] "+format, append([]interface{}{LogLevelDebug}, v...)...)
+// SetLogFormat selects text lines, with the [NR_EXT LEVEL] prefix, or JSON lines
+func SetLogFormat(format string) {
+    if strings.ToLower(format) == LogFormatJSON {
+        logger.format = LogFormatJSON
+    } else {
+        logger.format = LogFormatText
     }
 }
 
-func (l Logger) Debugln(v ...interface{}) {
-    if l.isEnabled && l.isDebugEnabled {
-        log.Printf("[NR_EXT %s] %s\n", LogLevelDebug, fmt.Sprint(v...))
+// enabledFor is true when lines at level are written to stdout
+func (l Logger) enabledFor(level string) bool {
+    if !l.isEnabled {
+        return false
     }
+    if level == LogLevelDebug {
+        return l.isDebugEnabled
+    }
+
+    threshold, ok := levelRanks[l.logLevel]
+    if !ok {
+        threshold = levelRanks[LogLevelInfo]
+    }
+    return levelRanks[level] >= threshold
 }
 
-func (l Logger) Logf(format string, v ...interface{}) {
-    if l.isEnabled {
-        log.Printf("[NR_EXT %s] "+format, append([]interface{}{LogLevelInfo}, v...)...)
+func (l Logger) logf(level string, component string, fields Fields, format string, v ...interface{}) {
+    if l.enabledFor(level) || isSinkLevel(level) {
+        l.write(level, component, fields, fmt.Sprintf(format, v...))
     }
 }
 
+func (l Logger) logln(level string, component string, fields Fields, v ...interface{}) {
+    if l.enabledFor(level) || isSinkLevel(level) {
+        l.write(level, component, fields, fmt.Sprint(v...))
+    }
+}
+
+func (l Logger) write(level string, component string, fields Fields, message string) {
+    message = strings.TrimSuffix(message, "\n")
+    if l.enabledFor(level) {
+        l.emit(level, component, fields, message)
+    }
+    if isSinkLevel(level) {
+        writeToSinks(LogEntry{Time: time.Now(), Level: level, Component: component, Fields: fields, Message: message})
+    }
+}
+
+// emit writes a line to stdout, in the configured format
+func (l Logger) emit(level string, component string, fields Fields, message string) {
+    if l.format == LogFormatJSON {
+        line := make(map[string]interface{}, len(fields)+4)
+        for k, v := range fields {
+            line[k] = v
+        }
+        line["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+        line["level"] = level
+        line["message"] = message
+        if component != "" {
+            line["component"] = component
+        }
+
+        encoded, err := json.Marshal(line)
+        if err == nil {
+            log.Println(string(encoded))
+            return
+        }
+    }
+
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "[NR_EXT %s] ", level)
+    if component != "" {
+        fmt.Fprintf(&sb, "%s: ", component)
+    }
+    sb.WriteString(message)
+    keys := make([]string, 0, len(fields))
+    for k := range fields {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        fmt.Fprintf(&sb, " %s=%v", k, fields[k])
+    }
+    log.Println(sb.String())
+}
+
+func (l Logger) Debugf(format string, v ...interface{}) {
+    l.logf(LogLevelDebug, "", nil, format, v...)
+}
+
+func (l Logger) Debugln(v ...interface{}) {
+    l.logln(LogLevelDebug, "", nil, v...)
+}
+
+func (l Logger) Logf(format string, v ...interface{}) {
+    l.logf(LogLevelInfo, "", nil, format, v...)
+}
+
 func (l Logger) Logln(v ...interface{}) {
-    if l.isEnabled {
-        log.Printf("[NR_EXT %s] %s\n", LogLevelInfo, fmt.Sprint(v...))
+    l.logln(LogLevelInfo, "", nil, v...)
+}
+
+// Warnf logs a problem the extension recovers from. Warnings are also written to log sinks.
+func (l Logger) Warnf(format string, v ...interface{}) {
+    l.logf(LogLevelWarn, "", nil, format, v...)
+}
+
+func (l Logger) Warnln(v ...interface{}) {
+    l.logln(LogLevelWarn, "", nil, v...)
+}
+
+// Errorf logs a failure, such as data that couldn't be sent. Errors are also written to log sinks.
+func (l Logger) Errorf(format string, v ...interface{}) {
+    l.logf(LogLevelError, "", nil, format, v...)
+}
+
+func (l Logger) Errorln(v ...interface{}) {
+    l.logln(LogLevelError, "", nil, v...)
+}
+
+// ComponentLogger logs for a part of the extension, with optional structured fields. It uses the
+// extension logger's configuration at the time of each call.
+type ComponentLogger struct {
+    component string
+    fields    Fields
+}
+
+// NewComponentLogger creates a logger for a component, such as logserver or telemetry
+func NewComponentLogger(component string) ComponentLogger {
+    return ComponentLogger{component: component}
+}
+
+// With returns a logger that adds fields to each line
+func (c ComponentLogger) With(fields Fields) ComponentLogger {
+    merged := make(Fields, len(c.fields)+len(fields))
+    for k, v := range c.fields {
+        merged[k] = v
+    }
+    for k, v := range fields {
+        merged[k] = v
     }
+    return ComponentLogger{component: c.component, fields: merged}
+}
+
+// WithRequestID returns a logger that adds the invocation's request ID to each line
+func (c ComponentLogger) WithRequestID(requestId string) ComponentLogger {
+    return c.With(Fields{"requestId": requestId})
+}
+
+func (c ComponentLogger) Debugf(format string, v ...interface{}) {
+    logger.logf(LogLevelDebug, c.component, c.fields, format, v...)
+}
+
+func (c ComponentLogger) Debugln(v ...interface{}) {
+    logger.logln(LogLevelDebug, c.component, c.fields, v...)
+}
+
+func (c ComponentLogger) Logf(format string, v ...interface{}) {
+    logger.logf(LogLevelInfo, c.component, c.fields, format, v...)
+}
+
+func (c ComponentLogger) Logln(v ...interface{}) {
+    logger.logln(LogLevelInfo, c.component, c.fields, v...)
+}
+
+func (c ComponentLogger) Warnf(format string, v ...interface{}) {
+    logger.logf(LogLevelWarn, c.component, c.fields, format, v...)
+}
+
+func (c ComponentLogger) Warnln(v ...interface{}) {
+    logger.logln(LogLevelWarn, c.component, c.fields, v...)
+}
+
+func (c ComponentLogger) Errorf(format string, v ...interface{}) {
+    logger.logf(LogLevelError, c.component, c.fields, format, v...)
+}
+
+func (c ComponentLogger) Errorln(v ...interface{}) {
+    logger.logln(LogLevelError, c.component, c.fields, v...)
 }
 
 func Debugf(format string, v ...interface{}) {
-    if logger.isEnabled && logger.isDebugEnabled {
-        log.Printf("[NR_EXT %s] "+format, append([]interface{}{LogLevelDebug}, v...)...)
-    }
+    logger.Debugf(format, v...)
 }
 
 func Debugln(v ...interface{}) {
-    if logger.isEnabled && logger.isDebugEnabled {
-        log.Printf("[NR_EXT %s] %s\n", LogLevelDebug, fmt.Sprint(v...))
-    }
+    logger.Debugln(v...)
 }
 
 func Logf(format string, v ...interface{}) {
-    if logger.isEnabled {
-        log.Printf("[NR_EXT %s] "+format, append([]interface{}{LogLevelInfo}, v...)...)
-    }
+    logger.Logf(format, v...)
 }
 
 func Logln(v ...interface{}) {
-    if logger.isEnabled {
-        log.Printf("[NR_EXT %s] %s\n", LogLevelInfo, fmt.Sprint(v...))
-    }
+    logger.Logln(v...)
+}
+
+func Warnf(format string, v ...interface{}) {
+    logger.Warnf(format, v...)
+}
+
+func Warnln(v ...interface{}) {
+    logger.Warnln(v...)
+}
+
+func Errorf(format string, v ...interface{}) {
+    logger.Errorf(format, v...)
+}
+
+func Errorln(v ...interface{}) {
+    logger.Errorln(v...)
 }
 
 func Fatal(v ...interface{}) {
@@ -2,10 +2,12 @@ package util
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -203,3 +205,99 @@ func TestLogLevelConstants(t *testing.T) {
     assert.Equal(t, "INFO", LogLevelInfo)
     assert.Equal(t, "DEBUG", LogLevelDebug)
 }
+
+func TestWarnAndError(t *testing.T) {
+    var buf bytes.Buffer
+    log.SetOutput(&buf)
+    defer log.SetOutput(os.Stderr)
+
+    ConfigLogger(true, "INFO")
+    buf.Reset()
+
+    Warnf("Warn %s\n", "message")
+    assert.Equal(t, "[NR_EXT WARN] Warn message\n", buf.String())
+    buf.Reset()
+
+    Errorln("Error", "message")
+    assert.Equal(t, "[NR_EXT ERROR] Errormessage\n", buf.String())
+    buf.Reset()
+
+    ConfigLogger(false, "INFO")
+    Warnln("Warn message")
+    Errorf("Error %s", "message")
+    assert.Empty(t, buf.String())
+}
+
+func TestLogLevelThreshold(t *testing.T) {
+    var buf bytes.Buffer
+    log.SetOutput(&buf)
+    defer log.SetOutput(os.Stderr)
+
+    ConfigLogger(true, "WARN")
+    buf.Reset()
+
+    Debugf("Debug message")
+    Logf("Info message")
+    assert.Empty(t, buf.String())
+
+    Warnln("Warn message")
+    assert.Contains(t, buf.String(), "[NR_EXT WARN] Warn message")
+    buf.Reset()
+
+    ConfigLogger(true, "ERROR")
+    buf.Reset()
+
+    Warnln("Warn message")
+    assert.Empty(t, buf.String())
+    Errorln("Error message")
+    assert.Contains(t, buf.String(), "[NR_EXT ERROR] Error message")
+}
+
+func TestComponentLogger(t *testing.T) {
+    var buf bytes.Buffer
+    log.SetOutput(&buf)
+    defer log.SetOutput(os.Stderr)
+
+    ConfigLogger(true, "DEBUG")
+    buf.Reset()
+
+    componentLogger := NewComponentLogger("telemetry").With(Fields{"payloads": 2}).WithRequestID("abc-123")
+    componentLogger.Logf("Sent %s\n", "telemetry")
+    assert.Equal(t, "[NR_EXT INFO] telemetry: Sent telemetry payloads=2 requestId=abc-123\n", buf.String())
+    buf.Reset()
+
+    componentLogger.Debugln("Debug", "line")
+    assert.Contains(t, buf.String(), "[NR_EXT DEBUG] telemetry: Debugline")
+
+    // Without fields
+    NewComponentLogger("apm").Warnf("Warning")
+    assert.Contains(t, buf.String(), "[NR_EXT WARN] apm: Warning\n")
+}
+
+func TestJSONFormat(t *testing.T) {
+    var buf bytes.Buffer
+    log.SetOutput(&buf)
+    defer log.SetOutput(os.Stderr)
+
+    SetLogFormat("JSON")
+    defer SetLogFormat(LogFormatText)
+    ConfigLogger(true, "INFO")
+
+    var line map[string]interface{}
+    assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+    assert.Equal(t, "New Relic Lambda Extension starting up", line["message"])
+    buf.Reset()
+
+    NewComponentLogger("logserver").WithRequestID("abc-123").Errorf("Failed: %s\n", "timeout")
+    assert.True(t, strings.HasSuffix(buf.String(), "}\n"))
+
+    line = nil
+    assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+    assert.Equal(t, "ERROR", line["level"])
+    assert.Equal(t, "Failed: timeout", line["message"])
+    assert.Equal(t, "logserver", line["component"])
+    assert.Equal(t, "abc-123", line["requestId"])
+    timestamp, err := time.Parse(time.RFC3339Nano, line["timestamp"].(string))
+    assert.NoError(t, err)
+    assert.WithinDuration(t, time.Now(), timestamp, time.Minute)
+}